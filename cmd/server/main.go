@@ -13,6 +13,8 @@ import (
 	"github.com/bcnelson/tailscale-acl-manager/internal/api"
 	"github.com/bcnelson/tailscale-acl-manager/internal/auth"
 	"github.com/bcnelson/tailscale-acl-manager/internal/config"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage/sql"
 	"github.com/bcnelson/tailscale-acl-manager/internal/tailscale"
@@ -49,6 +51,21 @@ func main() {
 	}
 	defer store.Close()
 
+	// Load guardrails from configuration, replacing those loaded before
+	n, err := guardrails.LoadFile(context.Background(), store, cfg.Sync.GuardrailsFile, time.Now())
+	if err != nil {
+		log.Fatalf("Failed to load guardrails: %v", err)
+	}
+	if cfg.Sync.GuardrailsFile != "" {
+		log.Printf("Loaded %d guardrails from %s", n, cfg.Sync.GuardrailsFile)
+	}
+
+	// Configure how stacks defining the same name are merged
+	strategies, err := merger.ParseStrategies(cfg.Sync.MergeStrategies)
+	if err != nil {
+		log.Fatalf("Invalid MERGE_STRATEGIES: %v", err)
+	}
+
 	// Initialize Tailscale client (or file shim for testing)
 	var tsClient tailscale.PolicyClient
 	if cfg.UseFileShim() {
@@ -69,6 +86,20 @@ func main() {
 		cfg.Sync.Debounce,
 		cfg.Sync.AutoSync,
 	)
+	syncService.SetDriftPolicy(cfg.Sync.DriftPolicy)
+	syncService.SetVersion(Version)
+	syncService.SetConflictsAsErrors(cfg.Sync.ConflictsAsErrors)
+	syncService.SetMergeStrategies(strategies)
+
+	// Start background drift detection
+	driftCtx, stopDriftChecker := context.WithCancel(context.Background())
+	defer stopDriftChecker()
+	syncService.StartDriftChecker(driftCtx, cfg.Sync.DriftCheckInterval)
+
+	// Start background removal of expired access
+	reaperCtx, stopExpiryReaper := context.WithCancel(context.Background())
+	defer stopExpiryReaper()
+	syncService.StartExpiryReaper(reaperCtx)
 
 	// Initialize OIDC if enabled
 	var oidcComponents *web.OIDCComponents
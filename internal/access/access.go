@@ -0,0 +1,362 @@
+// Package access implements just-in-time access requests: time-boxed group
+// membership or grants that the approvers of a stack hand out on request.
+package access
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Submit stores a new pending request on behalf of the actor in ctx. The
+// target group or grant must exist in the request's stack.
+func Submit(ctx context.Context, store storage.Storage, req *domain.CreateAccessRequestRequest, now time.Time) (*domain.AccessRequest, error) {
+	switch req.Type {
+	case domain.AccessRequestTypeGroup:
+		group, err := store.GetGroup(ctx, req.StackID, req.Target)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(group.Members, req.Member) && !hasExpiry(group, req.Member) {
+			return nil, fmt.Errorf("%w: %s is already a permanent member of %s", domain.ErrConflict, req.Member, req.Target)
+		}
+	case domain.AccessRequestTypeGrant:
+		grant, err := store.GetGrant(ctx, req.Target)
+		if err != nil {
+			return nil, err
+		}
+		if grant.StackID != req.StackID {
+			return nil, domain.ErrNotFound
+		}
+	default:
+		return nil, domain.ErrInvalidInput
+	}
+
+	actor := audit.ActorFromContext(ctx)
+	request := &domain.AccessRequest{
+		ID:          uuid.New().String(),
+		StackID:     req.StackID,
+		Type:        req.Type,
+		Target:      req.Target,
+		Member:      req.Member,
+		Reason:      req.Reason,
+		Duration:    req.Duration,
+		Status:      domain.AccessRequestPending,
+		RequestedBy: actor.Name,
+		RequesterID: actor.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceAccessRequest,
+		ResourceID:   request.ID,
+		StackID:      request.StackID,
+		After:        request,
+	}
+	err := audit.Run(ctx, store, change, func(tx storage.Transaction) error {
+		if err := tx.CreateAccessRequest(ctx, request); err != nil {
+			return err
+		}
+		return tx.CreateAccessRequestEvent(ctx, newEvent(request.ID, domain.AccessEventRequested, actor, "", now))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Approvers returns the identities that may decide req: the approvers of the
+// whole stack and, for group requests, those of the requested group.
+func Approvers(ctx context.Context, store storage.Storage, req *domain.AccessRequest) ([]string, error) {
+	approvers, err := store.ListAccessApprovers(ctx, req.StackID)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, a := range approvers {
+		if a.Group == "" || (req.Type == domain.AccessRequestTypeGroup && a.Group == req.Target) {
+			names = append(names, a.Approver)
+		}
+	}
+	return names, nil
+}
+
+// ResolveApprover returns the stable identity for approver: the ID of the API
+// key with that ID or name, or else approver itself, taken as an OIDC
+// subject. A name shared by several API keys is rejected, since it does not
+// say which of them decides.
+func ResolveApprover(ctx context.Context, store storage.Storage, approver string) (string, error) {
+	keys, err := store.ListAPIKeys(ctx)
+	if err != nil {
+		return "", err
+	}
+	var named []string
+	for _, key := range keys {
+		if key.ID == approver {
+			return key.ID, nil
+		}
+		if key.Name == approver {
+			named = append(named, key.ID)
+		}
+	}
+	switch len(named) {
+	case 0:
+		return approver, nil
+	case 1:
+		return named[0], nil
+	}
+	return "", fmt.Errorf("%w: %d API keys are named %q; name the approver by key ID", domain.ErrInvalidInput, len(named), approver)
+}
+
+// CanDecide reports whether actor may approve or deny req. Approvers are
+// matched by actor ID only, and nobody may decide their own request.
+func CanDecide(ctx context.Context, store storage.Storage, req *domain.AccessRequest, actor domain.AuditActor) (bool, error) {
+	if actor.ID == req.RequesterID {
+		return false, nil
+	}
+	approvers, err := Approvers(ctx, store, req)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(approvers, actor.ID), nil
+}
+
+// Approve records the approval of the request with the given ID by the actor
+// in ctx. Stacks that require approvals for their change sets need as many
+// distinct approvers for access requests; until then the request stays
+// pending. The last approval grants the access, which lasts for the requested
+// duration from now: group requests add the member with an expiry, and grant
+// requests create an expiring copy of the grant with the member as its only
+// source. Guardrails are checked on the policy merged with strategies. The
+// caller is responsible for triggering a sync.
+func Approve(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, id, comment string, now time.Time) (*domain.AccessRequest, error) {
+	return decide(ctx, store, strategies, id, comment, now, true)
+}
+
+// Deny rejects the request with the given ID on behalf of the actor in ctx.
+func Deny(ctx context.Context, store storage.Storage, id, comment string, now time.Time) (*domain.AccessRequest, error) {
+	return decide(ctx, store, nil, id, comment, now, false)
+}
+
+// decide records a decision on a pending request, applying approved access in
+// the same transaction.
+func decide(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, id, comment string, now time.Time, approve bool) (*domain.AccessRequest, error) {
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	req, err := tx.GetAccessRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != domain.AccessRequestPending {
+		return nil, fmt.Errorf("%w: access request is already %s", domain.ErrConflict, req.Status)
+	}
+
+	actor := audit.ActorFromContext(ctx)
+	ok, err := CanDecide(ctx, tx, req, actor)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrForbidden
+	}
+
+	before := audit.Snapshot(req)
+	decided := *req
+	decided.UpdatedAt = now
+	conclude := func(status string) {
+		decided.Status = status
+		decided.DecidedBy = actor.Name
+		decided.DecidedAt = &now
+	}
+
+	action, event := domain.AuditActionDeny, domain.AccessEventDenied
+	if !approve {
+		conclude(domain.AccessRequestDenied)
+	} else {
+		action, event = domain.AuditActionApprove, domain.AccessEventApproved
+		pending, err := awaitingApprovals(ctx, tx, req, actor)
+		if err != nil {
+			return nil, err
+		}
+		if !pending {
+			conclude(domain.AccessRequestApproved)
+			if err := guardrails.CheckWrite(ctx, tx, strategies, func(tx storage.Transaction) error {
+				return grantAccess(ctx, tx, &decided, now)
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.UpdateAccessRequest(ctx, &decided); err != nil {
+		return nil, err
+	}
+	if err := tx.CreateAccessRequestEvent(ctx, newEvent(decided.ID, event, actor, comment, now)); err != nil {
+		return nil, err
+	}
+	if err := audit.Record(ctx, tx, audit.Change{
+		Action:       action,
+		ResourceType: domain.AuditResourceAccessRequest,
+		ResourceID:   decided.ID,
+		StackID:      decided.StackID,
+		Before:       before,
+		After:        &decided,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &decided, nil
+}
+
+// awaitingApprovals reports whether req still needs approvals from other
+// approvers after actor's. Each approver counts once, and a stack needs as
+// many as it requires for its change sets.
+func awaitingApprovals(ctx context.Context, tx storage.Transaction, req *domain.AccessRequest, actor domain.AuditActor) (bool, error) {
+	stack, err := tx.GetStack(ctx, req.StackID)
+	if err != nil {
+		return false, err
+	}
+	events, err := tx.ListAccessRequestEvents(ctx, req.ID)
+	if err != nil {
+		return false, err
+	}
+	approvers := map[string]bool{actor.ID: true}
+	for _, e := range events {
+		if e.Action != domain.AccessEventApproved {
+			continue
+		}
+		if e.ActorID == actor.ID {
+			return false, fmt.Errorf("%w: %s has already approved this request", domain.ErrConflict, actor.Name)
+		}
+		approvers[e.ActorID] = true
+	}
+	return len(approvers) < stack.RequiredApprovals, nil
+}
+
+// grantAccess writes the access of an approved request, setting its expiry
+// and the ID of the group or grant that holds it.
+func grantAccess(ctx context.Context, tx storage.Transaction, req *domain.AccessRequest, now time.Time) error {
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		return fmt.Errorf("%w: invalid duration %q", domain.ErrInvalidInput, req.Duration)
+	}
+	expiresAt := now.Add(d)
+	req.ExpiresAt = &expiresAt
+
+	if _, err := tx.IncrementStackGeneration(ctx, req.StackID, nil); err != nil {
+		return err
+	}
+
+	switch req.Type {
+	case domain.AccessRequestTypeGroup:
+		group, err := tx.GetGroup(ctx, req.StackID, req.Target)
+		if err != nil {
+			return err
+		}
+		before := audit.Snapshot(group)
+		if !slices.Contains(group.Members, req.Member) {
+			group.Members = append(group.Members, req.Member)
+		} else if !hasExpiry(group, req.Member) {
+			// Already a permanent member; there is nothing to grant
+			req.ExpiresAt = nil
+			req.ResourceID = group.ID
+			return nil
+		} else if group.MemberExpiresAt[req.Member].After(expiresAt) {
+			expiresAt = group.MemberExpiresAt[req.Member]
+		}
+		if group.MemberExpiresAt == nil {
+			group.MemberExpiresAt = make(map[string]time.Time)
+		}
+		group.MemberExpiresAt[req.Member] = expiresAt
+		group.UpdatedAt = now
+		if err := tx.UpdateGroup(ctx, group); err != nil {
+			return err
+		}
+		req.ResourceID = group.ID
+		return audit.Record(ctx, tx, audit.Change{
+			Action:       domain.AuditActionUpdate,
+			ResourceType: domain.AuditResourceGroup,
+			ResourceID:   group.ID,
+			StackID:      group.StackID,
+			Before:       before,
+			After:        group,
+		})
+	case domain.AccessRequestTypeGrant:
+		source, err := tx.GetGrant(ctx, req.Target)
+		if err != nil {
+			return err
+		}
+		grant := &domain.Grant{
+			ID:           uuid.New().String(),
+			StackID:      source.StackID,
+			Order:        source.Order,
+			Sources:      []string{req.Member},
+			Destinations: source.Destinations,
+			IP:           source.IP,
+			SrcPosture:   source.SrcPosture,
+			App:          source.App,
+			Description:  fmt.Sprintf("Access request %s: %s", req.ID, req.Reason),
+			ExpiresAt:    &expiresAt,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := tx.CreateGrant(ctx, grant); err != nil {
+			return err
+		}
+		req.ResourceID = grant.ID
+		return audit.Record(ctx, tx, audit.Change{
+			Action:       domain.AuditActionCreate,
+			ResourceType: domain.AuditResourceGrant,
+			ResourceID:   grant.ID,
+			StackID:      grant.StackID,
+			After:        grant,
+		})
+	}
+	return domain.ErrInvalidInput
+}
+
+// History returns req with its history attached.
+func History(ctx context.Context, store storage.Storage, req *domain.AccessRequest) (*domain.AccessRequest, error) {
+	events, err := store.ListAccessRequestEvents(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	withHistory := *req
+	withHistory.History = events
+	return &withHistory, nil
+}
+
+// hasExpiry reports whether member of group is set to expire.
+func hasExpiry(group *domain.Group, member string) bool {
+	_, ok := group.MemberExpiresAt[member]
+	return ok
+}
+
+func newEvent(requestID, action string, actor domain.AuditActor, comment string, now time.Time) *domain.AccessRequestEvent {
+	return &domain.AccessRequestEvent{
+		ID:        uuid.New().String(),
+		RequestID: requestID,
+		Action:    action,
+		ActorType: actor.Type,
+		ActorID:   actor.ID,
+		ActorName: actor.Name,
+		Comment:   comment,
+		CreatedAt: now,
+	}
+}
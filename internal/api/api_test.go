@@ -2,17 +2,29 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/api"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage/memory"
+	"github.com/bcnelson/tailscale-acl-manager/internal/tailscale"
 )
 
 // testServer creates a test server with in-memory storage
@@ -55,6 +67,11 @@ func newTestServer() *testServer {
 }
 
 func (ts *testServer) request(method, path string, body any, apiKey string) *httptest.ResponseRecorder {
+	return ts.requestIfMatch(method, path, body, apiKey, "")
+}
+
+// requestIfMatch is like request but also sends an If-Match header, if set.
+func (ts *testServer) requestIfMatch(method, path string, body any, apiKey, ifMatch string) *httptest.ResponseRecorder {
 	var reqBody io.Reader
 	if body != nil {
 		jsonBytes, _ := json.Marshal(body)
@@ -66,6 +83,20 @@ func (ts *testServer) request(method, path string, body any, apiKey string) *htt
 	if apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+apiKey)
 	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	rr := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// webRequest submits form to the web UI with an API key session.
+func (ts *testServer) webRequest(method, path string, form url.Values, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "acl_session", Value: apiKey})
 
 	rr := httptest.NewRecorder()
 	ts.handler.ServeHTTP(rr, req)
@@ -167,6 +198,267 @@ func TestAPIKeyLifecycle(t *testing.T) {
 	}
 }
 
+func TestScopedAPIKeys(t *testing.T) {
+	ts := newTestServer()
+
+	// Create two stacks and an admin key using bootstrap key
+	var stacks []domain.Stack
+	for _, name := range []string{"team-a", "team-b"} {
+		rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: name}, ts.bootstrapKey)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		stack, err := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal mutation response: %v", err)
+		}
+		stacks = append(stacks, stack)
+	}
+
+	rr := ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{Name: "Admin"}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var admin domain.CreateAPIKeyResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &admin)
+	if len(admin.Roles) != len(domain.AllRoles) {
+		t.Errorf("Expected key without roles to get all roles, got %v", admin.Roles)
+	}
+
+	// Writer scoped to team-a
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{
+		Name:     "Team A",
+		Roles:    []string{domain.RoleReadOnly, domain.RoleStackWriter},
+		StackIDs: []string{stacks[0].ID},
+	}, admin.Key)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var writer domain.CreateAPIKeyResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &writer)
+
+	// Read-only key for all stacks
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{
+		Name:  "Viewer",
+		Roles: []string{domain.RoleReadOnly},
+	}, admin.Key)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var viewer domain.CreateAPIKeyResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &viewer)
+
+	group := domain.CreateGroupRequest{Name: "group:devs", Members: []string{"user@example.com"}}
+
+	// Scoped writer can modify its own stack only
+	rr = ts.request("POST", "/api/v1/stacks/"+stacks[0].ID+"/groups", group, writer.Key)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 on scoped stack, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/stacks/"+stacks[1].ID+"/groups", group, writer.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 on other stack, got %d", rr.Code)
+	}
+	rr = ts.request("GET", "/api/v1/stacks/"+stacks[1].ID+"/", nil, writer.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 reading other stack, got %d", rr.Code)
+	}
+
+	// ID-addressed resources of another stack are not reachable through the scoped stack
+	rr = ts.request("POST", "/api/v1/stacks/"+stacks[1].ID+"/acls", domain.CreateACLRuleRequest{
+		Action:       "accept",
+		Sources:      []string{"*"},
+		Destinations: []string{"*:*"},
+	}, admin.Key)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	otherRule, _ := unmarshalMutationData[domain.ACLRule](rr.Body.Bytes())
+	rr = ts.request("DELETE", "/api/v1/stacks/"+stacks[0].ID+"/acls/"+otherRule.ID, nil, writer.Key)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting another stack's ACL, got %d", rr.Code)
+	}
+
+	// Scoped keys only see their stacks
+	rr = ts.request("GET", "/api/v1/stacks", nil, writer.Key)
+	var listed []*domain.Stack
+	_ = json.Unmarshal(rr.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].ID != stacks[0].ID {
+		t.Errorf("Expected only stack team-a to be listed, got %d stacks", len(listed))
+	}
+
+	// Scoped keys cannot create stacks
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "team-c"}, writer.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 creating stack with scoped key, got %d", rr.Code)
+	}
+
+	// Read-only key can read but not write
+	rr = ts.request("GET", "/api/v1/stacks/"+stacks[1].ID+"/groups", nil, viewer.Key)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for read-only key, got %d", rr.Code)
+	}
+	rr = ts.request("POST", "/api/v1/stacks/"+stacks[1].ID+"/groups", group, viewer.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for read-only write, got %d", rr.Code)
+	}
+
+	// Policy and key management require their own roles
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, writer.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 syncing without policy-admin, got %d", rr.Code)
+	}
+	rr = ts.request("GET", "/api/v1/keys", nil, viewer.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 listing keys without key-admin, got %d", rr.Code)
+	}
+
+	// Keys cannot grant roles the caller lacks
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{
+		Name:  "Escalated",
+		Roles: []string{domain.RoleKeyAdmin, domain.RolePolicyAdmin},
+	}, admin.Key)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var keyAdmin domain.CreateAPIKeyResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &keyAdmin)
+
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{
+		Name:  "Writer",
+		Roles: []string{domain.RoleStackWriter},
+	}, keyAdmin.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 granting role the caller lacks, got %d", rr.Code)
+	}
+
+	// Scoped key admins only list and delete keys they could have created
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{
+		Name:     "Team A Admin",
+		Roles:    []string{domain.RoleReadOnly, domain.RoleStackWriter, domain.RoleKeyAdmin},
+		StackIDs: []string{stacks[0].ID},
+	}, admin.Key)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var scopedAdmin domain.CreateAPIKeyResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &scopedAdmin)
+
+	rr = ts.request("GET", "/api/v1/keys", nil, scopedAdmin.Key)
+	var keys []*domain.APIKey
+	_ = json.Unmarshal(rr.Body.Bytes(), &keys)
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Name)
+	}
+	if !slices.Equal(names, []string{"Team A", "Team A Admin"}) && !slices.Equal(names, []string{"Team A Admin", "Team A"}) {
+		t.Errorf("Expected scoped key admin to list only team-a keys, got %v", names)
+	}
+	rr = ts.request("DELETE", "/api/v1/keys/"+admin.ID, nil, scopedAdmin.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 deleting an unscoped key, got %d", rr.Code)
+	}
+	rr = ts.request("DELETE", "/api/v1/keys/"+writer.ID, nil, scopedAdmin.Key)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting a team-a key, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Invalid roles are rejected
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{
+		Name:  "Bad",
+		Roles: []string{"superuser"},
+	}, admin.Key)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid role, got %d", rr.Code)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "audited"}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:ops", Members: []string{"a@example.com"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("PUT", base+"/groups/name/group:ops", domain.UpdateGroupRequest{Members: []string{"b@example.com"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("DELETE", base+"/groups/name/group:ops", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rr.Code)
+	}
+	rr = ts.request("PUT", base+"/state", domain.StackState{
+		Hosts: []domain.CreateHostRequest{{Name: "web", Address: "100.64.0.1"}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/audit?stackId="+stack.ID, nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var entries []*domain.AuditEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Failed to unmarshal audit entries: %v", err)
+	}
+
+	// Newest first
+	wantActions := []string{
+		domain.AuditActionReplace,
+		domain.AuditActionDelete,
+		domain.AuditActionUpdate,
+		domain.AuditActionCreate,
+		domain.AuditActionCreate,
+	}
+	if len(entries) != len(wantActions) {
+		t.Fatalf("Expected %d audit entries, got %d", len(wantActions), len(entries))
+	}
+	for i, want := range wantActions {
+		if entries[i].Action != want {
+			t.Errorf("Entry %d: expected action %q, got %q", i, want, entries[i].Action)
+		}
+		if entries[i].ActorType != domain.AuditActorAPIKey || entries[i].ActorID != "bootstrap" {
+			t.Errorf("Entry %d: expected bootstrap API key actor, got %s/%s", i, entries[i].ActorType, entries[i].ActorID)
+		}
+	}
+
+	update := entries[2]
+	var before, after domain.Group
+	_ = json.Unmarshal(update.Before, &before)
+	_ = json.Unmarshal(update.After, &after)
+	if len(before.Members) != 1 || before.Members[0] != "a@example.com" {
+		t.Errorf("Expected before members [a@example.com], got %v", before.Members)
+	}
+	if len(after.Members) != 1 || after.Members[0] != "b@example.com" {
+		t.Errorf("Expected after members [b@example.com], got %v", after.Members)
+	}
+	if entries[1].After != nil {
+		t.Errorf("Expected no after state for delete, got %s", entries[1].After)
+	}
+
+	// Filters
+	rr = ts.request("GET", "/api/v1/audit?resourceType=group&action=update", nil, ts.bootstrapKey)
+	entries = nil
+	_ = json.Unmarshal(rr.Body.Bytes(), &entries)
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 filtered entry, got %d", len(entries))
+	}
+
+	rr = ts.request("GET", "/api/v1/audit?since=not-a-time", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid since, got %d", rr.Code)
+	}
+}
+
 func TestStackCRUD(t *testing.T) {
 	ts := newTestServer()
 
@@ -501,6 +793,268 @@ func TestPolicyPreview(t *testing.T) {
 	}
 }
 
+func TestPolicyDiff(t *testing.T) {
+	ts := newTestServer()
+	ctx := context.Background()
+
+	// Seed two versions directly; the test server has no Tailscale client to sync to
+	v1 := &domain.PolicyVersion{
+		ID:             "v1",
+		VersionNumber:  1,
+		RenderedPolicy: `{"groups":{"group:dev":["a@example.com"]},"hosts":{"db":"10.0.0.1"}}`,
+		PushStatus:     "success",
+		CreatedAt:      time.Now(),
+	}
+	v2 := &domain.PolicyVersion{
+		ID:             "v2",
+		VersionNumber:  2,
+		RenderedPolicy: `{"groups":{"group:dev":["a@example.com","b@example.com"]},"hosts":{"db":"10.0.0.2"},"acls":[{"action":"accept","src":["*"],"dst":["*:*"]}]}`,
+		PushStatus:     "success",
+		CreatedAt:      time.Now(),
+	}
+	_ = ts.store.CreatePolicyVersion(ctx, v1)
+	_ = ts.store.CreatePolicyVersion(ctx, v2)
+
+	rr := ts.request("GET", "/api/v1/policy/diff?from=v1&to=v2", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var diff domain.PolicyDiff
+	_ = json.Unmarshal(rr.Body.Bytes(), &diff)
+
+	if diff.From != "version:1" || diff.To != "version:2" || diff.Identical {
+		t.Errorf("Unexpected diff header: from=%q to=%q identical=%v", diff.From, diff.To, diff.Identical)
+	}
+	if len(diff.Groups) != 1 || diff.Groups[0].Change != domain.DiffChanged || len(diff.Groups[0].Added) != 1 {
+		t.Errorf("Expected group:dev to gain one member, got %+v", diff.Groups)
+	}
+	if len(diff.Hosts) != 1 || diff.Hosts[0].Before != "10.0.0.1" || diff.Hosts[0].After != "10.0.0.2" {
+		t.Errorf("Expected db host to be re-pointed, got %+v", diff.Hosts)
+	}
+	if len(diff.ACLs) != 1 || diff.ACLs[0].Change != domain.DiffAdded {
+		t.Errorf("Expected one added ACL, got %+v", diff.ACLs)
+	}
+
+	// Without to, the diff is against the current merged policy (empty here)
+	rr = ts.request("GET", "/api/v1/policy/diff?from=v2", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	diff = domain.PolicyDiff{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &diff)
+	if diff.To != "merged" || len(diff.ACLs) != 1 || diff.ACLs[0].Change != domain.DiffRemoved {
+		t.Errorf("Expected ACL removal against merged policy, got %+v", diff)
+	}
+
+	// Missing from
+	rr = ts.request("GET", "/api/v1/policy/diff", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+
+	// Unknown version
+	rr = ts.request("GET", "/api/v1/policy/diff?from=nope", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestDriftDetection(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	shim := tailscale.NewFileShim(filepath.Join(t.TempDir(), "policy.json"))
+	syncService := service.NewSyncService(store, shim, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "drift-stack"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	ts.request("POST", "/api/v1/stacks/"+stack.ID+"/groups", domain.CreateGroupRequest{
+		Name:    "group:devs",
+		Members: []string{"dev@example.com"},
+	}, ts.bootstrapKey)
+
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	var syncResp domain.SyncResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" {
+		t.Fatalf("Expected initial sync to succeed, got %s", rr.Body.String())
+	}
+
+	getDrift := func() domain.DriftStatus {
+		t.Helper()
+		rr := ts.request("GET", "/api/v1/policy/drift?refresh=true", nil, ts.bootstrapKey)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var status domain.DriftStatus
+		_ = json.Unmarshal(rr.Body.Bytes(), &status)
+		return status
+	}
+
+	if status := getDrift(); status.Drifted || status.CheckedAt == nil {
+		t.Fatalf("Expected no drift after sync, got %+v", status)
+	}
+
+	// Someone edits the policy outside the manager
+	_, _ = shim.SetPolicy(ctx, &domain.TailscalePolicy{
+		Groups: map[string][]string{"group:devs": {"dev@example.com", "intruder@example.com"}},
+	}, "")
+
+	status := getDrift()
+	if !status.Drifted || status.Event == nil {
+		t.Fatalf("Expected drift, got %+v", status)
+	}
+	if len(status.Event.Diff.Groups) != 1 || status.Event.Diff.Groups[0].Added[0] != "intruder@example.com" {
+		t.Errorf("Expected drift diff to show the added member, got %+v", status.Event.Diff.Groups)
+	}
+
+	// Repeated checks keep the same open event
+	if again := getDrift(); again.Event == nil || again.Event.ID != status.Event.ID {
+		t.Errorf("Expected the same open drift event, got %+v", again.Event)
+	}
+
+	// Refuse policy blocks the sync
+	syncService.SetDriftPolicy(domain.DriftPolicyRefuse)
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "failed" {
+		t.Fatalf("Expected sync to be refused, got %s", rr.Body.String())
+	}
+
+	// Explicit overwrite goes through and resolves the drift
+	rr = ts.request("POST", "/api/v1/policy/sync?overwriteDrift=true", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" {
+		t.Fatalf("Expected overwrite sync to succeed, got %s", rr.Body.String())
+	}
+	if status := getDrift(); status.Drifted {
+		t.Errorf("Expected drift to be resolved, got %+v", status)
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/drift/events", nil, ts.bootstrapKey)
+	var events []domain.DriftEvent
+	_ = json.Unmarshal(rr.Body.Bytes(), &events)
+	if len(events) != 1 || events[0].Resolution != domain.DriftResolutionOverwritten || events[0].ResolvedAt == nil {
+		t.Errorf("Expected one overwritten drift event, got %+v", events)
+	}
+
+	// Warn policy pushes and reports a warning
+	syncService.SetDriftPolicy(domain.DriftPolicyWarn)
+	_, _ = shim.SetPolicy(ctx, &domain.TailscalePolicy{}, "")
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" || len(syncResp.Warnings) != 1 {
+		t.Errorf("Expected successful sync with a drift warning, got %s", rr.Body.String())
+	}
+}
+
+func TestLocalPolicyTests(t *testing.T) {
+	store := memory.New()
+	shim := tailscale.NewFileShim(filepath.Join(t.TempDir(), "policy.json"))
+	syncService := service.NewSyncService(store, shim, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "test-stack"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.5"}, ts.bootstrapKey)
+	ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action:       "accept",
+		Sources:      []string{"group:dev"},
+		Destinations: []string{"db:5432"},
+	}, ts.bootstrapKey)
+	rr = ts.request("POST", base+"/tests", domain.CreateACLTestRequest{
+		Source: "alice@example.com",
+		Accept: []string{"db:5432"},
+		Deny:   []string{"db:22"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/tests", nil, ts.bootstrapKey)
+	var report domain.PolicyTestReport
+	_ = json.Unmarshal(rr.Body.Bytes(), &report)
+	if !report.Passed || len(report.Results) != 1 {
+		t.Fatalf("Expected passing report, got %s", rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	var syncResp domain.SyncResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" {
+		t.Fatalf("Expected sync to succeed, got %s", rr.Body.String())
+	}
+
+	// Tests that depend on autogroups the evaluator cannot resolve are
+	// skipped with a warning
+	ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Order:        1,
+		Action:       "accept",
+		Sources:      []string{"autogroup:admin"},
+		Destinations: []string{"db:443"},
+	}, ts.bootstrapKey)
+	ts.request("POST", base+"/tests", domain.CreateACLTestRequest{
+		Order:  2,
+		Source: "carol@example.com",
+		Accept: []string{"db:443"},
+	}, ts.bootstrapKey)
+
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" || len(syncResp.Warnings) != 1 || !strings.Contains(syncResp.Warnings[0], "autogroup:admin") {
+		t.Fatalf("Expected sync to succeed with a skipped test warning, got %s", rr.Body.String())
+	}
+	rr = ts.request("GET", "/api/v1/policy/tests", nil, ts.bootstrapKey)
+	report = domain.PolicyTestReport{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &report)
+	if !report.Passed || report.Skipped != 1 || !report.Results[1].Skipped {
+		t.Fatalf("Expected carol's test to be skipped, got %s", rr.Body.String())
+	}
+
+	// A test that expects access nobody grants fails the sync
+	ts.request("POST", base+"/tests", domain.CreateACLTestRequest{
+		Order:  1,
+		Source: "bob@example.com",
+		Accept: []string{"db:5432"},
+	}, ts.bootstrapKey)
+
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "failed" || len(syncResp.TestResults) != 3 {
+		t.Fatalf("Expected sync to fail with test results, got %s", rr.Body.String())
+	}
+	if syncResp.TestResults[1].Passed || syncResp.TestResults[1].Src != "bob@example.com" {
+		t.Errorf("Expected bob's test to fail, got %+v", syncResp.TestResults[1])
+	}
+
+	// The failed version was recorded and nothing was pushed
+	latest, _ := store.GetLatestPolicyVersion(context.Background())
+	if latest.PushStatus != "failed" {
+		t.Errorf("Expected latest version to be failed, got %s", latest.PushStatus)
+	}
+	live, _, _ := shim.GetPolicy(context.Background())
+	if len(live.Tests) != 2 {
+		t.Errorf("Expected live policy to keep 2 tests, got %d", len(live.Tests))
+	}
+}
+
 func TestSSHRuleCRUD(t *testing.T) {
 	ts := newTestServer()
 
@@ -536,6 +1090,65 @@ func TestSSHRuleCRUD(t *testing.T) {
 	}
 }
 
+func TestGrantSrcPosture(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	// Posture names need the posture: prefix
+	rr = ts.request("POST", base+"/grants", domain.CreateGrantRequest{
+		Sources: []string{"group:dev"}, Destinations: []string{"tag:prod"}, IP: []string{"*"}, SrcPosture: []string{"latestMac"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "srcPosture[0]") {
+		t.Fatalf("Expected a validation error for srcPosture[0], got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", base+"/grants", domain.CreateGrantRequest{
+		Sources: []string{"group:dev"}, Destinations: []string{"tag:prod"}, IP: []string{"*"}, SrcPosture: []string{"posture:latestMac"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	grant, _ := unmarshalMutationData[domain.Grant](rr.Body.Bytes())
+
+	// A posture no stack defines is reported
+	rr = ts.request("GET", "/api/v1/policy/lint", nil, ts.bootstrapKey)
+	var issues []domain.LintIssue
+	_ = json.Unmarshal(rr.Body.Bytes(), &issues)
+	if !slices.ContainsFunc(issues, func(issue domain.LintIssue) bool {
+		return issue.Check == domain.LintUndefinedPosture && issue.Reference == "posture:latestMac" && issue.Section == "grants"
+	}) {
+		t.Errorf("Expected an undefined posture issue, got %s", rr.Body.String())
+	}
+
+	ts.request("POST", base+"/postures", domain.CreatePostureRequest{Name: "posture:latestMac", Rules: []string{"node:os == 'macos'"}}, ts.bootstrapKey)
+	rr = ts.request("GET", "/api/v1/policy", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if len(policy.Grants) != 1 || !slices.Equal(policy.Grants[0].SrcPosture, []string{"posture:latestMac"}) {
+		t.Errorf("Expected the grant's srcPosture in the policy, got %+v", policy.Grants)
+	}
+	rr = ts.request("GET", base+"/state", nil, ts.bootstrapKey)
+	var state domain.StackState
+	_ = json.Unmarshal(rr.Body.Bytes(), &state)
+	if len(state.Grants) != 1 || !slices.Equal(state.Grants[0].SrcPosture, []string{"posture:latestMac"}) {
+		t.Errorf("Expected the grant's srcPosture in the stack state, got %s", rr.Body.String())
+	}
+
+	// Updates are validated too
+	rr = ts.request("PUT", base+"/grants/"+grant.ID, domain.UpdateGrantRequest{SrcPosture: []string{"posture:"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("PUT", base+"/grants/"+grant.ID, domain.UpdateGrantRequest{SrcPosture: []string{"posture:latestMac", "posture:managed"}}, ts.bootstrapKey)
+	updated, _ := unmarshalMutationData[domain.Grant](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || len(updated.SrcPosture) != 2 {
+		t.Errorf("Expected both postures, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestTagOwnerCRUD(t *testing.T) {
 	ts := newTestServer()
 
@@ -645,3 +1258,1754 @@ func TestInvalidRequests(t *testing.T) {
 		t.Errorf("Expected status 400 for missing src/dst, got %d", rr.Code)
 	}
 }
+
+func TestPolicyQuery(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra", Priority: 10}, ts.bootstrapKey)
+	infra, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "apps", Priority: 20}, ts.bootstrapKey)
+	apps, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	ts.request("POST", "/api/v1/stacks/"+infra.ID+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	ts.request("POST", "/api/v1/stacks/"+infra.ID+"/tags", domain.CreateTagOwnerRequest{Tag: "tag:server", Owners: []string{"group:dev"}}, ts.bootstrapKey)
+	ts.request("POST", "/api/v1/stacks/"+infra.ID+"/acls", domain.CreateACLRuleRequest{
+		Action:       "accept",
+		Sources:      []string{"group:dev"},
+		Destinations: []string{"tag:server:22"},
+	}, ts.bootstrapKey)
+	rr = ts.request("POST", "/api/v1/stacks/"+apps.ID+"/acls", domain.CreateACLRuleRequest{
+		Action:       "accept",
+		Sources:      []string{"group:dev"},
+		Destinations: []string{"tag:server:443"},
+	}, ts.bootstrapKey)
+	appsACL, _ := unmarshalMutationData[domain.ACLRule](rr.Body.Bytes())
+
+	rr = ts.request("GET", "/api/v1/policy/query?src=alice@example.com&dst=tag:server&port=443", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result domain.PolicyQueryResult
+	_ = json.Unmarshal(rr.Body.Bytes(), &result)
+	if !result.Allowed || result.Match == nil || result.Match.Index != 1 {
+		t.Fatalf("Expected access via ACL 1, got %s", rr.Body.String())
+	}
+	if result.Source == nil || result.Source.StackID != apps.ID || result.Source.ResourceID != appsACL.ID || result.StackName != "apps" {
+		t.Errorf("Expected rule to come from the apps stack, got %s", rr.Body.String())
+	}
+	if len(result.SrcMemberOf) == 0 || result.SrcMemberOf[0] != "group:dev" {
+		t.Errorf("Expected src to be a member of group:dev, got %v", result.SrcMemberOf)
+	}
+	if owners := result.TagOwners["tag:server"]; len(owners) != 1 || owners[0] != "alice@example.com" {
+		t.Errorf("Expected expanded tag owners, got %v", result.TagOwners)
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/query?src=bob@example.com&dst=tag:server&port=22", nil, ts.bootstrapKey)
+	result = domain.PolicyQueryResult{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &result)
+	if result.Allowed || result.Match != nil {
+		t.Errorf("Expected deny, got %s", rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/query?src=alice@example.com&port=70000", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for missing dst and bad port, got %d", rr.Code)
+	}
+}
+
+func TestPolicyExplain(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks/"+stack.ID+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	group, _ := unmarshalMutationData[domain.Group](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks/"+stack.ID+"/acls", domain.CreateACLRuleRequest{
+		Action:       "accept",
+		Sources:      []string{"group:dev"},
+		Destinations: []string{"tag:server:22"},
+	}, ts.bootstrapKey)
+	acl, _ := unmarshalMutationData[domain.ACLRule](rr.Body.Bytes())
+
+	rr = ts.request("GET", "/api/v1/policy?explain=true", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var explained domain.ExplainedPolicy
+	if err := json.Unmarshal(rr.Body.Bytes(), &explained); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if explained.Policy == nil || len(explained.Policy.ACLs) != 1 {
+		t.Fatalf("Expected policy with 1 ACL, got %s", rr.Body.String())
+	}
+	if len(explained.Provenance.ACLs) != 1 || explained.Provenance.ACLs[0].ResourceID != acl.ID {
+		t.Errorf("Expected ACL provenance for %s, got %+v", acl.ID, explained.Provenance.ACLs)
+	}
+	if got := explained.Provenance.Groups["group:dev"]["alice@example.com"]; len(got) != 1 || got[0].ResourceID != group.ID {
+		t.Errorf("Expected group member provenance for %s, got %+v", group.ID, got)
+	}
+
+	// Without explain the plain policy is returned
+	rr = ts.request("GET", "/api/v1/policy", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if len(policy.ACLs) != 1 {
+		t.Errorf("Expected plain policy, got %s", rr.Body.String())
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	store := memory.New()
+	shim := tailscale.NewFileShim(filepath.Join(t.TempDir(), "policy.json"))
+	syncService := service.NewSyncService(store, shim, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra", Priority: 10}, ts.bootstrapKey)
+	infra, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "apps", Priority: 20}, ts.bootstrapKey)
+	apps, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	ts.request("POST", "/api/v1/stacks/"+infra.ID+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.1"}, ts.bootstrapKey)
+	ts.request("POST", "/api/v1/stacks/"+apps.ID+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.2"}, ts.bootstrapKey)
+
+	rr = ts.request("GET", "/api/v1/policy/conflicts", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var conflicts []domain.MergeConflict
+	_ = json.Unmarshal(rr.Body.Bytes(), &conflicts)
+	if len(conflicts) != 1 || conflicts[0].Name != "db" || conflicts[0].Winner.StackID != infra.ID {
+		t.Fatalf("Expected db conflict won by infra, got %s", rr.Body.String())
+	}
+	if len(conflicts[0].Shadowed) != 1 || conflicts[0].Shadowed[0].StackID != apps.ID {
+		t.Errorf("Expected apps definition to be shadowed, got %+v", conflicts[0].Shadowed)
+	}
+
+	// By default conflicts are warnings
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	var syncResp domain.SyncResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" || len(syncResp.Warnings) != 1 || len(syncResp.Conflicts) != 1 {
+		t.Fatalf("Expected successful sync with a conflict warning, got %s", rr.Body.String())
+	}
+
+	// Optionally they fail the sync
+	syncService.SetConflictsAsErrors(true)
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "failed" || len(syncResp.Conflicts) != 1 {
+		t.Fatalf("Expected sync to fail on conflicts, got %s", rr.Body.String())
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	store := memory.New()
+	shim := tailscale.NewFileShim(filepath.Join(t.TempDir(), "policy.json"))
+	syncService := service.NewSyncService(store, shim, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra", Priority: 10}, ts.bootstrapKey)
+	infra, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "apps", Priority: 20}, ts.bootstrapKey)
+	apps, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	ts.request("POST", "/api/v1/stacks/"+infra.ID+"/groups", domain.CreateGroupRequest{Name: "group:admins", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	ts.request("POST", "/api/v1/stacks/"+apps.ID+"/groups", domain.CreateGroupRequest{Name: "group:admins", Members: []string{"bob@example.com"}}, ts.bootstrapKey)
+
+	// The highest-priority stack fully defines the group
+	strategies, err := merger.ParseStrategies("groups=priority-override")
+	if err != nil {
+		t.Fatalf("ParseStrategies failed: %v", err)
+	}
+	syncService.SetMergeStrategies(strategies)
+
+	rr = ts.request("GET", "/api/v1/policy?explain=true", nil, ts.bootstrapKey)
+	var explained domain.ExplainedPolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &explained)
+	if got := explained.Policy.Groups["group:admins"]; len(got) != 1 || got[0] != "alice@example.com" {
+		t.Errorf("Expected group:admins to be defined by infra only, got %v", got)
+	}
+	if explained.Provenance.Strategies["groups"] != domain.MergeStrategyPriorityOverride || explained.Provenance.Strategies["hosts"] != domain.MergeStrategyPriorityOverride {
+		t.Errorf("Expected the strategies in the explained preview, got %v", explained.Provenance.Strategies)
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/preview?format=hujson", nil, ts.bootstrapKey)
+	if !strings.Contains(rr.Body.String(), "// Merge strategies: groups=priority-override.") {
+		t.Errorf("Expected the HuJSON preview to name the strategy, got %s", rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	var syncResp domain.SyncResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" || len(syncResp.Conflicts) != 1 || syncResp.Conflicts[0].Type != domain.ConflictTypeGroup {
+		t.Fatalf("Expected successful sync with a group conflict warning, got %s", rr.Body.String())
+	}
+
+	// Differing definitions fail syncs
+	syncService.SetMergeStrategies(domain.MergeStrategies{"groups": domain.MergeStrategyErrorOnConflict})
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "failed" || len(syncResp.Conflicts) != 1 || !syncResp.Conflicts[0].Blocking() {
+		t.Fatalf("Expected sync to fail on the group conflict, got %s", rr.Body.String())
+	}
+
+	// Only members every stack agrees on
+	syncService.SetMergeStrategies(domain.MergeStrategies{"groups": domain.MergeStrategyIntersect})
+	rr = ts.request("GET", "/api/v1/policy", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if got, ok := policy.Groups["group:admins"]; !ok || len(got) != 0 {
+		t.Errorf("Expected group:admins to be empty, got %v", got)
+	}
+}
+
+func TestStackClaims(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	infra, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "apps"}, ts.bootstrapKey)
+	apps, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	rr = ts.request("POST", "/api/v1/stacks/"+infra.ID+"/claims", domain.CreateClaimRequest{Type: domain.ClaimTypeGroup, Name: "group:admins"}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	claim, _ := unmarshalMutationData[domain.Claim](rr.Body.Bytes())
+
+	// The same name cannot be claimed twice
+	rr = ts.request("POST", "/api/v1/stacks/"+apps.ID+"/claims", domain.CreateClaimRequest{Type: domain.ClaimTypeGroup, Name: "group:admins"}, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for duplicate claim, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Names another stack already defines cannot be claimed
+	ts.request("POST", "/api/v1/stacks/"+apps.ID+"/hosts", domain.CreateHostRequest{Name: "web", Address: "10.0.0.2"}, ts.bootstrapKey)
+	rr = ts.request("POST", "/api/v1/stacks/"+infra.ID+"/claims", domain.CreateClaimRequest{Type: domain.ClaimTypeHost, Name: "web"}, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for claim on a defined host, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Other stacks cannot create the claimed group
+	groupReq := domain.CreateGroupRequest{Name: "group:admins", Members: []string{"alice@example.com"}}
+	rr = ts.request("POST", "/api/v1/stacks/"+apps.ID+"/groups", groupReq, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var errResp domain.StandardErrorResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if errResp.Error.Code != domain.ErrCodeResourceConflict || errResp.Error.Details["stackId"] != infra.ID {
+		t.Errorf("Expected RESOURCE_CONFLICT naming the owner, got %s", rr.Body.String())
+	}
+
+	// Nor replace their state to include it; existing resources are kept
+	ts.request("POST", "/api/v1/stacks/"+apps.ID+"/groups", domain.CreateGroupRequest{Name: "group:apps", Members: []string{"bob@example.com"}}, ts.bootstrapKey)
+	state := domain.StackState{Groups: []domain.CreateGroupRequest{groupReq}}
+	rr = ts.request("PUT", "/api/v1/stacks/"+apps.ID+"/state", state, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 from state replace, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("GET", "/api/v1/stacks/"+apps.ID+"/groups/name/group:apps", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected rejected state replace to keep existing groups, got status %d", rr.Code)
+	}
+
+	// The owner can
+	rr = ts.request("POST", "/api/v1/stacks/"+infra.ID+"/groups", groupReq, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected owner create to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/stacks/"+infra.ID+"/claims", nil, ts.bootstrapKey)
+	var list []*domain.Claim
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != claim.ID {
+		t.Errorf("Expected 1 claim, got %s", rr.Body.String())
+	}
+
+	// Claims are scoped to their stack
+	rr = ts.request("DELETE", "/api/v1/stacks/"+apps.ID+"/claims/"+claim.ID, nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting another stack's claim, got %d", rr.Code)
+	}
+	rr = ts.request("DELETE", "/api/v1/stacks/"+infra.ID+"/claims/"+claim.ID, nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHuJSONPolicy(t *testing.T) {
+	store := memory.New()
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	shim := tailscale.NewFileShim(policyPath)
+	syncService := service.NewSyncService(store, shim, 5*time.Second, false)
+	syncService.SetVersion("v9.9.9")
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	aclReq := domain.CreateACLRuleRequest{
+		Action:       "accept",
+		Sources:      []string{"group:dev"},
+		Destinations: []string{"tag:server:22"},
+		Description:  "Developers can SSH to servers",
+	}
+	rr = ts.request("POST", "/api/v1/stacks/"+stack.ID+"/acls", aclReq, ts.bootstrapKey)
+	rule, _ := unmarshalMutationData[domain.ACLRule](rr.Body.Bytes())
+	if rule.Description != aclReq.Description {
+		t.Fatalf("Expected description to be stored, got %q", rule.Description)
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/preview?format=hujson", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/hujson" {
+		t.Fatalf("Expected HuJSON preview, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{"tailscale-acl-manager v9.9.9", "// Stack: infra", "// Developers can SSH to servers"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("Expected preview to contain %q, got:\n%s", want, rr.Body.String())
+		}
+	}
+
+	// Syncs push the commented document
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	var syncResp domain.SyncResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" {
+		t.Fatalf("Expected sync to succeed, got %s", rr.Body.String())
+	}
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		t.Fatalf("Reading pushed policy: %v", err)
+	}
+	if !strings.Contains(string(data), "// Developers can SSH to servers") {
+		t.Errorf("Expected pushed policy to keep comments, got:\n%s", data)
+	}
+
+	// Comments do not count as drift
+	rr = ts.request("GET", "/api/v1/policy/drift?refresh=true", nil, ts.bootstrapKey)
+	var status domain.DriftStatus
+	_ = json.Unmarshal(rr.Body.Bytes(), &status)
+	if rr.Code != http.StatusOK || status.Drifted || status.CheckedAt == nil {
+		t.Errorf("Expected no drift after pushing HuJSON, got %s", rr.Body.String())
+	}
+}
+
+func TestReplaceStateValidation(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.5"}, ts.bootstrapKey)
+
+	state := domain.StackState{
+		Groups: []domain.CreateGroupRequest{
+			{Name: "group:dev", Members: []string{"alice@example.com"}},
+			{Name: "group:dev", Members: []string{"bob@example.com"}},
+		},
+		ACLs: []domain.CreateACLRuleRequest{
+			{Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"tag:server:22"}},
+			{Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"tag:server:22", "db:99999"}},
+		},
+	}
+	rr = ts.request("PUT", base+"/state", state, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Errors []struct {
+					Field string `json:"field"`
+				} `json:"errors"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Error.Code != domain.ErrCodeValidationError {
+		t.Errorf("Expected VALIDATION_ERROR, got %s", rr.Body.String())
+	}
+	var fields []string
+	for _, e := range resp.Error.Details.Errors {
+		fields = append(fields, e.Field)
+	}
+	if strings.Join(fields, ",") != "groups[1].name,acls[1].dst[1]" {
+		t.Errorf("Expected errors for groups[1].name and acls[1].dst[1], got %v", fields)
+	}
+
+	// Nothing was deleted
+	rr = ts.request("GET", base+"/hosts/name/db", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected rejected state replace to keep existing hosts, got status %d", rr.Code)
+	}
+}
+
+// TestReplaceStateValidationParity checks that PUT /state and the
+// single-resource endpoints accept and reject the same entries.
+func TestReplaceStateValidationParity(t *testing.T) {
+	ts := newTestServer()
+
+	acl := func(action string, dst ...string) domain.CreateACLRuleRequest {
+		return domain.CreateACLRuleRequest{Action: action, Sources: []string{"autogroup:member"}, Destinations: dst}
+	}
+	ssh := func(action string) domain.CreateSSHRuleRequest {
+		return domain.CreateSSHRuleRequest{Action: action, Sources: []string{"autogroup:member"}, Destinations: []string{"autogroup:self"}, Users: []string{"autogroup:nonroot"}}
+	}
+	posture := func(name string) domain.CreatePostureRequest {
+		return domain.CreatePostureRequest{Name: name, Rules: []string{"node:os == 'macos'"}}
+	}
+	routes := func(match string) domain.CreateAutoApproverRequest {
+		return domain.CreateAutoApproverRequest{Type: "routes", Match: match, Approvers: []string{"tag:router"}}
+	}
+	grant := func(srcPosture string) domain.CreateGrantRequest {
+		return domain.CreateGrantRequest{Sources: []string{"autogroup:member"}, Destinations: []string{"*"}, IP: []string{"*"}, SrcPosture: []string{srcPosture}}
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   any
+		state  domain.StackState
+		wantOK bool
+	}{
+		{"acl accept", "/acls", acl("accept", "*:*"), domain.StackState{ACLs: []domain.CreateACLRuleRequest{acl("accept", "*:*")}}, true},
+		{"acl deny", "/acls", acl("deny", "*:*"), domain.StackState{ACLs: []domain.CreateACLRuleRequest{acl("deny", "*:*")}}, false},
+		{"acl without dst", "/acls", acl("accept"), domain.StackState{ACLs: []domain.CreateACLRuleRequest{acl("accept")}}, false},
+		{"ssh check", "/ssh", ssh("check"), domain.StackState{SSHRules: []domain.CreateSSHRuleRequest{ssh("check")}}, true},
+		{"ssh without action", "/ssh", ssh(""), domain.StackState{SSHRules: []domain.CreateSSHRuleRequest{ssh("")}}, false},
+		{"ssh unknown action", "/ssh", ssh("drop"), domain.StackState{SSHRules: []domain.CreateSSHRuleRequest{ssh("drop")}}, false},
+		{"posture", "/postures", posture("posture:latestMac"), domain.StackState{Postures: []domain.CreatePostureRequest{posture("posture:latestMac")}}, true},
+		{"posture without prefix", "/postures", posture("latestMac"), domain.StackState{Postures: []domain.CreatePostureRequest{posture("latestMac")}}, false},
+		{"routes", "/autoapprovers", routes("10.0.0.0/24"), domain.StackState{AutoApprovers: []domain.CreateAutoApproverRequest{routes("10.0.0.0/24")}}, true},
+		{"routes with invalid CIDR", "/autoapprovers", routes("10.0.0.0/33"), domain.StackState{AutoApprovers: []domain.CreateAutoApproverRequest{routes("10.0.0.0/33")}}, false},
+		{"grant srcPosture without prefix", "/grants", grant("latestMac"), domain.StackState{Grants: []domain.CreateGrantRequest{grant("latestMac")}}, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: fmt.Sprintf("parity-%d", i)}, ts.bootstrapKey)
+			stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+			base := "/api/v1/stacks/" + stack.ID
+
+			single := ts.request("POST", base+tt.path, tt.body, ts.bootstrapKey)
+			replace := ts.request("PUT", base+"/state", tt.state, ts.bootstrapKey)
+			for _, rr := range []*httptest.ResponseRecorder{single, replace} {
+				if ok := rr.Code < 300; ok != tt.wantOK {
+					t.Errorf("Expected ok=%v, got %d: %s", tt.wantOK, rr.Code, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceStatePlan(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:old", Members: []string{"old@example.com"}}, ts.bootstrapKey)
+	ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.5"}, ts.bootstrapKey)
+	ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{Order: 0, Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"db:5432"}}, ts.bootstrapKey)
+
+	state := domain.StackState{
+		Groups: []domain.CreateGroupRequest{
+			{Name: "group:dev", Members: []string{"alice@example.com", "bob@example.com"}},
+		},
+		Hosts: []domain.CreateHostRequest{
+			{Name: "db", Address: "10.0.0.5"},
+			{Name: "web", Address: "10.0.0.6"},
+		},
+		ACLs: []domain.CreateACLRuleRequest{
+			{Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"db:5432"}},
+		},
+	}
+	rr = ts.request("PUT", base+"/state?plan=true", state, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var plan domain.StatePlan
+	if err := json.Unmarshal(rr.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("Failed to decode plan: %v", err)
+	}
+
+	actions := make(map[string]string)
+	for _, c := range plan.Changes {
+		actions[c.Resource+"/"+c.Key] = c.Action
+	}
+	want := map[string]string{
+		"groups/group:dev": domain.PlanUpdate,
+		"groups/group:old": domain.PlanDelete,
+		"hosts/db":         domain.PlanUnchanged,
+		"hosts/web":        domain.PlanCreate,
+		"acls/0":           domain.PlanUnchanged,
+	}
+	for k, v := range want {
+		if actions[k] != v {
+			t.Errorf("Expected %s to be %q, got %q", k, v, actions[k])
+		}
+	}
+	if plan.Summary != (domain.PlanSummary{Create: 1, Update: 1, Delete: 1, Unchanged: 2}) {
+		t.Errorf("Unexpected summary %+v", plan.Summary)
+	}
+
+	if plan.Diff == nil || len(plan.Diff.Groups) != 2 || len(plan.Diff.Hosts) != 1 || len(plan.Diff.ACLs) != 0 {
+		t.Errorf("Expected merged diff to change two groups and one host, got %+v", plan.Diff)
+	}
+
+	// Nothing was written
+	rr = ts.request("GET", base+"/groups/name/group:old", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected plan to keep existing groups, got status %d", rr.Code)
+	}
+	rr = ts.request("GET", base+"/hosts/name/web", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected plan not to create hosts, got status %d", rr.Code)
+	}
+}
+
+func TestStackGeneration(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	rr = ts.request("GET", base, nil, ts.bootstrapKey)
+	initial := rr.Header().Get("ETag")
+	if initial != `"stack-`+stack.ID+`-0"` {
+		t.Fatalf("Expected generation 0 ETag, got %q", initial)
+	}
+
+	// Resource changes bump the generation
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	group, _ := unmarshalMutationData[domain.Group](rr.Body.Bytes())
+	rr = ts.request("GET", base, nil, ts.bootstrapKey)
+	current := rr.Header().Get("ETag")
+	var got domain.Stack
+	_ = json.Unmarshal(rr.Body.Bytes(), &got)
+	if got.Generation != 1 || current == initial {
+		t.Fatalf("Expected generation 1, got %d (ETag %q)", got.Generation, current)
+	}
+
+	// A stale generation is rejected with the current one
+	state := domain.StackState{Groups: []domain.CreateGroupRequest{{Name: "group:ops", Members: []string{"bob@example.com"}}}}
+	rr = ts.requestIfMatch("PUT", base+"/state", state, ts.bootstrapKey, initial)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status 412, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var errResp domain.StandardErrorResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if errResp.Error.Details["generation"] != float64(1) || rr.Header().Get("ETag") != current {
+		t.Errorf("Expected 412 to report generation 1, got %s", rr.Body.String())
+	}
+
+	// Stale stack ETags also guard resource mutations
+	rr = ts.requestIfMatch("DELETE", base+"/groups/"+group.ID, nil, ts.bootstrapKey, initial)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for stale delete, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The current generation is accepted
+	rr = ts.requestIfMatch("PUT", base+"/state", state, ts.bootstrapKey, current)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if etag := rr.Header().Get("ETag"); etag != `"stack-`+stack.ID+`-2"` {
+		t.Errorf("Expected generation 2 ETag after replace, got %q", etag)
+	}
+}
+
+func TestStackGeneration_ConcurrentTransactions(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+	_ = store.CreateStack(ctx, &domain.Stack{ID: "s1", Name: "infra"})
+
+	// Both writers pass If-Match against their own snapshot
+	gen := int64(0)
+	first, _ := store.BeginTx(ctx)
+	second, _ := store.BeginTx(ctx)
+	if _, err := first.IncrementStackGeneration(ctx, "s1", &gen); err != nil {
+		t.Fatalf("IncrementStackGeneration failed: %v", err)
+	}
+	if _, err := second.IncrementStackGeneration(ctx, "s1", &gen); err != nil {
+		t.Fatalf("IncrementStackGeneration failed: %v", err)
+	}
+	_ = second.CreateGroup(ctx, &domain.Group{ID: "g1", StackID: "s1", Name: "group:dev", Members: []string{"alice@example.com"}})
+	if err := first.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	// Only one of them commits
+	err := second.Commit()
+	var generationErr *domain.StackGenerationError
+	if !errors.As(err, &generationErr) || generationErr.Generation != 1 {
+		t.Fatalf("Expected the second commit to fail at generation 1, got %v", err)
+	}
+	if _, err := store.GetGroup(ctx, "s1", "group:dev"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected the failed commit to write nothing, got %v", err)
+	}
+	if stack, _ := store.GetStack(ctx, "s1"); stack.Generation != 1 {
+		t.Errorf("Expected generation 1, got %d", stack.Generation)
+	}
+}
+
+func TestGetStackState(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	// Resources created individually, with explicit rule orders
+	ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}, Description: "Developers"}, ts.bootstrapKey)
+	ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.5"}, ts.bootstrapKey)
+	ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{Order: 20, Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"db:5432"}}, ts.bootstrapKey)
+	ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{Order: 10, Action: "accept", Protocol: "udp", Sources: []string{"group:dev"}, Destinations: []string{"db:53"}}, ts.bootstrapKey)
+	ts.request("POST", base+"/nodeattrs", domain.CreateNodeAttrRequest{Order: 3, Target: []string{"group:dev"}, Attr: []string{"funnel"}}, ts.bootstrapKey)
+	ts.request("POST", base+"/tests", domain.CreateACLTestRequest{Order: 5, Source: "alice@example.com", Accept: []string{"db:5432"}}, ts.bootstrapKey)
+
+	rr = ts.request("GET", base+"/state", nil, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if etag := rr.Header().Get("ETag"); etag != `"stack-`+stack.ID+`-6"` {
+		t.Errorf("Expected generation 6 ETag, got %q", etag)
+	}
+	first := rr.Body.String()
+
+	var state domain.StackState
+	if err := json.Unmarshal(rr.Body.Bytes(), &state); err != nil {
+		t.Fatalf("Failed to decode state: %v", err)
+	}
+	if len(state.ACLs) != 2 || state.ACLs[0].Order != 10 || state.ACLs[1].Order != 20 || state.Groups[0].Description != "Developers" {
+		t.Errorf("Unexpected state %s", first)
+	}
+
+	// Writing the state back changes nothing
+	rr = ts.request("PUT", base+"/state", json.RawMessage(first), ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from replace, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("GET", base+"/state", nil, ts.bootstrapKey)
+	if rr.Body.String() != first {
+		t.Errorf("State did not round-trip:\nbefore: %s\nafter:  %s", first, rr.Body.String())
+	}
+}
+
+func TestAdoptPolicy(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "base"}, ts.bootstrapKey)
+	base, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "web"}, ts.bootstrapKey)
+	web, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	policyFile := `{
+		// Hand-maintained policy
+		"groups": {"group:dev": ["alice@example.com"]},
+		"tagOwners": {"tag:web": ["group:dev"]},
+		"hosts": {"db": "10.0.0.5"},
+		"acls": [
+			{"action": "accept", "src": ["group:dev"], "dst": ["db:5432"]},
+			{"action": "accept", "src": ["group:dev"], "dst": ["tag:web:443"]},
+		],
+		"sshTests": [{"src": "alice@example.com", "dst": ["tag:web"], "accept": ["root"]}],
+		"randomizeClientPort": true,
+	}`
+	req := domain.AdoptRequest{
+		StackID:    base.ID,
+		PolicyFile: policyFile,
+		Split:      []domain.AdoptSplitRule{{StackID: web.ID, Destination: "tag:web"}},
+	}
+
+	rr = ts.request("POST", "/api/v1/policy/adopt?dryRun=true", req, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var preview struct {
+		Preview domain.AdoptResult `json:"preview"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &preview)
+	if !preview.Preview.Equivalent || len(preview.Preview.States) != 2 {
+		t.Fatalf("Expected an equivalent split into two stacks, got %s", rr.Body.String())
+	}
+	// Keys the manager does not handle are reported rather than rejected
+	if warnings := preview.Preview.Warnings; len(warnings) != 2 || !strings.Contains(warnings[0], "randomizeClientPort") || !strings.Contains(warnings[1], "sshTests") {
+		t.Errorf("Expected warnings for randomizeClientPort and sshTests, got %v", warnings)
+	}
+	rr = ts.request("GET", "/api/v1/stacks/"+base.ID+"/groups", nil, ts.bootstrapKey)
+	if strings.Contains(rr.Body.String(), "group:dev") {
+		t.Fatal("Expected dry run not to write")
+	}
+
+	rr = ts.request("POST", "/api/v1/policy/adopt", req, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var baseState, webState domain.StackState
+	rr = ts.request("GET", "/api/v1/stacks/"+base.ID+"/state", nil, ts.bootstrapKey)
+	_ = json.Unmarshal(rr.Body.Bytes(), &baseState)
+	rr = ts.request("GET", "/api/v1/stacks/"+web.ID+"/state", nil, ts.bootstrapKey)
+	_ = json.Unmarshal(rr.Body.Bytes(), &webState)
+	if len(baseState.Groups) != 1 || len(baseState.Hosts) != 1 || len(baseState.ACLs) != 1 || baseState.ACLs[0].Destinations[0] != "db:5432" {
+		t.Errorf("Unexpected base state %+v", baseState)
+	}
+	if len(webState.ACLs) != 1 || webState.ACLs[0].Destinations[0] != "tag:web:443" || len(webState.Groups) != 0 {
+		t.Errorf("Unexpected web state %+v", webState)
+	}
+
+	// A third stack would add to the merged policy, so adoption is refused
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "extra"}, ts.bootstrapKey)
+	extra, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	ts.request("POST", "/api/v1/stacks/"+extra.ID+"/hosts", domain.CreateHostRequest{Name: "cache", Address: "10.0.0.9"}, ts.bootstrapKey)
+
+	rr = ts.request("POST", "/api/v1/policy/adopt", req, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req.Split[0].StackID = "missing"
+	rr = ts.request("POST", "/api/v1/policy/adopt", req, ts.bootstrapKey)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown split stack, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReplaceStateHuJSON(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	put := func(path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+ts.bootstrapKey)
+		rr := httptest.NewRecorder()
+		ts.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	fragment := `{
+		// Database access
+		"hosts": {"db": "10.0.0.5"},
+		"tagOwners": {"tag:db": ["autogroup:admin"]},
+		"acls": [
+			{"action": "accept", "src": ["autogroup:member"], "dst": ["db:5432"]}, // Postgres
+		],
+		"ssh": [{"action": "check", "src": ["autogroup:member"], "dst": ["tag:db"], "users": ["root"]}],
+		"autoApprovers": {"routes": {"10.0.0.0/24": ["tag:db"]}},
+		"tests": [{"src": "alice@example.com", "accept": ["db:5432"]}],
+	}`
+	rr = put(base+"/state?format=hujson", "text/plain", fragment)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var state domain.StackState
+	rr = ts.request("GET", base+"/state", nil, ts.bootstrapKey)
+	_ = json.Unmarshal(rr.Body.Bytes(), &state)
+	if len(state.Hosts) != 1 || len(state.TagOwners) != 1 || len(state.ACLs) != 1 || len(state.SSHRules) != 1 ||
+		len(state.AutoApprovers) != 1 || len(state.Tests) != 1 || state.ACLs[0].Destinations[0] != "db:5432" {
+		t.Errorf("Unexpected state %s", rr.Body.String())
+	}
+
+	// The content type alone selects the format, and sections left out are cleared
+	rr = put(base+"/state", "application/hujson", `{"hosts": {"db": "10.0.0.6"},}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("GET", base+"/state", nil, ts.bootstrapKey)
+	state = domain.StackState{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &state)
+	if len(state.Hosts) != 1 || state.Hosts[0].Address != "10.0.0.6" || len(state.ACLs) != 0 {
+		t.Errorf("Unexpected state after replace %s", rr.Body.String())
+	}
+
+	// Unknown top-level keys are ignored with a warning, and keys match case-insensitively
+	rr = put(base+"/state?format=hujson", "text/plain", `{"derpMap": {}, "Hosts": {"db": "10.0.0.7"}}`)
+	var resp domain.MutationResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "derpMap") {
+		t.Errorf("Expected status 200 with a warning for derpMap, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = put(base+"/state?format=hujson&plan=true", "text/plain", `{"disableIPv4": true}`)
+	var plan domain.StatePlan
+	_ = json.Unmarshal(rr.Body.Bytes(), &plan)
+	if rr.Code != http.StatusOK || len(plan.Warnings) != 1 {
+		t.Errorf("Expected the plan to carry the warning, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("GET", base+"/state", nil, ts.bootstrapKey)
+	state = domain.StackState{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &state)
+	if len(state.Hosts) != 1 || state.Hosts[0].Address != "10.0.0.7" {
+		t.Errorf("Unexpected state after replace %s", rr.Body.String())
+	}
+
+	// Unknown keys within a section are rejected instead of being dropped
+	rr = put(base+"/state?format=hujson", "text/plain", `{"acls": [{"action": "accept", "srcs": ["*"], "dst": ["*:*"]}]}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "srcs") {
+		t.Errorf("Expected status 400 naming the unknown key, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Fragments are validated like any other state
+	rr = put(base+"/state?format=hujson", "text/plain", `{"acls": [{"action": "accept", "src": ["autogroup:member"], "dst": ["db:99999"]}]}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "acls[0].dst[0]") {
+		t.Errorf("Expected a validation error for acls[0].dst[0], got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestResourceExpiry(t *testing.T) {
+	store := memory.New()
+	syncService := service.NewSyncService(store, nil, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+	ctx := context.Background()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "jit"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	past := time.Now().Add(-time.Hour)
+	rr = ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action: "accept", Sources: []string{"*"}, Destinations: []string{"*:*"}, ExpiresAt: &past,
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "expiresAt") {
+		t.Fatalf("Expected a validation error for a past expiresAt, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	rr = ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"tag:db:5432"}, ExpiresAt: &future,
+	}, ts.bootstrapKey)
+	rule, _ := unmarshalMutationData[domain.ACLRule](rr.Body.Bytes())
+	if rr.Code != http.StatusCreated || rule.ExpiresAt == nil || !rule.ExpiresAt.Equal(future) {
+		t.Fatalf("Expected ACL with expiresAt %v, got %d: %s", future, rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{
+		Name:            "group:dev",
+		Members:         []string{"alice@example.com", "bob@example.com"},
+		MemberExpiresAt: map[string]time.Time{"bob@example.com": future},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{
+		Name:            "group:ops",
+		Members:         []string{"carol@example.com"},
+		MemberExpiresAt: map[string]time.Time{"dave@example.com": future},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "memberExpiresAt[dave@example.com]") {
+		t.Fatalf("Expected a validation error for a non-member expiry, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Clearing the expiry keeps the rule indefinitely
+	empty := ""
+	rr = ts.request("PUT", base+"/acls/"+rule.ID, domain.UpdateACLRuleRequest{ExpiresAt: &empty}, ts.bootstrapKey)
+	cleared, _ := unmarshalMutationData[domain.ACLRule](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || cleared.ExpiresAt != nil {
+		t.Fatalf("Expected expiresAt to be cleared, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Let the rule and bob's membership lapse
+	acl, _ := store.GetACLRule(ctx, rule.ID)
+	acl.ExpiresAt = &past
+	_ = store.UpdateACLRule(ctx, acl)
+	group, _ := store.GetGroup(ctx, stack.ID, "group:dev")
+	group.MemberExpiresAt["bob@example.com"] = past
+	_ = store.UpdateGroup(ctx, group)
+
+	rr = ts.request("GET", "/api/v1/policy/preview", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if len(policy.ACLs) != 0 {
+		t.Errorf("Expected expired ACL to be left out of the policy, got %+v", policy.ACLs)
+	}
+	if members := policy.Groups["group:dev"]; len(members) != 1 || members[0] != "alice@example.com" {
+		t.Errorf("Expected only alice in group:dev, got %v", members)
+	}
+
+	next, err := syncService.ReapExpired(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ReapExpired failed: %v", err)
+	}
+	if next != nil {
+		t.Errorf("Expected no pending expiry, got %v", next)
+	}
+	if _, err := store.GetACLRule(ctx, rule.ID); err != domain.ErrNotFound {
+		t.Errorf("Expected expired ACL to be deleted, got %v", err)
+	}
+	group, _ = store.GetGroup(ctx, stack.ID, "group:dev")
+	if len(group.Members) != 1 || len(group.MemberExpiresAt) != 0 {
+		t.Errorf("Expected bob to be removed from group:dev, got %v %v", group.Members, group.MemberExpiresAt)
+	}
+
+	rr = ts.request("GET", "/api/v1/audit?action=expire", nil, ts.bootstrapKey)
+	var entries []*domain.AuditEntry
+	_ = json.Unmarshal(rr.Body.Bytes(), &entries)
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 expire audit entries, got %d", len(entries))
+	}
+
+	// One entry that cannot be removed does not hold up the rest
+	_ = store.CreateACLRule(ctx, &domain.ACLRule{ID: "orphan", StackID: "missing", Action: "accept", Sources: []string{"*"}, Destinations: []string{"*:*"}, ExpiresAt: &past})
+	rr = ts.request("POST", base+"/ssh", domain.CreateSSHRuleRequest{
+		Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"autogroup:self"}, Users: []string{"root"}, ExpiresAt: &future,
+	}, ts.bootstrapKey)
+	sshRule, _ := unmarshalMutationData[domain.SSHRule](rr.Body.Bytes())
+	ssh, _ := store.GetSSHRule(ctx, sshRule.ID)
+	ssh.ExpiresAt = &past
+	_ = store.UpdateSSHRule(ctx, ssh)
+
+	if _, err := syncService.ReapExpired(ctx, time.Now()); err != nil {
+		t.Fatalf("ReapExpired failed: %v", err)
+	}
+	if _, err := store.GetSSHRule(ctx, sshRule.ID); err != domain.ErrNotFound {
+		t.Errorf("Expected expired SSH rule to be deleted despite the failing ACL, got %v", err)
+	}
+	if _, err := store.GetACLRule(ctx, "orphan"); err != nil {
+		t.Errorf("Expected the failed removal to be rolled back, got %v", err)
+	}
+}
+
+func TestAccessRequests(t *testing.T) {
+	ts := newTestServer()
+	ctx := context.Background()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "jit"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{
+		Name: "group:oncall", Members: []string{"alice@example.com"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/grants", domain.CreateGrantRequest{
+		Sources: []string{"group:oncall"}, Destinations: []string{"tag:prod"}, IP: []string{"*"},
+	}, ts.bootstrapKey)
+	grant, _ := unmarshalMutationData[domain.Grant](rr.Body.Bytes())
+
+	// The bootstrap key stops working once the first key exists
+	keys, keyIDs := make(map[string]string), make(map[string]string)
+	creator := ts.bootstrapKey
+	for _, name := range []string{"Requester", "Approver"} {
+		rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{Name: name}, creator)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var key domain.CreateAPIKeyResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &key)
+		keys[name], keyIDs[name] = key.Key, key.ID
+		creator = key.Key
+	}
+	requester, approver := keys["Requester"], keys["Approver"]
+
+	rr = ts.request("POST", base+"/approvers", domain.CreateAccessApproverRequest{
+		Group: "group:oncall", Approver: "Approver",
+	}, requester)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/access-requests", domain.CreateAccessRequestRequest{
+		StackID: stack.ID, Type: "group", Target: "group:oncall", Member: "bob@example.com", Duration: "-1h",
+	}, requester)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "reason") || !strings.Contains(rr.Body.String(), "duration") {
+		t.Fatalf("Expected validation errors for reason and duration, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/access-requests", domain.CreateAccessRequestRequest{
+		StackID: stack.ID, Type: "group", Target: "group:oncall", Member: "bob@example.com",
+		Reason: "incident", Duration: "4h",
+	}, requester)
+	req, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	if rr.Code != http.StatusCreated || req.Status != domain.AccessRequestPending || req.RequestedBy != "Requester" {
+		t.Fatalf("Expected a pending request, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Nobody decides their own request
+	rr = ts.request("POST", "/api/v1/access-requests/"+req.ID+"/approve", nil, requester)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for self-approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Approvers are matched by key ID, so a key that shares the name decides nothing
+	rr = ts.request("POST", "/api/v1/keys", domain.CreateAPIKeyRequest{Name: "Approver"}, requester)
+	var impostor domain.CreateAPIKeyResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &impostor)
+	rr = ts.request("POST", "/api/v1/access-requests/"+req.ID+"/approve", nil, impostor.Key)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a key sharing the approver's name, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/approvers", domain.CreateAccessApproverRequest{Approver: "Approver"}, requester)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "key ID") {
+		t.Errorf("Expected an ambiguous approver name to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/access-requests/"+req.ID+"/approve", domain.DecideAccessRequestRequest{Comment: "ok"}, approver)
+	approved, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || approved.Status != domain.AccessRequestApproved || approved.ExpiresAt == nil {
+		t.Fatalf("Expected an approved request with an expiry, got %d: %s", rr.Code, rr.Body.String())
+	}
+	group, _ := ts.store.GetGroup(ctx, stack.ID, "group:oncall")
+	if !slices.Contains(group.Members, "bob@example.com") || !group.MemberExpiresAt["bob@example.com"].Equal(*approved.ExpiresAt) {
+		t.Errorf("Expected bob to be an expiring member, got %v %v", group.Members, group.MemberExpiresAt)
+	}
+
+	rr = ts.request("POST", "/api/v1/access-requests/"+req.ID+"/deny", nil, approver)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a decided request, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/access-requests/"+req.ID, nil, requester)
+	var withHistory domain.AccessRequest
+	_ = json.Unmarshal(rr.Body.Bytes(), &withHistory)
+	if len(withHistory.History) != 2 || withHistory.History[1].Comment != "ok" {
+		t.Errorf("Expected requested and approved events, got %+v", withHistory.History)
+	}
+
+	// Group approvers cannot decide grant requests
+	rr = ts.request("POST", "/api/v1/access-requests", domain.CreateAccessRequestRequest{
+		StackID: stack.ID, Type: "grant", Target: grant.ID, Member: "carol@example.com",
+		Reason: "deploy", Duration: "30m",
+	}, requester)
+	grantReq, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/access-requests/"+grantReq.ID+"/approve", nil, approver)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a group approver, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", base+"/approvers", domain.CreateAccessApproverRequest{Approver: keyIDs["Approver"]}, requester)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/access-requests/"+grantReq.ID+"/approve", nil, approver)
+	approved, _ = unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	copied, err := ts.store.GetGrant(ctx, approved.ResourceID)
+	if err != nil || len(copied.Sources) != 1 || copied.Sources[0] != "carol@example.com" || copied.ExpiresAt == nil {
+		t.Errorf("Expected an expiring grant for carol, got %+v (%v)", copied, err)
+	}
+
+	rr = ts.request("POST", "/api/v1/access-requests", domain.CreateAccessRequestRequest{
+		StackID: stack.ID, Type: "group", Target: "group:oncall", Member: "dave@example.com",
+		Reason: "curious", Duration: "1h",
+	}, requester)
+	denyReq, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/access-requests/"+denyReq.ID+"/deny", nil, approver)
+	denied, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || denied.Status != domain.AccessRequestDenied {
+		t.Errorf("Expected a denied request, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/access-requests?status=approved", nil, requester)
+	var list []*domain.AccessRequest
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Errorf("Expected 2 approved requests, got %d", len(list))
+	}
+
+	// Stacks that require approvals need as many distinct approvers
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "prod", RequiredApprovals: 2}, requester)
+	prod, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	_ = ts.store.CreateGroup(ctx, &domain.Group{ID: "g-prod", StackID: prod.ID, Name: "group:oncall", Members: []string{"alice@example.com"}})
+	for _, id := range []string{keyIDs["Approver"], impostor.ID} {
+		rr = ts.request("POST", "/api/v1/stacks/"+prod.ID+"/approvers", domain.CreateAccessApproverRequest{Approver: id}, requester)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	rr = ts.request("POST", "/api/v1/access-requests", domain.CreateAccessRequestRequest{
+		StackID: prod.ID, Type: "group", Target: "group:oncall", Member: "erin@example.com",
+		Reason: "incident", Duration: "1h",
+	}, requester)
+	prodReq, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/access-requests/"+prodReq.ID+"/approve", nil, approver)
+	first, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || first.Status != domain.AccessRequestPending {
+		t.Fatalf("Expected the request to stay pending after one approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if group, _ := ts.store.GetGroup(ctx, prod.ID, "group:oncall"); slices.Contains(group.Members, "erin@example.com") {
+		t.Errorf("Expected no access after one approval, got %v", group.Members)
+	}
+	rr = ts.request("POST", "/api/v1/access-requests/"+prodReq.ID+"/approve", nil, approver)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a second approval by the same key, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/access-requests/"+prodReq.ID+"/approve", nil, impostor.Key)
+	second, _ := unmarshalMutationData[domain.AccessRequest](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || second.Status != domain.AccessRequestApproved {
+		t.Fatalf("Expected the second approver to grant the access, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if group, _ := ts.store.GetGroup(ctx, prod.ID, "group:oncall"); !slices.Contains(group.Members, "erin@example.com") {
+		t.Errorf("Expected erin to be a member, got %v", group.Members)
+	}
+}
+
+func TestChangeSets(t *testing.T) {
+	ts := newTestServer()
+	ctx := context.Background()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "prod", RequiredApprovals: 2}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	if rr.Code != http.StatusCreated || stack.RequiredApprovals != 2 {
+		t.Fatalf("Expected a stack requiring 2 approvals, got %d: %s", rr.Code, rr.Body.String())
+	}
+	base := "/api/v1/stacks/" + stack.ID
+
+	// The bootstrap key stops working once the first key exists
+	keys := make(map[string]string)
+	creator := ts.bootstrapKey
+	for _, name := range []string{"Admin", "Author", "Alice", "Bob"} {
+		req := domain.CreateAPIKeyRequest{Name: name}
+		if name != "Admin" {
+			req.Roles = []string{domain.RoleReadOnly, domain.RoleStackWriter}
+		}
+		rr = ts.request("POST", "/api/v1/keys", req, creator)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var key domain.CreateAPIKeyResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &key)
+		keys[name] = key.Key
+		if name == "Admin" {
+			creator = key.Key
+		}
+	}
+
+	// Writes land in a change set instead of the stack
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:sre", Members: []string{"alice@example.com"}}, keys["Author"])
+	change, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusAccepted || change.Status != domain.ChangeSetPending {
+		t.Fatalf("Expected status 202 with a pending change set, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := ts.store.GetGroup(ctx, stack.ID, "group:sre"); err != domain.ErrNotFound {
+		t.Errorf("Expected the group not to be written yet, got %v", err)
+	}
+
+	// Further writes by the author amend the same change set
+	rr = ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action: "accept", Sources: []string{"group:sre"}, Destinations: []string{"tag:prod:*"},
+	}, keys["Author"])
+	amended, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusAccepted || amended.ID != change.ID || len(amended.State.Groups) != 1 || len(amended.State.ACLs) != 1 {
+		t.Fatalf("Expected the change set to be amended, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Failed writes are answered as usual
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "sre"}, keys["Author"])
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid staged write, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/changes/"+change.ID, nil, keys["Alice"])
+	var detail domain.ChangeSet
+	_ = json.Unmarshal(rr.Body.Bytes(), &detail)
+	if rr.Code != http.StatusOK || detail.Diff == nil || len(detail.Diff.Groups) != 1 || detail.RequiredApprovals != 2 {
+		t.Fatalf("Expected a change set with a diff, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/changes/"+change.ID+"/approve", nil, keys["Author"])
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for self-approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/changes/"+change.ID+"/approve", domain.ReviewChangeSetRequest{Comment: "lgtm"}, keys["Alice"])
+	approved, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || approved.Status != domain.ChangeSetPending || approved.Approvals() != 1 {
+		t.Fatalf("Expected one approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/changes/"+change.ID+"/approve", nil, keys["Alice"])
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a repeated approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Reviewed change sets are not amended
+	rr = ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.1"}, keys["Author"])
+	next, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusAccepted || next.ID == change.ID {
+		t.Fatalf("Expected a new change set, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/changes/"+change.ID+"/approve", nil, keys["Bob"])
+	applied, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || applied.Status != domain.ChangeSetApplied {
+		t.Fatalf("Expected the change set to be applied, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := ts.store.GetGroup(ctx, stack.ID, "group:sre"); err != nil {
+		t.Errorf("Expected the group to be written, got %v", err)
+	}
+
+	// The other change set was made against the old generation
+	rr = ts.request("POST", "/api/v1/changes/"+next.ID+"/approve", nil, keys["Alice"])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/changes/"+next.ID+"/approve", nil, keys["Bob"])
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a stale change set, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/changes/"+next.ID+"/reject", domain.ReviewChangeSetRequest{Comment: "stale"}, keys["Author"])
+	rejected, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || rejected.Status != domain.ChangeSetRejected {
+		t.Errorf("Expected the author to withdraw the change set, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Writes to existing resources are rebased onto the open change set
+	group, _ := ts.store.GetGroup(ctx, stack.ID, "group:sre")
+	rr = ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "web", Address: "10.0.0.2"}, keys["Author"])
+	open, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	rr = ts.request("PUT", base+"/groups/"+group.ID, domain.UpdateGroupRequest{Members: []string{"bob@example.com"}}, keys["Author"])
+	rebased, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusAccepted || rebased.ID != open.ID || len(rebased.State.Hosts) != 1 ||
+		len(rebased.State.Groups) != 1 || rebased.State.Groups[0].Members[0] != "bob@example.com" {
+		t.Fatalf("Expected the update to amend the open change set, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if stored, _ := ts.store.GetGroup(ctx, stack.ID, "group:sre"); stored.Members[0] != "alice@example.com" {
+		t.Errorf("Expected the group not to be updated yet, got %v", stored.Members)
+	}
+	rr = ts.request("DELETE", base+"/groups/"+group.ID, nil, keys["Author"])
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a write to an entry the change set changed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Bulk replacements replace the state of the open change set
+	rr = ts.request("PUT", base+"/state", domain.StackState{
+		Hosts: []domain.CreateHostRequest{{Name: "cache", Address: "10.0.0.3"}},
+	}, keys["Author"])
+	replaced, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	if rr.Code != http.StatusAccepted || replaced.ID != open.ID || len(replaced.State.Groups) != 0 || len(replaced.State.Hosts) != 1 {
+		t.Fatalf("Expected the state to be staged, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := ts.store.GetGroup(ctx, stack.ID, "group:sre"); err != nil {
+		t.Errorf("Expected the stack to keep its resources, got %v", err)
+	}
+	rr = ts.request("POST", "/api/v1/changes/"+open.ID+"/reject", nil, keys["Author"])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Proposing a whole state
+	rr = ts.request("POST", "/api/v1/changes", domain.CreateChangeSetRequest{
+		StackID: stack.ID, Description: "empty", State: &domain.StackState{},
+	}, keys["Author"])
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/changes?stackId="+stack.ID+"&status=pending", nil, keys["Alice"])
+	var pending []*domain.ChangeSet
+	_ = json.Unmarshal(rr.Body.Bytes(), &pending)
+	if len(pending) != 1 {
+		t.Errorf("Expected 1 pending change set, got %d", len(pending))
+	}
+
+	// Keys created by the author do not count as other reviewers
+	rr = ts.request("POST", "/api/v1/changes", domain.CreateChangeSetRequest{
+		StackID: stack.ID, Description: "by admin", State: &domain.StackState{},
+	}, keys["Admin"])
+	byAdmin, _ := unmarshalMutationData[domain.ChangeSet](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/changes/"+byAdmin.ID+"/approve", nil, keys["Alice"])
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "created by the author") {
+		t.Errorf("Expected status 403 for a key the author created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/changes/"+byAdmin.ID+"/reject", nil, keys["Admin"])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Only policy admins may enable or disable the stack
+	disabled := true
+	rr = ts.request("PUT", base, domain.UpdateStackRequest{Disabled: &disabled}, keys["Author"])
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("PUT", base, domain.UpdateStackRequest{Disabled: &disabled}, keys["Admin"])
+	if updated, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes()); rr.Code != http.StatusOK || !updated.Disabled {
+		t.Fatalf("Expected the stack to be disabled, got %d: %s", rr.Code, rr.Body.String())
+	}
+	disabled = false
+	rr = ts.request("PUT", base, domain.UpdateStackRequest{Disabled: &disabled}, keys["Author"])
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d: %s", rr.Code, rr.Body.String())
+	}
+	ts.request("PUT", base, domain.UpdateStackRequest{Disabled: &disabled}, keys["Admin"])
+
+	// Only policy admins may lower the bar
+	zero := 0
+	rr = ts.request("PUT", base, domain.UpdateStackRequest{RequiredApprovals: &zero}, keys["Author"])
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("PUT", base, domain.UpdateStackRequest{RequiredApprovals: &zero}, keys["Admin"])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.1"}, keys["Author"])
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected direct writes once approvals are off, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWebChangeSets(t *testing.T) {
+	ts := newTestServer()
+	ctx := context.Background()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "prod", RequiredApprovals: 1}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	_ = ts.store.CreateGroup(ctx, &domain.Group{ID: "g1", StackID: stack.ID, Name: "group:ops", Members: []string{"alice@example.com"}})
+	_ = ts.store.CreateHost(ctx, &domain.Host{ID: "h1", StackID: stack.ID, Name: "db", Address: "10.0.0.1"})
+	base := "/stacks/" + stack.ID
+
+	// Each write redirects to the change set it was staged in
+	var changeID string
+	staged := func(rr *httptest.ResponseRecorder) {
+		t.Helper()
+		redirect := rr.Header().Get("HX-Redirect")
+		id, ok := strings.CutPrefix(redirect, "/changes/")
+		if rr.Code != http.StatusOK || !ok {
+			t.Fatalf("Expected a redirect to a change set, got %d to %q: %s", rr.Code, redirect, rr.Body.String())
+		}
+		if changeID != "" && id != changeID {
+			t.Errorf("Expected change set %s to be amended, got %s", changeID, id)
+		}
+		changeID = id
+	}
+
+	staged(ts.webRequest("POST", base+"/groups", url.Values{"name": {"group:web"}, "members": {"bob@example.com"}}, ts.bootstrapKey))
+	staged(ts.webRequest("PUT", base+"/groups/group:ops", url.Values{"name": {"group:ops"}, "members": {"carol@example.com"}}, ts.bootstrapKey))
+	staged(ts.webRequest("DELETE", base+"/hosts/db", nil, ts.bootstrapKey))
+
+	// Nothing is applied
+	if _, err := ts.store.GetGroup(ctx, stack.ID, "group:web"); err != domain.ErrNotFound {
+		t.Errorf("Expected the new group not to be written, got %v", err)
+	}
+	if group, _ := ts.store.GetGroup(ctx, stack.ID, "group:ops"); group.Members[0] != "alice@example.com" {
+		t.Errorf("Expected the group not to be updated, got %v", group.Members)
+	}
+	if _, err := ts.store.GetHost(ctx, stack.ID, "db"); err != nil {
+		t.Errorf("Expected the host not to be deleted, got %v", err)
+	}
+
+	change, err := ts.store.GetChangeSet(ctx, changeID)
+	if err != nil {
+		t.Fatalf("Expected the change set to be stored, got %v", err)
+	}
+	members := make(map[string]string)
+	for _, g := range change.State.Groups {
+		members[g.Name] = strings.Join(g.Members, ",")
+	}
+	expected := map[string]string{"group:ops": "carol@example.com", "group:web": "bob@example.com"}
+	if !maps.Equal(members, expected) || len(change.State.Hosts) != 0 {
+		t.Errorf("Expected the change set to hold all three writes, got %+v", change.State)
+	}
+}
+
+func TestGuardrails(t *testing.T) {
+	ts := newTestServer()
+	ctx := context.Background()
+
+	rr := ts.request("POST", "/api/v1/guardrails", domain.CreateGuardrailRequest{
+		Name:  "no-wildcard-prod",
+		Match: domain.GuardrailMatch{Src: []string{"*"}, Dst: []string{"tag:prod:*"}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Users and actions only apply to SSH rules
+	rr = ts.request("POST", "/api/v1/guardrails", domain.CreateGuardrailRequest{
+		Name:  "root",
+		Match: domain.GuardrailMatch{Users: []string{"root"}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/guardrails", domain.CreateGuardrailRequest{
+		Name:    "ssh-root-check",
+		Targets: []string{domain.GuardrailTargetSSH},
+		Match:   domain.GuardrailMatch{Users: []string{"root"}, Action: "accept"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "prod"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	// Violating writes are refused, naming the guardrail
+	rr = ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action: "accept", Sources: []string{"*"}, Destinations: []string{"tag:prod:443"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), domain.ErrCodeGuardrailViolation) ||
+		!strings.Contains(rr.Body.String(), "no-wildcard-prod") {
+		t.Errorf("Expected a guardrail violation, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rules, _ := ts.store.ListACLRules(ctx, stack.ID)
+	if len(rules) != 0 {
+		t.Errorf("Expected the rule not to be written, got %d rules", len(rules))
+	}
+
+	rr = ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action: "accept", Sources: []string{"group:sre"}, Destinations: []string{"tag:prod:443"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("POST", base+"/ssh", domain.CreateSSHRuleRequest{
+		Action: "accept", Sources: []string{"group:sre"}, Destinations: []string{"tag:prod"}, Users: []string{"root"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "ssh-root-check") {
+		t.Errorf("Expected a guardrail violation, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/ssh", domain.CreateSSHRuleRequest{
+		Action: "check", Sources: []string{"group:sre"}, Destinations: []string{"tag:prod"}, Users: []string{"root"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("PUT", base+"/state", domain.StackState{
+		ACLs: []domain.CreateACLRuleRequest{{Action: "accept", Sources: []string{"*"}, Destinations: []string{"tag:prod:5432"}}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected state with a violation to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Violations that predate a guardrail are reported but do not block
+	// writes to fix them
+	rr = ts.request("POST", "/api/v1/guardrails", domain.CreateGuardrailRequest{
+		Name:  "no-sre-prod",
+		Match: domain.GuardrailMatch{Src: []string{"group:sre"}, Dst: []string{"tag:prod:*"}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("GET", "/api/v1/guardrails/violations", nil, ts.bootstrapKey)
+	var violations []domain.GuardrailViolation
+	_ = json.Unmarshal(rr.Body.Bytes(), &violations)
+	if len(violations) != 1 || violations[0].GuardrailName != "no-sre-prod" || violations[0].StackName != "prod" {
+		t.Fatalf("Expected 1 violation from stack prod, got %s", rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.1"}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected unrelated writes to pass, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("DELETE", base+"/acls/"+violations[0].ResourceID, nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Guardrails from the configuration file are read-only
+	path := filepath.Join(t.TempDir(), "guardrails.json")
+	data, _ := json.Marshal([]domain.CreateGuardrailRequest{{
+		Name:  "no-internet",
+		Match: domain.GuardrailMatch{Dst: []string{"autogroup:internet:*"}},
+	}})
+	_ = os.WriteFile(path, data, 0o600)
+	if n, err := guardrails.LoadFile(ctx, ts.store, path, time.Now()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 guardrail to be loaded, got %d: %v", n, err)
+	}
+	rr = ts.request("GET", "/api/v1/guardrails", nil, ts.bootstrapKey)
+	var list []*domain.Guardrail
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 4 || list[0].Name != "no-internet" || list[0].Source != domain.GuardrailSourceConfig {
+		t.Fatalf("Expected 4 guardrails with the configured one first, got %s", rr.Body.String())
+	}
+	rr = ts.request("DELETE", "/api/v1/guardrails/"+list[0].ID, nil, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("DELETE", "/api/v1/guardrails/"+list[1].ID, nil, ts.bootstrapKey)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPolicyLint(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "team"}, ts.bootstrapKey)
+	stack, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	base := "/api/v1/stacks/" + stack.ID
+
+	rr = ts.request("POST", base+"/acls", domain.CreateACLRuleRequest{
+		Action: "accept", Sources: []string{"group:sre"}, Destinations: []string{"db:5432"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/lint", nil, ts.bootstrapKey)
+	var issues []domain.LintIssue
+	_ = json.Unmarshal(rr.Body.Bytes(), &issues)
+	if rr.Code != http.StatusOK || len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if issues[0].Check != domain.LintUndefinedGroup || issues[0].StackName != "team" || issues[0].Section != "acls" {
+		t.Errorf("Expected an undefined group in stack team, got %+v", issues[0])
+	}
+	if issues[1].Check != domain.LintUndefinedHost || issues[1].Reference != "db" {
+		t.Errorf("Expected an undefined host db, got %+v", issues[1])
+	}
+
+	// Blocking undefined references is opt-in through a guardrail
+	rr = ts.request("POST", "/api/v1/guardrails", domain.CreateGuardrailRequest{
+		Name:  "no-undefined-references",
+		Match: domain.GuardrailMatch{UndefinedReferences: true, Src: []string{"*"}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for combined conditions, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/guardrails", domain.CreateGuardrailRequest{
+		Name:  "no-undefined-references",
+		Match: domain.GuardrailMatch{UndefinedReferences: true},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Existing references do not block unrelated writes, new ones do
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"group:contractors"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), `references undefined group \"group:contractors\"`) {
+		t.Errorf("Expected the undefined group to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/hosts", domain.CreateHostRequest{Name: "db", Address: "10.0.0.5"}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", base+"/groups", domain.CreateGroupRequest{Name: "group:sre", Members: []string{"bob@example.com"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/policy/lint", nil, ts.bootstrapKey)
+	issues = nil
+	_ = json.Unmarshal(rr.Body.Bytes(), &issues)
+	if len(issues) != 0 {
+		t.Errorf("Expected no issues, got %s", rr.Body.String())
+	}
+}
+
+func TestNestedGroups(t *testing.T) {
+	ts := newTestServer()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "platform"}, ts.bootstrapKey)
+	platform, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "team"}, ts.bootstrapKey)
+	team, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	rr = ts.request("POST", "/api/v1/stacks/"+platform.ID+"/groups", domain.CreateGroupRequest{
+		Name: "group:sre", Members: []string{"bob@example.com"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/stacks/"+team.ID+"/groups", domain.CreateGroupRequest{
+		Name: "group:eng", Members: []string{"alice@example.com", "group:sre"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Tags cannot be members
+	rr = ts.request("POST", "/api/v1/stacks/"+team.ID+"/groups", domain.CreateGroupRequest{
+		Name: "group:ci", Members: []string{"tag:ci"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a tag member, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The rendered policy only holds users
+	rr = ts.request("GET", "/api/v1/policy/preview", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	eng := policy.Groups["group:eng"]
+	slices.Sort(eng)
+	if !slices.Equal(eng, []string{"alice@example.com", "bob@example.com"}) {
+		t.Errorf("Expected group:eng to be flattened, got %v", eng)
+	}
+
+	// Closing the loop from another stack is a validation error
+	rr = ts.request("PUT", "/api/v1/stacks/"+platform.ID+"/groups/name/group:sre", domain.UpdateGroupRequest{
+		Members: []string{"bob@example.com", "group:eng"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"cycle":["group:sre","group:eng","group:sre"]`) {
+		t.Errorf("Expected a cycle error, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("PUT", "/api/v1/stacks/"+platform.ID+"/state", domain.StackState{
+		Groups: []domain.CreateGroupRequest{{Name: "group:sre", Members: []string{"group:eng"}}},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a cycle, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGroupTagMembers(t *testing.T) {
+	store := memory.New()
+	shim := tailscale.NewFileShim(filepath.Join(t.TempDir(), "policy.json"))
+	syncService := service.NewSyncService(store, shim, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "team"}, ts.bootstrapKey)
+	team, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+
+	// Stored before tags were refused as group members
+	_ = store.CreateGroup(context.Background(), &domain.Group{
+		ID: "g1", StackID: team.ID, Name: "group:ci", Members: []string{"alice@example.com", "tag:ci"},
+	})
+
+	// The tag is kept in the merged policy and reported
+	rr = ts.request("GET", "/api/v1/policy", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if !slices.Contains(policy.Groups["group:ci"], "tag:ci") {
+		t.Errorf("Expected the tag member to be kept, got %v", policy.Groups["group:ci"])
+	}
+	rr = ts.request("GET", "/api/v1/policy/lint", nil, ts.bootstrapKey)
+	var issues []domain.LintIssue
+	_ = json.Unmarshal(rr.Body.Bytes(), &issues)
+	if !slices.ContainsFunc(issues, func(i domain.LintIssue) bool {
+		return i.Check == domain.LintTagGroupMember && i.ResourceID == "g1"
+	}) {
+		t.Errorf("Expected a tag member issue, got %s", rr.Body.String())
+	}
+
+	// Syncs are refused until the member is removed
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	var syncResp domain.SyncResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "failed" || len(syncResp.LintIssues) != 1 || !strings.Contains(syncResp.Error, "group:ci contains tag:ci") {
+		t.Fatalf("Expected sync to fail on the tag member, got %s", rr.Body.String())
+	}
+
+	rr = ts.request("PUT", "/api/v1/stacks/"+team.ID+"/groups/name/group:ci", domain.UpdateGroupRequest{
+		Members: []string{"alice@example.com"},
+	}, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("POST", "/api/v1/policy/sync", nil, ts.bootstrapKey)
+	syncResp = domain.SyncResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &syncResp)
+	if syncResp.Status != "success" {
+		t.Errorf("Expected sync to succeed, got %s", rr.Body.String())
+	}
+}
+func TestDisableStack(t *testing.T) {
+	store := memory.New()
+	syncService := service.NewSyncService(store, nil, 5*time.Second, false)
+	ts := &testServer{
+		handler:      api.NewRouter(store, syncService, "test-bootstrap-key", nil, nil),
+		store:        store,
+		bootstrapKey: "test-bootstrap-key",
+	}
+	ctx := context.Background()
+
+	rr := ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "infra", Priority: 10}, ts.bootstrapKey)
+	infra, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	rr = ts.request("POST", "/api/v1/stacks", domain.CreateStackRequest{Name: "apps", Priority: 20}, ts.bootstrapKey)
+	apps, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	if apps.Disabled {
+		t.Fatalf("Expected new stacks to be enabled, got %s", rr.Body.String())
+	}
+
+	ts.request("POST", "/api/v1/stacks/"+infra.ID+"/groups", domain.CreateGroupRequest{Name: "group:dev", Members: []string{"alice@example.com"}}, ts.bootstrapKey)
+	future := time.Now().Add(time.Hour)
+	ts.request("POST", "/api/v1/stacks/"+apps.ID+"/groups", domain.CreateGroupRequest{
+		Name:            "group:dev",
+		Members:         []string{"bob@example.com", "carol@example.com"},
+		MemberExpiresAt: map[string]time.Time{"carol@example.com": future},
+	}, ts.bootstrapKey)
+	ts.request("POST", "/api/v1/stacks/"+apps.ID+"/acls", domain.CreateACLRuleRequest{Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"tag:apps:443"}}, ts.bootstrapKey)
+
+	disabled := true
+	rr = ts.request("PUT", "/api/v1/stacks/"+apps.ID, domain.UpdateStackRequest{Disabled: &disabled}, ts.bootstrapKey)
+	updated, _ := unmarshalMutationData[domain.Stack](rr.Body.Bytes())
+	if rr.Code != http.StatusOK || !updated.Disabled {
+		t.Fatalf("Expected apps to be disabled, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = ts.request("GET", "/api/v1/policy", nil, ts.bootstrapKey)
+	var policy domain.TailscalePolicy
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if len(policy.ACLs) != 0 {
+		t.Errorf("Expected the ACLs of apps to be left out, got %+v", policy.ACLs)
+	}
+	if members := policy.Groups["group:dev"]; len(members) != 1 || members[0] != "alice@example.com" {
+		t.Errorf("Expected only infra's members in group:dev, got %v", members)
+	}
+
+	// Resources of disabled stacks stay editable
+	rr = ts.request("POST", "/api/v1/stacks/"+apps.ID+"/groups", domain.CreateGroupRequest{Name: "group:sre", Members: []string{"group:ops"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Nested groups of disabled stacks still count, so enabling it cannot form a cycle
+	rr = ts.request("POST", "/api/v1/stacks/"+infra.ID+"/groups", domain.CreateGroupRequest{Name: "group:ops", Members: []string{"group:sre"}}, ts.bootstrapKey)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a cycle through the disabled stack to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Expired access is removed from disabled stacks too
+	group, _ := store.GetGroup(ctx, apps.ID, "group:dev")
+	group.MemberExpiresAt["carol@example.com"] = time.Now().Add(-time.Minute)
+	_ = store.UpdateGroup(ctx, group)
+	if _, err := syncService.ReapExpired(ctx, time.Now()); err != nil {
+		t.Fatalf("ReapExpired failed: %v", err)
+	}
+	group, _ = store.GetGroup(ctx, apps.ID, "group:dev")
+	if len(group.Members) != 1 || group.Members[0] != "bob@example.com" {
+		t.Errorf("Expected carol to be removed from the disabled stack, got %v", group.Members)
+	}
+
+	enabled := false
+	rr = ts.request("PUT", "/api/v1/stacks/"+apps.ID, domain.UpdateStackRequest{Disabled: &enabled}, ts.bootstrapKey)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = ts.request("GET", "/api/v1/policy", nil, ts.bootstrapKey)
+	policy = domain.TailscalePolicy{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &policy)
+	if len(policy.ACLs) != 1 || len(policy.Groups["group:dev"]) != 2 {
+		t.Errorf("Expected apps to be merged again, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/access"
+	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/service"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+	"github.com/go-chi/chi/v5"
+)
+
+// AccessHandler handles just-in-time access requests and their approvers.
+type AccessHandler struct {
+	store       storage.Storage
+	syncService *service.SyncService
+}
+
+// NewAccessHandler creates a new AccessHandler.
+func NewAccessHandler(store storage.Storage, syncService *service.SyncService) *AccessHandler {
+	return &AccessHandler{store: store, syncService: syncService}
+}
+
+// CreateApprover designates an approver for the stack's access requests,
+// optionally limited to requests for one group.
+func (h *AccessHandler) CreateApprover(w http.ResponseWriter, r *http.Request) {
+	stackID := chi.URLParam(r, "stack_id")
+	ctx := r.Context()
+
+	if _, err := h.store.GetStack(ctx, stackID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var req domain.CreateAccessApproverRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Approver == "" {
+		respondValidationError(w, "approver", "", "approver is required")
+		return
+	}
+	if req.Group != "" {
+		if err := validation.ValidateGroupName(req.Group); err != nil {
+			respondValidationError(w, "group", req.Group, err.Error())
+			return
+		}
+	}
+
+	identity, err := access.ResolveApprover(ctx, h.store, req.Approver)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			respondValidationError(w, "approver", req.Approver, err.Error())
+			return
+		}
+		handleError(w, err)
+		return
+	}
+
+	approver := &domain.AccessApprover{
+		ID:        generateID(),
+		StackID:   stackID,
+		Group:     req.Group,
+		Approver:  identity,
+		CreatedAt: time.Now(),
+	}
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceAccessApprover,
+		ResourceID:   approver.ID,
+		StackID:      stackID,
+		After:        approver,
+	}
+	if err := runStackChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateAccessApprover(ctx, approver)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, &domain.MutationResponse{Data: approver})
+}
+
+// ListApprovers lists the stack's approvers.
+func (h *AccessHandler) ListApprovers(w http.ResponseWriter, r *http.Request) {
+	list, err := h.store.ListAccessApprovers(r.Context(), chi.URLParam(r, "stack_id"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// DeleteApprover removes an approver. Pending requests they could decide
+// stay pending.
+func (h *AccessHandler) DeleteApprover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	approver, err := h.store.GetAccessApprover(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if approver.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceAccessApprover,
+		ResourceID:   approver.ID,
+		StackID:      approver.StackID,
+		Before:       approver,
+	}
+	if err := runStackChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteAccessApprover(ctx, approver.ID)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateRequest asks for time-boxed access to a group or grant. Any key
+// that can read the stack may ask; the access is written once an approver
+// approves the request.
+func (h *AccessHandler) CreateRequest(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreateAccessRequestRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if errs := validation.ValidateAccessRequest(&req); errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	ctx := r.Context()
+	if !canReadStack(r, req.StackID) {
+		handleError(w, domain.ErrForbidden)
+		return
+	}
+
+	request, err := access.Submit(ctx, h.store, &req, time.Now())
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, &domain.MutationResponse{Data: request})
+}
+
+// ListRequests lists access requests, newest first.
+// Supports filtering by stackId and status.
+func (h *AccessHandler) ListRequests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.AccessRequestFilter{Status: q.Get("status")}
+
+	key := middleware.GetAPIKeyFromContext(r.Context())
+	if stackID := q.Get("stackId"); stackID != "" {
+		if !canReadStack(r, stackID) {
+			handleError(w, domain.ErrForbidden)
+			return
+		}
+		filter.StackIDs = []string{stackID}
+	} else if key != nil && key.IsScoped() {
+		// Scoped keys only see requests for their own stacks
+		filter.StackIDs = key.StackIDs
+	}
+
+	list, err := h.store.ListAccessRequests(r.Context(), filter)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// GetRequest returns an access request with its history.
+func (h *AccessHandler) GetRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req, err := h.store.GetAccessRequest(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if !canReadStack(r, req.StackID) {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	req, err = access.History(ctx, h.store, req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, req)
+}
+
+// Approve approves a pending access request, writes the access with its
+// expiry, and triggers a sync. Only approvers of the stack or group may
+// approve, and never their own request.
+func (h *AccessHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decision(w, r)
+	if !ok {
+		return
+	}
+
+	approved, err := access.Approve(r.Context(), h.store, h.syncService.MergeStrategies(), req.ID, decisionComment(r), time.Now())
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+
+	respondMutation(w, r, http.StatusOK, approved, h.syncService)
+}
+
+// Deny denies a pending access request.
+func (h *AccessHandler) Deny(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decision(w, r)
+	if !ok {
+		return
+	}
+
+	denied, err := access.Deny(r.Context(), h.store, req.ID, decisionComment(r), time.Now())
+	if err != nil {
+		respondAccessError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, &domain.MutationResponse{Data: denied})
+}
+
+// decision loads the request being decided, hiding requests of stacks the
+// key cannot read.
+func (h *AccessHandler) decision(w http.ResponseWriter, r *http.Request) (*domain.AccessRequest, bool) {
+	req, err := h.store.GetAccessRequest(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		handleError(w, err)
+		return nil, false
+	}
+	if !canReadStack(r, req.StackID) {
+		handleError(w, domain.ErrNotFound)
+		return nil, false
+	}
+	return req, true
+}
+
+// decisionComment reads the optional comment of an approval or denial.
+func decisionComment(r *http.Request) string {
+	var body domain.DecideAccessRequestRequest
+	if r.ContentLength != 0 {
+		_ = decodeJSON(r, &body)
+	}
+	return body.Comment
+}
+
+// canReadStack reports whether the request's API key may read stackID.
+func canReadStack(r *http.Request, stackID string) bool {
+	key := middleware.GetAPIKeyFromContext(r.Context())
+	return key == nil || key.CanReadStack(stackID)
+}
+
+// respondAccessError reports access request errors, keeping the reason for
+// conflicts such as deciding a request twice.
+func respondAccessError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrConflict) {
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceConflict, err.Error(), "", nil)
+		return
+	}
+	if errors.Is(err, domain.ErrForbidden) {
+		respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden, "not an approver for this request", "", nil)
+		return
+	}
+	handleError(w, err)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -51,8 +52,11 @@ func (h *ACLHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate sources and destinations
+	// Validate action, sources and destinations
 	var errs validation.ValidationErrors
+	if err := validation.ValidateACLAction(req.Action); err != nil {
+		errs.Add("action", req.Action, err.Error())
+	}
 	for i, src := range req.Sources {
 		if err := validation.ValidateACLSource(src); err != nil {
 			errs.Add(fmt.Sprintf("sources[%d]", i), src, err.Error())
@@ -63,6 +67,9 @@ func (h *ACLHandler) Create(w http.ResponseWriter, r *http.Request) {
 			errs.Add(fmt.Sprintf("destinations[%d]", i), dst, err.Error())
 		}
 	}
+	if err := validation.ValidateExpiresAt(req.ExpiresAt, time.Now()); err != nil {
+		errs.Add("expiresAt", req.ExpiresAt.Format(time.RFC3339), err.Error())
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
@@ -77,11 +84,23 @@ func (h *ACLHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Protocol:     req.Protocol,
 		Sources:      req.Sources,
 		Destinations: req.Destinations,
+		Description:  req.Description,
+		ExpiresAt:    req.ExpiresAt,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
-	if err := h.store.CreateACLRule(r.Context(), rule); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceACL,
+		ResourceID:   rule.ID,
+		StackID:      stackID,
+		After:        rule,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateACLRule(ctx, rule)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -120,6 +139,12 @@ func (h *ACLHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the rule belongs to the requested stack
+	if rule.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, rule)
 }
 
@@ -143,17 +168,31 @@ func (h *ACLHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the rule belongs to the requested stack
+	if rule.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	before := audit.Snapshot(rule)
+
 	if req.Order != nil {
 		rule.Order = *req.Order
 	}
-	if req.Action != nil {
-		rule.Action = *req.Action
-	}
 	if req.Protocol != nil {
 		rule.Protocol = *req.Protocol
 	}
-	// Validate sources and destinations if provided
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	// Validate action, sources and destinations if provided
 	var errs validation.ValidationErrors
+	if req.Action != nil {
+		if err := validation.ValidateACLAction(*req.Action); err != nil {
+			errs.Add("action", *req.Action, err.Error())
+		}
+		rule.Action = *req.Action
+	}
 	if req.Sources != nil {
 		for i, src := range req.Sources {
 			if err := validation.ValidateACLSource(src); err != nil {
@@ -170,12 +209,30 @@ func (h *ACLHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 		rule.Destinations = req.Destinations
 	}
+	if req.ExpiresAt != nil {
+		expiresAt, err := validation.ParseExpiresAt(*req.ExpiresAt, time.Now())
+		if err != nil {
+			errs.Add("expiresAt", *req.ExpiresAt, err.Error())
+		}
+		rule.ExpiresAt = expiresAt
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
 	}
 
-	if err := h.store.UpdateACLRule(r.Context(), rule); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceACL,
+		ResourceID:   rule.ID,
+		StackID:      rule.StackID,
+		Before:       before,
+		After:        rule,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateACLRule(ctx, rule)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -191,7 +248,28 @@ func (h *ACLHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteACLRule(r.Context(), id); err != nil {
+	// First verify the rule belongs to the requested stack
+	rule, err := h.store.GetACLRule(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if rule.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceACL,
+		ResourceID:   rule.ID,
+		StackID:      rule.StackID,
+		Before:       rule,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteACLRule(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
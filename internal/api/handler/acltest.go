@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -57,7 +58,17 @@ func (h *ACLTestHandler) Create(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: now,
 	}
 
-	if err := h.store.CreateACLTest(r.Context(), test); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceACLTest,
+		ResourceID:   test.ID,
+		StackID:      stackID,
+		After:        test,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateACLTest(ctx, test)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -96,6 +107,12 @@ func (h *ACLTestHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the test belongs to the requested stack
+	if test.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, test)
 }
 
@@ -119,6 +136,14 @@ func (h *ACLTestHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the test belongs to the requested stack
+	if test.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	before := audit.Snapshot(test)
+
 	if req.Order != nil {
 		test.Order = *req.Order
 	}
@@ -132,7 +157,18 @@ func (h *ACLTestHandler) Update(w http.ResponseWriter, r *http.Request) {
 		test.Deny = req.Deny
 	}
 
-	if err := h.store.UpdateACLTest(r.Context(), test); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceACLTest,
+		ResourceID:   test.ID,
+		StackID:      test.StackID,
+		Before:       before,
+		After:        test,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateACLTest(ctx, test)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -148,7 +184,28 @@ func (h *ACLTestHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteACLTest(r.Context(), id); err != nil {
+	// First verify the test belongs to the requested stack
+	test, err := h.store.GetACLTest(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if test.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceACLTest,
+		ResourceID:   test.ID,
+		StackID:      test.StackID,
+		Before:       test,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteACLTest(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
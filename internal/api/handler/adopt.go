@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
+	"github.com/bcnelson/tailscale-acl-manager/internal/policydiff"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+)
+
+// Adopt converts an existing Tailscale policy into the state of managed
+// stacks, replacing their contents. The policy is taken from the request, or
+// fetched from the tailnet if none is given. The write is refused unless the
+// merged result of all stacks matches the original policy; use ?dryRun=true
+// to preview the result either way.
+func (h *PolicyHandler) Adopt(w http.ResponseWriter, r *http.Request) {
+	var req domain.AdoptRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.StackID == "" {
+		respondValidationError(w, "stackId", "", "stackId is required")
+		return
+	}
+
+	var errs validation.ValidationErrors
+	for i, rule := range req.Split {
+		if rule.StackID == "" {
+			errs.Add(fmt.Sprintf("split[%d].stackId", i), "", "stackId is required")
+		}
+		if rule.Destination == "" && rule.Source == "" {
+			errs.Add(fmt.Sprintf("split[%d]", i), "", "destination or source is required")
+		}
+	}
+	if errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	ctx := r.Context()
+
+	policy := req.Policy
+	var warnings []string
+	if policy == nil && req.PolicyFile != "" {
+		var err error
+		if policy, warnings, err = parsePolicyFile([]byte(req.PolicyFile)); err != nil {
+			respondValidationError(w, "policyFile", "", err.Error())
+			return
+		}
+	}
+	if policy == nil {
+		var err error
+		if policy, err = h.syncService.GetLivePolicy(ctx); err != nil {
+			respondError(w, http.StatusBadGateway, fmt.Sprintf("failed to get live policy: %v", err))
+			return
+		}
+	}
+
+	states := stackstate.Split(policy, req.StackID, req.Split)
+	stackIDs := make([]string, 0, len(states))
+	for id := range states {
+		if _, err := h.store.GetStack(ctx, id); err != nil {
+			handleError(w, err)
+			return
+		}
+		stackIDs = append(stackIDs, id)
+	}
+	sort.Strings(stackIDs)
+
+	for _, id := range stackIDs {
+		for _, e := range validation.ValidateStackState(states[id]) {
+			errs.Add(fmt.Sprintf("states[%s].%s", id, e.Field), e.Value, e.Message)
+		}
+	}
+	if errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	diff, err := adoptionDiff(ctx, h.store, h.syncService.MergeStrategies(), policy, states, stackIDs)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	result := &domain.AdoptResult{States: states, Diff: diff, Equivalent: diff.Identical, Warnings: warnings}
+
+	if isDryRun(r) {
+		respondDryRun(w, result)
+		return
+	}
+	if !result.Equivalent {
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceConflict,
+			"adopted stacks do not reproduce the policy", "", map[string]any{"diff": diff})
+		return
+	}
+
+	tx, err := h.store.BeginTx(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := guardrails.CheckWrite(ctx, tx, h.syncService.MergeStrategies(), func(tx storage.Transaction) error {
+		for _, id := range stackIDs {
+			state := states[id]
+			if err := claims.CheckState(ctx, tx, id, state); err != nil {
+				return err
+			}
+			before, err := stackstate.Load(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.IncrementStackGeneration(ctx, id, nil); err != nil {
+				return err
+			}
+			if err := stackstate.Clear(ctx, tx, id); err != nil {
+				return err
+			}
+			if err := stackstate.Apply(ctx, tx, id, state); err != nil {
+				return err
+			}
+			if err := audit.Record(ctx, tx, audit.Change{
+				Action:       domain.AuditActionReplace,
+				ResourceType: domain.AuditResourceStackState,
+				ResourceID:   id,
+				StackID:      id,
+				Before:       before,
+				After:        state,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondMutation(w, r, http.StatusOK, result, h.syncService)
+}
+
+// adoptionDiff compares the original policy with the policy merged from all
+// stacks with strategies once the adopted states replace the contents of
+// stackIDs.
+func adoptionDiff(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, original *domain.TailscalePolicy, states map[string]*domain.StackState, stackIDs []string) (*domain.PolicyDiff, error) {
+	scratch, err := stackstate.Copy(ctx, store, stackIDs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range stackIDs {
+		if err := stackstate.Apply(ctx, scratch, id, states[id]); err != nil {
+			return nil, err
+		}
+	}
+
+	merged, err := merger.New(scratch, strategies).Merge(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := policydiff.Diff(original, merged)
+	diff.From = "original"
+	diff.To = "adopted"
+	return diff, nil
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -32,6 +37,33 @@ func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(req.Roles) == 0 {
+		req.Roles = domain.AllRoles
+	}
+
+	// Validate roles and stack scope
+	var errs validation.ValidationErrors
+	for i, role := range req.Roles {
+		if err := validation.ValidateAPIKeyRole(role); err != nil {
+			errs.Add(fmt.Sprintf("roles[%d]", i), role, err.Error())
+		}
+	}
+	for i, stackID := range req.StackIDs {
+		if _, err := h.store.GetStack(r.Context(), stackID); err != nil {
+			errs.Add(fmt.Sprintf("stackIds[%d]", i), stackID, "stack not found")
+		}
+	}
+	if errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	// A key can only hand out permissions it holds itself
+	if caller := middleware.GetAPIKeyFromContext(r.Context()); caller != nil && !caller.Covers(req.Roles, req.StackIDs) {
+		respondError(w, http.StatusForbidden, "cannot create a key with more access than the calling key")
+		return
+	}
+
 	key, hash, prefix, err := generateAPIKey()
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to generate API key")
@@ -43,10 +75,22 @@ func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Name:      req.Name,
 		KeyHash:   hash,
 		KeyPrefix: prefix,
+		Roles:     req.Roles,
+		StackIDs:  req.StackIDs,
+		CreatedBy: audit.ActorFromContext(r.Context()).ID,
 		CreatedAt: time.Now(),
 	}
 
-	if err := h.store.CreateAPIKey(r.Context(), apiKey); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceAPIKey,
+		ResourceID:   apiKey.ID,
+		After:        apiKey,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.CreateAPIKey(ctx, apiKey)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -56,13 +100,16 @@ func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Name:      apiKey.Name,
 		Key:       key, // Only returned on creation
 		KeyPrefix: apiKey.KeyPrefix,
+		Roles:     apiKey.Roles,
+		StackIDs:  apiKey.StackIDs,
 		CreatedAt: apiKey.CreatedAt,
 	}
 
 	respondJSON(w, http.StatusCreated, resp)
 }
 
-// List lists all API keys (without the actual key values).
+// List lists the API keys the calling key could have created (without the
+// actual key values).
 func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
 	keys, err := h.store.ListAPIKeys(r.Context())
 	if err != nil {
@@ -70,6 +117,12 @@ func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if caller := middleware.GetAPIKeyFromContext(r.Context()); caller != nil {
+		keys = slices.DeleteFunc(keys, func(k *domain.APIKey) bool {
+			return !caller.Covers(k.Roles, k.StackIDs)
+		})
+	}
+
 	respondJSON(w, http.StatusOK, keys)
 }
 
@@ -81,7 +134,40 @@ func (h *APIKeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteAPIKey(r.Context(), id); err != nil {
+	// Look up the key so the audit entry records what was deleted
+	keys, err := h.store.ListAPIKeys(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	var apiKey *domain.APIKey
+	for _, k := range keys {
+		if k.ID == id {
+			apiKey = k
+			break
+		}
+	}
+	if apiKey == nil {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	// A key can only delete keys it could have created
+	if caller := middleware.GetAPIKeyFromContext(r.Context()); caller != nil && !caller.Covers(apiKey.Roles, apiKey.StackIDs) {
+		respondError(w, http.StatusForbidden, "cannot delete a key with more access than the calling key")
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceAPIKey,
+		ResourceID:   apiKey.ID,
+		Before:       apiKey,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.DeleteAPIKey(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+)
+
+// AuditHandler handles audit log endpoints.
+type AuditHandler struct {
+	store storage.Storage
+}
+
+// NewAuditHandler creates a new AuditHandler.
+func NewAuditHandler(store storage.Storage) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// List lists audit entries, newest first.
+// Supports filtering by stackId, resourceType, resourceId, actorId, action,
+// and an RFC 3339 time range via since and until.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.AuditFilter{
+		ResourceType: q.Get("resourceType"),
+		ResourceID:   q.Get("resourceId"),
+		ActorID:      q.Get("actorId"),
+		Action:       q.Get("action"),
+		Limit:        100,
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			filter.Limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			filter.Offset = parsed
+		}
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			respondValidationError(w, "since", since, "must be an RFC 3339 timestamp")
+			return
+		}
+		filter.Since = &t
+	}
+	if until := q.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			respondValidationError(w, "until", until, "must be an RFC 3339 timestamp")
+			return
+		}
+		filter.Until = &t
+	}
+
+	key := middleware.GetAPIKeyFromContext(r.Context())
+	if stackID := q.Get("stackId"); stackID != "" {
+		if key != nil && !key.CanReadStack(stackID) {
+			handleError(w, domain.ErrForbidden)
+			return
+		}
+		filter.StackIDs = []string{stackID}
+	} else if key != nil && key.IsScoped() {
+		// Scoped keys only see entries for their own stacks
+		filter.StackIDs = key.StackIDs
+	}
+
+	entries, err := h.store.ListAuditEntries(r.Context(), filter)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, entries)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -81,7 +82,17 @@ func (h *AutoApproverHandler) Create(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: now,
 	}
 
-	if err := h.store.CreateAutoApprover(r.Context(), aa); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceAutoApprover,
+		ResourceID:   aa.ID,
+		StackID:      stackID,
+		After:        aa,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateAutoApprover(ctx, aa)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -120,6 +131,12 @@ func (h *AutoApproverHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the auto approver belongs to the requested stack
+	if aa.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, aa)
 }
 
@@ -143,6 +160,14 @@ func (h *AutoApproverHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the auto approver belongs to the requested stack
+	if aa.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	before := audit.Snapshot(aa)
+
 	// Validate approvers
 	var errs validation.ValidationErrors
 	for i, approver := range req.Approvers {
@@ -157,7 +182,18 @@ func (h *AutoApproverHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	aa.Approvers = req.Approvers
 
-	if err := h.store.UpdateAutoApprover(r.Context(), aa); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceAutoApprover,
+		ResourceID:   aa.ID,
+		StackID:      aa.StackID,
+		Before:       before,
+		After:        aa,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateAutoApprover(ctx, aa)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -173,7 +209,28 @@ func (h *AutoApproverHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteAutoApprover(r.Context(), id); err != nil {
+	// First verify the auto approver belongs to the requested stack
+	aa, err := h.store.GetAutoApprover(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if aa.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceAutoApprover,
+		ResourceID:   aa.ID,
+		StackID:      aa.StackID,
+		Before:       aa,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteAutoApprover(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
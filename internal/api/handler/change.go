@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
+	"github.com/bcnelson/tailscale-acl-manager/internal/changes"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/service"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+	"github.com/go-chi/chi/v5"
+)
+
+// ChangeHandler handles change sets: staged writes to stacks that require
+// approvals.
+type ChangeHandler struct {
+	store       storage.Storage
+	syncService *service.SyncService
+}
+
+// NewChangeHandler creates a new ChangeHandler.
+func NewChangeHandler(store storage.Storage, syncService *service.SyncService) *ChangeHandler {
+	return &ChangeHandler{store: store, syncService: syncService}
+}
+
+// Create proposes a new state for a stack as a change set, in the form
+// accepted by ReplaceState.
+func (h *ChangeHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreateChangeSetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.StackID == "" {
+		respondValidationError(w, "stackId", "", "stackId is required")
+		return
+	}
+	if key := middleware.GetAPIKeyFromContext(r.Context()); key == nil || !key.CanWriteStack(req.StackID) {
+		respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden,
+			"API key requires the "+domain.RoleStackWriter+" role", "", nil)
+		return
+	}
+
+	state := req.State
+	var warnings []string
+	if state == nil && req.StateFile != "" {
+		policy, ignored, err := parsePolicyFile([]byte(req.StateFile))
+		if err != nil {
+			respondValidationError(w, "stateFile", "", err.Error())
+			return
+		}
+		state, warnings = stackstate.FromPolicy(policy), ignored
+	}
+	if state == nil {
+		respondValidationError(w, "state", "", "state or stateFile is required")
+		return
+	}
+	if errs := validation.ValidateStackState(state); errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	change, err := changes.Propose(r.Context(), h.store, h.syncService.MergeStrategies(), req.StackID, req.Description, state, time.Now())
+	if err != nil {
+		respondChangeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/changes/"+change.ID)
+	respondJSON(w, http.StatusCreated, &domain.MutationResponse{Data: change, Warnings: warnings})
+}
+
+// List lists change sets, newest first.
+// Supports filtering by stackId and status.
+func (h *ChangeHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.ChangeSetFilter{Status: q.Get("status")}
+
+	key := middleware.GetAPIKeyFromContext(r.Context())
+	if stackID := q.Get("stackId"); stackID != "" {
+		if !canReadStack(r, stackID) {
+			handleError(w, domain.ErrForbidden)
+			return
+		}
+		filter.StackIDs = []string{stackID}
+	} else if key != nil && key.IsScoped() {
+		// Scoped keys only see change sets for their own stacks
+		filter.StackIDs = key.StackIDs
+	}
+
+	list, err := h.store.ListChangeSets(r.Context(), filter)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// Get returns a change set with its reviews and, while it is pending, the
+// merged policy diff it would cause.
+func (h *ChangeHandler) Get(w http.ResponseWriter, r *http.Request) {
+	change, ok := h.changeSet(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	change, err := changes.Get(ctx, h.store, change.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if change.Status == domain.ChangeSetPending {
+		if change.Diff, err = changes.Diff(ctx, h.store, h.syncService.MergeStrategies(), change); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, change)
+}
+
+// Approve approves a change set. The approval that reaches the stack's
+// required approvals applies the change set and triggers a sync.
+func (h *ChangeHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	change, ok := h.review(w, r)
+	if !ok {
+		return
+	}
+
+	approved, err := changes.Approve(r.Context(), h.store, h.syncService.MergeStrategies(), change.ID, reviewComment(r), time.Now())
+	if err != nil {
+		respondChangeError(w, err)
+		return
+	}
+
+	if approved.Status == domain.ChangeSetApplied {
+		respondMutation(w, r, http.StatusOK, approved, h.syncService)
+		return
+	}
+	respondJSON(w, http.StatusOK, &domain.MutationResponse{Data: approved})
+}
+
+// Reject closes a change set without applying it.
+func (h *ChangeHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	change, ok := h.review(w, r)
+	if !ok {
+		return
+	}
+
+	rejected, err := changes.Reject(r.Context(), h.store, change.ID, reviewComment(r), time.Now())
+	if err != nil {
+		respondChangeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, &domain.MutationResponse{Data: rejected})
+}
+
+// changeSet loads the change set in the URL, hiding change sets of stacks
+// the key cannot read.
+func (h *ChangeHandler) changeSet(w http.ResponseWriter, r *http.Request) (*domain.ChangeSet, bool) {
+	change, err := h.store.GetChangeSet(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		handleError(w, err)
+		return nil, false
+	}
+	if !canReadStack(r, change.StackID) {
+		handleError(w, domain.ErrNotFound)
+		return nil, false
+	}
+	return change, true
+}
+
+// review loads the change set being reviewed. Reviewers need write access
+// to its stack.
+func (h *ChangeHandler) review(w http.ResponseWriter, r *http.Request) (*domain.ChangeSet, bool) {
+	change, ok := h.changeSet(w, r)
+	if !ok {
+		return nil, false
+	}
+	if key := middleware.GetAPIKeyFromContext(r.Context()); key == nil || !key.CanWriteStack(change.StackID) {
+		respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden,
+			"API key requires the "+domain.RoleStackWriter+" role", "", nil)
+		return nil, false
+	}
+	return change, true
+}
+
+// reviewComment reads the optional comment of an approval or rejection.
+func reviewComment(r *http.Request) string {
+	var body domain.ReviewChangeSetRequest
+	if r.ContentLength != 0 {
+		_ = decodeJSON(r, &body)
+	}
+	return body.Comment
+}
+
+// respondChangeError reports change set errors, keeping the reason for
+// conflicts such as a stack that changed since the change set was made.
+func respondChangeError(w http.ResponseWriter, err error) {
+	var claimErr *domain.ClaimConflictError
+	var guardrailErr *domain.GuardrailViolationError
+	switch {
+	case errors.As(err, &claimErr), errors.As(err, &guardrailErr):
+		handleError(w, err)
+	case errors.Is(err, domain.ErrConflict):
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceConflict, err.Error(), "", nil)
+	case errors.Is(err, domain.ErrForbidden):
+		respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden, err.Error(), "", nil)
+	default:
+		handleError(w, err)
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/service"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+	"github.com/go-chi/chi/v5"
+)
+
+// ClaimHandler handles stack ownership claim endpoints.
+// Claims do not change the rendered policy, so they never trigger a sync.
+type ClaimHandler struct {
+	store       storage.Storage
+	syncService *service.SyncService
+}
+
+// NewClaimHandler creates a new ClaimHandler.
+func NewClaimHandler(store storage.Storage, syncService *service.SyncService) *ClaimHandler {
+	return &ClaimHandler{store: store, syncService: syncService}
+}
+
+// Create claims a group name, tag, or host name for the stack.
+// Names already claimed by, or defined in, another stack are rejected.
+func (h *ClaimHandler) Create(w http.ResponseWriter, r *http.Request) {
+	stackID := chi.URLParam(r, "stack_id")
+	if stackID == "" {
+		respondError(w, http.StatusBadRequest, "stack_id is required")
+		return
+	}
+
+	// Verify stack exists
+	if _, err := h.store.GetStack(r.Context(), stackID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var req domain.CreateClaimRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if !slices.Contains(domain.AllClaimTypes, req.Type) {
+		respondValidationError(w, "type", req.Type, "type must be one of group, tag, host")
+		return
+	}
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	var err error
+	switch req.Type {
+	case domain.ClaimTypeGroup:
+		err = validation.ValidateGroupName(req.Name)
+	case domain.ClaimTypeTag:
+		err = validation.ValidateTagName(req.Name)
+	case domain.ClaimTypeHost:
+		err = validation.ValidateHostName(req.Name)
+	}
+	if err != nil {
+		respondValidationError(w, "name", req.Name, err.Error())
+		return
+	}
+
+	claim := &domain.Claim{
+		ID:        generateID(),
+		StackID:   stackID,
+		Type:      req.Type,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceClaim,
+		ResourceID:   claim.ID,
+		StackID:      stackID,
+		After:        claim,
+	}
+	if err := runStackChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		if err := claims.CheckUnclaimed(ctx, tx, stackID, claim.Type, claim.Name); err != nil {
+			return err
+		}
+		return tx.CreateClaim(ctx, claim)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, &domain.MutationResponse{Data: claim})
+}
+
+// List lists the stack's claims.
+func (h *ClaimHandler) List(w http.ResponseWriter, r *http.Request) {
+	stackID := chi.URLParam(r, "stack_id")
+	if stackID == "" {
+		respondError(w, http.StatusBadRequest, "stack_id is required")
+		return
+	}
+
+	list, err := h.store.ListClaims(r.Context(), stackID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, list)
+}
+
+// Delete releases a claim.
+func (h *ClaimHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	// First verify the claim belongs to the requested stack
+	claim, err := h.store.GetClaimByID(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if claim.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceClaim,
+		ResourceID:   claim.ID,
+		StackID:      claim.StackID,
+		Before:       claim,
+	}
+	if err := runStackChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteClaim(ctx, id)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -8,8 +8,12 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/changes"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/google/uuid"
 )
@@ -51,6 +55,8 @@ func httpStatusToErrorCode(status int) string {
 		return domain.ErrCodeInvalidInput
 	case http.StatusUnauthorized:
 		return domain.ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return domain.ErrCodeForbidden
 	case http.StatusPreconditionFailed:
 		return domain.ErrCodePreconditionFailed
 	default:
@@ -60,15 +66,48 @@ func httpStatusToErrorCode(status int) string {
 
 // handleError converts domain errors to HTTP errors.
 func handleError(w http.ResponseWriter, err error) {
+	var claimErr *domain.ClaimConflictError
+	var generationErr *domain.StackGenerationError
+	var guardrailErr *domain.GuardrailViolationError
+	var cycleErr *domain.GroupCycleError
+	var stagedErr *domain.ChangeStagedError
 	switch {
+	case errors.As(err, &stagedErr):
+		respondStaged(w, stagedErr.Change)
 	case errors.Is(err, domain.ErrNotFound):
 		respondStandardError(w, http.StatusNotFound, domain.ErrCodeResourceNotFound, "resource not found", "", nil)
+	case errors.As(err, &claimErr):
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceConflict, claimErr.Error(), "", map[string]any{
+			"type":    claimErr.Type,
+			"name":    claimErr.Name,
+			"stackId": claimErr.StackID,
+		})
+	case errors.As(err, &guardrailErr):
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeGuardrailViolation, guardrailErr.Error(), "", map[string]any{
+			"violations": guardrailErr.Violations,
+		})
+	case errors.Is(err, domain.ErrConflict):
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceConflict, "resource conflict", "", nil)
 	case errors.Is(err, domain.ErrAlreadyExists):
 		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceAlreadyExists, "resource already exists", "", nil)
+	case errors.As(err, &cycleErr):
+		respondStandardError(w, http.StatusBadRequest, domain.ErrCodeValidationError, cycleErr.Error(), "members", map[string]any{
+			"cycle": cycleErr.Cycle,
+		})
 	case errors.Is(err, domain.ErrInvalidInput):
 		respondStandardError(w, http.StatusBadRequest, domain.ErrCodeInvalidInput, "invalid input", "", nil)
 	case errors.Is(err, domain.ErrUnauthorized):
 		respondStandardError(w, http.StatusUnauthorized, domain.ErrCodeUnauthorized, "unauthorized", "", nil)
+	case errors.Is(err, domain.ErrForbidden):
+		respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden, "forbidden", "", nil)
+	case errors.As(err, &generationErr):
+		currentETag := StackETag(generationErr.StackID, generationErr.Generation)
+		w.Header().Set("ETag", currentETag)
+		respondStandardError(w, http.StatusPreconditionFailed, domain.ErrCodePreconditionFailed, "stack has been modified", "", map[string]any{
+			"stackId":     generationErr.StackID,
+			"generation":  generationErr.Generation,
+			"currentETag": currentETag,
+		})
 	case errors.Is(err, domain.ErrPreconditionFailed):
 		respondStandardError(w, http.StatusPreconditionFailed, domain.ErrCodePreconditionFailed, "precondition failed", "", nil)
 	case errors.Is(err, domain.ErrSyncInProgress):
@@ -147,6 +186,50 @@ func isDryRun(r *http.Request) bool {
 	return r.URL.Query().Get("dryRun") == "true"
 }
 
+// isPlan checks if the request has ?plan=true query parameter.
+func isPlan(r *http.Request) bool {
+	return r.URL.Query().Get("plan") == "true"
+}
+
+// runStackChange applies fn like audit.Run and bumps the generation of
+// change.StackID in the same transaction. A stack ETag in If-Match must name
+// the current generation, and the change must not violate guardrails on the
+// policy merged with strategies.
+func runStackChange(r *http.Request, store storage.Storage, strategies domain.MergeStrategies, change audit.Change, fn func(tx storage.Transaction) error) error {
+	ifGeneration := stackIfMatch(r, change.StackID, false)
+	return audit.Run(r.Context(), store, change, func(tx storage.Transaction) error {
+		if _, err := tx.IncrementStackGeneration(r.Context(), change.StackID, ifGeneration); err != nil {
+			return err
+		}
+		return guardrails.CheckWrite(r.Context(), tx, strategies, fn)
+	})
+}
+
+// runResourceChange applies a write to the resources of change.StackID
+// like runStackChange. Writes to stacks that require approvals are staged
+// as change sets instead, and reported as a *domain.ChangeStagedError.
+func runResourceChange(r *http.Request, store storage.Storage, strategies domain.MergeStrategies, change audit.Change, fn func(tx storage.Transaction) error) error {
+	stack, err := store.GetStack(r.Context(), change.StackID)
+	if err != nil {
+		return err
+	}
+	if !stack.RequiresApproval() {
+		return runStackChange(r, store, strategies, change, fn)
+	}
+	staged, err := changes.Stage(r.Context(), store, strategies, stack.ID, stackIfMatch(r, stack.ID, false), fn)
+	if err != nil {
+		return err
+	}
+	return &domain.ChangeStagedError{Change: staged}
+}
+
+// respondStaged answers a write that was staged as change with 202
+// Accepted.
+func respondStaged(w http.ResponseWriter, change *domain.ChangeSet, warnings ...string) {
+	w.Header().Set("Location", "/api/v1/changes/"+change.ID)
+	respondJSON(w, http.StatusAccepted, &domain.MutationResponse{Data: change, Warnings: warnings})
+}
+
 // respondDryRun writes a dry run response.
 func respondDryRun(w http.ResponseWriter, preview any) {
 	respondJSON(w, http.StatusOK, &domain.DryRunResponse{
@@ -159,7 +242,7 @@ func respondDryRun(w http.ResponseWriter, preview any) {
 }
 
 // respondMutation writes a mutation response, optionally waiting for sync.
-func respondMutation(w http.ResponseWriter, r *http.Request, status int, data any, syncService *service.SyncService) {
+func respondMutation(w http.ResponseWriter, r *http.Request, status int, data any, syncService *service.SyncService, warnings ...string) {
 	if shouldWaitForSync(r) {
 		syncResp, err := syncService.TriggerSyncAndWait(r.Context())
 		if err != nil {
@@ -169,13 +252,15 @@ func respondMutation(w http.ResponseWriter, r *http.Request, status int, data an
 		respondJSON(w, status, &domain.MutationResponse{
 			Data:       data,
 			SyncResult: syncResp,
+			Warnings:   warnings,
 		})
 		return
 	}
 
 	syncService.TriggerSync()
 	respondJSON(w, status, &domain.MutationResponse{
-		Data: data,
+		Data:     data,
+		Warnings: warnings,
 	})
 }
 
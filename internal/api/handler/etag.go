@@ -3,6 +3,8 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
@@ -39,6 +41,11 @@ func CheckIfMatch(r *http.Request, resourceType, id string, updatedAt time.Time)
 		return true
 	}
 
+	// Stack generation ETags are checked by runStackChange instead
+	if resourceType != "stack" && strings.HasPrefix(ifMatch, `"stack-`) {
+		return true
+	}
+
 	currentETag := GenerateETag(resourceType, id, updatedAt)
 	return ifMatch == currentETag
 }
@@ -116,10 +123,35 @@ func CheckSSHRuleIfMatch(r *http.Request, rule *domain.SSHRule) bool {
 }
 
 // Stack ETag helpers
+// Stack ETags carry the stack generation rather than the update time, so
+// they change whenever any resource of the stack changes.
+
+// StackETag returns the ETag for the current generation of a stack.
+func StackETag(stackID string, generation int64) string {
+	return fmt.Sprintf(`"stack-%s-%d"`, stackID, generation)
+}
+
 func SetStackETag(w http.ResponseWriter, stack *domain.Stack) {
-	SetETagHeader(w, "stack", stack.ID, stack.UpdatedAt)
+	w.Header().Set("ETag", StackETag(stack.ID, stack.Generation))
 }
 
-func CheckStackIfMatch(r *http.Request, stack *domain.Stack) bool {
-	return CheckIfMatch(r, "stack", stack.ID, stack.UpdatedAt)
+// stackIfMatch returns the generation named by a stack If-Match header.
+// It returns nil if the header is absent or names a per-resource ETag; when
+// required is set, any other value is treated as a mismatch.
+func stackIfMatch(r *http.Request, stackID string, required bool) *int64 {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || (!required && !strings.HasPrefix(ifMatch, `"stack-`)) {
+		return nil
+	}
+
+	prefix := `"stack-` + stackID + "-"
+	if strings.HasPrefix(ifMatch, prefix) && strings.HasSuffix(ifMatch, `"`) {
+		if generation, err := strconv.ParseInt(ifMatch[len(prefix):len(ifMatch)-1], 10, 64); err == nil {
+			return &generation
+		}
+	}
+
+	// Never matches, so the write fails with the current generation
+	mismatch := int64(-1)
+	return &mismatch
 }
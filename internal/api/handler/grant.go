@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -54,6 +55,14 @@ func (h *GrantHandler) Create(w http.ResponseWriter, r *http.Request) {
 			errs.Add(fmt.Sprintf("destinations[%d]", i), dst, err.Error())
 		}
 	}
+	for i, posture := range req.SrcPosture {
+		if err := validation.ValidatePostureName(posture); err != nil {
+			errs.Add(fmt.Sprintf("srcPosture[%d]", i), posture, err.Error())
+		}
+	}
+	if err := validation.ValidateExpiresAt(req.ExpiresAt, time.Now()); err != nil {
+		errs.Add("expiresAt", req.ExpiresAt.Format(time.RFC3339), err.Error())
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
@@ -67,12 +76,25 @@ func (h *GrantHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Sources:      req.Sources,
 		Destinations: req.Destinations,
 		IP:           req.IP,
+		SrcPosture:   req.SrcPosture,
 		App:          req.App,
+		Description:  req.Description,
+		ExpiresAt:    req.ExpiresAt,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
-	if err := h.store.CreateGrant(r.Context(), grant); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceGrant,
+		ResourceID:   grant.ID,
+		StackID:      stackID,
+		After:        grant,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateGrant(ctx, grant)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -111,6 +133,12 @@ func (h *GrantHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the grant belongs to the requested stack
+	if grant.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, grant)
 }
 
@@ -134,6 +162,14 @@ func (h *GrantHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the grant belongs to the requested stack
+	if grant.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	before := audit.Snapshot(grant)
+
 	if req.Order != nil {
 		grant.Order = *req.Order
 	}
@@ -155,6 +191,21 @@ func (h *GrantHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 		grant.Destinations = req.Destinations
 	}
+	if req.SrcPosture != nil {
+		for i, posture := range req.SrcPosture {
+			if err := validation.ValidatePostureName(posture); err != nil {
+				errs.Add(fmt.Sprintf("srcPosture[%d]", i), posture, err.Error())
+			}
+		}
+		grant.SrcPosture = req.SrcPosture
+	}
+	if req.ExpiresAt != nil {
+		expiresAt, err := validation.ParseExpiresAt(*req.ExpiresAt, time.Now())
+		if err != nil {
+			errs.Add("expiresAt", *req.ExpiresAt, err.Error())
+		}
+		grant.ExpiresAt = expiresAt
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
@@ -165,8 +216,22 @@ func (h *GrantHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.App != nil {
 		grant.App = req.App
 	}
+	if req.Description != nil {
+		grant.Description = *req.Description
+	}
 
-	if err := h.store.UpdateGrant(r.Context(), grant); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceGrant,
+		ResourceID:   grant.ID,
+		StackID:      grant.StackID,
+		Before:       before,
+		After:        grant,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateGrant(ctx, grant)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -182,7 +247,28 @@ func (h *GrantHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteGrant(r.Context(), id); err != nil {
+	// First verify the grant belongs to the requested stack
+	grant, err := h.store.GetGrant(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if grant.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceGrant,
+		ResourceID:   grant.ID,
+		StackID:      grant.StackID,
+		Before:       grant,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteGrant(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
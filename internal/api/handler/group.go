@@ -5,7 +5,10 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/nesting"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
@@ -61,19 +64,34 @@ func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
 			errs.Add("members["+string(rune('0'+i))+"]", member, err.Error())
 		}
 	}
+	validation.ValidateMemberExpiresAt(&errs, "memberExpiresAt", req.Members, req.MemberExpiresAt, time.Now())
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
 	}
 
+	// Reject nested groups that would contain themselves
+	if err := nesting.Check(r.Context(), h.store, stackID, req.Name, req.Members); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	now := time.Now()
 	group := &domain.Group{
-		ID:        generateID(),
-		StackID:   stackID,
-		Name:      req.Name,
-		Members:   req.Members,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:              generateID(),
+		StackID:         stackID,
+		Name:            req.Name,
+		Members:         req.Members,
+		MemberExpiresAt: req.MemberExpiresAt,
+		Description:     req.Description,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	// Reject names claimed by another stack
+	if err := claims.Check(r.Context(), h.store, stackID, domain.ClaimTypeGroup, req.Name); err != nil {
+		handleError(w, err)
+		return
 	}
 
 	// Handle dry run mode
@@ -82,7 +100,17 @@ func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.CreateGroup(r.Context(), group); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceGroup,
+		ResourceID:   group.ID,
+		StackID:      stackID,
+		After:        group,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateGroup(ctx, group)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -207,6 +235,8 @@ func (h *GroupHandler) updateGroup(w http.ResponseWriter, r *http.Request, group
 		return
 	}
 
+	before := audit.Snapshot(group)
+
 	// Validate members
 	var errs validation.ValidationErrors
 	for i, member := range req.Members {
@@ -214,12 +244,26 @@ func (h *GroupHandler) updateGroup(w http.ResponseWriter, r *http.Request, group
 			errs.Add("members["+string(rune('0'+i))+"]", member, err.Error())
 		}
 	}
+	expiresAt := req.MemberExpiresAt
+	if expiresAt != nil {
+		validation.ValidateMemberExpiresAt(&errs, "memberExpiresAt", req.Members, expiresAt, time.Now())
+	} else {
+		expiresAt = remainingMemberExpiry(group, req.Members)
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
 	}
+	if err := nesting.Check(r.Context(), h.store, group.StackID, group.Name, req.Members); err != nil {
+		handleError(w, err)
+		return
+	}
 
 	group.Members = req.Members
+	group.MemberExpiresAt = expiresAt
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
 
 	// Handle dry run mode
 	if isDryRun(r) {
@@ -227,7 +271,18 @@ func (h *GroupHandler) updateGroup(w http.ResponseWriter, r *http.Request, group
 		return
 	}
 
-	if err := h.store.UpdateGroup(r.Context(), group); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceGroup,
+		ResourceID:   group.ID,
+		StackID:      group.StackID,
+		Before:       before,
+		After:        group,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateGroup(ctx, group)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -244,12 +299,13 @@ func (h *GroupHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteGroup(r.Context(), stackID, name); err != nil {
+	group, err := h.store.GetGroup(r.Context(), stackID, name)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	h.respondAfterDelete(w, r)
+	h.deleteGroup(w, r, group)
 }
 
 // DeleteByID deletes a group by UUID.
@@ -272,7 +328,22 @@ func (h *GroupHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteGroupByID(r.Context(), id); err != nil {
+	h.deleteGroup(w, r, group)
+}
+
+// deleteGroup deletes a group and records it in the audit log.
+func (h *GroupHandler) deleteGroup(w http.ResponseWriter, r *http.Request, group *domain.Group) {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceGroup,
+		ResourceID:   group.ID,
+		StackID:      group.StackID,
+		Before:       group,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteGroupByID(ctx, group.ID)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -284,3 +355,18 @@ func (h *GroupHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 func (h *GroupHandler) respondAfterDelete(w http.ResponseWriter, r *http.Request) {
 	respondDelete(w, r, h.syncService)
 }
+
+// remainingMemberExpiry returns the expiry of the members of group that are
+// also in members, so updates that leave out memberExpiresAt keep it.
+func remainingMemberExpiry(group *domain.Group, members []string) map[string]time.Time {
+	var expiresAt map[string]time.Time
+	for _, m := range members {
+		if t, ok := group.MemberExpiresAt[m]; ok {
+			if expiresAt == nil {
+				expiresAt = make(map[string]time.Time)
+			}
+			expiresAt[m] = t
+		}
+	}
+	return expiresAt
+}
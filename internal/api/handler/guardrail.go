@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/service"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+	"github.com/go-chi/chi/v5"
+)
+
+// GuardrailHandler handles guardrail endpoints.
+// Guardrails do not change the rendered policy, so they never trigger a sync.
+type GuardrailHandler struct {
+	store       storage.Storage
+	syncService *service.SyncService
+}
+
+// NewGuardrailHandler creates a new GuardrailHandler.
+func NewGuardrailHandler(store storage.Storage, syncService *service.SyncService) *GuardrailHandler {
+	return &GuardrailHandler{store: store, syncService: syncService}
+}
+
+// Create creates a guardrail. Existing violations are not rejected, but
+// block syncs until they are fixed.
+func (h *GuardrailHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreateGuardrailRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if errs := validation.ValidateGuardrail(&req); errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	now := time.Now()
+	guardrail := &domain.Guardrail{
+		ID:          generateID(),
+		Name:        req.Name,
+		Description: req.Description,
+		Targets:     req.Targets,
+		Match:       req.Match,
+		Source:      domain.GuardrailSourceAPI,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceGuardrail,
+		ResourceID:   guardrail.ID,
+		After:        guardrail,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.CreateGuardrail(ctx, guardrail)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, &domain.MutationResponse{Data: guardrail})
+}
+
+// List lists guardrails by name.
+func (h *GuardrailHandler) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.store.ListGuardrails(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// Get returns a guardrail.
+func (h *GuardrailHandler) Get(w http.ResponseWriter, r *http.Request) {
+	guardrail, err := h.store.GetGuardrail(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, guardrail)
+}
+
+// Update updates a guardrail created through the API.
+func (h *GuardrailHandler) Update(w http.ResponseWriter, r *http.Request) {
+	guardrail, ok := h.editable(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.UpdateGuardrailRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	before := audit.Snapshot(guardrail)
+	updated := *guardrail
+	if req.Name != nil {
+		updated.Name = *req.Name
+	}
+	if req.Description != nil {
+		updated.Description = *req.Description
+	}
+	if req.Targets != nil {
+		updated.Targets = req.Targets
+	}
+	if req.Match != nil {
+		updated.Match = *req.Match
+	}
+	if errs := validation.ValidateGuardrail(&domain.CreateGuardrailRequest{
+		Name:    updated.Name,
+		Targets: updated.Targets,
+		Match:   updated.Match,
+	}); errs.HasErrors() {
+		respondValidationErrors(w, errs)
+		return
+	}
+	updated.UpdatedAt = time.Now()
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceGuardrail,
+		ResourceID:   updated.ID,
+		Before:       before,
+		After:        &updated,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.UpdateGuardrail(ctx, &updated)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, &domain.MutationResponse{Data: &updated})
+}
+
+// Delete deletes a guardrail created through the API.
+func (h *GuardrailHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	guardrail, ok := h.editable(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceGuardrail,
+		ResourceID:   guardrail.ID,
+		Before:       guardrail,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.DeleteGuardrail(ctx, guardrail.ID)
+	}); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Violations evaluates the guardrails against the current merged policy.
+// Scoped keys only see violations from their own stacks.
+func (h *GuardrailHandler) Violations(w http.ResponseWriter, r *http.Request) {
+	violations, err := guardrails.Check(r.Context(), h.store, h.syncService.MergeStrategies())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	visible := make([]domain.GuardrailViolation, 0, len(violations))
+	for _, v := range violations {
+		if canReadStack(r, v.StackID) {
+			visible = append(visible, v)
+		}
+	}
+	respondJSON(w, http.StatusOK, visible)
+}
+
+// editable loads the guardrail in the URL, refusing guardrails loaded from
+// configuration, which are replaced from the guardrails file at startup.
+func (h *GuardrailHandler) editable(w http.ResponseWriter, r *http.Request) (*domain.Guardrail, bool) {
+	guardrail, err := h.store.GetGuardrail(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		handleError(w, err)
+		return nil, false
+	}
+	if guardrail.Source == domain.GuardrailSourceConfig {
+		respondStandardError(w, http.StatusConflict, domain.ErrCodeResourceConflict,
+			fmt.Sprintf("guardrail %q is loaded from configuration; change the guardrails file instead", guardrail.Name), "", nil)
+		return nil, false
+	}
+	return guardrail, true
+}
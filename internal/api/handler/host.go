@@ -5,6 +5,8 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -59,17 +61,34 @@ func (h *HostHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject names claimed by another stack
+	if err := claims.Check(r.Context(), h.store, stackID, domain.ClaimTypeHost, req.Name); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	now := time.Now()
 	host := &domain.Host{
-		ID:        generateID(),
-		StackID:   stackID,
-		Name:      req.Name,
-		Address:   req.Address,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          generateID(),
+		StackID:     stackID,
+		Name:        req.Name,
+		Address:     req.Address,
+		Description: req.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
-	if err := h.store.CreateHost(r.Context(), host); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceHost,
+		ResourceID:   host.ID,
+		StackID:      stackID,
+		After:        host,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateHost(ctx, host)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -184,6 +203,8 @@ func (h *HostHandler) updateHost(w http.ResponseWriter, r *http.Request, host *d
 		return
 	}
 
+	before := audit.Snapshot(host)
+
 	// Validate address format
 	if err := validation.ValidateHostAddress(req.Address); err != nil {
 		respondValidationError(w, "address", req.Address, err.Error())
@@ -191,8 +212,22 @@ func (h *HostHandler) updateHost(w http.ResponseWriter, r *http.Request, host *d
 	}
 
 	host.Address = req.Address
+	if req.Description != nil {
+		host.Description = *req.Description
+	}
 
-	if err := h.store.UpdateHost(r.Context(), host); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceHost,
+		ResourceID:   host.ID,
+		StackID:      host.StackID,
+		Before:       before,
+		After:        host,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateHost(ctx, host)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -209,12 +244,13 @@ func (h *HostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteHost(r.Context(), stackID, name); err != nil {
+	host, err := h.store.GetHost(r.Context(), stackID, name)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	respondDelete(w, r, h.syncService)
+	h.deleteHost(w, r, host)
 }
 
 // DeleteByID deletes a host by UUID.
@@ -236,7 +272,22 @@ func (h *HostHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteHostByID(r.Context(), id); err != nil {
+	h.deleteHost(w, r, host)
+}
+
+// deleteHost deletes a host and records it in the audit log.
+func (h *HostHandler) deleteHost(w http.ResponseWriter, r *http.Request, host *domain.Host) {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceHost,
+		ResourceID:   host.ID,
+		StackID:      host.StackID,
+		Before:       host,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteHostByID(ctx, host.ID)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 )
@@ -42,6 +43,14 @@ func (h *ImportHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
+	// Stack lookups are by name and checked after resolving the stack
+	if resourceType != "stack" {
+		if key := middleware.GetAPIKeyFromContext(ctx); key == nil || !key.CanReadStack(stackID) {
+			handleError(w, domain.ErrForbidden)
+			return
+		}
+	}
+
 	// Verify stack exists
 	if _, err := h.store.GetStack(ctx, stackID); err != nil {
 		handleError(w, err)
@@ -249,6 +258,9 @@ func (h *ImportHandler) lookupStack(ctx context.Context, name string) (*ImportRe
 	if err != nil {
 		return nil, err
 	}
+	if key := middleware.GetAPIKeyFromContext(ctx); key == nil || !key.CanReadStack(stack.ID) {
+		return nil, domain.ErrForbidden
+	}
 	return &ImportResponse{
 		ID:       stack.ID,
 		Type:     "stack",
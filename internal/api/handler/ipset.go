@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -76,7 +77,17 @@ func (h *IPSetHandler) Create(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: now,
 	}
 
-	if err := h.store.CreateIPSet(r.Context(), ipset); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceIPSet,
+		ResourceID:   ipset.ID,
+		StackID:      stackID,
+		After:        ipset,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateIPSet(ctx, ipset)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -191,6 +202,8 @@ func (h *IPSetHandler) updateIPSet(w http.ResponseWriter, r *http.Request, ipset
 		return
 	}
 
+	before := audit.Snapshot(ipset)
+
 	// Validate addresses
 	var errs validation.ValidationErrors
 	for i, addr := range req.Addresses {
@@ -205,7 +218,18 @@ func (h *IPSetHandler) updateIPSet(w http.ResponseWriter, r *http.Request, ipset
 
 	ipset.Addresses = req.Addresses
 
-	if err := h.store.UpdateIPSet(r.Context(), ipset); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceIPSet,
+		ResourceID:   ipset.ID,
+		StackID:      ipset.StackID,
+		Before:       before,
+		After:        ipset,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateIPSet(ctx, ipset)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -222,12 +246,13 @@ func (h *IPSetHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteIPSet(r.Context(), stackID, name); err != nil {
+	ipset, err := h.store.GetIPSet(r.Context(), stackID, name)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	respondDelete(w, r, h.syncService)
+	h.deleteIPSet(w, r, ipset)
 }
 
 // DeleteByID deletes an IP set by UUID.
@@ -249,7 +274,22 @@ func (h *IPSetHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteIPSetByID(r.Context(), id); err != nil {
+	h.deleteIPSet(w, r, ipset)
+}
+
+// deleteIPSet deletes a IP set and records it in the audit log.
+func (h *IPSetHandler) deleteIPSet(w http.ResponseWriter, r *http.Request, ipset *domain.IPSet) {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceIPSet,
+		ResourceID:   ipset.ID,
+		StackID:      ipset.StackID,
+		Before:       ipset,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteIPSetByID(ctx, ipset.ID)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
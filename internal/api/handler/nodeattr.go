@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -71,7 +72,17 @@ func (h *NodeAttrHandler) Create(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: now,
 	}
 
-	if err := h.store.CreateNodeAttr(r.Context(), attr); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceNodeAttr,
+		ResourceID:   attr.ID,
+		StackID:      stackID,
+		After:        attr,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateNodeAttr(ctx, attr)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -110,6 +121,12 @@ func (h *NodeAttrHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the node attribute belongs to the requested stack
+	if attr.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, attr)
 }
 
@@ -133,6 +150,14 @@ func (h *NodeAttrHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the node attribute belongs to the requested stack
+	if attr.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	before := audit.Snapshot(attr)
+
 	if req.Order != nil {
 		attr.Order = *req.Order
 	}
@@ -157,7 +182,18 @@ func (h *NodeAttrHandler) Update(w http.ResponseWriter, r *http.Request) {
 		attr.App = req.App
 	}
 
-	if err := h.store.UpdateNodeAttr(r.Context(), attr); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceNodeAttr,
+		ResourceID:   attr.ID,
+		StackID:      attr.StackID,
+		Before:       before,
+		After:        attr,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateNodeAttr(ctx, attr)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -173,7 +209,28 @@ func (h *NodeAttrHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteNodeAttr(r.Context(), id); err != nil {
+	// First verify the node attribute belongs to the requested stack
+	attr, err := h.store.GetNodeAttr(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if attr.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceNodeAttr,
+		ResourceID:   attr.ID,
+		StackID:      attr.StackID,
+		Before:       attr,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteNodeAttr(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
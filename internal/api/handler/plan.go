@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
+	"github.com/bcnelson/tailscale-acl-manager/internal/policydiff"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+)
+
+// planStackState computes what replacing the state of stackID would change
+// without writing to store. The replacement is applied to an in-memory copy
+// of the other stacks, so the plan uses the same code path as the real write.
+// Both policies are merged with strategies.
+func planStackState(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, stackID string, state *domain.StackState) (*domain.StatePlan, error) {
+	before, err := stackstate.Load(ctx, store, stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := stackstate.Copy(ctx, store, stackID)
+	if err != nil {
+		return nil, err
+	}
+	if err := stackstate.Apply(ctx, scratch, stackID, state); err != nil {
+		return nil, err
+	}
+
+	// Reload so defaults and ordering match what the store would return
+	after, err := stackstate.Load(ctx, scratch, stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := merger.New(store, strategies).Merge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	planned, err := merger.New(scratch, strategies).Merge(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := policydiff.Diff(current, planned)
+	diff.From = "current"
+	diff.To = "planned"
+
+	plan := &domain.StatePlan{
+		StackID: stackID,
+		Changes: stackStateChanges(before, after),
+		Diff:    diff,
+	}
+	for _, c := range plan.Changes {
+		switch c.Action {
+		case domain.PlanCreate:
+			plan.Summary.Create++
+		case domain.PlanUpdate:
+			plan.Summary.Update++
+		case domain.PlanDelete:
+			plan.Summary.Delete++
+		default:
+			plan.Summary.Unchanged++
+		}
+	}
+
+	return plan, nil
+}
+
+// stackStateChanges compares two states of the same stack. Named resources
+// are matched by name, auto approvers by type and match, and rules by their
+// position in the stack.
+func stackStateChanges(before, after *domain.StackState) []domain.ResourceChange {
+	var changes []domain.ResourceChange
+
+	changes = append(changes, entryChanges("groups", before.Groups, after.Groups,
+		func(_ int, g domain.CreateGroupRequest) string { return g.Name })...)
+	changes = append(changes, entryChanges("tagOwners", before.TagOwners, after.TagOwners,
+		func(_ int, t domain.CreateTagOwnerRequest) string { return t.Tag })...)
+	changes = append(changes, entryChanges("hosts", before.Hosts, after.Hosts,
+		func(_ int, h domain.CreateHostRequest) string { return h.Name })...)
+	changes = append(changes, entryChanges("acls", before.ACLs, after.ACLs, positionKey[domain.CreateACLRuleRequest])...)
+	changes = append(changes, entryChanges("ssh", before.SSHRules, after.SSHRules, positionKey[domain.CreateSSHRuleRequest])...)
+	changes = append(changes, entryChanges("grants", before.Grants, after.Grants, positionKey[domain.CreateGrantRequest])...)
+	changes = append(changes, entryChanges("autoApprovers", before.AutoApprovers, after.AutoApprovers,
+		func(_ int, aa domain.CreateAutoApproverRequest) string { return aa.Type + ":" + aa.Match })...)
+	changes = append(changes, entryChanges("nodeAttrs", before.NodeAttrs, after.NodeAttrs, positionKey[domain.CreateNodeAttrRequest])...)
+	changes = append(changes, entryChanges("postures", before.Postures, after.Postures,
+		func(_ int, p domain.CreatePostureRequest) string { return p.Name })...)
+	changes = append(changes, entryChanges("ipsets", before.IPSets, after.IPSets,
+		func(_ int, is domain.CreateIPSetRequest) string { return is.Name })...)
+	changes = append(changes, entryChanges("tests", before.Tests, after.Tests, positionKey[domain.CreateACLTestRequest])...)
+
+	return changes
+}
+
+// positionKey keys a rule by its position in the stack.
+func positionKey[T any](i int, _ T) string {
+	return strconv.Itoa(i)
+}
+
+// entryChanges reports entries of after as created, updated, or unchanged,
+// followed by the entries of before that are missing from after.
+func entryChanges[T any](resource string, before, after []T, key func(int, T) string) []domain.ResourceChange {
+	prev := make(map[string]T, len(before))
+	for i, entry := range before {
+		prev[key(i, entry)] = entry
+	}
+
+	var changes []domain.ResourceChange
+	seen := make(map[string]bool, len(after))
+	for i, entry := range after {
+		k := key(i, entry)
+		seen[k] = true
+
+		old, ok := prev[k]
+		switch {
+		case !ok:
+			changes = append(changes, domain.ResourceChange{Resource: resource, Key: k, Action: domain.PlanCreate, After: entry})
+		case sameEntry(old, entry):
+			changes = append(changes, domain.ResourceChange{Resource: resource, Key: k, Action: domain.PlanUnchanged})
+		default:
+			changes = append(changes, domain.ResourceChange{Resource: resource, Key: k, Action: domain.PlanUpdate, Before: old, After: entry})
+		}
+	}
+
+	for i, entry := range before {
+		if k := key(i, entry); !seen[k] {
+			changes = append(changes, domain.ResourceChange{Resource: resource, Key: k, Action: domain.PlanDelete, Before: entry})
+		}
+	}
+
+	return changes
+}
+
+// sameEntry compares two entries by their JSON form, treating null and
+// empty lists or objects as equal.
+func sameEntry(a, b any) bool {
+	return reflect.DeepEqual(normalizedJSON(a), normalizedJSON(b))
+}
+
+// normalizedJSON round-trips v through JSON and drops empty values.
+func normalizedJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return dropEmpty(out)
+}
+
+// dropEmpty removes null, empty list, and empty object values from v.
+func dropEmpty(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			item = dropEmpty(item)
+			if item == nil {
+				delete(val, k)
+			} else {
+				val[k] = item
+			}
+		}
+		if len(val) == 0 {
+			return nil
+		}
+		return val
+	case []any:
+		if len(val) == 0 {
+			return nil
+		}
+		for i := range val {
+			val[i] = dropEmpty(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
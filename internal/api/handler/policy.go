@@ -1,12 +1,23 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
 	"net/http"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/evaluator"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/go-chi/chi/v5"
+	"github.com/tailscale/hujson"
 )
 
 // PolicyHandler handles policy endpoints.
@@ -21,7 +32,18 @@ func NewPolicyHandler(store storage.Storage, syncService *service.SyncService) *
 }
 
 // Get returns the current merged policy.
+// Pass ?explain=true to wrap it with the provenance of every entry.
 func (h *PolicyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("explain") == "true" {
+		explained, err := h.syncService.GetExplainedPolicy(r.Context())
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, explained)
+		return
+	}
+
 	policy, err := h.syncService.GetMergedPolicy(r.Context())
 	if err != nil {
 		handleError(w, err)
@@ -32,7 +54,20 @@ func (h *PolicyHandler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 // Preview returns a preview of the merged policy without pushing.
+// Pass ?format=hujson to get the commented policy file a sync would push.
 func (h *PolicyHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "hujson" {
+		document, err := h.syncService.RenderHuJSON(r.Context())
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/hujson")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(document)
+		return
+	}
+
 	policy, err := h.syncService.GetMergedPolicy(r.Context())
 	if err != nil {
 		handleError(w, err)
@@ -42,9 +77,113 @@ func (h *PolicyHandler) Preview(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, policy)
 }
 
+// Test runs the merged policy's ACL tests locally and reports the results.
+func (h *PolicyHandler) Test(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.syncService.GetMergedPolicy(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.syncService.RunPolicyTests(policy))
+}
+
+// Conflicts lists names defined differently by several stacks in sections
+// merged with the priority-override or error-on-conflict strategy, where the
+// lower-priority definitions are dropped.
+func (h *PolicyHandler) Conflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts, err := h.syncService.GetConflicts(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if conflicts == nil {
+		conflicts = []domain.MergeConflict{}
+	}
+
+	respondJSON(w, http.StatusOK, conflicts)
+}
+
+// Lint reports problems in the merged policy, most severe first: references
+// that Tailscale would reject on push, unused definitions, and redundant
+// rules. Scoped keys only see issues from their own stacks.
+func (h *PolicyHandler) Lint(w http.ResponseWriter, r *http.Request) {
+	issues, err := h.syncService.Lint(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	visible := make([]domain.LintIssue, 0, len(issues))
+	for _, issue := range issues {
+		if canReadStack(r, issue.StackID) {
+			visible = append(visible, issue)
+		}
+	}
+	respondJSON(w, http.StatusOK, visible)
+}
+
+// Query reports whether the merged policy allows a connection from src to
+// dst on the given port and protocol, and which rule and stack allow it.
+// The port is required unless proto is icmp; proto defaults to tcp.
+func (h *PolicyHandler) Query(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := evaluator.Request{
+		Src:   strings.TrimSpace(q.Get("src")),
+		Dst:   strings.TrimSpace(q.Get("dst")),
+		Proto: strings.ToLower(strings.TrimSpace(q.Get("proto"))),
+	}
+
+	var errs validation.ValidationErrors
+	if req.Src == "" {
+		errs = append(errs, &validation.ValidationError{Field: "src", Message: "src is required"})
+	}
+	if req.Dst == "" {
+		errs = append(errs, &validation.ValidationError{Field: "dst", Message: "dst is required"})
+	}
+	if !validQueryProto(req.Proto) {
+		errs = append(errs, &validation.ValidationError{Field: "proto", Value: req.Proto, Message: "proto must be tcp, udp, icmp, or an IANA protocol number"})
+	}
+	port := q.Get("port")
+	if port == "" {
+		if req.Proto != evaluator.ProtoICMP && req.Proto != "1" {
+			errs = append(errs, &validation.ValidationError{Field: "port", Message: "port is required"})
+		}
+	} else if parsed, err := strconv.Atoi(port); err != nil || parsed < 0 || parsed > 65535 {
+		errs = append(errs, &validation.ValidationError{Field: "port", Value: port, Message: "port must be between 0 and 65535"})
+	} else {
+		req.Port = parsed
+	}
+	if len(errs) > 0 {
+		respondValidationErrors(w, errs)
+		return
+	}
+
+	result, err := h.syncService.QueryAccess(r.Context(), req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// validQueryProto reports whether proto is empty, a known protocol name, or
+// an IANA protocol number.
+func validQueryProto(proto string) bool {
+	switch proto {
+	case "", evaluator.ProtoTCP, evaluator.ProtoUDP, evaluator.ProtoICMP:
+		return true
+	}
+	n, err := strconv.Atoi(proto)
+	return err == nil && n >= 0 && n <= 255
+}
+
 // Sync forces a sync to Tailscale.
+// Pass ?overwriteDrift=true to push even when the drift policy is refuse.
 func (h *PolicyHandler) Sync(w http.ResponseWriter, r *http.Request) {
-	resp, err := h.syncService.ForceSync(r.Context())
+	overwriteDrift := r.URL.Query().Get("overwriteDrift") == "true"
+	resp, err := h.syncService.ForceSync(r.Context(), overwriteDrift)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -78,6 +217,80 @@ func (h *PolicyHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, versions)
 }
 
+// Diff returns a structural diff between two policy versions.
+// The from query parameter is required; if to is omitted the current merged
+// policy is used instead.
+func (h *PolicyHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		respondValidationError(w, "from", "", "from is required")
+		return
+	}
+
+	diff, err := h.syncService.DiffVersions(r.Context(), from, r.URL.Query().Get("to"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, diff)
+}
+
+// DiffLive returns a structural diff from the live tailnet policy to the
+// current merged policy.
+func (h *PolicyHandler) DiffLive(w http.ResponseWriter, r *http.Request) {
+	diff, err := h.syncService.DiffLive(r.Context())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, diff)
+}
+
+// DriftStatus returns the result of the most recent drift check.
+// Pass ?refresh=true to check against the live policy now.
+func (h *PolicyHandler) DriftStatus(w http.ResponseWriter, r *http.Request) {
+	var status *domain.DriftStatus
+	var err error
+	if r.URL.Query().Get("refresh") == "true" {
+		status, err = h.syncService.CheckDrift(r.Context())
+	} else {
+		status, err = h.syncService.DriftStatus(r.Context())
+	}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// ListDriftEvents lists recorded drift events, newest first.
+func (h *PolicyHandler) ListDriftEvents(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	offset := 0
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	events, err := h.syncService.ListDriftEvents(r.Context(), limit, offset)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, events)
+}
+
 // Rollback rolls back to a previous policy version.
 func (h *PolicyHandler) Rollback(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -94,3 +307,48 @@ func (h *PolicyHandler) Rollback(w http.ResponseWriter, r *http.Request) {
 
 	respondJSON(w, http.StatusOK, resp)
 }
+
+// parsePolicyFile decodes a policy file in Tailscale's HuJSON format. Top-level
+// keys the manager does not handle, such as derpMap or randomizeClientPort,
+// are left out and returned as warnings; unknown keys within the sections it
+// handles are rejected rather than silently dropped.
+func parsePolicyFile(data []byte) (*domain.TailscalePolicy, []string, error) {
+	data, err := hujson.Standardize(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid policy file: %w", err)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil, nil, fmt.Errorf("invalid policy file: %w", err)
+	}
+	var warnings []string
+	for _, key := range slices.Sorted(maps.Keys(sections)) {
+		if !policySections[strings.ToLower(key)] {
+			warnings = append(warnings, fmt.Sprintf("ignored top-level key %q, which the manager does not handle", key))
+			delete(sections, key)
+		}
+	}
+	known, err := json.Marshal(sections)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(known))
+	dec.DisallowUnknownFields()
+	var policy domain.TailscalePolicy
+	if err := dec.Decode(&policy); err != nil {
+		return nil, nil, fmt.Errorf("invalid policy file: %w", err)
+	}
+	return &policy, warnings, nil
+}
+
+// policySections holds the lowercased top-level keys of TailscalePolicy.
+// Keys match case-insensitively, as they do when decoding.
+var policySections = func() map[string]bool {
+	sections := make(map[string]bool)
+	t := reflect.TypeFor[domain.TailscalePolicy]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		sections[strings.ToLower(name)] = true
+	}
+	return sections
+}()
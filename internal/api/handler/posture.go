@@ -5,9 +5,11 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -46,6 +48,11 @@ func (h *PostureHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validation.ValidatePostureName(req.Name); err != nil {
+		respondValidationError(w, "name", req.Name, err.Error())
+		return
+	}
+
 	now := time.Now()
 	posture := &domain.Posture{
 		ID:        generateID(),
@@ -56,7 +63,17 @@ func (h *PostureHandler) Create(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: now,
 	}
 
-	if err := h.store.CreatePosture(r.Context(), posture); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourcePosture,
+		ResourceID:   posture.ID,
+		StackID:      stackID,
+		After:        posture,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreatePosture(ctx, posture)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -171,9 +188,22 @@ func (h *PostureHandler) updatePosture(w http.ResponseWriter, r *http.Request, p
 		return
 	}
 
+	before := audit.Snapshot(posture)
+
 	posture.Rules = req.Rules
 
-	if err := h.store.UpdatePosture(r.Context(), posture); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourcePosture,
+		ResourceID:   posture.ID,
+		StackID:      posture.StackID,
+		Before:       before,
+		After:        posture,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdatePosture(ctx, posture)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -190,12 +220,13 @@ func (h *PostureHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeletePosture(r.Context(), stackID, name); err != nil {
+	posture, err := h.store.GetPosture(r.Context(), stackID, name)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	respondDelete(w, r, h.syncService)
+	h.deletePosture(w, r, posture)
 }
 
 // DeleteByID deletes a posture by UUID.
@@ -217,7 +248,22 @@ func (h *PostureHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeletePostureByID(r.Context(), id); err != nil {
+	h.deletePosture(w, r, posture)
+}
+
+// deletePosture deletes a posture and records it in the audit log.
+func (h *PostureHandler) deletePosture(w http.ResponseWriter, r *http.Request, posture *domain.Posture) {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourcePosture,
+		ResourceID:   posture.ID,
+		StackID:      posture.StackID,
+		Before:       posture,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeletePostureByID(ctx, posture.ID)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -47,8 +48,11 @@ func (h *SSHHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate sources, destinations, and users
+	// Validate action, sources, destinations, and users
 	var errs validation.ValidationErrors
+	if err := validation.ValidateSSHAction(req.Action); err != nil {
+		errs.Add("action", req.Action, err.Error())
+	}
 	for i, src := range req.Sources {
 		if err := validation.ValidateACLSource(src); err != nil {
 			errs.Add(fmt.Sprintf("sources[%d]", i), src, err.Error())
@@ -64,6 +68,9 @@ func (h *SSHHandler) Create(w http.ResponseWriter, r *http.Request) {
 			errs.Add(fmt.Sprintf("users[%d]", i), user, err.Error())
 		}
 	}
+	if err := validation.ValidateExpiresAt(req.ExpiresAt, time.Now()); err != nil {
+		errs.Add("expiresAt", req.ExpiresAt.Format(time.RFC3339), err.Error())
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
@@ -79,11 +86,23 @@ func (h *SSHHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Destinations: req.Destinations,
 		Users:        req.Users,
 		CheckPeriod:  req.CheckPeriod,
+		Description:  req.Description,
+		ExpiresAt:    req.ExpiresAt,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
-	if err := h.store.CreateSSHRule(r.Context(), rule); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceSSH,
+		ResourceID:   rule.ID,
+		StackID:      stackID,
+		After:        rule,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateSSHRule(ctx, rule)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -122,6 +141,12 @@ func (h *SSHHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the rule belongs to the requested stack
+	if rule.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, rule)
 }
 
@@ -145,14 +170,25 @@ func (h *SSHHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Verify the rule belongs to the requested stack
+	if rule.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	before := audit.Snapshot(rule)
+
 	if req.Order != nil {
 		rule.Order = *req.Order
 	}
+	// Validate action, sources, destinations, and users if provided
+	var errs validation.ValidationErrors
 	if req.Action != nil {
+		if err := validation.ValidateSSHAction(*req.Action); err != nil {
+			errs.Add("action", *req.Action, err.Error())
+		}
 		rule.Action = *req.Action
 	}
-	// Validate sources, destinations, and users if provided
-	var errs validation.ValidationErrors
 	if req.Sources != nil {
 		for i, src := range req.Sources {
 			if err := validation.ValidateACLSource(src); err != nil {
@@ -177,6 +213,13 @@ func (h *SSHHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 		rule.Users = req.Users
 	}
+	if req.ExpiresAt != nil {
+		expiresAt, err := validation.ParseExpiresAt(*req.ExpiresAt, time.Now())
+		if err != nil {
+			errs.Add("expiresAt", *req.ExpiresAt, err.Error())
+		}
+		rule.ExpiresAt = expiresAt
+	}
 	if errs.HasErrors() {
 		respondValidationErrors(w, errs)
 		return
@@ -184,8 +227,22 @@ func (h *SSHHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.CheckPeriod != nil {
 		rule.CheckPeriod = *req.CheckPeriod
 	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
 
-	if err := h.store.UpdateSSHRule(r.Context(), rule); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceSSH,
+		ResourceID:   rule.ID,
+		StackID:      rule.StackID,
+		Before:       before,
+		After:        rule,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateSSHRule(ctx, rule)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -201,7 +258,28 @@ func (h *SSHHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteSSHRule(r.Context(), id); err != nil {
+	// First verify the rule belongs to the requested stack
+	rule, err := h.store.GetSSHRule(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if rule.StackID != chi.URLParam(r, "stack_id") {
+		handleError(w, domain.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceSSH,
+		ResourceID:   rule.ID,
+		StackID:      rule.StackID,
+		Before:       rule,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteSSHRule(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
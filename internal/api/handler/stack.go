@@ -1,12 +1,23 @@
 package handler
 
 import (
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/changes"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/nesting"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -33,22 +44,38 @@ func (h *StackHandler) Create(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if req.RequiredApprovals < 0 {
+		respondValidationError(w, "requiredApprovals", "", "requiredApprovals must not be negative")
+		return
+	}
 
 	now := time.Now()
 	stack := &domain.Stack{
-		ID:          generateID(),
-		Name:        req.Name,
-		Description: req.Description,
-		Priority:    req.Priority,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:                generateID(),
+		Name:              req.Name,
+		Description:       req.Description,
+		Priority:          req.Priority,
+		RequiredApprovals: req.RequiredApprovals,
+		Disabled:          req.Disabled,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
 	if stack.Priority == 0 {
 		stack.Priority = 100 // Default priority
 	}
 
-	if err := h.store.CreateStack(r.Context(), stack); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		After:        stack,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.CreateStack(ctx, stack)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -64,6 +91,17 @@ func (h *StackHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Scoped keys only see their own stacks
+	if key := middleware.GetAPIKeyFromContext(r.Context()); key != nil && key.IsScoped() {
+		visible := make([]*domain.Stack, 0, len(key.StackIDs))
+		for _, stack := range stacks {
+			if key.CanReadStack(stack.ID) {
+				visible = append(visible, stack)
+			}
+		}
+		stacks = visible
+	}
+
 	respondJSON(w, http.StatusOK, stacks)
 }
 
@@ -81,6 +119,7 @@ func (h *StackHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	SetStackETag(w, stack)
 	respondJSON(w, http.StatusOK, stack)
 }
 
@@ -104,6 +143,9 @@ func (h *StackHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := audit.Snapshot(stack)
+	gated := stack.RequiresApproval()
+
 	if req.Name != nil {
 		stack.Name = *req.Name
 	}
@@ -113,13 +155,47 @@ func (h *StackHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.Priority != nil {
 		stack.Priority = *req.Priority
 	}
+	if req.RequiredApprovals != nil {
+		if *req.RequiredApprovals < 0 {
+			respondValidationError(w, "requiredApprovals", "", "requiredApprovals must not be negative")
+			return
+		}
+		// Lowering the bar would let writers skip the approvals it exists for
+		if *req.RequiredApprovals < stack.RequiredApprovals && !hasRole(r, domain.RolePolicyAdmin) {
+			respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden,
+				"lowering requiredApprovals requires the "+domain.RolePolicyAdmin+" role", "requiredApprovals", nil)
+			return
+		}
+		stack.RequiredApprovals = *req.RequiredApprovals
+	}
+	if req.Disabled != nil {
+		// Enabling or disabling changes the policy without a change set
+		if *req.Disabled != stack.Disabled && gated && !hasRole(r, domain.RolePolicyAdmin) {
+			respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden,
+				"enabling or disabling a stack that requires approvals requires the "+domain.RolePolicyAdmin+" role", "disabled", nil)
+			return
+		}
+		stack.Disabled = *req.Disabled
+	}
 
-	if err := h.store.UpdateStack(r.Context(), stack); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		Before:       before,
+		After:        stack,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.UpdateStack(ctx, stack)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	// Priority changes affect merge order, trigger sync
+	// Priority changes affect merge order, and disabling a stack removes its
+	// resources from the policy, trigger sync
 	respondMutation(w, r, http.StatusOK, stack, h.syncService)
 }
 
@@ -131,38 +207,47 @@ func (h *StackHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteStack(r.Context(), id); err != nil {
+	stack, err := h.store.GetStack(r.Context(), id)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
-
-	respondDelete(w, r, h.syncService)
-}
-
-// ReplaceState replaces all resources for a stack with the provided state.
-func (h *StackHandler) ReplaceState(w http.ResponseWriter, r *http.Request) {
-	stackID := chi.URLParam(r, "stack_id")
-	if stackID == "" {
-		respondError(w, http.StatusBadRequest, "stack_id is required")
+	if stack.RequiresApproval() && !hasRole(r, domain.RolePolicyAdmin) {
+		respondStandardError(w, http.StatusForbidden, domain.ErrCodeForbidden,
+			"deleting a stack that requires approvals requires the "+domain.RolePolicyAdmin+" role", "", nil)
 		return
 	}
 
-	// Verify stack exists
-	_, err := h.store.GetStack(r.Context(), stackID)
-	if err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		Before:       stack,
+	}
+	if err := audit.Run(ctx, h.store, change, func(tx storage.Transaction) error {
+		return tx.DeleteStack(ctx, id)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	var state domain.StackState
-	if err := decodeJSON(r, &state); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid request body")
+	respondDelete(w, r, h.syncService)
+}
+
+// GetState returns all resources of a stack in the form accepted by
+// ReplaceState, with the stack's generation ETag.
+func (h *StackHandler) GetState(w http.ResponseWriter, r *http.Request) {
+	stackID := chi.URLParam(r, "stack_id")
+	if stackID == "" {
+		respondError(w, http.StatusBadRequest, "stack_id is required")
 		return
 	}
 
 	ctx := r.Context()
 
-	// Start a transaction
+	// Read the stack and its resources from one snapshot so the ETag matches
 	tx, err := h.store.BeginTx(ctx)
 	if err != nil {
 		handleError(w, err)
@@ -170,254 +255,175 @@ func (h *StackHandler) ReplaceState(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Delete all existing resources for this stack
-	if err := tx.DeleteAllGroupsForStack(ctx, stackID); err != nil {
-		handleError(w, err)
-		return
-	}
-	if err := tx.DeleteAllTagOwnersForStack(ctx, stackID); err != nil {
-		handleError(w, err)
-		return
-	}
-	if err := tx.DeleteAllHostsForStack(ctx, stackID); err != nil {
-		handleError(w, err)
-		return
-	}
-	if err := tx.DeleteAllACLRulesForStack(ctx, stackID); err != nil {
-		handleError(w, err)
-		return
-	}
-	if err := tx.DeleteAllSSHRulesForStack(ctx, stackID); err != nil {
+	stack, err := tx.GetStack(ctx, stackID)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
-	if err := tx.DeleteAllGrantsForStack(ctx, stackID); err != nil {
+
+	state, err := stackstate.Load(ctx, tx, stackID)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
-	if err := tx.DeleteAllAutoApproversForStack(ctx, stackID); err != nil {
-		handleError(w, err)
+
+	SetStackETag(w, stack)
+	respondJSON(w, http.StatusOK, state)
+}
+
+// ReplaceState replaces all resources for a stack with the provided state.
+// If-Match, when present, must carry the stack's current generation ETag.
+// With ?plan=true it returns the per-resource change set and merged policy
+// diff instead of writing. With ?format=hujson or an application/hujson
+// body the state is read as a policy fragment in Tailscale's own format.
+func (h *StackHandler) ReplaceState(w http.ResponseWriter, r *http.Request) {
+	stackID := chi.URLParam(r, "stack_id")
+	if stackID == "" {
+		respondError(w, http.StatusBadRequest, "stack_id is required")
 		return
 	}
-	if err := tx.DeleteAllNodeAttrsForStack(ctx, stackID); err != nil {
+
+	// Verify stack exists
+	stack, err := h.store.GetStack(r.Context(), stackID)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
-	if err := tx.DeleteAllPosturesForStack(ctx, stackID); err != nil {
-		handleError(w, err)
+
+	state, warnings, err := decodeStackState(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if err := tx.DeleteAllIPSetsForStack(ctx, stackID); err != nil {
-		handleError(w, err)
+
+	// Validate the whole payload before anything is deleted
+	if errs := validation.ValidateStackState(state); errs.HasErrors() {
+		respondValidationErrors(w, errs)
 		return
 	}
-	if err := tx.DeleteAllACLTestsForStack(ctx, stackID); err != nil {
+
+	ctx := r.Context()
+	if err := nesting.CheckState(ctx, h.store, stackID, state); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	now := time.Now()
-
-	// Create new resources
-	for _, g := range state.Groups {
-		group := &domain.Group{
-			ID:        generateID(),
-			StackID:   stackID,
-			Name:      g.Name,
-			Members:   g.Members,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if err := tx.CreateGroup(ctx, group); err != nil {
+	// Plan mode reports what would change without writing anything
+	if isPlan(r) {
+		if err := claims.CheckState(ctx, h.store, stackID, state); err != nil {
 			handleError(w, err)
 			return
 		}
-	}
-
-	for _, t := range state.TagOwners {
-		tagOwner := &domain.TagOwner{
-			ID:        generateID(),
-			StackID:   stackID,
-			Tag:       t.Tag,
-			Owners:    t.Owners,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if err := tx.CreateTagOwner(ctx, tagOwner); err != nil {
+		plan, err := planStackState(ctx, h.store, h.syncService.MergeStrategies(), stackID, state)
+		if err != nil {
 			handleError(w, err)
 			return
 		}
+		plan.Warnings = warnings
+		respondJSON(w, http.StatusOK, plan)
+		return
 	}
 
-	for _, h := range state.Hosts {
-		host := &domain.Host{
-			ID:        generateID(),
-			StackID:   stackID,
-			Name:      h.Name,
-			Address:   h.Address,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if err := tx.CreateHost(ctx, host); err != nil {
+	// Stacks that require approvals get the state as a change set
+	if stack.RequiresApproval() {
+		change, err := changes.StageState(ctx, h.store, h.syncService.MergeStrategies(), stackID, stackIfMatch(r, stackID, true), state)
+		if err != nil {
 			handleError(w, err)
 			return
 		}
+		respondStaged(w, change, warnings...)
+		return
 	}
 
-	for i, a := range state.ACLs {
-		rule := &domain.ACLRule{
-			ID:           generateID(),
-			StackID:      stackID,
-			Order:        i,
-			Action:       a.Action,
-			Protocol:     a.Protocol,
-			Sources:      a.Sources,
-			Destinations: a.Destinations,
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		}
-		if a.Order != 0 {
-			rule.Order = a.Order
-		}
-		if err := tx.CreateACLRule(ctx, rule); err != nil {
-			handleError(w, err)
-			return
-		}
+	// Start a transaction
+	tx, err := h.store.BeginTx(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	for i, s := range state.SSHRules {
-		rule := &domain.SSHRule{
-			ID:           generateID(),
-			StackID:      stackID,
-			Order:        i,
-			Action:       s.Action,
-			Sources:      s.Sources,
-			Destinations: s.Destinations,
-			Users:        s.Users,
-			CheckPeriod:  s.CheckPeriod,
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		}
-		if s.Order != 0 {
-			rule.Order = s.Order
-		}
-		if err := tx.CreateSSHRule(ctx, rule); err != nil {
-			handleError(w, err)
-			return
-		}
+	// Capture the previous state for the audit log
+	before, err := stackstate.Load(ctx, tx, stackID)
+	if err != nil {
+		handleError(w, err)
+		return
 	}
 
-	for i, g := range state.Grants {
-		grant := &domain.Grant{
-			ID:           generateID(),
-			StackID:      stackID,
-			Order:        i,
-			Sources:      g.Sources,
-			Destinations: g.Destinations,
-			IP:           g.IP,
-			App:          g.App,
-			CreatedAt:    now,
-			UpdatedAt:    now,
-		}
-		if g.Order != 0 {
-			grant.Order = g.Order
-		}
-		if err := tx.CreateGrant(ctx, grant); err != nil {
-			handleError(w, err)
-			return
-		}
+	// Reject names claimed by another stack before touching anything
+	if err := claims.CheckState(ctx, tx, stackID, state); err != nil {
+		handleError(w, err)
+		return
 	}
 
-	for _, aa := range state.AutoApprovers {
-		autoApprover := &domain.AutoApprover{
-			ID:        generateID(),
-			StackID:   stackID,
-			Type:      aa.Type,
-			Match:     aa.Match,
-			Approvers: aa.Approvers,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if err := tx.CreateAutoApprover(ctx, autoApprover); err != nil {
-			handleError(w, err)
-			return
-		}
+	// Any If-Match must name the current generation, so concurrent
+	// replacements cannot silently overwrite each other
+	generation, err := tx.IncrementStackGeneration(ctx, stackID, stackIfMatch(r, stackID, true))
+	if err != nil {
+		handleError(w, err)
+		return
 	}
 
-	for i, na := range state.NodeAttrs {
-		nodeAttr := &domain.NodeAttr{
-			ID:        generateID(),
-			StackID:   stackID,
-			Order:     i,
-			Target:    na.Target,
-			Attr:      na.Attr,
-			App:       na.App,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if na.Order != 0 {
-			nodeAttr.Order = na.Order
-		}
-		if err := tx.CreateNodeAttr(ctx, nodeAttr); err != nil {
-			handleError(w, err)
-			return
+	// Replace all existing resources of this stack, unless that violates
+	// guardrails
+	if err := guardrails.CheckWrite(ctx, tx, h.syncService.MergeStrategies(), func(tx storage.Transaction) error {
+		if err := stackstate.Clear(ctx, tx, stackID); err != nil {
+			return err
 		}
+		return stackstate.Apply(ctx, tx, stackID, state)
+	}); err != nil {
+		handleError(w, err)
+		return
 	}
 
-	for _, p := range state.Postures {
-		posture := &domain.Posture{
-			ID:        generateID(),
-			StackID:   stackID,
-			Name:      p.Name,
-			Rules:     p.Rules,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if err := tx.CreatePosture(ctx, posture); err != nil {
-			handleError(w, err)
-			return
-		}
+	if err := audit.Record(ctx, tx, audit.Change{
+		Action:       domain.AuditActionReplace,
+		ResourceType: domain.AuditResourceStackState,
+		ResourceID:   stackID,
+		StackID:      stackID,
+		Before:       before,
+		After:        state,
+	}); err != nil {
+		handleError(w, err)
+		return
 	}
 
-	for _, is := range state.IPSets {
-		ipset := &domain.IPSet{
-			ID:        generateID(),
-			StackID:   stackID,
-			Name:      is.Name,
-			Addresses: is.Addresses,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if err := tx.CreateIPSet(ctx, ipset); err != nil {
-			handleError(w, err)
-			return
-		}
+	if err := tx.Commit(); err != nil {
+		handleError(w, err)
+		return
 	}
 
-	for i, t := range state.Tests {
-		test := &domain.ACLTest{
-			ID:        generateID(),
-			StackID:   stackID,
-			Order:     i,
-			Source:    t.Source,
-			Accept:    t.Accept,
-			Deny:      t.Deny,
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		if t.Order != 0 {
-			test.Order = t.Order
-		}
-		if err := tx.CreateACLTest(ctx, test); err != nil {
-			handleError(w, err)
-			return
+	w.Header().Set("ETag", StackETag(stackID, generation))
+	respondMutation(w, r, http.StatusOK, map[string]string{"status": "ok"}, h.syncService, warnings...)
+}
+
+// decodeStackState reads the state of a ReplaceState request. Policy
+// fragments may contain comments and trailing commas; any section of a
+// Tailscale policy file is accepted, and the warnings name the top-level
+// keys that were ignored.
+func decodeStackState(r *http.Request) (*domain.StackState, []string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.URL.Query().Get("format") != "hujson" && mediaType != "application/hujson" {
+		var state domain.StackState
+		if err := decodeJSON(r, &state); err != nil {
+			return nil, nil, errors.New("invalid request body")
 		}
+		return &state, nil, nil
 	}
 
-	if err := tx.Commit(); err != nil {
-		handleError(w, err)
-		return
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, errors.New("invalid request body")
+	}
+	policy, warnings, err := parsePolicyFile(data)
+	if err != nil {
+		return nil, nil, err
 	}
+	return stackstate.FromPolicy(policy), warnings, nil
+}
 
-	respondMutation(w, r, http.StatusOK, map[string]string{"status": "ok"}, h.syncService)
+// hasRole reports whether the request's API key has role.
+func hasRole(r *http.Request, role string) bool {
+	key := middleware.GetAPIKeyFromContext(r.Context())
+	return key != nil && key.HasRole(role)
 }
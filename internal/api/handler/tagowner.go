@@ -5,6 +5,8 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -67,12 +69,19 @@ func (h *TagOwnerHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now()
 	tagOwner := &domain.TagOwner{
-		ID:        generateID(),
-		StackID:   stackID,
-		Tag:       req.Tag,
-		Owners:    req.Owners,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          generateID(),
+		StackID:     stackID,
+		Tag:         req.Tag,
+		Owners:      req.Owners,
+		Description: req.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	// Reject names claimed by another stack
+	if err := claims.Check(r.Context(), h.store, stackID, domain.ClaimTypeTag, req.Tag); err != nil {
+		handleError(w, err)
+		return
 	}
 
 	// Handle dry run mode
@@ -81,7 +90,17 @@ func (h *TagOwnerHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.CreateTagOwner(r.Context(), tagOwner); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceTagOwner,
+		ResourceID:   tagOwner.ID,
+		StackID:      stackID,
+		After:        tagOwner,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.CreateTagOwner(ctx, tagOwner)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -198,6 +217,8 @@ func (h *TagOwnerHandler) updateTagOwner(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	before := audit.Snapshot(tagOwner)
+
 	// Validate owners
 	var errs validation.ValidationErrors
 	for i, owner := range req.Owners {
@@ -211,6 +232,9 @@ func (h *TagOwnerHandler) updateTagOwner(w http.ResponseWriter, r *http.Request,
 	}
 
 	tagOwner.Owners = req.Owners
+	if req.Description != nil {
+		tagOwner.Description = *req.Description
+	}
 
 	// Handle dry run mode
 	if isDryRun(r) {
@@ -218,7 +242,18 @@ func (h *TagOwnerHandler) updateTagOwner(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	if err := h.store.UpdateTagOwner(r.Context(), tagOwner); err != nil {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceTagOwner,
+		ResourceID:   tagOwner.ID,
+		StackID:      tagOwner.StackID,
+		Before:       before,
+		After:        tagOwner,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.UpdateTagOwner(ctx, tagOwner)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
@@ -235,12 +270,13 @@ func (h *TagOwnerHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteTagOwner(r.Context(), stackID, tag); err != nil {
+	tagOwner, err := h.store.GetTagOwner(r.Context(), stackID, tag)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	h.respondAfterDelete(w, r)
+	h.deleteTagOwner(w, r, tagOwner)
 }
 
 // DeleteByID deletes a tag owner by UUID.
@@ -263,7 +299,22 @@ func (h *TagOwnerHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteTagOwnerByID(r.Context(), id); err != nil {
+	h.deleteTagOwner(w, r, tagOwner)
+}
+
+// deleteTagOwner deletes a tag owner and records it in the audit log.
+func (h *TagOwnerHandler) deleteTagOwner(w http.ResponseWriter, r *http.Request, tagOwner *domain.TagOwner) {
+	ctx := r.Context()
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceTagOwner,
+		ResourceID:   tagOwner.ID,
+		StackID:      tagOwner.StackID,
+		Before:       tagOwner,
+	}
+	if err := runResourceChange(r, h.store, h.syncService.MergeStrategies(), change, func(tx storage.Transaction) error {
+		return tx.DeleteTagOwnerByID(ctx, tagOwner.ID)
+	}); err != nil {
 		handleError(w, err)
 		return
 	}
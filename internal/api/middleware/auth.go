@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 )
@@ -76,10 +77,13 @@ func Auth(store storage.Storage, bootstrapKey string) func(http.Handler) http.Ha
 			if keyCount == 0 && bootstrapKey != "" {
 				if subtle.ConstantTimeCompare([]byte(apiKey), []byte(bootstrapKey)) == 1 {
 					// Bootstrap key is valid, allow request
-					ctx = context.WithValue(ctx, APIKeyContextKey, &domain.APIKey{
-						ID:   "bootstrap",
-						Name: "Bootstrap Key",
-					})
+					key := &domain.APIKey{
+						ID:    "bootstrap",
+						Name:  "Bootstrap Key",
+						Roles: domain.AllRoles,
+					}
+					ctx = context.WithValue(ctx, APIKeyContextKey, key)
+					ctx = audit.WithActor(ctx, audit.ActorFromAPIKey(key))
 					next.ServeHTTP(w, r.WithContext(ctx))
 					return
 				}
@@ -104,6 +108,7 @@ func Auth(store storage.Storage, bootstrapKey string) func(http.Handler) http.Ha
 
 			// Store the API key in context
 			ctx = context.WithValue(ctx, APIKeyContextKey, storedKey)
+			ctx = audit.WithActor(ctx, audit.ActorFromAPIKey(storedKey))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+// respondForbidden writes a standardized forbidden error response.
+func respondForbidden(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(&domain.StandardErrorResponse{
+		Error: domain.StandardError{
+			Code:    domain.ErrCodeForbidden,
+			Message: message,
+		},
+	})
+}
+
+// isReadMethod returns true for methods that do not mutate state.
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// RequireRole creates middleware that rejects API keys without the given role.
+// Must be mounted after Auth.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := GetAPIKeyFromContext(r.Context())
+			if key == nil || !key.HasRole(role) {
+				respondForbidden(w, "API key requires the "+role+" role")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUnscoped creates middleware that rejects API keys bound to specific stacks.
+// Used for operations that are not tied to a single stack, such as creating stacks.
+func RequireUnscoped(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := GetAPIKeyFromContext(r.Context())
+		if key == nil || key.IsScoped() {
+			respondForbidden(w, "API key is scoped to specific stacks")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// StackAccess enforces the API key's stack scope on routes with a {stack_id} parameter.
+// Read requests need any role on the stack; mutations need the stack-writer role.
+func StackAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := GetAPIKeyFromContext(r.Context())
+		stackID := chi.URLParam(r, "stack_id")
+		if key == nil || !key.CanReadStack(stackID) {
+			respondForbidden(w, "API key does not have access to this stack")
+			return
+		}
+		if !isReadMethod(r.Method) && !key.CanWriteStack(stackID) {
+			respondForbidden(w, "API key requires the "+domain.RoleStackWriter+" role")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
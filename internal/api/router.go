@@ -6,6 +6,7 @@ import (
 	"github.com/bcnelson/tailscale-acl-manager/internal/api/handler"
 	"github.com/bcnelson/tailscale-acl-manager/internal/api/middleware"
 	"github.com/bcnelson/tailscale-acl-manager/internal/config"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/service"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 	"github.com/bcnelson/tailscale-acl-manager/internal/web"
@@ -49,23 +50,33 @@ func NewRouter(
 
 		// API Keys
 		keyHandler := handler.NewAPIKeyHandler(store)
-		r.Post("/keys", keyHandler.Create)
-		r.Get("/keys", keyHandler.List)
-		r.Delete("/keys/{id}", keyHandler.Delete)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(domain.RoleKeyAdmin))
+			r.Post("/keys", keyHandler.Create)
+			r.Get("/keys", keyHandler.List)
+			r.Delete("/keys/{id}", keyHandler.Delete)
+		})
+
+		accessHandler := handler.NewAccessHandler(store, syncService)
+		changeHandler := handler.NewChangeHandler(store, syncService)
 
 		// Stacks
 		stackHandler := handler.NewStackHandler(store, syncService)
-		r.Post("/stacks", stackHandler.Create)
+		r.With(middleware.RequireRole(domain.RoleStackWriter), middleware.RequireUnscoped).
+			Post("/stacks", stackHandler.Create)
 		r.Get("/stacks", stackHandler.List)
 
 		// Stack-level routes and nested resources
 		r.Route("/stacks/{stack_id}", func(r chi.Router) {
+			r.Use(middleware.StackAccess)
+
 			// Stack CRUD (using stack_id parameter)
 			r.Get("/", stackHandler.Get)
 			r.Put("/", stackHandler.Update)
 			r.Delete("/", stackHandler.Delete)
 
 			// Bulk state management
+			r.Get("/state", stackHandler.GetState)
 			r.Put("/state", stackHandler.ReplaceState)
 			// Groups
 			groupHandler := handler.NewGroupHandler(store, syncService)
@@ -169,15 +180,68 @@ func NewRouter(
 			r.Get("/tests/{id}", testHandler.Get)
 			r.Put("/tests/{id}", testHandler.Update)
 			r.Delete("/tests/{id}", testHandler.Delete)
+
+			// Ownership claims
+			claimHandler := handler.NewClaimHandler(store, syncService)
+			r.Post("/claims", claimHandler.Create)
+			r.Get("/claims", claimHandler.List)
+			r.Delete("/claims/{id}", claimHandler.Delete)
+
+			// Access request approvers
+			r.Post("/approvers", accessHandler.CreateApprover)
+			r.Get("/approvers", accessHandler.ListApprovers)
+			r.Delete("/approvers/{id}", accessHandler.DeleteApprover)
 		})
 
+		// Just-in-time access requests; approvers are checked per request
+		r.Post("/access-requests", accessHandler.CreateRequest)
+		r.Get("/access-requests", accessHandler.ListRequests)
+		r.Get("/access-requests/{id}", accessHandler.GetRequest)
+		r.Post("/access-requests/{id}/approve", accessHandler.Approve)
+		r.Post("/access-requests/{id}/deny", accessHandler.Deny)
+
+		// Change sets for stacks that require approvals
+		r.Post("/changes", changeHandler.Create)
+		r.Get("/changes", changeHandler.List)
+		r.Get("/changes/{id}", changeHandler.Get)
+		r.Post("/changes/{id}/approve", changeHandler.Approve)
+		r.Post("/changes/{id}/reject", changeHandler.Reject)
+
 		// Policy management
 		policyHandler := handler.NewPolicyHandler(store, syncService)
 		r.Get("/policy", policyHandler.Get)
 		r.Get("/policy/preview", policyHandler.Preview)
-		r.Post("/policy/sync", policyHandler.Sync)
 		r.Get("/policy/versions", policyHandler.ListVersions)
-		r.Post("/policy/rollback/{id}", policyHandler.Rollback)
+		r.Get("/policy/tests", policyHandler.Test)
+		r.Get("/policy/query", policyHandler.Query)
+		r.Get("/policy/conflicts", policyHandler.Conflicts)
+		r.Get("/policy/lint", policyHandler.Lint)
+		r.Get("/policy/diff", policyHandler.Diff)
+		r.Get("/policy/diff/live", policyHandler.DiffLive)
+		r.Get("/policy/drift", policyHandler.DriftStatus)
+		r.Get("/policy/drift/events", policyHandler.ListDriftEvents)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(domain.RolePolicyAdmin))
+			r.Post("/policy/sync", policyHandler.Sync)
+			r.Post("/policy/rollback/{id}", policyHandler.Rollback)
+			r.Post("/policy/adopt", policyHandler.Adopt)
+		})
+
+		// Guardrails checked on every write and sync
+		guardrailHandler := handler.NewGuardrailHandler(store, syncService)
+		r.Get("/guardrails", guardrailHandler.List)
+		r.Get("/guardrails/violations", guardrailHandler.Violations)
+		r.Get("/guardrails/{id}", guardrailHandler.Get)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireRole(domain.RolePolicyAdmin))
+			r.Post("/guardrails", guardrailHandler.Create)
+			r.Put("/guardrails/{id}", guardrailHandler.Update)
+			r.Delete("/guardrails/{id}", guardrailHandler.Delete)
+		})
+
+		// Audit log
+		auditHandler := handler.NewAuditHandler(store)
+		r.Get("/audit", auditHandler.List)
 	})
 
 	return r
@@ -0,0 +1,108 @@
+// Package audit records who changed which resource, alongside the change itself.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/google/uuid"
+)
+
+type contextKey struct{}
+
+// WithActor returns a context carrying the actor responsible for changes made with it.
+func WithActor(ctx context.Context, actor domain.AuditActor) context.Context {
+	return context.WithValue(ctx, contextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx, or the system actor if none is set.
+func ActorFromContext(ctx context.Context) domain.AuditActor {
+	if actor, ok := ctx.Value(contextKey{}).(domain.AuditActor); ok {
+		return actor
+	}
+	return domain.AuditActor{Type: domain.AuditActorSystem, ID: "system", Name: "System"}
+}
+
+// ActorFromAPIKey builds an actor for a request authenticated with an API key.
+func ActorFromAPIKey(key *domain.APIKey) domain.AuditActor {
+	return domain.AuditActor{Type: domain.AuditActorAPIKey, ID: key.ID, Name: key.Name}
+}
+
+// Change describes a single mutation.
+// Before and After are marshaled to JSON when the change is recorded; use
+// Snapshot for values that are modified in place before then.
+type Change struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	StackID      string
+	Before       any
+	After        any
+}
+
+// Snapshot captures the current JSON form of v.
+func Snapshot(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Record writes an audit entry for change using s, which should be the
+// transaction that applied the change.
+func Record(ctx context.Context, s storage.Storage, change Change) error {
+	actor := ActorFromContext(ctx)
+	entry := &domain.AuditEntry{
+		ID:           uuid.New().String(),
+		ActorType:    actor.Type,
+		ActorID:      actor.ID,
+		ActorName:    actor.Name,
+		Action:       change.Action,
+		ResourceType: change.ResourceType,
+		ResourceID:   change.ResourceID,
+		StackID:      change.StackID,
+		CreatedAt:    time.Now(),
+	}
+
+	var err error
+	if entry.Before, err = marshal(change.Before); err != nil {
+		return err
+	}
+	if entry.After, err = marshal(change.After); err != nil {
+		return err
+	}
+
+	return s.CreateAuditEntry(ctx, entry)
+}
+
+// Run applies fn in a new transaction and records change in the same
+// transaction, so a mutation is never committed without its audit entry.
+func Run(ctx context.Context, store storage.Storage, change Change, fn func(tx storage.Transaction) error) error {
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := Record(ctx, tx, change); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func marshal(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,456 @@
+// Package changes implements change sets: writes to stacks that require
+// approvals are staged as a proposed state of the stack, which replaces the
+// stack's resources once enough users other than the author approve it.
+package changes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
+	"github.com/bcnelson/tailscale-acl-manager/internal/nesting"
+	"github.com/bcnelson/tailscale-acl-manager/internal/policydiff"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Stage stages fn, a write to stackID, which requires approvals. fn runs
+// on the stack's current resources in a transaction that is always rolled
+// back, and the resulting state of the stack becomes a new change set. If
+// the actor in ctx has an open change set for the stack, the change fn
+// made is instead rebased onto it. Any ifGeneration must name the current
+// generation of the stack. Guardrails are checked on the policy merged with
+// strategies.
+func Stage(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, stackID string, ifGeneration *int64, fn func(tx storage.Transaction) error) (*domain.ChangeSet, error) {
+	stack, open, err := stagingTarget(ctx, store, stackID, ifGeneration)
+	if err != nil {
+		return nil, err
+	}
+	state, err := stagedState(ctx, store, stackID, open, fn)
+	if err != nil {
+		return nil, err
+	}
+	return stage(ctx, store, strategies, stack, open, state)
+}
+
+// StageState stages replacing the state of stackID like Stage. The state
+// of an open change set is replaced as well.
+func StageState(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, stackID string, ifGeneration *int64, state *domain.StackState) (*domain.ChangeSet, error) {
+	stack, open, err := stagingTarget(ctx, store, stackID, ifGeneration)
+	if err != nil {
+		return nil, err
+	}
+	return stage(ctx, store, strategies, stack, open, state)
+}
+
+// stagingTarget returns the stack a write is staged to and the open change
+// set of the actor in ctx that it amends, if any.
+func stagingTarget(ctx context.Context, store storage.Storage, stackID string, ifGeneration *int64) (*domain.Stack, *domain.ChangeSet, error) {
+	stack, err := store.GetStack(ctx, stackID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ifGeneration != nil && *ifGeneration != stack.Generation {
+		return nil, nil, &domain.StackGenerationError{StackID: stackID, Generation: stack.Generation}
+	}
+	open, err := openChangeSet(ctx, store, stack, audit.ActorFromContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	return stack, open, nil
+}
+
+// stage amends open with state, or creates a change set if open is nil.
+func stage(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, stack *domain.Stack, open *domain.ChangeSet, state *domain.StackState) (*domain.ChangeSet, error) {
+	if err := claims.CheckState(ctx, store, stack.ID, state); err != nil {
+		return nil, err
+	}
+	if err := nesting.CheckState(ctx, store, stack.ID, state); err != nil {
+		return nil, err
+	}
+	if err := guardrails.CheckState(ctx, store, strategies, stack.ID, state); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if open == nil {
+		return create(ctx, store, stack, "", state, now)
+	}
+	amended := *open
+	amended.State = state
+	amended.UpdatedAt = now
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceChangeSet,
+		ResourceID:   amended.ID,
+		StackID:      stack.ID,
+		Before:       audit.Snapshot(open),
+		After:        &amended,
+	}
+	if err := audit.Run(ctx, store, change, func(tx storage.Transaction) error {
+		return tx.UpdateChangeSet(ctx, &amended)
+	}); err != nil {
+		return nil, err
+	}
+	return withReviews(ctx, store, &amended)
+}
+
+// stagedState returns the state of stackID once fn is applied, to the open
+// change set if there is one. Nothing is written to store.
+func stagedState(ctx context.Context, store storage.Storage, stackID string, open *domain.ChangeSet, fn func(tx storage.Transaction) error) (*domain.StackState, error) {
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	before, err := stackstate.Load(ctx, tx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+	after, err := stackstate.Load(ctx, tx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	if open == nil {
+		return after, nil
+	}
+
+	// Load the open change set back, so that its entries compare equal to
+	// the stored ones, then apply the rebased state to catch duplicates
+	if err := replace(ctx, tx, stackID, open.State); err != nil {
+		return nil, err
+	}
+	proposed, err := stackstate.Load(ctx, tx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	rebased, err := rebase(proposed, before, after)
+	if err != nil {
+		return nil, err
+	}
+	if err := replace(ctx, tx, stackID, rebased); err != nil {
+		return nil, err
+	}
+	return stackstate.Load(ctx, tx, stackID)
+}
+
+// replace replaces the resources of stackID with state.
+func replace(ctx context.Context, tx storage.Transaction, stackID string, state *domain.StackState) error {
+	if err := stackstate.Clear(ctx, tx, stackID); err != nil {
+		return err
+	}
+	return stackstate.Apply(ctx, tx, stackID, state)
+}
+
+// Propose records a new change set replacing the state of stackID, checking
+// guardrails on the policy merged with strategies.
+func Propose(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, stackID, description string, state *domain.StackState, now time.Time) (*domain.ChangeSet, error) {
+	stack, err := store.GetStack(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	if err := claims.CheckState(ctx, store, stackID, state); err != nil {
+		return nil, err
+	}
+	if err := nesting.CheckState(ctx, store, stackID, state); err != nil {
+		return nil, err
+	}
+	if err := guardrails.CheckState(ctx, store, strategies, stackID, state); err != nil {
+		return nil, err
+	}
+	return create(ctx, store, stack, description, state, now)
+}
+
+// create stores a pending change set by the actor in ctx.
+func create(ctx context.Context, store storage.Storage, stack *domain.Stack, description string, state *domain.StackState, now time.Time) (*domain.ChangeSet, error) {
+	actor := audit.ActorFromContext(ctx)
+	change := &domain.ChangeSet{
+		ID:             uuid.New().String(),
+		StackID:        stack.ID,
+		Description:    description,
+		State:          state,
+		BaseGeneration: stack.Generation,
+		Status:         domain.ChangeSetPending,
+		AuthorType:     actor.Type,
+		AuthorID:       actor.ID,
+		AuthorName:     actor.Name,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := audit.Run(ctx, store, audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceChangeSet,
+		ResourceID:   change.ID,
+		StackID:      stack.ID,
+		After:        change,
+	}, func(tx storage.Transaction) error {
+		return tx.CreateChangeSet(ctx, change)
+	}); err != nil {
+		return nil, err
+	}
+	return withReviews(ctx, store, change)
+}
+
+// openChangeSet returns the change set that further writes by actor to
+// stack amend: the actor's latest pending change set for the stack, if it
+// has not been reviewed and the stack has not changed since it was made.
+func openChangeSet(ctx context.Context, store storage.Storage, stack *domain.Stack, actor domain.AuditActor) (*domain.ChangeSet, error) {
+	pending, err := store.ListChangeSets(ctx, domain.ChangeSetFilter{
+		StackIDs: []string{stack.ID},
+		Status:   domain.ChangeSetPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range pending {
+		if change.AuthorID != actor.ID || change.BaseGeneration != stack.Generation {
+			continue
+		}
+		reviews, err := store.ListChangeReviews(ctx, change.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(reviews) > 0 {
+			return nil, nil
+		}
+		return change, nil
+	}
+	return nil, nil
+}
+
+// Get returns the change set with the given ID, its reviews and the
+// number of approvals it needs.
+func Get(ctx context.Context, store storage.Storage, id string) (*domain.ChangeSet, error) {
+	change, err := store.GetChangeSet(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return withReviews(ctx, store, change)
+}
+
+// withReviews returns change with its reviews and required approvals.
+func withReviews(ctx context.Context, store storage.Storage, change *domain.ChangeSet) (*domain.ChangeSet, error) {
+	reviews, err := store.ListChangeReviews(ctx, change.ID)
+	if err != nil {
+		return nil, err
+	}
+	stack, err := store.GetStack(ctx, change.StackID)
+	if err != nil {
+		return nil, err
+	}
+	detailed := *change
+	detailed.Reviews = reviews
+	detailed.RequiredApprovals = requiredApprovals(stack)
+	return &detailed, nil
+}
+
+// Diff compares the policy merged with strategies with the policy merged
+// once change is applied.
+func Diff(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, change *domain.ChangeSet) (*domain.PolicyDiff, error) {
+	scratch, err := stackstate.Copy(ctx, store, change.StackID)
+	if err != nil {
+		return nil, err
+	}
+	if err := stackstate.Apply(ctx, scratch, change.StackID, change.State); err != nil {
+		return nil, err
+	}
+
+	current, err := merger.New(store, strategies).Merge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	proposed, err := merger.New(scratch, strategies).Merge(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := policydiff.Diff(current, proposed)
+	diff.From = "current"
+	diff.To = "change set"
+	return diff, nil
+}
+
+// Approve records the approval of the actor in ctx. Authors cannot approve
+// their own change sets, nor can API keys they created, and each user
+// approves a change set once. When the stack's required approvals are
+// reached the change set is applied in the same transaction, checking
+// guardrails on the policy merged with strategies; the caller is
+// responsible for triggering a sync.
+func Approve(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, id, comment string, now time.Time) (*domain.ChangeSet, error) {
+	return review(ctx, store, strategies, id, comment, now, true)
+}
+
+// Reject closes a pending change set without applying it. Authors may
+// reject, that is withdraw, their own change sets.
+func Reject(ctx context.Context, store storage.Storage, id, comment string, now time.Time) (*domain.ChangeSet, error) {
+	return review(ctx, store, nil, id, comment, now, false)
+}
+
+// createdBy reports whether the API key keyID was created by author, either
+// directly or through a chain of keys that author created.
+func createdBy(ctx context.Context, tx storage.Transaction, keyID, author string) (bool, error) {
+	keys, err := tx.ListAPIKeys(ctx)
+	if err != nil {
+		return false, err
+	}
+	creators := make(map[string]string, len(keys))
+	for _, key := range keys {
+		creators[key.ID] = key.CreatedBy
+	}
+	seen := make(map[string]bool)
+	for id := creators[keyID]; id != "" && !seen[id]; id = creators[id] {
+		if id == author {
+			return true, nil
+		}
+		seen[id] = true
+	}
+	return false, nil
+}
+
+func review(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, id, comment string, now time.Time, approve bool) (*domain.ChangeSet, error) {
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	change, err := tx.GetChangeSet(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if change.Status != domain.ChangeSetPending {
+		return nil, fmt.Errorf("%w: change set is already %s", domain.ErrConflict, change.Status)
+	}
+	reviewed, err := withReviews(ctx, tx, change)
+	if err != nil {
+		return nil, err
+	}
+
+	actor := audit.ActorFromContext(ctx)
+	action, reviewAction := domain.AuditActionReject, domain.ChangeReviewReject
+	if approve {
+		action, reviewAction = domain.AuditActionApprove, domain.ChangeReviewApprove
+		if actor.ID == change.AuthorID {
+			return nil, fmt.Errorf("%w: authors cannot approve their own change sets", domain.ErrForbidden)
+		}
+		authored, err := createdBy(ctx, tx, actor.ID, change.AuthorID)
+		if err != nil {
+			return nil, err
+		}
+		if authored {
+			return nil, fmt.Errorf("%w: keys created by the author cannot approve their change sets", domain.ErrForbidden)
+		}
+		for _, r := range reviewed.Reviews {
+			if r.ActorID == actor.ID && r.Action == domain.ChangeReviewApprove {
+				return nil, fmt.Errorf("%w: change set is already approved by %s", domain.ErrConflict, actor.Name)
+			}
+		}
+	}
+
+	r := &domain.ChangeReview{
+		ID:        uuid.New().String(),
+		ChangeID:  change.ID,
+		Action:    reviewAction,
+		ActorType: actor.Type,
+		ActorID:   actor.ID,
+		ActorName: actor.Name,
+		Comment:   comment,
+		CreatedAt: now,
+	}
+	if err := tx.CreateChangeReview(ctx, r); err != nil {
+		return nil, err
+	}
+	reviewed.Reviews = append(reviewed.Reviews, r)
+	reviewed.UpdatedAt = now
+
+	if !approve {
+		reviewed.Status = domain.ChangeSetRejected
+		reviewed.ClosedAt = &now
+	} else if reviewed.Approvals() >= reviewed.RequiredApprovals {
+		if err := apply(ctx, tx, strategies, reviewed, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.UpdateChangeSet(ctx, reviewed); err != nil {
+		return nil, err
+	}
+	if err := audit.Record(ctx, tx, audit.Change{
+		Action:       action,
+		ResourceType: domain.AuditResourceChangeSet,
+		ResourceID:   change.ID,
+		StackID:      change.StackID,
+		Before:       change,
+		After:        reviewed,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return reviewed, nil
+}
+
+// apply replaces the resources of the change set's stack with its state.
+// The stack must not have changed since the change set was made, or the
+// change set would silently undo those changes.
+func apply(ctx context.Context, tx storage.Transaction, strategies domain.MergeStrategies, change *domain.ChangeSet, now time.Time) error {
+	stack, err := tx.GetStack(ctx, change.StackID)
+	if err != nil {
+		return err
+	}
+	if stack.Generation != change.BaseGeneration {
+		return fmt.Errorf("%w: stack has changed since the change set was made (generation %d, change set made at %d); reject it and propose it again",
+			domain.ErrConflict, stack.Generation, change.BaseGeneration)
+	}
+	if err := claims.CheckState(ctx, tx, stack.ID, change.State); err != nil {
+		return err
+	}
+	if err := nesting.CheckState(ctx, tx, stack.ID, change.State); err != nil {
+		return err
+	}
+
+	before, err := stackstate.Load(ctx, tx, stack.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.IncrementStackGeneration(ctx, stack.ID, nil); err != nil {
+		return err
+	}
+	if err := guardrails.CheckWrite(ctx, tx, strategies, func(tx storage.Transaction) error {
+		return replace(ctx, tx, stack.ID, change.State)
+	}); err != nil {
+		return err
+	}
+	if err := audit.Record(ctx, tx, audit.Change{
+		Action:       domain.AuditActionReplace,
+		ResourceType: domain.AuditResourceStackState,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		Before:       before,
+		After:        change.State,
+	}); err != nil {
+		return err
+	}
+
+	change.Status = domain.ChangeSetApplied
+	change.ClosedAt = &now
+	return nil
+}
+
+// requiredApprovals returns the approvals a change set to stack needs.
+// Change sets left pending when a stack stops requiring approvals need one.
+func requiredApprovals(stack *domain.Stack) int {
+	return max(stack.RequiredApprovals, 1)
+}
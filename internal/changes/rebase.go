@@ -0,0 +1,115 @@
+package changes
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// rebase applies the change a write made to the current state of a stack,
+// from before to after, to state, the state of an open change set.
+func rebase(state, before, after *domain.StackState) (*domain.StackState, error) {
+	var rebased domain.StackState
+	var err error
+	if rebased.Groups, err = rebaseEntries("groups", state.Groups, before.Groups, after.Groups); err != nil {
+		return nil, err
+	}
+	if rebased.TagOwners, err = rebaseEntries("tag owners", state.TagOwners, before.TagOwners, after.TagOwners); err != nil {
+		return nil, err
+	}
+	if rebased.Hosts, err = rebaseEntries("hosts", state.Hosts, before.Hosts, after.Hosts); err != nil {
+		return nil, err
+	}
+	if rebased.ACLs, err = rebaseEntries("ACL rules", state.ACLs, before.ACLs, after.ACLs); err != nil {
+		return nil, err
+	}
+	if rebased.SSHRules, err = rebaseEntries("SSH rules", state.SSHRules, before.SSHRules, after.SSHRules); err != nil {
+		return nil, err
+	}
+	if rebased.Grants, err = rebaseEntries("grants", state.Grants, before.Grants, after.Grants); err != nil {
+		return nil, err
+	}
+	if rebased.AutoApprovers, err = rebaseEntries("auto approvers", state.AutoApprovers, before.AutoApprovers, after.AutoApprovers); err != nil {
+		return nil, err
+	}
+	if rebased.NodeAttrs, err = rebaseEntries("node attributes", state.NodeAttrs, before.NodeAttrs, after.NodeAttrs); err != nil {
+		return nil, err
+	}
+	if rebased.Postures, err = rebaseEntries("postures", state.Postures, before.Postures, after.Postures); err != nil {
+		return nil, err
+	}
+	if rebased.IPSets, err = rebaseEntries("IP sets", state.IPSets, before.IPSets, after.IPSets); err != nil {
+		return nil, err
+	}
+	if rebased.Tests, err = rebaseEntries("ACL tests", state.Tests, before.Tests, after.Tests); err != nil {
+		return nil, err
+	}
+	return &rebased, nil
+}
+
+// rebaseEntries applies the change from before to after to entries, which
+// are compared by value. The entries the write removed are removed from
+// entries; the entries it added replace them in place when the write
+// changed as many entries as it added, and are appended otherwise. Removing
+// an entry that entries no longer has is a conflict.
+func rebaseEntries[T any](section string, entries, before, after []T) ([]T, error) {
+	removed := difference(before, after)
+	added := difference(after, before)
+	if len(removed) == 0 && len(added) == 0 {
+		return entries, nil
+	}
+
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = entryKey(e)
+	}
+	positions := make([]int, 0, len(removed))
+	for _, e := range removed {
+		i := slices.Index(keys, entryKey(e))
+		if i < 0 {
+			return nil, fmt.Errorf("%w: the write changes %s that your open change set has already changed", domain.ErrConflict, section)
+		}
+		keys[i] = "" // Each entry is removed once
+		positions = append(positions, i)
+	}
+
+	result := slices.Clone(entries)
+	if len(added) == len(removed) {
+		for j, i := range positions {
+			result[i] = added[j]
+		}
+		return result, nil
+	}
+	slices.Sort(positions)
+	for _, i := range slices.Backward(positions) {
+		result = slices.Delete(result, i, i+1)
+	}
+	return append(result, added...), nil
+}
+
+// difference returns the entries of a that are not in b, counting
+// duplicates.
+func difference[T any](a, b []T) []T {
+	counts := make(map[string]int, len(b))
+	for _, e := range b {
+		counts[entryKey(e)]++
+	}
+	var diff []T
+	for _, e := range a {
+		key := entryKey(e)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		diff = append(diff, e)
+	}
+	return diff
+}
+
+// entryKey identifies a state entry by value.
+func entryKey[T any](e T) string {
+	data, _ := json.Marshal(e)
+	return string(data)
+}
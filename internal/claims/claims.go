@@ -0,0 +1,100 @@
+// Package claims enforces stack ownership claims on group names, tags, and
+// host names.
+package claims
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+)
+
+// Check returns a *domain.ClaimConflictError if a stack other than stackID
+// has claimed the name.
+func Check(ctx context.Context, store storage.Storage, stackID, claimType, name string) error {
+	claim, err := store.GetClaim(ctx, claimType, name)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if claim.StackID != stackID {
+		return &domain.ClaimConflictError{Type: claimType, Name: name, StackID: claim.StackID, Claimed: true}
+	}
+	return nil
+}
+
+// CheckState checks every group, tag, and host in a stack state, returning
+// the first conflict found.
+func CheckState(ctx context.Context, store storage.Storage, stackID string, state *domain.StackState) error {
+	for _, g := range state.Groups {
+		if err := Check(ctx, store, stackID, domain.ClaimTypeGroup, g.Name); err != nil {
+			return err
+		}
+	}
+	for _, t := range state.TagOwners {
+		if err := Check(ctx, store, stackID, domain.ClaimTypeTag, t.Tag); err != nil {
+			return err
+		}
+	}
+	for _, h := range state.Hosts {
+		if err := Check(ctx, store, stackID, domain.ClaimTypeHost, h.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckUnclaimed returns a *domain.ClaimConflictError if a stack other than
+// stackID already defines the name, so a claim by stackID would take over
+// another stack's resource. Disabled stacks count, since they may be
+// enabled again.
+func CheckUnclaimed(ctx context.Context, store storage.Storage, stackID, claimType, name string) error {
+	if err := Check(ctx, store, stackID, claimType, name); err != nil {
+		return err
+	}
+
+	var owners []string
+	switch claimType {
+	case domain.ClaimTypeGroup:
+		groups, err := stackstate.ListAll(ctx, store, store.ListAllGroups, store.ListGroups)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if g.Name == name {
+				owners = append(owners, g.StackID)
+			}
+		}
+	case domain.ClaimTypeTag:
+		tagOwners, err := stackstate.ListAll(ctx, store, store.ListAllTagOwners, store.ListTagOwners)
+		if err != nil {
+			return err
+		}
+		for _, t := range tagOwners {
+			if t.Tag == name {
+				owners = append(owners, t.StackID)
+			}
+		}
+	case domain.ClaimTypeHost:
+		hosts, err := stackstate.ListAll(ctx, store, store.ListAllHosts, store.ListHosts)
+		if err != nil {
+			return err
+		}
+		for _, h := range hosts {
+			if h.Name == name {
+				owners = append(owners, h.StackID)
+			}
+		}
+	}
+
+	for _, owner := range owners {
+		if owner != stackID {
+			return &domain.ClaimConflictError{Type: claimType, Name: name, StackID: owner}
+		}
+	}
+	return nil
+}
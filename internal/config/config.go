@@ -95,6 +95,25 @@ type SyncConfig struct {
 	AutoSync        bool          `env:"AUTO_SYNC" envDefault:"true"`
 	Debounce        time.Duration `env:"SYNC_DEBOUNCE" envDefault:"5s"`
 	BootstrapAPIKey string        `env:"BOOTSTRAP_API_KEY"`
+
+	// Drift detection: what to do when the tailnet policy was edited outside
+	// the manager (refuse, warn, or overwrite), and how often to check.
+	// A zero interval disables background checks; syncs still check.
+	DriftPolicy        string        `env:"DRIFT_POLICY" envDefault:"warn"`
+	DriftCheckInterval time.Duration `env:"DRIFT_CHECK_INTERVAL" envDefault:"5m"`
+
+	// Merge conflicts: fail syncs when stacks define the same host, posture,
+	// or IP set differently, instead of only warning.
+	ConflictsAsErrors bool `env:"MERGE_CONFLICTS_AS_ERRORS" envDefault:"false"`
+
+	// Merge strategies: how stacks defining the same name are combined, per
+	// named section, such as "groups=priority-override,hosts=error-on-conflict".
+	// Sections left out keep their defaults.
+	MergeStrategies string `env:"MERGE_STRATEGIES"`
+
+	// Guardrails: a JSON file of organisation-wide rules, loaded at startup
+	// alongside the guardrails managed through the API.
+	GuardrailsFile string `env:"GUARDRAILS_FILE"`
 }
 
 // Load loads configuration from environment variables.
@@ -137,6 +156,12 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	switch c.Sync.DriftPolicy {
+	case "refuse", "warn", "overwrite":
+	default:
+		return fmt.Errorf("DRIFT_POLICY must be one of refuse, warn, overwrite")
+	}
+
 	// Validate OIDC config when enabled
 	if c.OIDC.Enabled {
 		if c.OIDC.IssuerURL == "" {
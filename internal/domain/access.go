@@ -0,0 +1,98 @@
+package domain
+
+import "time"
+
+// Access request types.
+const (
+	AccessRequestTypeGroup = "group" // Time-boxed membership in a group
+	AccessRequestTypeGrant = "grant" // Time-boxed copy of a grant with the member as source
+)
+
+// Access request statuses.
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+// Access request history actions.
+const (
+	AccessEventRequested = "requested"
+	AccessEventApproved  = "approved"
+	AccessEventDenied    = "denied"
+)
+
+// AccessApprover allows an identity to decide access requests for a stack.
+// Approvers without a group decide every request in the stack; approvers
+// with a group only decide requests for membership in that group.
+type AccessApprover struct {
+	ID        string    `json:"id" db:"id"`
+	StackID   string    `json:"stackId" db:"stack_id"`
+	Group     string    `json:"group,omitempty" db:"group_name"`
+	Approver  string    `json:"approver" db:"approver"` // API key ID or OIDC subject
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CreateAccessApproverRequest is the request body for adding an approver.
+type CreateAccessApproverRequest struct {
+	Group    string `json:"group,omitempty"`
+	Approver string `json:"approver"`
+}
+
+// AccessRequest asks for time-boxed access to a group or grant of a stack.
+// The access starts when the request is approved and lasts for Duration.
+type AccessRequest struct {
+	ID          string     `json:"id" db:"id"`
+	StackID     string     `json:"stackId" db:"stack_id"`
+	Type        string     `json:"type" db:"type"`     // "group" or "grant"
+	Target      string     `json:"target" db:"target"` // Group name or grant ID
+	Member      string     `json:"member" db:"member"` // Identity that receives the access
+	Reason      string     `json:"reason" db:"reason"`
+	Duration    string     `json:"duration" db:"duration"` // Go duration, e.g. "4h"
+	Status      string     `json:"status" db:"status"`
+	RequestedBy string     `json:"requestedBy" db:"requested_by"` // Name of the requesting actor
+	RequesterID string     `json:"requesterId" db:"requester_id"`
+	DecidedBy   string     `json:"decidedBy,omitempty" db:"decided_by"`
+	DecidedAt   *time.Time `json:"decidedAt,omitempty" db:"decided_at"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty" db:"expires_at"`   // Set on approval
+	ResourceID  string     `json:"resourceId,omitempty" db:"resource_id"` // Group or grant written on approval
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updatedAt" db:"updated_at"`
+
+	History []*AccessRequestEvent `json:"history,omitempty" db:"-"` // Oldest first
+}
+
+// AccessRequestEvent records a step in the life of an access request.
+type AccessRequestEvent struct {
+	ID        string    `json:"id" db:"id"`
+	RequestID string    `json:"requestId" db:"request_id"`
+	Action    string    `json:"action" db:"action"` // "requested", "approved", or "denied"
+	ActorType string    `json:"actorType" db:"actor_type"`
+	ActorID   string    `json:"actorId" db:"actor_id"`
+	ActorName string    `json:"actorName" db:"actor_name"`
+	Comment   string    `json:"comment,omitempty" db:"comment"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CreateAccessRequestRequest is the request body for requesting access.
+type CreateAccessRequestRequest struct {
+	StackID  string `json:"stackId"`
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Member   string `json:"member"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+// DecideAccessRequestRequest is the request body for approving or denying
+// an access request.
+type DecideAccessRequestRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// AccessRequestFilter restricts the requests returned by ListAccessRequests.
+// Zero-valued fields are not filtered on.
+type AccessRequestFilter struct {
+	StackIDs []string
+	Status   string
+}
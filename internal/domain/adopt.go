@@ -0,0 +1,27 @@
+package domain
+
+// AdoptRequest converts an existing Tailscale policy into the state of
+// managed stacks.
+type AdoptRequest struct {
+	StackID    string           `json:"stackId"`              // Receives everything not moved by a split rule
+	Policy     *TailscalePolicy `json:"policy,omitempty"`     // Policy to adopt
+	PolicyFile string           `json:"policyFile,omitempty"` // Policy to adopt as HuJSON text
+	Split      []AdoptSplitRule `json:"split,omitempty"`      // Applied in order; the first match wins
+}
+
+// AdoptSplitRule moves ACLs, grants, and SSH rules to another stack.
+// A rule matches when any destination names Destination (with or without a
+// port) or any source equals Source.
+type AdoptSplitRule struct {
+	StackID     string `json:"stackId"`
+	Destination string `json:"destination,omitempty"` // e.g. "tag:web"
+	Source      string `json:"source,omitempty"`      // e.g. "group:dev"
+}
+
+// AdoptResult reports the stack states produced by adopting a policy.
+type AdoptResult struct {
+	States     map[string]*StackState `json:"states"`             // Keyed by stack ID
+	Diff       *PolicyDiff            `json:"diff"`               // Original policy against the merged result
+	Equivalent bool                   `json:"equivalent"`         // Whether the merged result matches the original
+	Warnings   []string               `json:"warnings,omitempty"` // Keys of the policy file that were ignored
+}
@@ -1,21 +1,92 @@
 package domain
 
-import "time"
+import (
+	"slices"
+	"time"
+)
+
+// API key roles. A key may hold several roles; every role grants read access
+// to the stacks in the key's scope.
+const (
+	RoleReadOnly    = "read-only"    // Read stacks, resources and policy
+	RoleStackWriter = "stack-writer" // Mutate resources and state of scoped stacks
+	RolePolicyAdmin = "policy-admin" // Force sync and rollback of the policy
+	RoleKeyAdmin    = "key-admin"    // Create, list and delete API keys
+)
+
+// AllRoles lists every API key role.
+var AllRoles = []string{RoleReadOnly, RoleStackWriter, RolePolicyAdmin, RoleKeyAdmin}
 
 // APIKey represents an API key for authentication.
 // The actual key is only returned once on creation.
 type APIKey struct {
 	ID         string     `json:"id" db:"id"`
 	Name       string     `json:"name" db:"name"`
-	KeyHash    string     `json:"-" db:"key_hash"` // Never expose hash
-	KeyPrefix  string     `json:"keyPrefix" db:"key_prefix"` // First 8 chars for identification
+	KeyHash    string     `json:"-" db:"key_hash"`                     // Never expose hash
+	KeyPrefix  string     `json:"keyPrefix" db:"key_prefix"`           // First 8 chars for identification
+	Roles      []string   `json:"roles" db:"-"`                        // Stored in separate table
+	StackIDs   []string   `json:"stackIds,omitempty" db:"-"`           // Empty = all stacks
+	CreatedBy  string     `json:"createdBy,omitempty" db:"created_by"` // ID of the actor that created the key
 	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
 	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
 }
 
+// HasRole reports whether the key holds the given role.
+func (k *APIKey) HasRole(role string) bool {
+	return slices.Contains(k.Roles, role)
+}
+
+// IsScoped reports whether the key is restricted to a set of stacks.
+func (k *APIKey) IsScoped() bool {
+	return len(k.StackIDs) > 0
+}
+
+// CanReadStack reports whether the key may read the given stack.
+func (k *APIKey) CanReadStack(stackID string) bool {
+	if len(k.Roles) == 0 {
+		return false
+	}
+	return !k.IsScoped() || slices.Contains(k.StackIDs, stackID)
+}
+
+// CanWriteStack reports whether the key may mutate the given stack.
+func (k *APIKey) CanWriteStack(stackID string) bool {
+	return k.HasRole(RoleStackWriter) && k.CanReadStack(stackID)
+}
+
+// Covers reports whether the key holds every given role and can read every
+// given stack. A scoped key never covers an unscoped set of stacks.
+func (k *APIKey) Covers(roles, stackIDs []string) bool {
+	for _, role := range roles {
+		if !k.HasRole(role) {
+			return false
+		}
+	}
+	if !k.IsScoped() {
+		return true
+	}
+	if len(stackIDs) == 0 {
+		return false
+	}
+	for _, stackID := range stackIDs {
+		if !k.CanReadStack(stackID) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAdmin reports whether the key holds every role on every stack.
+func (k *APIKey) IsAdmin() bool {
+	return k.Covers(AllRoles, nil)
+}
+
 // CreateAPIKeyRequest is the request body for creating an API key.
+// Omitting roles creates a key with every role; omitting stackIds leaves it unscoped.
 type CreateAPIKeyRequest struct {
-	Name string `json:"name"`
+	Name     string   `json:"name"`
+	Roles    []string `json:"roles,omitempty"`
+	StackIDs []string `json:"stackIds,omitempty"`
 }
 
 // CreateAPIKeyResponse is returned when creating an API key.
@@ -25,5 +96,7 @@ type CreateAPIKeyResponse struct {
 	Name      string    `json:"name"`
 	Key       string    `json:"key"` // Only returned on creation
 	KeyPrefix string    `json:"keyPrefix"`
+	Roles     []string  `json:"roles"`
+	StackIDs  []string  `json:"stackIds,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
 }
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions.
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionReplace = "replace" // Bulk stack state replacement
+	AuditActionExpire  = "expire"  // Removal of expired entries by the reaper
+	AuditActionApprove = "approve" // Approval of an access request or change set
+	AuditActionDeny    = "deny"    // Denial of an access request
+	AuditActionReject  = "reject"  // Rejection of a change set
+)
+
+// Audit actor types.
+const (
+	AuditActorAPIKey = "api_key"
+	AuditActorOIDC   = "oidc"
+	AuditActorSystem = "system" // Background jobs with no request
+)
+
+// Audited resource types.
+const (
+	AuditResourceAPIKey         = "api_key"
+	AuditResourceStack          = "stack"
+	AuditResourceStackState     = "stack_state"
+	AuditResourceGroup          = "group"
+	AuditResourceTagOwner       = "tagowner"
+	AuditResourceHost           = "host"
+	AuditResourceACL            = "acl"
+	AuditResourceSSH            = "ssh"
+	AuditResourceGrant          = "grant"
+	AuditResourceAutoApprover   = "autoapprover"
+	AuditResourceNodeAttr       = "nodeattr"
+	AuditResourcePosture        = "posture"
+	AuditResourceIPSet          = "ipset"
+	AuditResourceACLTest        = "acltest"
+	AuditResourceClaim          = "claim"
+	AuditResourceAccessApprover = "access_approver"
+	AuditResourceAccessRequest  = "access_request"
+	AuditResourceChangeSet      = "change_set"
+	AuditResourceGuardrail      = "guardrail"
+)
+
+// AuditActor identifies who made a change.
+type AuditActor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`   // API key ID or OIDC subject
+	Name string `json:"name"` // API key name or OIDC email
+}
+
+// AuditEntry is a record of a single mutation.
+// Entries are written in the same transaction as the change they describe.
+type AuditEntry struct {
+	ID           string          `json:"id" db:"id"`
+	ActorType    string          `json:"actorType" db:"actor_type"`
+	ActorID      string          `json:"actorId" db:"actor_id"`
+	ActorName    string          `json:"actorName" db:"actor_name"`
+	Action       string          `json:"action" db:"action"`
+	ResourceType string          `json:"resourceType" db:"resource_type"`
+	ResourceID   string          `json:"resourceId,omitempty" db:"resource_id"`
+	StackID      string          `json:"stackId,omitempty" db:"stack_id"`
+	Before       json.RawMessage `json:"before,omitempty" db:"before_json"` // Nil for creates
+	After        json.RawMessage `json:"after,omitempty" db:"after_json"`   // Nil for deletes
+	CreatedAt    time.Time       `json:"createdAt" db:"created_at"`
+}
+
+// AuditFilter restricts the entries returned by ListAuditEntries.
+// Zero-valued fields are not filtered on.
+type AuditFilter struct {
+	StackIDs     []string
+	ResourceType string
+	ResourceID   string
+	ActorID      string
+	Action       string
+	Since        *time.Time
+	Until        *time.Time
+	Limit        int
+	Offset       int
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Change set statuses.
+const (
+	ChangeSetPending  = "pending"
+	ChangeSetApplied  = "applied"
+	ChangeSetRejected = "rejected"
+)
+
+// Change set review actions.
+const (
+	ChangeReviewApprove = "approve"
+	ChangeReviewReject  = "reject"
+)
+
+// ChangeSet is a pending change to a stack that requires approvals. Writes to
+// a stack with RequiredApprovals set are staged as change sets holding the
+// proposed state of the stack, which replaces the stack's resources once
+// enough users other than the author approve it.
+type ChangeSet struct {
+	ID             string      `json:"id" db:"id"`
+	StackID        string      `json:"stackId" db:"stack_id"`
+	Description    string      `json:"description,omitempty" db:"description"`
+	State          *StackState `json:"state" db:"-"`
+	BaseGeneration int64       `json:"baseGeneration" db:"base_generation"` // Stack generation the change was made against
+	Status         string      `json:"status" db:"status"`
+	AuthorType     string      `json:"authorType" db:"author_type"`
+	AuthorID       string      `json:"authorId" db:"author_id"`
+	AuthorName     string      `json:"authorName" db:"author_name"`
+	ClosedAt       *time.Time  `json:"closedAt,omitempty" db:"closed_at"` // When the change was applied or rejected
+	CreatedAt      time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updatedAt" db:"updated_at"`
+
+	Reviews           []*ChangeReview `json:"reviews,omitempty" db:"-"` // Oldest first
+	RequiredApprovals int             `json:"requiredApprovals" db:"-"`
+	Diff              *PolicyDiff     `json:"diff,omitempty" db:"-"` // Merged policy diff, for pending changes
+}
+
+// Approvals returns the number of approvals the change set has received.
+func (c *ChangeSet) Approvals() int {
+	n := 0
+	for _, r := range c.Reviews {
+		if r.Action == ChangeReviewApprove {
+			n++
+		}
+	}
+	return n
+}
+
+// ChangeStagedError reports a write to a stack that requires approvals,
+// which was staged as Change instead of being applied. It is not a failure:
+// like http.ErrUseLastResponse it stops the write, and handlers answer it
+// with 202 Accepted and the change set.
+type ChangeStagedError struct {
+	Change *ChangeSet
+}
+
+// Error implements the error interface.
+func (e *ChangeStagedError) Error() string {
+	return fmt.Sprintf("write staged as change set %s", e.Change.ID)
+}
+
+// ChangeReview records an approval or rejection of a change set.
+type ChangeReview struct {
+	ID        string    `json:"id" db:"id"`
+	ChangeID  string    `json:"changeId" db:"change_id"`
+	Action    string    `json:"action" db:"action"` // "approve" or "reject"
+	ActorType string    `json:"actorType" db:"actor_type"`
+	ActorID   string    `json:"actorId" db:"actor_id"`
+	ActorName string    `json:"actorName" db:"actor_name"`
+	Comment   string    `json:"comment,omitempty" db:"comment"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CreateChangeSetRequest is the request body for proposing a new state for
+// a stack. State and StateFile are alternatives, as for replacing the state.
+type CreateChangeSetRequest struct {
+	StackID     string      `json:"stackId"`
+	Description string      `json:"description,omitempty"`
+	State       *StackState `json:"state,omitempty"`
+	StateFile   string      `json:"stateFile,omitempty"` // HuJSON policy fragment
+}
+
+// ReviewChangeSetRequest is the request body for approving or rejecting a
+// change set.
+type ReviewChangeSetRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// ChangeSetFilter restricts the change sets returned by ListChangeSets.
+// Zero-valued fields are not filtered on.
+type ChangeSetFilter struct {
+	StackIDs []string
+	Status   string
+}
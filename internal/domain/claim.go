@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Claim types: the kinds of names a stack can claim exclusively.
+const (
+	ClaimTypeGroup = "group"
+	ClaimTypeTag   = "tag"
+	ClaimTypeHost  = "host"
+)
+
+// AllClaimTypes lists every valid claim type.
+var AllClaimTypes = []string{ClaimTypeGroup, ClaimTypeTag, ClaimTypeHost}
+
+// Claim gives a stack exclusive ownership of a group name, tag, or host name.
+// Other stacks cannot define resources with a claimed name.
+type Claim struct {
+	ID        string    `json:"id" db:"id"`
+	StackID   string    `json:"stackId" db:"stack_id"`
+	Type      string    `json:"type" db:"type"` // "group", "tag", or "host"
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CreateClaimRequest is the request body for creating a claim.
+type CreateClaimRequest struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// ClaimConflictError reports a write that collides with another stack's
+// ownership of a name. It matches ErrConflict.
+type ClaimConflictError struct {
+	Type    string // Claim type
+	Name    string
+	StackID string // The stack that owns or already defines the name
+	Claimed bool   // False when the name is merely defined, e.g. when creating a claim
+}
+
+// Error implements the error interface.
+func (e *ClaimConflictError) Error() string {
+	if e.Claimed {
+		return fmt.Sprintf("%s %q is claimed by stack %s", e.Type, e.Name, e.StackID)
+	}
+	return fmt.Sprintf("%s %q is already defined by stack %s", e.Type, e.Name, e.StackID)
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ClaimConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
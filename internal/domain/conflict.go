@@ -0,0 +1,36 @@
+package domain
+
+// Merge conflict types, one per named section.
+const (
+	ConflictTypeGroup        = "group"
+	ConflictTypeTagOwner     = "tagOwner"
+	ConflictTypeAutoApprover = "autoApprover"
+	ConflictTypeHost         = "host"
+	ConflictTypePosture      = "posture"
+	ConflictTypeIPSet        = "ipset"
+)
+
+// MergeConflict describes a name defined differently by several stacks in a
+// section merged with the priority-override or error-on-conflict strategy.
+// The winner's definition is rendered; the shadowed definitions are dropped
+// from the merged policy.
+type MergeConflict struct {
+	Type     string               `json:"type"` // "group", "tagOwner", "autoApprover", "host", "posture", or "ipset"
+	Name     string               `json:"name"`
+	Strategy string               `json:"strategy"` // The merge strategy of the section
+	Winner   ConflictDefinition   `json:"winner"`
+	Shadowed []ConflictDefinition `json:"shadowed"`
+}
+
+// Blocking reports whether the conflict fails syncs on its own, because its
+// section is merged with the error-on-conflict strategy.
+func (c MergeConflict) Blocking() bool {
+	return c.Strategy == MergeStrategyErrorOnConflict
+}
+
+// ConflictDefinition is one stack's definition of a conflicting name.
+type ConflictDefinition struct {
+	RuleSource
+	StackName string `json:"stackName"`
+	Value     any    `json:"value"` // The host address, or the members, owners, approvers, posture rules, or IP set addresses
+}
@@ -0,0 +1,61 @@
+package domain
+
+// Diff change kinds.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// PolicyDiff is a structural diff between two TailscalePolicy values.
+// Named sections are compared by key; rule lists are compared as multisets,
+// so a rule that only moved position is not reported.
+type PolicyDiff struct {
+	From      string `json:"from"` // Describes the old side, e.g. "version:3" or "live"
+	To        string `json:"to"`   // Describes the new side, e.g. "version:4" or "merged"
+	Identical bool   `json:"identical"`
+
+	Groups        []NamedListDiff `json:"groups,omitempty"`
+	TagOwners     []NamedListDiff `json:"tagOwners,omitempty"`
+	Hosts         []HostDiff      `json:"hosts,omitempty"`
+	Postures      []NamedListDiff `json:"postures,omitempty"`
+	IPSets        []NamedListDiff `json:"ipsets,omitempty"`
+	AutoApprovers []NamedListDiff `json:"autoApprovers,omitempty"` // Keyed by route CIDR, or "exitNode"
+	ACLs          []RuleDiff      `json:"acls,omitempty"`
+	Grants        []RuleDiff      `json:"grants,omitempty"`
+	SSH           []RuleDiff      `json:"ssh,omitempty"`
+	NodeAttrs     []RuleDiff      `json:"nodeAttrs,omitempty"`
+	Tests         []RuleDiff      `json:"tests,omitempty"`
+}
+
+// NamedListDiff describes a change to a named string list, such as a group's members.
+type NamedListDiff struct {
+	Name    string   `json:"name"`
+	Change  string   `json:"change"` // "added", "removed", or "changed"
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// HostDiff describes a host that was added, removed, or re-pointed.
+type HostDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// RuleDiff describes a rule that was added or removed.
+// Index is the rule's position in the new policy for additions and in the
+// old policy for removals.
+type RuleDiff struct {
+	Change string `json:"change"`
+	Index  int    `json:"index"`
+	Rule   any    `json:"rule"`
+}
+
+// ChangeCount returns the total number of changed entries across all sections.
+func (d *PolicyDiff) ChangeCount() int {
+	return len(d.Groups) + len(d.TagOwners) + len(d.Hosts) + len(d.Postures) +
+		len(d.IPSets) + len(d.AutoApprovers) + len(d.ACLs) + len(d.Grants) +
+		len(d.SSH) + len(d.NodeAttrs) + len(d.Tests)
+}
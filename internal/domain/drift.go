@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// Drift policies control what a sync does when the tailnet policy was changed
+// outside of the manager since the last successful push.
+const (
+	DriftPolicyRefuse    = "refuse"    // Fail the sync until drift is resolved or overwritten explicitly
+	DriftPolicyWarn      = "warn"      // Push anyway and report a warning
+	DriftPolicyOverwrite = "overwrite" // Push anyway without warning
+)
+
+// AllDriftPolicies lists the valid drift policies.
+var AllDriftPolicies = []string{DriftPolicyRefuse, DriftPolicyWarn, DriftPolicyOverwrite}
+
+// Drift event resolutions.
+const (
+	DriftResolutionOverwritten = "overwritten" // A sync or rollback replaced the live policy
+	DriftResolutionReverted    = "reverted"    // The live policy matches the last pushed version again
+)
+
+// DriftEvent records a detected difference between the last successfully
+// pushed policy version and the policy currently live on the tailnet.
+// An event stays open until it is resolved.
+type DriftEvent struct {
+	ID            string      `json:"id"`
+	VersionID     string      `json:"versionId"`
+	VersionNumber int         `json:"versionNumber"`
+	ExpectedETag  string      `json:"expectedEtag,omitempty"`
+	LiveETag      string      `json:"liveEtag,omitempty"`
+	Diff          *PolicyDiff `json:"diff"` // From the pushed version to the live policy
+	DetectedAt    time.Time   `json:"detectedAt"`
+	ResolvedAt    *time.Time  `json:"resolvedAt,omitempty"`
+	Resolution    string      `json:"resolution,omitempty"`
+}
+
+// DriftStatus is the result of the most recent drift check.
+type DriftStatus struct {
+	Drifted   bool        `json:"drifted"`
+	Policy    string      `json:"policy"`
+	CheckedAt *time.Time  `json:"checkedAt,omitempty"` // Nil until the first check runs
+	Error     string      `json:"error,omitempty"`
+	Event     *DriftEvent `json:"event,omitempty"` // The open drift event, if any
+}
@@ -4,30 +4,34 @@ import "errors"
 
 // Common errors used throughout the application.
 var (
-	ErrNotFound            = errors.New("not found")
-	ErrAlreadyExists       = errors.New("already exists")
-	ErrInvalidInput        = errors.New("invalid input")
-	ErrUnauthorized        = errors.New("unauthorized")
-	ErrConflict            = errors.New("conflict")
-	ErrSyncInProgress      = errors.New("sync already in progress")
-	ErrSyncFailed          = errors.New("sync failed")
-	ErrNoAPIKeys           = errors.New("no API keys configured")
-	ErrInvalidAPIKey       = errors.New("invalid API key")
-	ErrBootstrapDisabled   = errors.New("bootstrap key disabled - API keys exist")
-	ErrPreconditionFailed  = errors.New("precondition failed")
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInvalidInput       = errors.New("invalid input")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrConflict           = errors.New("conflict")
+	ErrSyncInProgress     = errors.New("sync already in progress")
+	ErrSyncFailed         = errors.New("sync failed")
+	ErrNoAPIKeys          = errors.New("no API keys configured")
+	ErrInvalidAPIKey      = errors.New("invalid API key")
+	ErrBootstrapDisabled  = errors.New("bootstrap key disabled - API keys exist")
+	ErrPreconditionFailed = errors.New("precondition failed")
 )
 
 // Error codes for standardized API error responses.
 const (
-	ErrCodeResourceNotFound     = "RESOURCE_NOT_FOUND"
+	ErrCodeResourceNotFound      = "RESOURCE_NOT_FOUND"
 	ErrCodeResourceAlreadyExists = "RESOURCE_ALREADY_EXISTS"
-	ErrCodeInvalidInput         = "INVALID_INPUT"
-	ErrCodeUnauthorized         = "UNAUTHORIZED"
-	ErrCodeValidationError      = "VALIDATION_ERROR"
-	ErrCodePreconditionFailed   = "PRECONDITION_FAILED"
-	ErrCodeSyncInProgress       = "SYNC_IN_PROGRESS"
-	ErrCodeSyncFailed           = "SYNC_FAILED"
-	ErrCodeInternalError        = "INTERNAL_ERROR"
+	ErrCodeResourceConflict      = "RESOURCE_CONFLICT"
+	ErrCodeInvalidInput          = "INVALID_INPUT"
+	ErrCodeUnauthorized          = "UNAUTHORIZED"
+	ErrCodeForbidden             = "FORBIDDEN"
+	ErrCodeValidationError       = "VALIDATION_ERROR"
+	ErrCodePreconditionFailed    = "PRECONDITION_FAILED"
+	ErrCodeSyncInProgress        = "SYNC_IN_PROGRESS"
+	ErrCodeSyncFailed            = "SYNC_FAILED"
+	ErrCodeGuardrailViolation    = "GUARDRAIL_VIOLATION"
+	ErrCodeInternalError         = "INTERNAL_ERROR"
 )
 
 // StandardError represents a standardized error response from the API.
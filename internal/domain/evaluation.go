@@ -0,0 +1,61 @@
+package domain
+
+// Rule types reported by the local policy evaluator.
+const (
+	RuleTypeACL   = "acl"
+	RuleTypeGrant = "grant"
+)
+
+// RuleMatch identifies the merged policy rule that allowed a connection.
+type RuleMatch struct {
+	Type  string `json:"type"`  // "acl" or "grant"
+	Index int    `json:"index"` // Position in the merged policy's acls or grants
+}
+
+// PolicyTestReport summarizes a local run of the merged policy's ACL tests.
+type PolicyTestReport struct {
+	Passed  bool               `json:"passed"`
+	Failed  int                `json:"failed"`
+	Skipped int                `json:"skipped"`
+	Unknown []string           `json:"unknown,omitempty"` // Selectors that left skipped tests unknown
+	Results []PolicyTestResult `json:"results"`
+}
+
+// PolicyTestResult is the outcome of evaluating one ACL test locally. Tests
+// that depend on selectors the evaluator cannot resolve are skipped.
+type PolicyTestResult struct {
+	Index      int                   `json:"index"` // Position in the merged policy's tests
+	Src        string                `json:"src"`
+	Passed     bool                  `json:"passed"`
+	Skipped    bool                  `json:"skipped,omitempty"`
+	Assertions []PolicyTestAssertion `json:"assertions"`
+}
+
+// PolicyTestAssertion is the outcome of a single accept or deny entry of a test.
+type PolicyTestAssertion struct {
+	Dst      string     `json:"dst"`
+	Expected string     `json:"expected"` // "accept" or "deny"
+	Passed   bool       `json:"passed"`
+	Match    *RuleMatch `json:"match,omitempty"`   // The rule that allowed the connection, if any
+	Unknown  []string   `json:"unknown,omitempty"` // Unresolvable selectors that leave the outcome unknown
+	Error    string     `json:"error,omitempty"`
+}
+
+// PolicyQueryResult answers whether the merged policy allows a connection.
+type PolicyQueryResult struct {
+	Src     string   `json:"src"`
+	Dst     string   `json:"dst"`
+	Port    int      `json:"port"`
+	Proto   string   `json:"proto"`
+	Allowed bool     `json:"allowed"`
+	Unknown []string `json:"unknown,omitempty"` // Unresolvable selectors that might allow a denied connection
+
+	Match     *RuleMatch  `json:"match,omitempty"`     // The rule that allowed the connection
+	Rule      any         `json:"rule,omitempty"`      // The matching TailscaleACL or TailscaleGrant
+	Source    *RuleSource `json:"source,omitempty"`    // The stack resource that produced the rule
+	StackName string      `json:"stackName,omitempty"` // Name of the contributing stack
+
+	SrcMemberOf []string            `json:"srcMemberOf"` // Groups, IP sets, hosts and autogroups including src
+	DstMemberOf []string            `json:"dstMemberOf"`
+	TagOwners   map[string][]string `json:"tagOwners,omitempty"` // Expanded owners of tags in src or dst
+}
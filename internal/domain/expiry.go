@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// Expired reports whether an entry with the given expiry has expired at now.
+// Entries without an expiry never expire.
+func Expired(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt != nil && !now.Before(*expiresAt)
+}
+
+// MemberExpired reports whether member of g has expired at now.
+func (g *Group) MemberExpired(member string, now time.Time) bool {
+	expiresAt, ok := g.MemberExpiresAt[member]
+	return ok && !now.Before(expiresAt)
+}
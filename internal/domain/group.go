@@ -1,25 +1,50 @@
 package domain
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // Group represents a Tailscale group (e.g., group:developers).
 // Groups from different stacks with the same name will have their members merged.
 type Group struct {
-	ID        string    `json:"id" db:"id"`
-	StackID   string    `json:"stackId" db:"stack_id"`
-	Name      string    `json:"name" db:"name"` // e.g., "group:developers"
-	Members   []string  `json:"members" db:"-"` // Stored in separate table
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID              string               `json:"id" db:"id"`
+	StackID         string               `json:"stackId" db:"stack_id"`
+	Name            string               `json:"name" db:"name"`                         // e.g., "group:developers"
+	Members         []string             `json:"members" db:"-"`                         // Stored in separate table
+	MemberExpiresAt map[string]time.Time `json:"memberExpiresAt,omitempty" db:"-"`       // Members removed at the given time
+	Description     string               `json:"description,omitempty" db:"description"` // Rendered as a comment
+	CreatedAt       time.Time            `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time            `json:"updatedAt" db:"updated_at"`
 }
 
 // CreateGroupRequest is the request body for creating a group.
 type CreateGroupRequest struct {
-	Name    string   `json:"name"`
-	Members []string `json:"members"`
+	Name            string               `json:"name"`
+	Members         []string             `json:"members"`
+	MemberExpiresAt map[string]time.Time `json:"memberExpiresAt,omitempty"` // Keyed by member
+	Description     string               `json:"description,omitempty"`
 }
 
 // UpdateGroupRequest is the request body for updating a group.
 type UpdateGroupRequest struct {
-	Members []string `json:"members"`
+	Members         []string             `json:"members"`
+	MemberExpiresAt map[string]time.Time `json:"memberExpiresAt,omitempty"` // Replaces the expiry of all members when set
+	Description     *string              `json:"description,omitempty"`
+}
+
+// GroupCycleError reports nested groups that would contain themselves.
+// It matches ErrInvalidInput.
+type GroupCycleError struct {
+	Cycle []string // Group names, starting and ending with the same group
+}
+
+// Error implements the error interface.
+func (e *GroupCycleError) Error() string {
+	return "nested groups form a cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// Is reports whether target is ErrInvalidInput.
+func (e *GroupCycleError) Is(target error) bool {
+	return target == ErrInvalidInput
 }
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Guardrail sources.
+const (
+	GuardrailSourceAPI    = "api"    // Managed through the API
+	GuardrailSourceConfig = "config" // Loaded from the guardrails file at startup
+)
+
+// Guardrail targets: the merged policy sections a guardrail checks.
+const (
+	GuardrailTargetACLs   = "acls"
+	GuardrailTargetGrants = "grants"
+	GuardrailTargetSSH    = "ssh"
+)
+
+// GuardrailTargets lists the valid guardrail targets.
+var GuardrailTargets = []string{GuardrailTargetACLs, GuardrailTargetGrants, GuardrailTargetSSH}
+
+// Guardrail is an organisation-wide rule that no stack may violate. Every
+// ACL, grant, or SSH rule of the merged policy that matches it is a
+// violation, as is every undefined reference when the guardrail forbids
+// them. Violations block syncs and the writes that introduce them.
+type Guardrail struct {
+	ID          string         `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Description string         `json:"description,omitempty" db:"description"`
+	Targets     []string       `json:"targets,omitempty" db:"-"` // Sections checked; all when empty
+	Match       GuardrailMatch `json:"match" db:"-"`
+	Source      string         `json:"source" db:"source"` // "api" or "config"
+	CreatedAt   time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// AppliesTo reports whether the guardrail checks the given target.
+func (g *Guardrail) AppliesTo(target string) bool {
+	if len(g.Targets) == 0 {
+		return true
+	}
+	for _, t := range g.Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// GuardrailMatch describes the rules a guardrail forbids. A rule matches
+// when every condition that is set matches; a list condition matches when
+// any of the rule's values matches any of its patterns.
+//
+// Patterns match values exactly, except that a pattern ending in "*" after
+// a prefix, such as "tag:prod:*", matches every value with that prefix. A
+// lone "*" only matches the "*" wildcard itself. ACL destinations are
+// matched as written ("host:port"); grant destinations are matched once for
+// each of the grant's IP entries, as "host:ip".
+//
+// RequirePosture limits the guardrail to rules without a source posture,
+// so that src "*" and dst "autogroup:internet:*" forbid internet access
+// from devices that are not posture-checked. Only grants carry postures:
+// every matching ACL or SSH rule lacks one.
+//
+// UndefinedReferences instead matches every entry that the policy linter
+// reports as referencing a group, host, or IP set that no stack defines,
+// or a tag without tag owners. It cannot be combined with other conditions,
+// and checks every policy section when the guardrail has no targets.
+type GuardrailMatch struct {
+	Src    []string `json:"src,omitempty"`
+	Dst    []string `json:"dst,omitempty"`
+	Users  []string `json:"users,omitempty"`  // SSH users; SSH rules only
+	Action string   `json:"action,omitempty"` // "accept" or "check"; SSH rules only
+
+	RequirePosture      bool `json:"requirePosture,omitempty"`
+	UndefinedReferences bool `json:"undefinedReferences,omitempty"`
+}
+
+// IsEmpty reports whether no condition is set.
+func (m GuardrailMatch) IsEmpty() bool {
+	return len(m.Src) == 0 && len(m.Dst) == 0 && len(m.Users) == 0 && m.Action == "" && !m.RequirePosture && !m.UndefinedReferences
+}
+
+// CreateGuardrailRequest is the request body for creating a guardrail, and
+// the format of each entry in the guardrails file.
+type CreateGuardrailRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Targets     []string       `json:"targets,omitempty"`
+	Match       GuardrailMatch `json:"match"`
+}
+
+// UpdateGuardrailRequest is the request body for updating a guardrail.
+type UpdateGuardrailRequest struct {
+	Name        *string         `json:"name,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Targets     []string        `json:"targets,omitempty"`
+	Match       *GuardrailMatch `json:"match,omitempty"`
+}
+
+// GuardrailViolation is an entry of the merged policy that a guardrail
+// forbids. Violations of UndefinedReferences guardrails give the reference
+// as the reason, and name entries of named sections, such as groups, by key.
+type GuardrailViolation struct {
+	GuardrailID   string `json:"guardrailId"`
+	GuardrailName string `json:"guardrailName"`
+	Target        string `json:"target"`        // Merged policy section, such as "acls"
+	Index         int    `json:"index"`         // Index of the rule in the merged policy section
+	Key           string `json:"key,omitempty"` // Name of the entry in a named section
+	StackID       string `json:"stackId"`
+	StackName     string `json:"stackName"`
+	ResourceID    string `json:"resourceId"`
+	Rule          any    `json:"rule,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// GuardrailViolationError reports a write or sync that violates guardrails.
+// It matches ErrConflict.
+type GuardrailViolationError struct {
+	Violations []GuardrailViolation
+}
+
+// Error implements the error interface, naming the first violation.
+func (e *GuardrailViolationError) Error() string {
+	if len(e.Violations) == 0 {
+		return "guardrail violated"
+	}
+	v := e.Violations[0]
+	location := fmt.Sprintf("%s rule %d", v.Target, v.Index)
+	if v.Key != "" {
+		location = fmt.Sprintf("%s %q", v.Target, v.Key)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "guardrail %q is violated by %s from stack %s", v.GuardrailName, location, v.StackName)
+	if v.Reason != "" {
+		fmt.Fprintf(&b, ": %s", v.Reason)
+	}
+	if n := len(e.Violations) - 1; n > 0 {
+		fmt.Fprintf(&b, " (and %d more)", n)
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrConflict.
+func (e *GuardrailViolationError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -5,21 +5,24 @@ import "time"
 // Host represents an IP alias in the Tailscale ACL.
 // If multiple stacks define the same host name, first-writer wins (by stack priority).
 type Host struct {
-	ID        string    `json:"id" db:"id"`
-	StackID   string    `json:"stackId" db:"stack_id"`
-	Name      string    `json:"name" db:"name"` // Alias name
-	Address   string    `json:"address" db:"address"` // IP address or CIDR
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID          string    `json:"id" db:"id"`
+	StackID     string    `json:"stackId" db:"stack_id"`
+	Name        string    `json:"name" db:"name"`                         // Alias name
+	Address     string    `json:"address" db:"address"`                   // IP address or CIDR
+	Description string    `json:"description,omitempty" db:"description"` // Rendered as a comment
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
 }
 
 // CreateHostRequest is the request body for creating a host.
 type CreateHostRequest struct {
-	Name    string `json:"name"`
-	Address string `json:"address"`
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Description string `json:"description,omitempty"`
 }
 
 // UpdateHostRequest is the request body for updating a host.
 type UpdateHostRequest struct {
-	Address string `json:"address"`
+	Address     string  `json:"address"`
+	Description *string `json:"description,omitempty"`
 }
@@ -0,0 +1,57 @@
+package domain
+
+import "fmt"
+
+// Lint checks: what a lint issue reports.
+const (
+	LintUndefinedGroup   = "undefined-group"   // A group no stack defines
+	LintUndefinedTag     = "undefined-tag"     // A tag without tag owners
+	LintUndefinedHost    = "undefined-host"    // A host alias no stack defines
+	LintUndefinedIPSet   = "undefined-ipset"   // An IP set no stack defines
+	LintUndefinedPosture = "undefined-posture" // A posture no stack defines
+
+	LintTagGroupMember = "tag-group-member" // A tag among the members of a group
+
+	LintUnusedGroup = "unused-group" // A group nothing references
+	LintUnusedHost  = "unused-host"  // A host alias nothing references
+	LintUnusedIPSet = "unused-ipset" // An IP set nothing references
+
+	LintDuplicateACL = "duplicate-acl" // An ACL identical to an earlier one
+	LintSubsumedACL  = "subsumed-acl"  // An ACL that a broader ACL already allows
+	LintEmptyTest    = "empty-test"    // A test without accept or deny assertions
+	LintEmptyPosture = "empty-posture" // A posture without rules
+)
+
+// Lint severities, from most to least severe.
+const (
+	LintSeverityError   = "error"   // Tailscale rejects the policy
+	LintSeverityWarning = "warning" // The policy works, but an entry has no effect
+	LintSeverityInfo    = "info"    // A definition nothing uses
+)
+
+// LintIssue is a problem in the merged policy, such as a reference to a
+// group that no stack defines or an ACL that duplicates another. Issues in
+// rule sections (acls, grants, ssh, nodeAttrs, tests) name the rule by
+// index; issues in named sections (groups, tagOwners, autoApprovers, hosts,
+// ipsets, postures) name the entry by key.
+type LintIssue struct {
+	Check      string `json:"check"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Reference  string `json:"reference,omitempty"` // The name that is referenced
+	Section    string `json:"section"`             // Merged policy section of the entry
+	Index      int    `json:"index"`               // Index of the rule in a rule section
+	Key        string `json:"key,omitempty"`       // Name of the entry in a named section
+	StackID    string `json:"stackId"`
+	StackName  string `json:"stackName"`
+	ResourceID string `json:"resourceId"`
+}
+
+// Location describes the referencing entry, such as "acls rule 2" or
+// `groups "group:dev"`.
+func (i LintIssue) Location() string {
+	if i.Key != "" {
+		return fmt.Sprintf("%s %q", i.Section, i.Key)
+	}
+	return fmt.Sprintf("%s rule %d", i.Section, i.Index)
+}
@@ -0,0 +1,36 @@
+package domain
+
+// Plan actions for a stack state replacement.
+const (
+	PlanCreate    = "create"
+	PlanUpdate    = "update"
+	PlanDelete    = "delete"
+	PlanUnchanged = "unchanged"
+)
+
+// StatePlan previews what replacing a stack's state would change, both in
+// the stack itself and in the merged policy.
+type StatePlan struct {
+	StackID  string           `json:"stackId"`
+	Summary  PlanSummary      `json:"summary"`
+	Changes  []ResourceChange `json:"changes"`
+	Diff     *PolicyDiff      `json:"diff"`               // Merged policy before and after the replacement
+	Warnings []string         `json:"warnings,omitempty"` // Parts of the request that were ignored
+}
+
+// PlanSummary counts the planned changes by action.
+type PlanSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ResourceChange is the planned change to a single stack resource.
+type ResourceChange struct {
+	Resource string `json:"resource"` // Stack state section, e.g. "groups" or "acls"
+	Key      string `json:"key"`      // Name, tag, "type:match", or rule position
+	Action   string `json:"action"`   // "create", "update", "delete", or "unchanged"
+	Before   any    `json:"before,omitempty"`
+	After    any    `json:"after,omitempty"`
+}
@@ -5,30 +5,30 @@ import "time"
 // PolicyVersion represents a versioned snapshot of the rendered ACL policy.
 // Used for audit trail and rollback capability.
 type PolicyVersion struct {
-	ID             string    `json:"id" db:"id"`
-	VersionNumber  int       `json:"versionNumber" db:"version_number"`
-	RenderedPolicy string    `json:"renderedPolicy" db:"rendered_policy"` // JSON string
-	TailscaleETag  string    `json:"tailscaleEtag,omitempty" db:"tailscale_etag"`
-	PushStatus     string    `json:"pushStatus" db:"push_status"` // "pending", "success", "failed"
-	PushError      string    `json:"pushError,omitempty" db:"push_error"`
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	ID             string     `json:"id" db:"id"`
+	VersionNumber  int        `json:"versionNumber" db:"version_number"`
+	RenderedPolicy string     `json:"renderedPolicy" db:"rendered_policy"` // JSON string
+	TailscaleETag  string     `json:"tailscaleEtag,omitempty" db:"tailscale_etag"`
+	PushStatus     string     `json:"pushStatus" db:"push_status"` // "pending", "success", "failed"
+	PushError      string     `json:"pushError,omitempty" db:"push_error"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
 	PushedAt       *time.Time `json:"pushedAt,omitempty" db:"pushed_at"`
 }
 
 // TailscalePolicy represents the complete Tailscale ACL policy structure.
 // This is what gets rendered and pushed to Tailscale.
 type TailscalePolicy struct {
-	Groups        map[string][]string        `json:"groups,omitempty"`
-	TagOwners     map[string][]string        `json:"tagOwners,omitempty"`
-	Hosts         map[string]string          `json:"hosts,omitempty"`
-	ACLs          []TailscaleACL             `json:"acls,omitempty"`
-	Grants        []TailscaleGrant           `json:"grants,omitempty"`
-	SSH           []TailscaleSSH             `json:"ssh,omitempty"`
-	AutoApprovers *TailscaleAutoApprovers    `json:"autoApprovers,omitempty"`
-	NodeAttrs     []TailscaleNodeAttr        `json:"nodeAttrs,omitempty"`
-	Postures      map[string][]string        `json:"postures,omitempty"`
-	IPSets        map[string][]string        `json:"ipsets,omitempty"`
-	Tests         []TailscaleTest            `json:"tests,omitempty"`
+	Groups        map[string][]string     `json:"groups,omitempty"`
+	TagOwners     map[string][]string     `json:"tagOwners,omitempty"`
+	Hosts         map[string]string       `json:"hosts,omitempty"`
+	ACLs          []TailscaleACL          `json:"acls,omitempty"`
+	Grants        []TailscaleGrant        `json:"grants,omitempty"`
+	SSH           []TailscaleSSH          `json:"ssh,omitempty"`
+	AutoApprovers *TailscaleAutoApprovers `json:"autoApprovers,omitempty"`
+	NodeAttrs     []TailscaleNodeAttr     `json:"nodeAttrs,omitempty"`
+	Postures      map[string][]string     `json:"postures,omitempty"`
+	IPSets        map[string][]string     `json:"ipsets,omitempty"`
+	Tests         []TailscaleTest         `json:"tests,omitempty"`
 }
 
 // TailscaleACL is an ACL rule in Tailscale format.
@@ -41,10 +41,11 @@ type TailscaleACL struct {
 
 // TailscaleGrant is a grant in Tailscale format.
 type TailscaleGrant struct {
-	Src []string               `json:"src"`
-	Dst []string               `json:"dst"`
-	IP  []string               `json:"ip,omitempty"`
-	App map[string][]AppPermission `json:"app,omitempty"`
+	Src        []string                   `json:"src"`
+	Dst        []string                   `json:"dst"`
+	IP         []string                   `json:"ip,omitempty"`
+	App        map[string][]AppPermission `json:"app,omitempty"`
+	SrcPosture []string                   `json:"srcPosture,omitempty"`
 }
 
 // TailscaleSSH is an SSH rule in Tailscale format.
@@ -83,10 +84,15 @@ type SyncRequest struct {
 
 // SyncResponse is returned after a sync operation.
 type SyncResponse struct {
-	VersionID     string `json:"versionId"`
-	VersionNumber int    `json:"versionNumber"`
-	Status        string `json:"status"`
-	Error         string `json:"error,omitempty"`
+	VersionID           string               `json:"versionId"`
+	VersionNumber       int                  `json:"versionNumber"`
+	Status              string               `json:"status"`
+	Error               string               `json:"error,omitempty"`
+	Warnings            []string             `json:"warnings,omitempty"`
+	TestResults         []PolicyTestResult   `json:"testResults,omitempty"`         // Set when local ACL tests fail
+	Conflicts           []MergeConflict      `json:"conflicts,omitempty"`           // Shadowed definitions
+	GuardrailViolations []GuardrailViolation `json:"guardrailViolations,omitempty"` // Set when the policy violates guardrails
+	LintIssues          []LintIssue          `json:"lintIssues,omitempty"`          // Set when groups have tag members
 }
 
 // RollbackRequest is used to rollback to a previous version.
@@ -98,6 +104,7 @@ type RollbackRequest struct {
 type MutationResponse struct {
 	Data       any           `json:"data"`
 	SyncResult *SyncResponse `json:"syncResult,omitempty"`
+	Warnings   []string      `json:"warnings,omitempty"` // Parts of the request that were ignored
 }
 
 // DryRunResponse is returned for ?dryRun=true requests.
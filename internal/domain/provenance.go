@@ -0,0 +1,43 @@
+package domain
+
+// RuleSource identifies the stack resource a merged policy entry came from.
+type RuleSource struct {
+	StackID    string `json:"stackId"`
+	ResourceID string `json:"resourceId"`
+	Order      int    `json:"order"` // The resource's order within its stack; 0 for named resources
+
+	Description string `json:"description,omitempty"` // The resource's description, if any
+}
+
+// PolicyProvenance maps merged policy entries back to the resources that
+// produced them. Rule slices are parallel to the corresponding TailscalePolicy
+// slices. Groups, tag owners, and auto approvers are keyed by name and then
+// member, since a member may be contributed by several stacks. Hosts,
+// postures, and IP sets record only the highest-priority resource that
+// defines them.
+type PolicyProvenance struct {
+	Stacks map[string]string `json:"stacks"` // Stack ID to name
+
+	Groups        map[string]map[string][]RuleSource `json:"groups,omitempty"`
+	NestedGroups  map[string]map[string][]RuleSource `json:"nestedGroups,omitempty"` // Groups flattened into each group, keyed by group and then nested group
+	TagOwners     map[string]map[string][]RuleSource `json:"tagOwners,omitempty"`
+	AutoApprovers map[string]map[string][]RuleSource `json:"autoApprovers,omitempty"` // Keyed by route CIDR, or "exitNode"
+	Hosts         map[string]RuleSource              `json:"hosts,omitempty"`
+	Postures      map[string]RuleSource              `json:"postures,omitempty"`
+	IPSets        map[string]RuleSource              `json:"ipsets,omitempty"`
+
+	ACLs      []RuleSource `json:"acls,omitempty"`
+	Grants    []RuleSource `json:"grants,omitempty"`
+	SSH       []RuleSource `json:"ssh,omitempty"`
+	NodeAttrs []RuleSource `json:"nodeAttrs,omitempty"`
+	Tests     []RuleSource `json:"tests,omitempty"`
+
+	Strategies MergeStrategies `json:"strategies"`          // Merge strategy of each named section
+	Conflicts  []MergeConflict `json:"conflicts,omitempty"` // Shadowed definitions
+}
+
+// ExplainedPolicy is a merged policy together with its provenance.
+type ExplainedPolicy struct {
+	Policy     *TailscalePolicy  `json:"policy"`
+	Provenance *PolicyProvenance `json:"provenance"`
+}
@@ -1,28 +1,61 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Stack represents an IaC deployment or rule owner.
 // Each stack contains a set of ACL resources that will be merged together.
 type Stack struct {
-	ID          string    `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	Priority    int       `json:"priority" db:"priority"` // Lower = higher priority
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+	ID                string    `json:"id" db:"id"`
+	Name              string    `json:"name" db:"name"`
+	Description       string    `json:"description" db:"description"`
+	Priority          int       `json:"priority" db:"priority"`                    // Lower = higher priority
+	Generation        int64     `json:"generation" db:"generation"`                // Bumped by every change to the stack's resources
+	RequiredApprovals int       `json:"requiredApprovals" db:"required_approvals"` // Writes are staged as change sets when > 0
+	Disabled          bool      `json:"disabled" db:"disabled"`                    // Disabled stacks are left out of the merged policy
+	CreatedAt         time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// RequiresApproval reports whether writes to the stack are staged as change
+// sets.
+func (s *Stack) RequiresApproval() bool {
+	return s.RequiredApprovals > 0
 }
 
 // CreateStackRequest is the request body for creating a stack.
 type CreateStackRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
-	Priority    int    `json:"priority,omitempty"`
+	Name              string `json:"name"`
+	Description       string `json:"description,omitempty"`
+	Priority          int    `json:"priority,omitempty"`
+	RequiredApprovals int    `json:"requiredApprovals,omitempty"`
+	Disabled          bool   `json:"disabled,omitempty"`
 }
 
 // UpdateStackRequest is the request body for updating a stack.
 type UpdateStackRequest struct {
-	Name        *string `json:"name,omitempty"`
-	Description *string `json:"description,omitempty"`
-	Priority    *int    `json:"priority,omitempty"`
+	Name              *string `json:"name,omitempty"`
+	Description       *string `json:"description,omitempty"`
+	Priority          *int    `json:"priority,omitempty"`
+	RequiredApprovals *int    `json:"requiredApprovals,omitempty"` // Lowering it requires the policy-admin role
+	Disabled          *bool   `json:"disabled,omitempty"`          // Requires the policy-admin role if the stack requires approvals
+}
+
+// StackGenerationError reports a write whose If-Match names a stack
+// generation that is no longer current. It matches ErrPreconditionFailed.
+type StackGenerationError struct {
+	StackID    string
+	Generation int64 // The current generation
+}
+
+// Error implements the error interface.
+func (e *StackGenerationError) Error() string {
+	return fmt.Sprintf("stack %s has been modified (generation %d)", e.StackID, e.Generation)
+}
+
+// Is reports whether target is ErrPreconditionFailed.
+func (e *StackGenerationError) Is(target error) bool {
+	return target == ErrPreconditionFailed
 }
@@ -0,0 +1,36 @@
+package domain
+
+// Merge strategies: how the definitions of one name by several stacks are
+// combined in the merged policy.
+const (
+	MergeStrategyUnion            = "union"             // Every member of every definition
+	MergeStrategyPriorityOverride = "priority-override" // The definition of the highest-priority stack
+	MergeStrategyErrorOnConflict  = "error-on-conflict" // Like priority-override, but differing definitions fail syncs
+	MergeStrategyIntersect        = "intersect"         // Only the members of every definition
+)
+
+// MergeStrategies maps the named sections of the merged policy (groups,
+// tagOwners, autoApprovers, hosts, postures, ipsets) to their merge
+// strategy. Rule sections are always concatenated in stack priority order.
+type MergeStrategies map[string]string
+
+// DefaultMergeStrategies returns the strategy of each named section when
+// none is configured.
+func DefaultMergeStrategies() MergeStrategies {
+	return MergeStrategies{
+		"groups":        MergeStrategyUnion,
+		"tagOwners":     MergeStrategyUnion,
+		"autoApprovers": MergeStrategyUnion,
+		"hosts":         MergeStrategyPriorityOverride,
+		"postures":      MergeStrategyPriorityOverride,
+		"ipsets":        MergeStrategyPriorityOverride,
+	}
+}
+
+// For returns the strategy of section, or its default if none is set.
+func (s MergeStrategies) For(section string) string {
+	if strategy, ok := s[section]; ok {
+		return strategy
+	}
+	return DefaultMergeStrategies()[section]
+}
@@ -0,0 +1,566 @@
+// Package evaluator evaluates connections and ACL tests against a merged
+// Tailscale policy locally, without calling the Tailscale API.
+//
+// The evaluator models the parts of Tailscale's policy semantics that can be
+// decided from the policy file alone: users, groups, tags, hosts, IP sets,
+// IPs and CIDRs, and the autogroups member, tagged, self and internet.
+// Selectors it cannot resolve, such as autogroup:admin, leave the outcome of
+// the connections they might allow unknown, and tests of those connections
+// are skipped.
+package evaluator
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// Protocols understood by the evaluator.
+const (
+	ProtoTCP  = "tcp"
+	ProtoUDP  = "udp"
+	ProtoICMP = "icmp"
+)
+
+// Request describes a connection to evaluate.
+type Request struct {
+	Src   string // User, group, tag, host name, or IP
+	Dst   string // User, tag, host name, IP, or CIDR
+	Port  int
+	Proto string // Defaults to tcp
+}
+
+// Decision is the result of evaluating a Request.
+type Decision struct {
+	Allowed bool
+	Match   *domain.RuleMatch // The first rule that allowed the connection
+	Unknown []string          // Unresolvable selectors of rules that might allow the connection
+}
+
+// Evaluator evaluates requests against a single policy.
+type Evaluator struct {
+	policy *domain.TailscalePolicy
+}
+
+// New creates an Evaluator for the given policy.
+func New(policy *domain.TailscalePolicy) *Evaluator {
+	if policy == nil {
+		policy = &domain.TailscalePolicy{}
+	}
+	return &Evaluator{policy: policy}
+}
+
+// Check reports whether the policy allows the request.
+// ACLs are checked before grants; the first matching rule is reported.
+// A request no rule allows reports the unresolvable selectors of the rules
+// that might allow it; its outcome is unknown if there are any.
+func (e *Evaluator) Check(req Request) Decision {
+	proto := normalizeProto(req.Proto)
+	src := e.resolve(req.Src)
+	dst := e.resolve(req.Dst)
+	var unknown []string
+
+	for i, acl := range e.policy.ACLs {
+		if acl.Action != "" && acl.Action != "accept" {
+			continue
+		}
+		if !protoMatches(acl.Protocol, proto) {
+			continue
+		}
+		srcMatch := e.anyMatches(acl.Src, src, nil)
+		if srcMatch == noMatch {
+			continue
+		}
+		for _, d := range acl.Dst {
+			target, ports, ok := splitTargetPorts(d)
+			if !ok || !portsMatch(ports, req.Port) {
+				continue
+			}
+			switch both(srcMatch, e.matches(target, dst, &src)) {
+			case isMatch:
+				return Decision{Allowed: true, Match: &domain.RuleMatch{Type: domain.RuleTypeACL, Index: i}}
+			case unknownMatch:
+				unknown = append(unknown, e.unresolved(append([]string{target}, acl.Src...))...)
+			}
+		}
+	}
+
+	for i, grant := range e.policy.Grants {
+		if !ipCapsMatch(grant.IP, proto, req.Port) {
+			continue
+		}
+		srcMatch := e.anyMatches(grant.Src, src, nil)
+		if srcMatch == noMatch {
+			continue
+		}
+		switch both(srcMatch, e.anyMatches(grant.Dst, dst, &src)) {
+		case isMatch:
+			return Decision{Allowed: true, Match: &domain.RuleMatch{Type: domain.RuleTypeGrant, Index: i}}
+		case unknownMatch:
+			unknown = append(unknown, e.unresolved(append(slices.Clone(grant.Src), grant.Dst...))...)
+		}
+	}
+
+	slices.Sort(unknown)
+	return Decision{Unknown: slices.Compact(unknown)}
+}
+
+// Memberships lists the groups, IP sets, hosts and autogroups that include
+// the given user, tag, host name, or IP. Nested groups are included.
+func (e *Evaluator) Memberships(s string) []string {
+	p := e.resolve(s)
+	var names []string
+
+	for name := range e.policy.Groups {
+		if name != s && e.matches(name, p, nil) == isMatch {
+			names = append(names, name)
+		}
+	}
+	for name := range e.policy.IPSets {
+		if name != s && e.matches(name, p, nil) == isMatch {
+			names = append(names, name)
+		}
+	}
+	if len(p.prefixes) > 0 {
+		for name, addr := range e.policy.Hosts {
+			if name != s && e.matches(addr, p, nil) == isMatch {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, ag := range []string{"autogroup:member", "autogroup:tagged", "autogroup:internet"} {
+		if matchesAutogroup(ag, p, nil) == isMatch {
+			names = append(names, ag)
+		}
+	}
+
+	return names
+}
+
+// Expand resolves a selector to its leaf members, following nested groups.
+// Selectors other than groups expand to themselves.
+func (e *Evaluator) Expand(sel string) []string {
+	seen := map[string]bool{}
+	var members []string
+	var walk func(string)
+	walk = func(s string) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		if strings.HasPrefix(s, "group:") {
+			for _, m := range e.policy.Groups[s] {
+				walk(m)
+			}
+			return
+		}
+		members = append(members, s)
+	}
+	walk(sel)
+	return members
+}
+
+// TagOwners returns the expanded owners of a tag, or nil if the tag has none.
+func (e *Evaluator) TagOwners(tag string) []string {
+	owners, ok := e.policy.TagOwners[tag]
+	if !ok {
+		return nil
+	}
+	seen := map[string]bool{}
+	var expanded []string
+	for _, owner := range owners {
+		for _, m := range e.Expand(owner) {
+			if !seen[m] {
+				seen[m] = true
+				expanded = append(expanded, m)
+			}
+		}
+	}
+	return expanded
+}
+
+// RunTests evaluates every test in the policy. Tests with an assertion
+// whose outcome is unknown, and none that fails, are skipped.
+func (e *Evaluator) RunTests() []domain.PolicyTestResult {
+	results := make([]domain.PolicyTestResult, 0, len(e.policy.Tests))
+	for i, test := range e.policy.Tests {
+		result := domain.PolicyTestResult{Index: i, Src: test.Src}
+		for _, dst := range test.Accept {
+			result.Assertions = append(result.Assertions, e.assert(test.Src, dst, "accept"))
+		}
+		for _, dst := range test.Deny {
+			result.Assertions = append(result.Assertions, e.assert(test.Src, dst, "deny"))
+		}
+
+		failed := false
+		for _, a := range result.Assertions {
+			if len(a.Unknown) > 0 {
+				result.Skipped = true
+			} else if !a.Passed {
+				failed = true
+			}
+		}
+		result.Skipped = result.Skipped && !failed
+		result.Passed = !failed && !result.Skipped
+		results = append(results, result)
+	}
+	return results
+}
+
+// RunTests evaluates every test in the policy.
+func RunTests(policy *domain.TailscalePolicy) []domain.PolicyTestResult {
+	return New(policy).RunTests()
+}
+
+// FailedTests returns the number of failed results. Skipped tests have not
+// failed.
+func FailedTests(results []domain.PolicyTestResult) int {
+	failed := 0
+	for _, r := range results {
+		if !r.Passed && !r.Skipped {
+			failed++
+		}
+	}
+	return failed
+}
+
+// SkippedTests returns the number of skipped results and the unresolvable
+// selectors that left them unknown.
+func SkippedTests(results []domain.PolicyTestResult) (int, []string) {
+	skipped := 0
+	var unknown []string
+	for _, r := range results {
+		if !r.Skipped {
+			continue
+		}
+		skipped++
+		for _, a := range r.Assertions {
+			unknown = append(unknown, a.Unknown...)
+		}
+	}
+	slices.Sort(unknown)
+	return skipped, slices.Compact(unknown)
+}
+
+// assert evaluates a single "host:port" test entry.
+func (e *Evaluator) assert(src, dst, expected string) domain.PolicyTestAssertion {
+	assertion := domain.PolicyTestAssertion{Dst: dst, Expected: expected}
+
+	target, portStr, ok := splitTargetPorts(dst)
+	if !ok {
+		assertion.Error = "destination must be in host:port format"
+		return assertion
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		assertion.Error = fmt.Sprintf("invalid port %q", portStr)
+		return assertion
+	}
+
+	decision := e.Check(Request{Src: src, Dst: target, Port: port})
+	assertion.Match = decision.Match
+	if !decision.Allowed && len(decision.Unknown) > 0 {
+		assertion.Unknown = decision.Unknown
+		return assertion
+	}
+	assertion.Passed = decision.Allowed == (expected == "accept")
+	return assertion
+}
+
+// principal is a resolved request source or destination.
+type principal struct {
+	raw      string
+	user     string         // Set for user identities
+	tag      string         // Set for tags
+	prefixes []netip.Prefix // Addresses, for IPs and hosts
+}
+
+// resolve turns a request endpoint into a principal.
+func (e *Evaluator) resolve(s string) principal {
+	p := principal{raw: s}
+
+	switch {
+	case strings.HasPrefix(s, "tag:"):
+		p.tag = s
+	case strings.HasPrefix(s, "group:"), strings.HasPrefix(s, "autogroup:"), strings.HasPrefix(s, "ipset:"):
+		// Matched by name only
+	default:
+		if prefix, ok := parsePrefix(s); ok {
+			p.prefixes = []netip.Prefix{prefix}
+		} else if addr, ok := e.policy.Hosts[s]; ok {
+			if prefix, ok := parsePrefix(addr); ok {
+				p.prefixes = []netip.Prefix{prefix}
+			}
+		} else if strings.Contains(s, "@") {
+			p.user = s
+		}
+	}
+
+	return p
+}
+
+// match is the result of matching a selector against a principal.
+type match int
+
+const (
+	noMatch      match = iota
+	isMatch            // The selector matches
+	unknownMatch       // The selector might match, but cannot be resolved
+)
+
+// matchIf returns isMatch if ok, and noMatch otherwise.
+func matchIf(ok bool) match {
+	if ok {
+		return isMatch
+	}
+	return noMatch
+}
+
+// both combines the matches of a rule's source and destination.
+func both(a, b match) match {
+	if a == noMatch || b == noMatch {
+		return noMatch
+	}
+	return max(a, b)
+}
+
+// anyMatches reports whether any selector matches the principal.
+func (e *Evaluator) anyMatches(selectors []string, p principal, src *principal) match {
+	result := noMatch
+	for _, sel := range selectors {
+		switch e.matches(sel, p, src) {
+		case isMatch:
+			return isMatch
+		case unknownMatch:
+			result = unknownMatch
+		}
+	}
+	return result
+}
+
+// matches reports whether a policy selector matches the principal.
+// src is the request source when matching a destination, for autogroup:self.
+func (e *Evaluator) matches(sel string, p principal, src *principal) match {
+	return e.matchesVisited(sel, p, src, map[string]bool{})
+}
+
+func (e *Evaluator) matchesVisited(sel string, p principal, src *principal, visited map[string]bool) match {
+	if sel == "*" || sel == p.raw {
+		return isMatch
+	}
+
+	switch {
+	case strings.HasPrefix(sel, "group:"):
+		if visited[sel] {
+			return noMatch
+		}
+		visited[sel] = true
+		return e.anyMatchesVisited(e.policy.Groups[sel], p, src, visited)
+
+	case strings.HasPrefix(sel, "tag:"):
+		return matchIf(p.tag == sel)
+
+	case strings.HasPrefix(sel, "autogroup:"):
+		return matchesAutogroup(sel, p, src)
+
+	case strings.HasPrefix(sel, "ipset:"):
+		if visited[sel] {
+			return noMatch
+		}
+		visited[sel] = true
+		return e.anyMatchesVisited(e.policy.IPSets[sel], p, src, visited)
+
+	case strings.HasPrefix(sel, "*@"):
+		return matchIf(p.user != "" && strings.HasSuffix(p.user, sel[1:]))
+	}
+
+	if strings.HasPrefix(sel, "host:") {
+		sel = strings.TrimPrefix(sel, "host:")
+	}
+	if addr, ok := e.policy.Hosts[sel]; ok {
+		sel = addr
+	}
+	if prefix, ok := parsePrefix(sel); ok {
+		return matchIf(containsAny(prefix, p.prefixes))
+	}
+
+	return noMatch
+}
+
+// anyMatchesVisited matches the members of a group or IP set.
+func (e *Evaluator) anyMatchesVisited(selectors []string, p principal, src *principal, visited map[string]bool) match {
+	result := noMatch
+	for _, sel := range selectors {
+		switch e.matchesVisited(sel, p, src, visited) {
+		case isMatch:
+			return isMatch
+		case unknownMatch:
+			result = unknownMatch
+		}
+	}
+	return result
+}
+
+// matchesAutogroup handles the autogroups that can be decided from the
+// policy alone. Other autogroups, such as autogroup:admin, depend on the
+// tailnet and match unknown.
+func matchesAutogroup(sel string, p principal, src *principal) match {
+	switch sel {
+	case "autogroup:member":
+		return matchIf(p.user != "")
+	case "autogroup:tagged":
+		return matchIf(p.tag != "")
+	case "autogroup:self":
+		return matchIf(src != nil && p.user != "" && p.user == src.user)
+	case "autogroup:internet":
+		for _, prefix := range p.prefixes {
+			if isInternet(prefix.Addr()) {
+				return isMatch
+			}
+		}
+		return noMatch
+	}
+	return unknownMatch
+}
+
+// resolvableAutogroups are the autogroups matchesAutogroup decides.
+var resolvableAutogroups = []string{"autogroup:member", "autogroup:tagged", "autogroup:self", "autogroup:internet"}
+
+// unresolved returns the autogroups among selectors, and the members of the
+// groups among them, that cannot be resolved from the policy alone.
+func (e *Evaluator) unresolved(selectors []string) []string {
+	var names []string
+	for _, sel := range selectors {
+		for _, m := range e.Expand(sel) {
+			if strings.HasPrefix(m, "autogroup:") && !slices.Contains(resolvableAutogroups, m) {
+				names = append(names, m)
+			}
+		}
+	}
+	return names
+}
+
+// tailscaleRanges are address ranges assigned within a tailnet.
+var tailscaleRanges = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("fd7a:115c:a1e0::/48"),
+}
+
+// isInternet reports whether an address is outside the tailnet and private ranges.
+func isInternet(addr netip.Addr) bool {
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, r := range tailscaleRanges {
+		if r.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny reports whether the selector prefix fully contains any of the prefixes.
+func containsAny(sel netip.Prefix, prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if sel.Bits() <= p.Bits() && sel.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses an IP address or CIDR.
+func parsePrefix(s string) (netip.Prefix, bool) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		return prefix.Masked(), true
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// splitTargetPorts splits "target:ports" at the last colon.
+func splitTargetPorts(s string) (target, ports string, ok bool) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 || i == len(s)-1 {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// portsMatch reports whether a port list such as "*", "22", "80,443" or
+// "8000-9000" includes the port.
+func portsMatch(ports string, port int) bool {
+	for _, part := range strings.Split(ports, ",") {
+		if portRangeMatches(strings.TrimSpace(part), port) {
+			return true
+		}
+	}
+	return false
+}
+
+// portRangeMatches matches a single port, range, or wildcard.
+func portRangeMatches(spec string, port int) bool {
+	if spec == "*" {
+		return true
+	}
+	if lo, hi, found := strings.Cut(spec, "-"); found {
+		low, err1 := strconv.Atoi(lo)
+		high, err2 := strconv.Atoi(hi)
+		return err1 == nil && err2 == nil && port >= low && port <= high
+	}
+	p, err := strconv.Atoi(spec)
+	return err == nil && p == port
+}
+
+// ipCapsMatch reports whether a grant's ip list allows the protocol and port.
+// Entries look like "*", "443", "tcp:443", "udp:53" or "tcp:8000-9000".
+func ipCapsMatch(caps []string, proto string, port int) bool {
+	for _, c := range caps {
+		capProto, ports, found := strings.Cut(c, ":")
+		if !found {
+			ports = c
+			capProto = ""
+		}
+		if capProto != "" && normalizeProto(capProto) != proto {
+			continue
+		}
+		if portsMatch(ports, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// protoMatches reports whether an ACL's proto field allows the protocol.
+// An empty proto allows all protocols.
+func protoMatches(aclProto, proto string) bool {
+	return aclProto == "" || normalizeProto(aclProto) == proto
+}
+
+// normalizeProto maps IANA protocol numbers to names and defaults to tcp.
+func normalizeProto(proto string) string {
+	switch strings.ToLower(proto) {
+	case "", "6", ProtoTCP:
+		return ProtoTCP
+	case "17", ProtoUDP:
+		return ProtoUDP
+	case "1", ProtoICMP:
+		return ProtoICMP
+	default:
+		return strings.ToLower(proto)
+	}
+}
@@ -0,0 +1,175 @@
+package evaluator_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/evaluator"
+)
+
+func testPolicy() *domain.TailscalePolicy {
+	return &domain.TailscalePolicy{
+		Groups: map[string][]string{
+			"group:dev":  {"alice@example.com", "bob@example.com"},
+			"group:ops":  {"carol@example.com"},
+			"group:eng":  {"group:dev", "group:ops"},
+			"group:loop": {"group:loop", "dave@example.com"},
+		},
+		Hosts: map[string]string{
+			"db":      "10.0.0.5",
+			"web-net": "10.1.0.0/24",
+		},
+		IPSets: map[string][]string{
+			"ipset:prod": {"10.2.0.0/16", "host:db"},
+		},
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"db:5432"}},
+			{Action: "accept", Src: []string{"group:eng"}, Dst: []string{"tag:server:22,80", "web-net:8000-9000"}},
+			{Action: "accept", Protocol: "udp", Src: []string{"tag:monitor"}, Dst: []string{"ipset:prod:161"}},
+			{Action: "accept", Src: []string{"autogroup:member"}, Dst: []string{"autogroup:self:*", "autogroup:internet:443"}},
+			{Action: "accept", Src: []string{"group:loop"}, Dst: []string{"10.9.9.9:1"}},
+		},
+		Grants: []domain.TailscaleGrant{
+			{Src: []string{"*@example.com"}, Dst: []string{"10.3.0.0/16"}, IP: []string{"tcp:443"}},
+			{Src: []string{"autogroup:tagged"}, Dst: []string{"100.64.0.1"}, IP: []string{"*"}},
+			{Src: []string{"*"}, Dst: []string{"*"}}, // App-only grants give no network access
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	e := evaluator.New(testPolicy())
+
+	tests := []struct {
+		name    string
+		req     evaluator.Request
+		allowed bool
+		match   *domain.RuleMatch
+	}{
+		{"group member to host", evaluator.Request{Src: "alice@example.com", Dst: "db", Port: 5432}, true, &domain.RuleMatch{Type: "acl", Index: 0}},
+		{"group member to host IP", evaluator.Request{Src: "bob@example.com", Dst: "10.0.0.5", Port: 5432}, true, &domain.RuleMatch{Type: "acl", Index: 0}},
+		{"wrong port", evaluator.Request{Src: "alice@example.com", Dst: "db", Port: 22}, false, nil},
+		{"non-member", evaluator.Request{Src: "carol@example.com", Dst: "db", Port: 5432}, false, nil},
+		{"nested group to tag", evaluator.Request{Src: "carol@example.com", Dst: "tag:server", Port: 80}, true, &domain.RuleMatch{Type: "acl", Index: 1}},
+		{"port range in CIDR host", evaluator.Request{Src: "alice@example.com", Dst: "10.1.0.7", Port: 8500}, true, &domain.RuleMatch{Type: "acl", Index: 1}},
+		{"outside port range", evaluator.Request{Src: "alice@example.com", Dst: "10.1.0.7", Port: 9500}, false, nil},
+		{"proto mismatch", evaluator.Request{Src: "tag:monitor", Dst: "10.2.3.4", Port: 161}, false, nil},
+		{"ipset with udp", evaluator.Request{Src: "tag:monitor", Dst: "10.2.3.4", Port: 161, Proto: "udp"}, true, &domain.RuleMatch{Type: "acl", Index: 2}},
+		{"ipset host reference", evaluator.Request{Src: "tag:monitor", Dst: "db", Port: 161, Proto: "17"}, true, &domain.RuleMatch{Type: "acl", Index: 2}},
+		{"autogroup self", evaluator.Request{Src: "alice@example.com", Dst: "alice@example.com", Port: 3000}, true, &domain.RuleMatch{Type: "acl", Index: 3}},
+		{"autogroup self other user", evaluator.Request{Src: "alice@example.com", Dst: "bob@example.com", Port: 3000}, false, nil},
+		{"autogroup internet", evaluator.Request{Src: "alice@example.com", Dst: "8.8.8.8", Port: 443}, true, &domain.RuleMatch{Type: "acl", Index: 3}},
+		{"tailnet address is not internet", evaluator.Request{Src: "alice@example.com", Dst: "100.64.0.9", Port: 443}, false, nil},
+		{"group cycle", evaluator.Request{Src: "dave@example.com", Dst: "10.9.9.9", Port: 1}, true, &domain.RuleMatch{Type: "acl", Index: 4}},
+		{"grant by domain", evaluator.Request{Src: "zed@example.com", Dst: "10.3.1.1", Port: 443}, true, &domain.RuleMatch{Type: "grant", Index: 0}},
+		{"grant wrong proto", evaluator.Request{Src: "zed@example.com", Dst: "10.3.1.1", Port: 443, Proto: "udp"}, false, nil},
+		{"grant to tagged", evaluator.Request{Src: "tag:ci", Dst: "100.64.0.1", Port: 9999}, true, &domain.RuleMatch{Type: "grant", Index: 1}},
+		{"unknown source", evaluator.Request{Src: "mallory@evil.test", Dst: "10.3.1.1", Port: 443}, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := e.Check(tt.req)
+			if d.Allowed != tt.allowed {
+				t.Fatalf("Check(%+v).Allowed = %v, want %v", tt.req, d.Allowed, tt.allowed)
+			}
+			if (d.Match == nil) != (tt.match == nil) || (d.Match != nil && *d.Match != *tt.match) {
+				t.Errorf("Check(%+v).Match = %+v, want %+v", tt.req, d.Match, tt.match)
+			}
+		})
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	policy := testPolicy()
+	policy.Tests = []domain.TailscaleTest{
+		{Src: "alice@example.com", Accept: []string{"db:5432"}, Deny: []string{"db:22"}},
+		{Src: "carol@example.com", Accept: []string{"db:5432"}},
+		{Src: "alice@example.com", Accept: []string{"db"}},
+	}
+
+	results := evaluator.RunTests(policy)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	if !results[0].Passed || len(results[0].Assertions) != 2 {
+		t.Errorf("Expected test 0 to pass with 2 assertions, got %+v", results[0])
+	}
+	if results[0].Assertions[0].Match == nil || results[0].Assertions[0].Match.Index != 0 {
+		t.Errorf("Expected accept assertion to report ACL 0, got %+v", results[0].Assertions[0].Match)
+	}
+
+	if results[1].Passed || results[1].Assertions[0].Passed {
+		t.Errorf("Expected test 1 to fail, got %+v", results[1])
+	}
+
+	if results[2].Passed || results[2].Assertions[0].Error == "" {
+		t.Errorf("Expected test 2 to fail with a format error, got %+v", results[2])
+	}
+
+	if failed := evaluator.FailedTests(results); failed != 2 {
+		t.Errorf("Expected 2 failed tests, got %d", failed)
+	}
+}
+
+func TestRunTests_UnknownAutogroups(t *testing.T) {
+	policy := testPolicy()
+	policy.Groups["group:admins"] = []string{"autogroup:admin"}
+	policy.ACLs = append(policy.ACLs,
+		domain.TailscaleACL{Action: "accept", Src: []string{"group:admins"}, Dst: []string{"db:443"}},
+		domain.TailscaleACL{Action: "accept", Src: []string{"autogroup:shared"}, Dst: []string{"tag:server:443"}},
+	)
+	policy.Tests = []domain.TailscaleTest{
+		{Src: "carol@example.com", Accept: []string{"db:443"}},                            // Only admins may have access
+		{Src: "alice@example.com", Accept: []string{"db:5432"}, Deny: []string{"db:443"}}, // Unknown, not failed
+		{Src: "carol@example.com", Deny: []string{"db:5432"}},                             // The rule cannot apply
+		{Src: "alice@example.com", Accept: []string{"db:22"}, Deny: []string{"db:443"}},   // A known failure fails the test
+	}
+
+	results := evaluator.RunTests(policy)
+
+	if !results[0].Skipped || results[0].Passed || strings.Join(results[0].Assertions[0].Unknown, ",") != "autogroup:admin" {
+		t.Errorf("Expected test 0 to be skipped on autogroup:admin, got %+v", results[0])
+	}
+	if !results[1].Skipped || !results[1].Assertions[0].Passed {
+		t.Errorf("Expected test 1 to be skipped, got %+v", results[1])
+	}
+	if results[2].Skipped || !results[2].Passed {
+		t.Errorf("Expected test 2 to pass, got %+v", results[2])
+	}
+	if results[3].Skipped || results[3].Passed {
+		t.Errorf("Expected test 3 to fail, got %+v", results[3])
+	}
+
+	if failed := evaluator.FailedTests(results); failed != 1 {
+		t.Errorf("Expected 1 failed test, got %d", failed)
+	}
+	skipped, unknown := evaluator.SkippedTests(results)
+	if skipped != 2 || strings.Join(unknown, ",") != "autogroup:admin" {
+		t.Errorf("Expected 2 tests skipped on autogroup:admin, got %d on %v", skipped, unknown)
+	}
+}
+
+func TestMemberships(t *testing.T) {
+	e := evaluator.New(testPolicy())
+
+	got := e.Memberships("carol@example.com")
+	want := []string{"group:eng", "group:ops", "autogroup:member"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Memberships(carol) = %v, want %v", got, want)
+	}
+
+	got = e.Memberships("db")
+	want = []string{"ipset:prod"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Memberships(db) = %v, want %v", got, want)
+	}
+
+	got = e.Memberships("10.1.0.7")
+	want = []string{"web-net"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Memberships(10.1.0.7) = %v, want %v", got, want)
+	}
+}
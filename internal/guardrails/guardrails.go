@@ -0,0 +1,305 @@
+// Package guardrails evaluates organisation-wide rules against the merged
+// policy. Guardrails are stored with the stacks, either created through the
+// API or loaded from the guardrails file at startup.
+package guardrails
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/lint"
+	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+	"github.com/google/uuid"
+)
+
+// Evaluate returns the entries of policy that the guardrails forbid, naming
+// the stack that contributed each one.
+func Evaluate(rules []*domain.Guardrail, policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.GuardrailViolation {
+	var violations []domain.GuardrailViolation
+	var references []domain.LintIssue
+	linted := false
+	for _, g := range rules {
+		if g.Match.UndefinedReferences {
+			if !linted {
+				references, linted = lint.References(policy, provenance), true
+			}
+			for _, issue := range references {
+				if g.AppliesTo(issue.Section) {
+					violations = append(violations, referenceViolation(g, issue))
+				}
+			}
+			continue
+		}
+		if g.AppliesTo(domain.GuardrailTargetACLs) {
+			for i, acl := range policy.ACLs {
+				if matches(g.Match, acl.Src, acl.Dst, nil, "", nil) {
+					violations = append(violations, violation(g, domain.GuardrailTargetACLs, i, provenance.ACLs, provenance, acl))
+				}
+			}
+		}
+		if g.AppliesTo(domain.GuardrailTargetGrants) {
+			for i, grant := range policy.Grants {
+				if matches(g.Match, grant.Src, grantDestinations(grant), nil, "", grant.SrcPosture) {
+					violations = append(violations, violation(g, domain.GuardrailTargetGrants, i, provenance.Grants, provenance, grant))
+				}
+			}
+		}
+		if g.AppliesTo(domain.GuardrailTargetSSH) {
+			for i, ssh := range policy.SSH {
+				if matches(g.Match, ssh.Src, ssh.Dst, ssh.Users, ssh.Action, nil) {
+					violations = append(violations, violation(g, domain.GuardrailTargetSSH, i, provenance.SSH, provenance, ssh))
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// Check merges the policy in store with strategies and evaluates its
+// guardrails.
+func Check(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies) ([]domain.GuardrailViolation, error) {
+	rules, err := store.ListGuardrails(ctx)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+	return evaluateStore(ctx, rules, store, strategies)
+}
+
+// CheckWrite applies fn in tx and returns a *domain.GuardrailViolationError
+// if the policy merged from tx with strategies afterwards violates guardrails
+// in ways it did not before. Violations that already exist do not block
+// writes, so stacks can be fixed one write at a time. Errors from fn are
+// returned as they are. The caller must roll tx back when CheckWrite fails.
+func CheckWrite(ctx context.Context, tx storage.Transaction, strategies domain.MergeStrategies, fn func(tx storage.Transaction) error) error {
+	rules, err := tx.ListGuardrails(ctx)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return fn(tx)
+	}
+
+	before, err := evaluateStore(ctx, rules, tx, strategies)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	after, err := evaluateStore(ctx, rules, tx, strategies)
+	if err != nil {
+		return err
+	}
+
+	if added := newViolations(before, after); len(added) > 0 {
+		return &domain.GuardrailViolationError{Violations: added}
+	}
+	return nil
+}
+
+// CheckState reports like CheckWrite whether replacing the state of stackID
+// would violate guardrails, without writing anything: the replacement is
+// made in a transaction that is always rolled back.
+func CheckState(ctx context.Context, store storage.Storage, strategies domain.MergeStrategies, stackID string, state *domain.StackState) error {
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	return CheckWrite(ctx, tx, strategies, func(tx storage.Transaction) error {
+		if err := stackstate.Clear(ctx, tx, stackID); err != nil {
+			return err
+		}
+		return stackstate.Apply(ctx, tx, stackID, state)
+	})
+}
+
+// LoadFile replaces the guardrails loaded from configuration with the
+// guardrails in the JSON file at path, a list of guardrails in the form
+// accepted by the API. An empty path removes them. Guardrails created
+// through the API are kept.
+func LoadFile(ctx context.Context, store storage.Storage, path string, now time.Time) (int, error) {
+	var reqs []domain.CreateGuardrailRequest
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if err := json.Unmarshal(data, &reqs); err != nil {
+			return 0, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	for i := range reqs {
+		if errs := validation.ValidateGuardrail(&reqs[i]); errs.HasErrors() {
+			return 0, fmt.Errorf("guardrail %d in %s: %s", i, path, errs.Error())
+		}
+	}
+
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	existing, err := tx.ListGuardrails(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, g := range existing {
+		if g.Source != domain.GuardrailSourceConfig {
+			continue
+		}
+		if err := tx.DeleteGuardrail(ctx, g.ID); err != nil {
+			return 0, err
+		}
+	}
+	for _, req := range reqs {
+		g := &domain.Guardrail{
+			ID:          uuid.New().String(),
+			Name:        req.Name,
+			Description: req.Description,
+			Targets:     req.Targets,
+			Match:       req.Match,
+			Source:      domain.GuardrailSourceConfig,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := tx.CreateGuardrail(ctx, g); err != nil {
+			return 0, fmt.Errorf("guardrail %q: %w", req.Name, err)
+		}
+	}
+
+	return len(reqs), tx.Commit()
+}
+
+// evaluateStore merges the policy in store with strategies and evaluates
+// rules against it.
+func evaluateStore(ctx context.Context, rules []*domain.Guardrail, store storage.Storage, strategies domain.MergeStrategies) ([]domain.GuardrailViolation, error) {
+	policy, provenance, err := merger.New(store, strategies).MergeWithProvenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(rules, policy, provenance), nil
+}
+
+// newViolations returns the violations in after beyond those in before.
+// Violations are compared by guardrail, stack, and rule, since writes move
+// rules around in the merged policy.
+func newViolations(before, after []domain.GuardrailViolation) []domain.GuardrailViolation {
+	seen := make(map[string]int, len(before))
+	for _, v := range before {
+		seen[violationKey(v)]++
+	}
+	var added []domain.GuardrailViolation
+	for _, v := range after {
+		key := violationKey(v)
+		if seen[key] > 0 {
+			seen[key]--
+			continue
+		}
+		added = append(added, v)
+	}
+	return added
+}
+
+func violationKey(v domain.GuardrailViolation) string {
+	rule, _ := json.Marshal(v.Rule)
+	return strings.Join([]string{v.GuardrailID, v.Target, v.StackID, v.Key, v.Reason, string(rule)}, "\x00")
+}
+
+// violation describes rule i of a merged policy section.
+func violation(g *domain.Guardrail, target string, i int, sources []domain.RuleSource, provenance *domain.PolicyProvenance, rule any) domain.GuardrailViolation {
+	v := domain.GuardrailViolation{
+		GuardrailID:   g.ID,
+		GuardrailName: g.Name,
+		Target:        target,
+		Index:         i,
+		Rule:          rule,
+	}
+	if i < len(sources) {
+		v.StackID = sources[i].StackID
+		v.StackName = provenance.Stacks[v.StackID]
+		v.ResourceID = sources[i].ResourceID
+	}
+	return v
+}
+
+// referenceViolation describes an undefined reference. The referencing rule
+// is left out, so that moving a reference between rules of a stack is not a
+// new violation.
+func referenceViolation(g *domain.Guardrail, issue domain.LintIssue) domain.GuardrailViolation {
+	return domain.GuardrailViolation{
+		GuardrailID:   g.ID,
+		GuardrailName: g.Name,
+		Target:        issue.Section,
+		Index:         issue.Index,
+		Key:           issue.Key,
+		StackID:       issue.StackID,
+		StackName:     issue.StackName,
+		ResourceID:    issue.ResourceID,
+		Reason:        issue.Message,
+	}
+}
+
+// matches reports whether a rule with the given fields matches m.
+func matches(m domain.GuardrailMatch, src, dst, users []string, action string, postures []string) bool {
+	if m.IsEmpty() {
+		return false
+	}
+	if m.Action != "" && m.Action != action {
+		return false
+	}
+	if m.RequirePosture && len(postures) > 0 {
+		return false
+	}
+	return matchesAny(m.Src, src) && matchesAny(m.Dst, dst) && matchesAny(m.Users, users)
+}
+
+// matchesAny reports whether any value matches any pattern. An empty
+// pattern list matches everything.
+func matchesAny(patterns, values []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		for _, v := range values {
+			if matchPattern(p, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPattern matches value exactly, or by prefix for patterns such as
+// "tag:prod:*". A lone "*" is the Tailscale wildcard and matches only itself.
+func matchPattern(pattern, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && prefix != "" {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
+
+// grantDestinations returns the destinations of a grant as "host:ip", like
+// ACL destinations. Grants without IP entries keep their bare destinations.
+func grantDestinations(grant domain.TailscaleGrant) []string {
+	if len(grant.IP) == 0 {
+		return grant.Dst
+	}
+	dsts := make([]string, 0, len(grant.Dst)*len(grant.IP))
+	for _, dst := range grant.Dst {
+		for _, ip := range grant.IP {
+			dsts = append(dsts, dst+":"+ip)
+		}
+	}
+	return dsts
+}
@@ -0,0 +1,194 @@
+package guardrails_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage/memory"
+)
+
+func TestEvaluate(t *testing.T) {
+	rules := []*domain.Guardrail{
+		{
+			ID:    "no-wildcard-prod",
+			Name:  "no wildcard to prod",
+			Match: domain.GuardrailMatch{Src: []string{"*"}, Dst: []string{"tag:prod:*"}},
+		},
+		{
+			ID:      "ssh-root-check",
+			Name:    "root needs check",
+			Targets: []string{domain.GuardrailTargetSSH},
+			Match:   domain.GuardrailMatch{Users: []string{"root"}, Action: "accept"},
+		},
+	}
+	policy := &domain.TailscalePolicy{
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"tag:prod:443"}},
+			{Action: "accept", Src: []string{"*"}, Dst: []string{"tag:prod:443"}},
+			{Action: "accept", Src: []string{"*"}, Dst: []string{"tag:dev:*"}},
+		},
+		Grants: []domain.TailscaleGrant{
+			{Src: []string{"*"}, Dst: []string{"tag:prod"}, IP: []string{"*"}},
+		},
+		SSH: []domain.TailscaleSSH{
+			{Action: "check", Src: []string{"group:ops"}, Dst: []string{"tag:prod"}, Users: []string{"root"}},
+			{Action: "accept", Src: []string{"group:ops"}, Dst: []string{"tag:prod"}, Users: []string{"root"}},
+			{Action: "accept", Src: []string{"group:ops"}, Dst: []string{"tag:prod"}, Users: []string{"ubuntu"}},
+		},
+	}
+	provenance := &domain.PolicyProvenance{
+		Stacks: map[string]string{"s1": "prod"},
+		ACLs:   []domain.RuleSource{{StackID: "s1"}, {StackID: "s1", ResourceID: "acl-2"}, {StackID: "s1"}},
+		Grants: []domain.RuleSource{{StackID: "s1", ResourceID: "grant-1"}},
+		SSH:    []domain.RuleSource{{StackID: "s1"}, {StackID: "s1", ResourceID: "ssh-2"}, {StackID: "s1"}},
+	}
+
+	violations := guardrails.Evaluate(rules, policy, provenance)
+
+	type found struct {
+		guardrail, target string
+		index             int
+		resourceID        string
+	}
+	expected := []found{
+		{"no-wildcard-prod", domain.GuardrailTargetACLs, 1, "acl-2"},
+		{"no-wildcard-prod", domain.GuardrailTargetGrants, 0, "grant-1"},
+		{"ssh-root-check", domain.GuardrailTargetSSH, 1, "ssh-2"},
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %+v", len(expected), violations)
+	}
+	for i, v := range violations {
+		got := found{v.GuardrailID, v.Target, v.Index, v.ResourceID}
+		if got != expected[i] {
+			t.Errorf("Violation %d: expected %+v, got %+v", i, expected[i], got)
+		}
+		if v.StackName != "prod" {
+			t.Errorf("Violation %d: expected stack prod, got %q", i, v.StackName)
+		}
+	}
+}
+
+func TestEvaluate_Patterns(t *testing.T) {
+	policy := &domain.TailscalePolicy{
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"autogroup:internet:*"}},
+		},
+	}
+	provenance := &domain.PolicyProvenance{ACLs: []domain.RuleSource{{StackID: "s1"}}}
+
+	tests := []struct {
+		name  string
+		match domain.GuardrailMatch
+		want  bool
+	}{
+		{"lone wildcard is literal", domain.GuardrailMatch{Src: []string{"*"}}, false},
+		{"prefix pattern", domain.GuardrailMatch{Src: []string{"group:*"}}, true},
+		{"exact value", domain.GuardrailMatch{Dst: []string{"autogroup:internet:*"}}, true},
+		{"all conditions must match", domain.GuardrailMatch{Src: []string{"group:ops"}, Dst: []string{"autogroup:internet:*"}}, false},
+		{"empty match never matches", domain.GuardrailMatch{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := []*domain.Guardrail{{ID: "g", Name: "g", Match: tt.match}}
+			got := len(guardrails.Evaluate(rules, policy, provenance)) > 0
+			if got != tt.want {
+				t.Errorf("Expected match %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluate_RequirePosture(t *testing.T) {
+	rules := []*domain.Guardrail{{
+		ID:    "internet-posture",
+		Name:  "internet needs posture",
+		Match: domain.GuardrailMatch{Dst: []string{"autogroup:internet:*"}, RequirePosture: true},
+	}}
+	policy := &domain.TailscalePolicy{
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"autogroup:internet:*"}},
+		},
+		Grants: []domain.TailscaleGrant{
+			{Src: []string{"group:dev"}, Dst: []string{"autogroup:internet"}, IP: []string{"*"}, SrcPosture: []string{"posture:latestMac"}},
+			{Src: []string{"group:ops"}, Dst: []string{"autogroup:internet"}, IP: []string{"*"}},
+			{Src: []string{"group:ops"}, Dst: []string{"tag:prod"}, IP: []string{"*"}},
+		},
+	}
+	provenance := &domain.PolicyProvenance{
+		ACLs:   []domain.RuleSource{{StackID: "s1"}},
+		Grants: []domain.RuleSource{{StackID: "s1"}, {StackID: "s1"}, {StackID: "s1"}},
+	}
+
+	violations := guardrails.Evaluate(rules, policy, provenance)
+
+	type found struct {
+		target string
+		index  int
+	}
+	expected := []found{
+		{domain.GuardrailTargetACLs, 0},   // ACLs carry no posture
+		{domain.GuardrailTargetGrants, 1}, // No posture on an internet grant
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %+v", len(expected), violations)
+	}
+	for i, v := range violations {
+		if got := (found{v.Target, v.Index}); got != expected[i] {
+			t.Errorf("Violation %d: expected %+v, got %+v", i, expected[i], got)
+		}
+	}
+}
+
+func TestCheckWrite(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	_ = store.CreateStack(ctx, &domain.Stack{ID: "s1", Name: "prod"})
+	_ = store.CreateGuardrail(ctx, &domain.Guardrail{
+		ID:    "no-wildcard-prod",
+		Name:  "no wildcard to prod",
+		Match: domain.GuardrailMatch{Src: []string{"*"}, Dst: []string{"tag:prod:*"}},
+	})
+	rule := func(id, src string) *domain.ACLRule {
+		return &domain.ACLRule{ID: id, StackID: "s1", Action: "accept", Sources: []string{src}, Destinations: []string{"tag:prod:443"}}
+	}
+	write := func(fn func(tx storage.Transaction) error) error {
+		tx, _ := store.BeginTx(ctx)
+		defer func() { _ = tx.Rollback() }()
+		if err := guardrails.CheckWrite(ctx, tx, nil, fn); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// A new violation is refused and nothing is written
+	err := write(func(tx storage.Transaction) error {
+		return tx.CreateACLRule(ctx, rule("acl-1", "*"))
+	})
+	var violation *domain.GuardrailViolationError
+	if !errors.As(err, &violation) || len(violation.Violations) != 1 {
+		t.Fatalf("Expected a guardrail violation, got %v", err)
+	}
+	if rules, _ := store.ListACLRules(ctx, "s1"); len(rules) != 0 {
+		t.Errorf("Expected the refused rule to be rolled back, got %d rules", len(rules))
+	}
+
+	// Violations that already exist do not block other writes
+	_ = store.CreateACLRule(ctx, rule("acl-1", "*"))
+	if err := write(func(tx storage.Transaction) error {
+		return tx.CreateACLRule(ctx, rule("acl-2", "group:sre"))
+	}); err != nil {
+		t.Errorf("Expected a write next to an existing violation to pass, got %v", err)
+	}
+
+	// Errors of the write itself are returned
+	if err := write(func(tx storage.Transaction) error {
+		return tx.DeleteACLRule(ctx, "missing")
+	}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected the write's error, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// redundantACLs returns the ACLs of policy that duplicate an earlier ACL,
+// and those that a broader ACL already allows. ACLs only accept, so their
+// order does not matter. Selectors are compared as written: an ACL for a
+// group is not covered by an ACL for a member of the group.
+func redundantACLs(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.LintIssue {
+	var issues []domain.LintIssue
+
+	keys := make([]string, len(policy.ACLs))
+	first := make(map[string]int, len(policy.ACLs))
+	for i, acl := range policy.ACLs {
+		keys[i] = aclKey(acl)
+		if _, ok := first[keys[i]]; !ok {
+			first[keys[i]] = i
+		}
+	}
+
+	for j, acl := range policy.ACLs {
+		if i := first[keys[j]]; i != j {
+			issues = append(issues, aclIssue(provenance, domain.LintDuplicateACL, j, i, "duplicates"))
+			continue
+		}
+		for i, broader := range policy.ACLs {
+			if i == j || keys[i] == keys[j] || !aclCovers(broader, acl) {
+				continue
+			}
+			// ACLs that cover each other are equivalent; report the later one
+			if aclCovers(acl, broader) && j < i {
+				continue
+			}
+			issues = append(issues, aclIssue(provenance, domain.LintSubsumedACL, j, i, "is covered by"))
+			break
+		}
+	}
+
+	return issues
+}
+
+// aclIssue reports ACL j as redundant given ACL i.
+func aclIssue(provenance *domain.PolicyProvenance, check string, j, i int, relation string) domain.LintIssue {
+	var other domain.RuleSource
+	if i < len(provenance.ACLs) {
+		other = provenance.ACLs[i]
+	}
+	issue := domain.LintIssue{
+		Check:    check,
+		Severity: domain.LintSeverityWarning,
+		Message:  fmt.Sprintf("%s acls rule %d from stack %q", relation, i, provenance.Stacks[other.StackID]),
+		Section:  "acls",
+		Index:    j,
+	}
+	if j < len(provenance.ACLs) {
+		issue = withSource(issue, provenance, provenance.ACLs[j])
+	}
+	return issue
+}
+
+// aclKey identifies an ACL regardless of the order of its selectors.
+func aclKey(acl domain.TailscaleACL) string {
+	src := slices.Clone(acl.Src)
+	dst := slices.Clone(acl.Dst)
+	slices.Sort(src)
+	slices.Sort(dst)
+	return acl.Action + "\x00" + acl.Protocol + "\x00" + strings.Join(src, ",") + "\x00" + strings.Join(dst, ",")
+}
+
+// aclCovers reports whether everything acl allows, broader allows too.
+func aclCovers(broader, acl domain.TailscaleACL) bool {
+	if broader.Action != acl.Action || (broader.Protocol != "" && broader.Protocol != acl.Protocol) {
+		return false
+	}
+	for _, src := range acl.Src {
+		if !slices.Contains(broader.Src, "*") && !slices.Contains(broader.Src, src) {
+			return false
+		}
+	}
+	for _, dst := range acl.Dst {
+		if !slices.ContainsFunc(broader.Dst, func(b string) bool { return destinationCovers(b, dst) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// destinationCovers reports whether the "target:ports" destination broader
+// includes dst.
+func destinationCovers(broader, dst string) bool {
+	if broader == dst {
+		return true
+	}
+	bTarget, bPorts := splitDestination(broader)
+	target, ports := splitDestination(dst)
+	if bTarget != "*" && bTarget != target {
+		return false
+	}
+	return portsCover(bPorts, ports)
+}
+
+// splitDestination splits a destination at the colon before its ports.
+// Destinations without ports allow every port.
+func splitDestination(dst string) (target, ports string) {
+	if dst == "*" {
+		return "*", "*"
+	}
+	if i := strings.LastIndex(dst, ":"); i > 0 && !isAddress(dst) {
+		return dst[:i], dst[i+1:]
+	}
+	return dst, "*"
+}
+
+// portsCover reports whether the port list broader includes every port of
+// ports. Lists that cannot be parsed only cover themselves.
+func portsCover(broader, ports string) bool {
+	if broader == "*" || broader == ports {
+		return true
+	}
+	bRanges, ok := parsePorts(broader)
+	if !ok {
+		return false
+	}
+	ranges, ok := parsePorts(ports)
+	if !ok {
+		return false
+	}
+	for _, r := range ranges {
+		if !slices.ContainsFunc(bRanges, func(b [2]int) bool { return b[0] <= r[0] && r[1] <= b[1] }) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePorts parses a port list such as "22", "80,443", or "8000-9000",
+// treating "*" as every port.
+func parsePorts(ports string) ([][2]int, bool) {
+	var ranges [][2]int
+	for _, part := range strings.Split(ports, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" {
+			ranges = append(ranges, [2]int{0, 65535})
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			hi = lo
+		}
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, false
+		}
+		to, err := strconv.Atoi(hi)
+		if err != nil || to < from {
+			return nil, false
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+	return ranges, true
+}
@@ -0,0 +1,141 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// unused returns the groups, hosts, and IP sets of policy that are not in
+// used.
+func unused(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance, used map[string]bool) []domain.LintIssue {
+	var issues []domain.LintIssue
+
+	for _, name := range sortedKeys(policy.Groups) {
+		if used[name] {
+			continue
+		}
+		issue := unusedIssue(domain.LintUnusedGroup, "groups", name, fmt.Sprintf("group %q is not referenced", name))
+		sources := groupSources(provenance.Groups[name])
+		if len(sources) == 0 {
+			issues = append(issues, issue)
+		}
+		for _, source := range sources {
+			issues = append(issues, withSource(issue, provenance, source))
+		}
+	}
+	for _, name := range sortedKeys(policy.Hosts) {
+		if !used[name] {
+			issue := unusedIssue(domain.LintUnusedHost, "hosts", name, fmt.Sprintf("host %q is not referenced", name))
+			issues = append(issues, withSource(issue, provenance, provenance.Hosts[name]))
+		}
+	}
+	for _, name := range sortedKeys(policy.IPSets) {
+		if !used[name] {
+			issue := unusedIssue(domain.LintUnusedIPSet, "ipsets", name, fmt.Sprintf("IP set %q is not referenced", name))
+			issues = append(issues, withSource(issue, provenance, provenance.IPSets[name]))
+		}
+	}
+
+	return issues
+}
+
+func unusedIssue(check, section, name, message string) domain.LintIssue {
+	return domain.LintIssue{
+		Check:     check,
+		Severity:  domain.LintSeverityInfo,
+		Message:   message,
+		Reference: name,
+		Section:   section,
+		Key:       name,
+	}
+}
+
+// groupSources returns the group resources that contributed members to a
+// group, once each.
+func groupSources(members map[string][]domain.RuleSource) []domain.RuleSource {
+	var sources []domain.RuleSource
+	seen := make(map[string]bool)
+	for _, member := range sortedKeys(members) {
+		for _, source := range members[member] {
+			if !seen[source.ResourceID] {
+				seen[source.ResourceID] = true
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources
+}
+
+// emptyTests returns the tests of policy that assert nothing.
+func emptyTests(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.LintIssue {
+	var issues []domain.LintIssue
+	for i, test := range policy.Tests {
+		if len(test.Accept) > 0 || len(test.Deny) > 0 {
+			continue
+		}
+		issue := domain.LintIssue{
+			Check:    domain.LintEmptyTest,
+			Severity: domain.LintSeverityWarning,
+			Message:  fmt.Sprintf("test from %q has no accept or deny destinations", test.Src),
+			Section:  "tests",
+			Index:    i,
+		}
+		if i < len(provenance.Tests) {
+			issue = withSource(issue, provenance, provenance.Tests[i])
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// emptyPostures returns the postures of policy without rules.
+func emptyPostures(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.LintIssue {
+	var issues []domain.LintIssue
+	for _, name := range sortedKeys(policy.Postures) {
+		if len(policy.Postures[name]) > 0 {
+			continue
+		}
+		issue := domain.LintIssue{
+			Check:     domain.LintEmptyPosture,
+			Severity:  domain.LintSeverityWarning,
+			Message:   fmt.Sprintf("posture %q has no rules", name),
+			Reference: name,
+			Section:   "postures",
+			Key:       name,
+		}
+		issues = append(issues, withSource(issue, provenance, provenance.Postures[name]))
+	}
+	return issues
+}
+
+// TagGroupMembers returns the tags among the members of the groups of
+// policy. Tailscale groups only contain users, but tags were accepted as
+// group members before they were refused on write, and syncs are refused
+// until they are removed.
+func TagGroupMembers(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.LintIssue {
+	var issues []domain.LintIssue
+	for _, name := range sortedKeys(policy.Groups) {
+		members := slices.Clone(policy.Groups[name])
+		slices.Sort(members)
+		for _, member := range members {
+			if !strings.HasPrefix(member, "tag:") {
+				continue
+			}
+			issue := domain.LintIssue{
+				Check:     domain.LintTagGroupMember,
+				Severity:  domain.LintSeverityError,
+				Message:   fmt.Sprintf("group %q has tag %q as a member; groups can only contain users", name, member),
+				Reference: member,
+				Section:   "groups",
+				Key:       name,
+			}
+			for _, source := range provenance.Groups[name][member] {
+				issues = append(issues, withSource(issue, provenance, source))
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,65 @@
+// Package lint finds problems in the merged policy: references that
+// Tailscale would only reject when the policy is pushed, and entries that
+// have no effect, such as unused definitions and redundant ACLs.
+package lint
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// Lint returns the issues in policy, most severe first, naming the stack
+// that contributed each entry.
+func Lint(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.LintIssue {
+	c := walk(policy, provenance)
+	issues := c.issues
+	issues = append(issues, TagGroupMembers(policy, provenance)...)
+	issues = append(issues, unused(policy, provenance, c.used)...)
+	issues = append(issues, redundantACLs(policy, provenance)...)
+	issues = append(issues, emptyTests(policy, provenance)...)
+	issues = append(issues, emptyPostures(policy, provenance)...)
+
+	slices.SortStableFunc(issues, func(a, b domain.LintIssue) int {
+		return severityRank(a.Severity) - severityRank(b.Severity)
+	})
+	return issues
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case domain.LintSeverityError:
+		return 0
+	case domain.LintSeverityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// withSource attributes issue to the resource source.
+func withSource(issue domain.LintIssue, provenance *domain.PolicyProvenance, source domain.RuleSource) domain.LintIssue {
+	issue.StackID = source.StackID
+	issue.StackName = provenance.Stacks[source.StackID]
+	issue.ResourceID = source.ResourceID
+	return issue
+}
+
+// isAddress reports whether s is an IP address or CIDR prefix.
+func isAddress(s string) bool {
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,127 @@
+package lint_test
+
+import (
+	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/lint"
+)
+
+func TestReferences(t *testing.T) {
+	policy := &domain.TailscalePolicy{
+		Groups: map[string][]string{
+			"group:dev": {"alice@example.com", "group:contractors", "tag:ci"},
+		},
+		TagOwners: map[string][]string{"tag:web": {"group:dev"}},
+		Hosts:     map[string]string{"db": "10.0.0.5"},
+		IPSets:    map[string][]string{"ipset:office": {"192.0.2.0/24"}},
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev", "ipset:office", "*"}, Dst: []string{"tag:web:443", "db:5432", "10.0.0.0/8:22"}},
+			{Action: "accept", Src: []string{"group:sre", "ipset:vpn"}, Dst: []string{"cache:6379", "autogroup:internet:*"}},
+		},
+		Grants: []domain.TailscaleGrant{
+			{Src: []string{"alice@example.com"}, Dst: []string{"tag:db"}, IP: []string{"*"}, SrcPosture: []string{"posture:latestMac"}},
+		},
+		SSH: []domain.TailscaleSSH{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"autogroup:self"}, Users: []string{"autogroup:nonroot"}},
+		},
+	}
+	provenance := &domain.PolicyProvenance{
+		Stacks: map[string]string{"s1": "base", "s2": "team"},
+		Groups: map[string]map[string][]domain.RuleSource{
+			"group:dev": {
+				"group:contractors": {{StackID: "s1", ResourceID: "g1"}, {StackID: "s2", ResourceID: "g2"}},
+				"tag:ci":            {{StackID: "s2", ResourceID: "g2"}},
+			},
+		},
+		ACLs:   []domain.RuleSource{{StackID: "s1", ResourceID: "a1"}, {StackID: "s2", ResourceID: "a2"}},
+		Grants: []domain.RuleSource{{StackID: "s2", ResourceID: "gr1"}},
+		SSH:    []domain.RuleSource{{StackID: "s1", ResourceID: "ssh1"}},
+	}
+
+	issues := lint.References(policy, provenance)
+
+	type found struct {
+		check, reference, location, stack string
+	}
+	expected := []found{
+		{domain.LintUndefinedGroup, "group:sre", "acls rule 1", "team"},
+		{domain.LintUndefinedIPSet, "ipset:vpn", "acls rule 1", "team"},
+		{domain.LintUndefinedHost, "cache", "acls rule 1", "team"},
+		{domain.LintUndefinedTag, "tag:db", "grants rule 0", "team"},
+		{domain.LintUndefinedPosture, "posture:latestMac", "grants rule 0", "team"},
+		{domain.LintUndefinedGroup, "group:contractors", `groups "group:dev"`, "base"},
+		{domain.LintUndefinedGroup, "group:contractors", `groups "group:dev"`, "team"},
+		{domain.LintUndefinedTag, "tag:ci", `groups "group:dev"`, "team"},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %+v", len(expected), issues)
+	}
+	for i, issue := range issues {
+		got := found{issue.Check, issue.Reference, issue.Location(), issue.StackName}
+		if got != expected[i] {
+			t.Errorf("Issue %d: expected %+v, got %+v", i, expected[i], got)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	policy := &domain.TailscalePolicy{
+		Groups:    map[string][]string{"group:dev": {"alice@example.com"}, "group:old": {"bob@example.com"}},
+		TagOwners: map[string][]string{"tag:web": {"group:dev"}},
+		Hosts:     map[string]string{"db": "10.0.0.5", "legacy": "10.0.0.6"},
+		IPSets:    map[string][]string{"ipset:office": {"192.0.2.0/24"}},
+		Postures:  map[string][]string{"posture:latest": {}},
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"tag:web:*", "db:5432"}},
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"db:5432", "tag:web:*"}},
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"tag:web:80,443"}},
+			{Action: "accept", Src: []string{"*"}, Dst: []string{"db:5000-6000"}},
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"db:5432"}},
+			{Action: "accept", Src: []string{"group:nope"}, Dst: []string{"tag:web:22"}},
+		},
+		Tests: []domain.TailscaleTest{
+			{Src: "alice@example.com", Accept: []string{"tag:web:443"}},
+			{Src: "alice@example.com"},
+		},
+	}
+	provenance := &domain.PolicyProvenance{
+		Stacks: map[string]string{"s1": "base", "s2": "team"},
+		Groups: map[string]map[string][]domain.RuleSource{
+			"group:old": {"bob@example.com": {{StackID: "s1", ResourceID: "g-old"}}},
+		},
+		Hosts:    map[string]domain.RuleSource{"legacy": {StackID: "s1", ResourceID: "h-legacy"}},
+		IPSets:   map[string]domain.RuleSource{"ipset:office": {StackID: "s2", ResourceID: "ip-office"}},
+		Postures: map[string]domain.RuleSource{"posture:latest": {StackID: "s2", ResourceID: "p-latest"}},
+		ACLs: []domain.RuleSource{
+			{StackID: "s1"}, {StackID: "s2"}, {StackID: "s2"}, {StackID: "s1"}, {StackID: "s2"}, {StackID: "s2"},
+		},
+		Tests: []domain.RuleSource{{StackID: "s1"}, {StackID: "s2", ResourceID: "t2"}},
+	}
+
+	issues := lint.Lint(policy, provenance)
+
+	type found struct {
+		check, severity, location, stack string
+	}
+	expected := []found{
+		{domain.LintUndefinedGroup, domain.LintSeverityError, "acls rule 5", "team"},
+		{domain.LintDuplicateACL, domain.LintSeverityWarning, "acls rule 1", "team"},
+		{domain.LintSubsumedACL, domain.LintSeverityWarning, "acls rule 2", "team"},
+		{domain.LintSubsumedACL, domain.LintSeverityWarning, "acls rule 4", "team"},
+		{domain.LintEmptyTest, domain.LintSeverityWarning, "tests rule 1", "team"},
+		{domain.LintEmptyPosture, domain.LintSeverityWarning, `postures "posture:latest"`, "team"},
+		{domain.LintUnusedGroup, domain.LintSeverityInfo, `groups "group:old"`, "base"},
+		{domain.LintUnusedHost, domain.LintSeverityInfo, `hosts "legacy"`, "base"},
+		{domain.LintUnusedIPSet, domain.LintSeverityInfo, `ipsets "ipset:office"`, "team"},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %+v", len(expected), issues)
+	}
+	for i, issue := range issues {
+		got := found{issue.Check, issue.Severity, issue.Location(), issue.StackName}
+		if got != expected[i] {
+			t.Errorf("Issue %d: expected %+v, got %+v (%s)", i, expected[i], got, issue.Message)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+)
+
+// References returns the references in policy to groups, hosts, IP sets, and
+// postures that no stack defines, and to tags that have no tag owners.
+func References(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) []domain.LintIssue {
+	return walk(policy, provenance).issues
+}
+
+// walk checks every reference in policy.
+func walk(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance) *checker {
+	c := &checker{policy: policy, provenance: provenance, used: make(map[string]bool)}
+
+	for i, acl := range policy.ACLs {
+		c.rule("acls", i, provenance.ACLs, acl.Src, destinations(acl.Dst))
+	}
+	for i, grant := range policy.Grants {
+		c.rule("grants", i, provenance.Grants, grant.Src, grant.Dst, grant.SrcPosture)
+	}
+	for i, ssh := range policy.SSH {
+		c.rule("ssh", i, provenance.SSH, ssh.Src, ssh.Dst)
+	}
+	for i, attr := range policy.NodeAttrs {
+		c.rule("nodeAttrs", i, provenance.NodeAttrs, attr.Target)
+	}
+	for i, test := range policy.Tests {
+		c.rule("tests", i, provenance.Tests, []string{test.Src}, destinations(test.Accept), destinations(test.Deny))
+	}
+
+	for _, name := range sortedKeys(policy.Groups) {
+		c.named("groups", name, policy.Groups[name], provenance.Groups[name])
+		c.named("groups", name, sortedKeys(provenance.NestedGroups[name]), provenance.NestedGroups[name])
+	}
+	for _, tag := range sortedKeys(policy.TagOwners) {
+		c.named("tagOwners", tag, policy.TagOwners[tag], provenance.TagOwners[tag])
+	}
+	if aa := policy.AutoApprovers; aa != nil {
+		for _, route := range sortedKeys(aa.Routes) {
+			c.named("autoApprovers", route, aa.Routes[route], provenance.AutoApprovers[route])
+		}
+		c.named("autoApprovers", "exitNode", aa.ExitNode, provenance.AutoApprovers["exitNode"])
+	}
+
+	return c
+}
+
+// checker collects the undefined references of a policy, and the names of
+// the groups, hosts, and IP sets that are referenced.
+type checker struct {
+	policy     *domain.TailscalePolicy
+	provenance *domain.PolicyProvenance
+	issues     []domain.LintIssue
+	used       map[string]bool
+}
+
+// rule checks the selectors of rule i of a rule section, whose sources are
+// parallel to the section.
+func (c *checker) rule(section string, i int, sources []domain.RuleSource, selectors ...[]string) {
+	var source domain.RuleSource
+	if i < len(sources) {
+		source = sources[i]
+	}
+	seen := make(map[string]bool)
+	for _, list := range selectors {
+		for _, sel := range list {
+			if seen[sel] {
+				continue
+			}
+			seen[sel] = true
+			if issue, ok := c.check(sel); ok {
+				issue.Section = section
+				issue.Index = i
+				c.add(issue, source)
+			}
+		}
+	}
+}
+
+// named checks the members of the entry key of a named section, reporting
+// each issue once for every resource that contributed the member.
+func (c *checker) named(section, key string, members []string, sources map[string][]domain.RuleSource) {
+	members = slices.Clone(members)
+	slices.Sort(members)
+	for _, member := range members {
+		issue, ok := c.check(member)
+		if !ok {
+			continue
+		}
+		issue.Section = section
+		issue.Key = key
+		for _, source := range sources[member] {
+			c.add(issue, source)
+		}
+	}
+}
+
+func (c *checker) add(issue domain.LintIssue, source domain.RuleSource) {
+	c.issues = append(c.issues, withSource(issue, c.provenance, source))
+}
+
+// check returns the issue with the selector sel, if it refers to something
+// the policy does not define, and records what it refers to as used.
+func (c *checker) check(sel string) (domain.LintIssue, bool) {
+	switch {
+	case sel == "*", strings.HasPrefix(sel, "autogroup:"), strings.HasPrefix(sel, "svc:"), strings.Contains(sel, "@"):
+		return domain.LintIssue{}, false
+
+	case strings.HasPrefix(sel, "group:"):
+		c.used[sel] = true
+		if _, ok := c.policy.Groups[sel]; !ok {
+			return undefined(domain.LintUndefinedGroup, sel, fmt.Sprintf("references undefined group %q", sel)), true
+		}
+
+	case strings.HasPrefix(sel, "tag:"):
+		if _, ok := c.policy.TagOwners[sel]; !ok {
+			return undefined(domain.LintUndefinedTag, sel, fmt.Sprintf("references tag %q, which has no tag owners", sel)), true
+		}
+
+	case strings.HasPrefix(sel, "ipset:"):
+		c.used[sel] = true
+		if _, ok := c.policy.IPSets[sel]; !ok {
+			return undefined(domain.LintUndefinedIPSet, sel, fmt.Sprintf("references undefined IP set %q", sel)), true
+		}
+
+	case strings.HasPrefix(sel, "posture:"):
+		if _, ok := c.policy.Postures[sel]; !ok {
+			return undefined(domain.LintUndefinedPosture, sel, fmt.Sprintf("references undefined posture %q", sel)), true
+		}
+
+	default:
+		host := strings.TrimPrefix(sel, "host:")
+		if isAddress(host) || validation.ValidateHostName(host) != nil {
+			return domain.LintIssue{}, false
+		}
+		c.used[host] = true
+		if _, ok := c.policy.Hosts[host]; !ok {
+			return undefined(domain.LintUndefinedHost, host, fmt.Sprintf("references undefined host %q", host)), true
+		}
+	}
+	return domain.LintIssue{}, false
+}
+
+func undefined(check, reference, message string) domain.LintIssue {
+	return domain.LintIssue{Check: check, Severity: domain.LintSeverityError, Reference: reference, Message: message}
+}
+
+// destinations strips the ports from "target:ports" destinations, as used
+// by ACLs and tests.
+func destinations(dsts []string) []string {
+	targets := make([]string, 0, len(dsts))
+	for _, dst := range dsts {
+		if i := strings.LastIndex(dst, ":"); i > 0 && !isAddress(dst) {
+			dst = dst[:i]
+		}
+		targets = append(targets, dst)
+	}
+	return targets
+}
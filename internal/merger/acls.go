@@ -2,25 +2,32 @@ package merger
 
 import (
 	"context"
+	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
 // mergeACLs merges ACL rules from all stacks.
 // Rules are ordered by stack priority, then by rule order within each stack.
-func (m *Merger) mergeACLs(ctx context.Context) ([]domain.TailscaleACL, error) {
+// Expired rules are left out.
+// The returned sources are parallel to the merged rules.
+func (m *Merger) mergeACLs(ctx context.Context, now time.Time) ([]domain.TailscaleACL, []domain.RuleSource, error) {
 	rules, err := m.store.ListAllACLRules(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(rules) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Results are already ordered by stack priority then rule order
 	result := make([]domain.TailscaleACL, 0, len(rules))
+	sources := make([]domain.RuleSource, 0, len(rules))
 	for _, r := range rules {
+		if domain.Expired(r.ExpiresAt, now) {
+			continue
+		}
 		acl := domain.TailscaleACL{
 			Action: r.Action,
 			Src:    r.Sources,
@@ -30,7 +37,8 @@ func (m *Merger) mergeACLs(ctx context.Context) ([]domain.TailscaleACL, error) {
 			acl.Protocol = r.Protocol
 		}
 		result = append(result, acl)
+		sources = append(sources, domain.RuleSource{StackID: r.StackID, ResourceID: r.ID, Order: r.Order, Description: r.Description})
 	}
 
-	return result, nil
+	return result, sources, nil
 }
@@ -6,62 +6,48 @@ import (
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
-// mergeAutoApprovers merges auto approvers from all stacks.
-// Auto approvers are merged additively - all approvers for a route are combined.
-func (m *Merger) mergeAutoApprovers(ctx context.Context) (*domain.TailscaleAutoApprovers, error) {
+// mergeAutoApprovers merges auto approvers from all stacks with the
+// autoApprovers strategy, which by default combines all approvers for a route.
+// The returned sources are keyed by route, or "exitNode", and then approver.
+func (m *Merger) mergeAutoApprovers(ctx context.Context, strategy string) (*domain.TailscaleAutoApprovers, map[string]map[string][]domain.RuleSource, []domain.MergeConflict, error) {
 	autoApprovers, err := m.store.ListAllAutoApprovers(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if len(autoApprovers) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 
-	result := &domain.TailscaleAutoApprovers{
-		Routes: make(map[string][]string),
-	}
-
-	// Track approvers with sets to avoid duplicates
-	routeApproverSets := make(map[string]map[string]bool)
-	exitNodeApproverSet := make(map[string]bool)
-
+	defs := make([]definition, 0, len(autoApprovers))
 	for _, aa := range autoApprovers {
+		source := domain.RuleSource{StackID: aa.StackID, ResourceID: aa.ID}
 		if aa.Type == "routes" {
-			if _, ok := routeApproverSets[aa.Match]; !ok {
-				routeApproverSets[aa.Match] = make(map[string]bool)
-			}
-			for _, approver := range aa.Approvers {
-				routeApproverSets[aa.Match][approver] = true
-			}
+			defs = append(defs, definition{name: aa.Match, values: aa.Approvers, source: source})
 		} else if aa.Type == "exitNode" {
-			for _, approver := range aa.Approvers {
-				exitNodeApproverSet[approver] = true
-			}
+			defs = append(defs, definition{name: "exitNode", values: aa.Approvers, source: source})
 		}
 	}
+	merged, sources, conflicts := mergeLists(domain.ConflictTypeAutoApprover, strategy, defs)
 
-	// Convert sets to slices
-	for route, approverSet := range routeApproverSets {
-		approvers := make([]string, 0, len(approverSet))
-		for approver := range approverSet {
-			approvers = append(approvers, approver)
-		}
-		result.Routes[route] = approvers
+	result := &domain.TailscaleAutoApprovers{
+		Routes: make(map[string][]string),
 	}
-
-	if len(exitNodeApproverSet) > 0 {
-		exitNodeApprovers := make([]string, 0, len(exitNodeApproverSet))
-		for approver := range exitNodeApproverSet {
-			exitNodeApprovers = append(exitNodeApprovers, approver)
+	for key, approvers := range merged {
+		if len(approvers) == 0 {
+			continue
+		}
+		if key == "exitNode" {
+			result.ExitNode = approvers
+		} else {
+			result.Routes[key] = approvers
 		}
-		result.ExitNode = exitNodeApprovers
 	}
 
 	// Return nil if nothing was added
 	if len(result.Routes) == 0 && len(result.ExitNode) == 0 {
-		return nil, nil
+		return nil, nil, conflicts, nil
 	}
 
-	return result, nil
+	return result, sources, conflicts, nil
 }
@@ -0,0 +1,83 @@
+package merger
+
+import (
+	"sort"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// conflictTracker collects definitions that lose a priority-override or
+// error-on-conflict merge. Definitions identical to the winner are not
+// conflicts and are ignored.
+type conflictTracker struct {
+	kind      string
+	strategy  string
+	winners   map[string]domain.ConflictDefinition
+	conflicts map[string]*domain.MergeConflict
+	order     []string
+}
+
+func newConflictTracker(kind, strategy string) *conflictTracker {
+	return &conflictTracker{
+		kind:      kind,
+		strategy:  strategy,
+		winners:   make(map[string]domain.ConflictDefinition),
+		conflicts: make(map[string]*domain.MergeConflict),
+	}
+}
+
+// win records the definition that is rendered for name.
+func (c *conflictTracker) win(name string, source domain.RuleSource, value any) {
+	c.winners[name] = domain.ConflictDefinition{RuleSource: source, Value: value}
+}
+
+// shadow records a lower-priority definition of name, if it differs from the winner.
+func (c *conflictTracker) shadow(name string, source domain.RuleSource, value any) {
+	winner := c.winners[name]
+	if sameDefinition(winner.Value, value) {
+		return
+	}
+	conflict, ok := c.conflicts[name]
+	if !ok {
+		conflict = &domain.MergeConflict{Type: c.kind, Name: name, Strategy: c.strategy, Winner: winner}
+		c.conflicts[name] = conflict
+		c.order = append(c.order, name)
+	}
+	conflict.Shadowed = append(conflict.Shadowed, domain.ConflictDefinition{RuleSource: source, Value: value})
+}
+
+// result returns the collected conflicts sorted by name.
+func (c *conflictTracker) result() []domain.MergeConflict {
+	sort.Strings(c.order)
+	result := make([]domain.MergeConflict, 0, len(c.order))
+	for _, name := range c.order {
+		result = append(result, *c.conflicts[name])
+	}
+	return result
+}
+
+// sameDefinition compares host addresses exactly and string lists as sets.
+func sameDefinition(a, b any) bool {
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case []string:
+		bv, ok := b.([]string)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		set := make(map[string]int, len(av))
+		for _, s := range av {
+			set[s]++
+		}
+		for _, s := range bv {
+			if set[s] == 0 {
+				return false
+			}
+			set[s]--
+		}
+		return true
+	}
+	return false
+}
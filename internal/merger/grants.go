@@ -2,25 +2,32 @@ package merger
 
 import (
 	"context"
+	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
 // mergeGrants merges grants from all stacks.
 // Grants are ordered by stack priority, then by rule order within each stack.
-func (m *Merger) mergeGrants(ctx context.Context) ([]domain.TailscaleGrant, error) {
+// Expired grants are left out.
+// The returned sources are parallel to the merged grants.
+func (m *Merger) mergeGrants(ctx context.Context, now time.Time) ([]domain.TailscaleGrant, []domain.RuleSource, error) {
 	grants, err := m.store.ListAllGrants(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(grants) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Results are already ordered by stack priority then rule order
 	result := make([]domain.TailscaleGrant, 0, len(grants))
+	sources := make([]domain.RuleSource, 0, len(grants))
 	for _, g := range grants {
+		if domain.Expired(g.ExpiresAt, now) {
+			continue
+		}
 		grant := domain.TailscaleGrant{
 			Src: g.Sources,
 			Dst: g.Destinations,
@@ -31,8 +38,12 @@ func (m *Merger) mergeGrants(ctx context.Context) ([]domain.TailscaleGrant, erro
 		if len(g.App) > 0 {
 			grant.App = g.App
 		}
+		if len(g.SrcPosture) > 0 {
+			grant.SrcPosture = g.SrcPosture
+		}
 		result = append(result, grant)
+		sources = append(sources, domain.RuleSource{StackID: g.StackID, ResourceID: g.ID, Order: g.Order, Description: g.Description})
 	}
 
-	return result, nil
+	return result, sources, nil
 }
@@ -2,41 +2,59 @@ package merger
 
 import (
 	"context"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/nesting"
 )
 
-// mergeGroups merges groups from all stacks.
-// Groups with the same name have their members merged (union).
-func (m *Merger) mergeGroups(ctx context.Context) (map[string][]string, error) {
+// mergeGroups merges groups from all stacks with the groups strategy,
+// leaving out expired members. Nested groups are then flattened into their
+// members. The returned sources record every group resource that contributed
+// each member, and the nested sources every group resource that nested a
+// group.
+func (m *Merger) mergeGroups(ctx context.Context, strategy string, now time.Time) (map[string][]string, map[string]map[string][]domain.RuleSource, map[string]map[string][]domain.RuleSource, []domain.MergeConflict, error) {
 	groups, err := m.store.ListAllGroups(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	if len(groups) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil, nil
 	}
 
-	// Group by name, union members
-	result := make(map[string][]string)
-	memberSet := make(map[string]map[string]bool)
-
+	defs := make([]definition, 0, len(groups))
 	for _, g := range groups {
-		if _, ok := memberSet[g.Name]; !ok {
-			memberSet[g.Name] = make(map[string]bool)
-		}
+		members := make([]string, 0, len(g.Members))
 		for _, member := range g.Members {
-			memberSet[g.Name][member] = true
+			if !g.MemberExpired(member, now) {
+				members = append(members, member)
+			}
 		}
+		defs = append(defs, definition{name: g.Name, values: members, source: domain.RuleSource{StackID: g.StackID, ResourceID: g.ID, Description: g.Description}})
 	}
+	result, sources, conflicts := mergeLists(domain.ConflictTypeGroup, strategy, defs)
 
-	// Convert sets to slices
-	for name, members := range memberSet {
-		slice := make([]string, 0, len(members))
-		for member := range members {
-			slice = append(slice, member)
+	// Tailscale does not allow nested groups. Members reached through a
+	// nested group are attributed to the resources that nested it.
+	flat := make(map[string][]string, len(result))
+	nested := make(map[string]map[string][]domain.RuleSource)
+	for name, members := range result {
+		flat[name] = nesting.Members(result, name)
+		for _, member := range members {
+			if !nesting.IsGroup(member) {
+				continue
+			}
+			nestedSources := sources[name][member]
+			delete(sources[name], member)
+			for _, source := range nestedSources {
+				addMemberSource(nested, name, member, source)
+				for _, inherited := range nesting.Members(result, member) {
+					addMemberSource(sources, name, inherited, source)
+				}
+			}
 		}
-		result[name] = slice
 	}
 
-	return result, nil
+	return flat, sources, nested, conflicts, nil
 }
@@ -2,28 +2,39 @@ package merger
 
 import (
 	"context"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
 // mergeHosts merges hosts from all stacks.
 // First-writer wins (by stack priority) - if multiple stacks define the same host name,
 // the one from the highest priority stack is used.
-func (m *Merger) mergeHosts(ctx context.Context) (map[string]string, error) {
+// Definitions that lose to a different definition are reported as conflicts,
+// which fail syncs under the error-on-conflict strategy.
+func (m *Merger) mergeHosts(ctx context.Context, strategy string) (map[string]string, map[string]domain.RuleSource, []domain.MergeConflict, error) {
 	hosts, err := m.store.ListAllHosts(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if len(hosts) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 
 	// Results are already ordered by stack priority, so first occurrence wins
 	result := make(map[string]string)
+	sources := make(map[string]domain.RuleSource)
+	conflicts := newConflictTracker(domain.ConflictTypeHost, strategy)
 	for _, h := range hosts {
+		source := domain.RuleSource{StackID: h.StackID, ResourceID: h.ID, Description: h.Description}
 		if _, exists := result[h.Name]; !exists {
 			result[h.Name] = h.Address
+			sources[h.Name] = source
+			conflicts.win(h.Name, source, h.Address)
+		} else {
+			conflicts.shadow(h.Name, source, h.Address)
 		}
 	}
 
-	return result, nil
+	return result, sources, conflicts.result(), nil
 }
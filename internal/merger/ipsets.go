@@ -2,28 +2,28 @@ package merger
 
 import (
 	"context"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
-// mergeIPSets merges IP sets from all stacks.
-// First-writer wins (by stack priority) - if multiple stacks define the same IP set name,
-// the one from the highest priority stack is used.
-func (m *Merger) mergeIPSets(ctx context.Context) (map[string][]string, error) {
+// mergeIPSets merges IP sets from all stacks with the ipsets strategy.
+// By default the definition from the highest priority stack is used, and
+// definitions that differ from it are reported as conflicts.
+func (m *Merger) mergeIPSets(ctx context.Context, strategy string) (map[string][]string, map[string]domain.RuleSource, []domain.MergeConflict, error) {
 	ipsets, err := m.store.ListAllIPSets(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if len(ipsets) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 
-	// Results are already ordered by stack priority, so first occurrence wins
-	result := make(map[string][]string)
+	defs := make([]definition, 0, len(ipsets))
 	for _, is := range ipsets {
-		if _, exists := result[is.Name]; !exists {
-			result[is.Name] = is.Addresses
-		}
+		defs = append(defs, definition{name: is.Name, values: is.Addresses, source: domain.RuleSource{StackID: is.StackID, ResourceID: is.ID}})
 	}
+	result, _, conflicts := mergeLists(domain.ConflictTypeIPSet, strategy, defs)
 
-	return result, nil
+	return result, firstSources(defs), conflicts, nil
 }
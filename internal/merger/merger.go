@@ -2,6 +2,8 @@ package merger
 
 import (
 	"context"
+	"maps"
+	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
@@ -9,116 +11,177 @@ import (
 
 // Merger merges ACL resources from multiple stacks into a single Tailscale policy.
 type Merger struct {
-	store storage.Storage
+	store      storage.Storage
+	strategies domain.MergeStrategies
 }
 
-// New creates a new Merger.
-func New(store storage.Storage) *Merger {
-	return &Merger{store: store}
+// New creates a new Merger that merges named sections with strategies.
+// Sections left out, or all of them when strategies is nil, keep their
+// default strategy.
+func New(store storage.Storage, strategies domain.MergeStrategies) *Merger {
+	merged := domain.DefaultMergeStrategies()
+	maps.Copy(merged, strategies)
+	return &Merger{store: store, strategies: merged}
 }
 
 // Merge loads all resources from storage and merges them into a single policy.
 func (m *Merger) Merge(ctx context.Context) (*domain.TailscalePolicy, error) {
+	policy, _, err := m.MergeWithProvenance(ctx)
+	return policy, err
+}
+
+// MergeWithProvenance merges all resources like Merge and also reports which
+// stack resource produced each merged rule, group member, and named entry.
+// Group members, ACLs, grants, and SSH rules past their expiry are left out.
+// Named sections are merged with the strategies the Merger was created with.
+func (m *Merger) MergeWithProvenance(ctx context.Context) (*domain.TailscalePolicy, *domain.PolicyProvenance, error) {
+	now := time.Now()
+	strategies := maps.Clone(m.strategies)
 	policy := &domain.TailscalePolicy{}
+	provenance := &domain.PolicyProvenance{Stacks: make(map[string]string), Strategies: strategies}
+
+	stacks, err := m.store.ListStacks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, stack := range stacks {
+		provenance.Stacks[stack.ID] = stack.Name
+	}
 
-	// Merge groups (union of members)
-	groups, err := m.mergeGroups(ctx)
+	// Merge groups (union of members by default, with nested groups flattened)
+	groups, groupSources, nestedSources, groupConflicts, err := m.mergeGroups(ctx, strategies.For("groups"), now)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(groups) > 0 {
 		policy.Groups = groups
+		provenance.Groups = groupSources
 	}
+	if len(nestedSources) > 0 {
+		provenance.NestedGroups = nestedSources
+	}
+	provenance.Conflicts = append(provenance.Conflicts, groupConflicts...)
 
-	// Merge tag owners (union of owners)
-	tagOwners, err := m.mergeTagOwners(ctx)
+	// Merge tag owners (union of owners by default)
+	tagOwners, tagOwnerSources, tagOwnerConflicts, err := m.mergeTagOwners(ctx, strategies.For("tagOwners"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(tagOwners) > 0 {
 		policy.TagOwners = tagOwners
+		provenance.TagOwners = tagOwnerSources
 	}
+	provenance.Conflicts = append(provenance.Conflicts, tagOwnerConflicts...)
 
-	// Merge hosts (first-writer wins by stack priority)
-	hosts, err := m.mergeHosts(ctx)
+	// Merge hosts (highest stack priority wins by default, collecting conflicts)
+	hosts, hostSources, hostConflicts, err := m.mergeHosts(ctx, strategies.For("hosts"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(hosts) > 0 {
 		policy.Hosts = hosts
+		provenance.Hosts = hostSources
 	}
+	provenance.Conflicts = append(provenance.Conflicts, hostConflicts...)
 
 	// Merge ACLs (ordered by stack priority, then rule order)
-	acls, err := m.mergeACLs(ctx)
+	acls, aclSources, err := m.mergeACLs(ctx, now)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(acls) > 0 {
 		policy.ACLs = acls
+		provenance.ACLs = aclSources
 	}
 
 	// Merge grants (ordered by stack priority, then rule order)
-	grants, err := m.mergeGrants(ctx)
+	grants, grantSources, err := m.mergeGrants(ctx, now)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(grants) > 0 {
 		policy.Grants = grants
+		provenance.Grants = grantSources
 	}
 
 	// Merge SSH rules (ordered by stack priority, then rule order)
-	ssh, err := m.mergeSSH(ctx)
+	ssh, sshSources, err := m.mergeSSH(ctx, now)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(ssh) > 0 {
 		policy.SSH = ssh
+		provenance.SSH = sshSources
 	}
 
-	// Merge auto approvers (additive merge)
-	autoApprovers, err := m.mergeAutoApprovers(ctx)
+	// Merge auto approvers (additive merge by default)
+	autoApprovers, autoApproverSources, autoApproverConflicts, err := m.mergeAutoApprovers(ctx, strategies.For("autoApprovers"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if autoApprovers != nil {
 		policy.AutoApprovers = autoApprovers
+		provenance.AutoApprovers = autoApproverSources
 	}
+	provenance.Conflicts = append(provenance.Conflicts, autoApproverConflicts...)
 
 	// Merge node attributes (concatenated)
-	nodeAttrs, err := m.mergeNodeAttrs(ctx)
+	nodeAttrs, nodeAttrSources, err := m.mergeNodeAttrs(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(nodeAttrs) > 0 {
 		policy.NodeAttrs = nodeAttrs
+		provenance.NodeAttrs = nodeAttrSources
 	}
 
-	// Merge postures (first-writer wins by stack priority)
-	postures, err := m.mergePostures(ctx)
+	// Merge postures (highest stack priority wins by default, collecting conflicts)
+	postures, postureSources, postureConflicts, err := m.mergePostures(ctx, strategies.For("postures"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(postures) > 0 {
 		policy.Postures = postures
+		provenance.Postures = postureSources
 	}
+	provenance.Conflicts = append(provenance.Conflicts, postureConflicts...)
 
-	// Merge IP sets (first-writer wins by stack priority)
-	ipsets, err := m.mergeIPSets(ctx)
+	// Merge IP sets (highest stack priority wins by default, collecting conflicts)
+	ipsets, ipsetSources, ipsetConflicts, err := m.mergeIPSets(ctx, strategies.For("ipsets"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(ipsets) > 0 {
 		policy.IPSets = ipsets
+		provenance.IPSets = ipsetSources
 	}
+	provenance.Conflicts = append(provenance.Conflicts, ipsetConflicts...)
 
 	// Merge tests (concatenated)
-	tests, err := m.mergeTests(ctx)
+	tests, testSources, err := m.mergeTests(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(tests) > 0 {
 		policy.Tests = tests
+		provenance.Tests = testSources
+	}
+
+	for i := range provenance.Conflicts {
+		c := &provenance.Conflicts[i]
+		c.Winner.StackName = provenance.Stacks[c.Winner.StackID]
+		for j := range c.Shadowed {
+			c.Shadowed[j].StackName = provenance.Stacks[c.Shadowed[j].StackID]
+		}
 	}
 
-	return policy, nil
+	return policy, provenance, nil
+}
+
+// addMemberSource records that a resource contributed member to the named entry.
+func addMemberSource(sources map[string]map[string][]domain.RuleSource, name, member string, source domain.RuleSource) {
+	if _, ok := sources[name]; !ok {
+		sources[name] = make(map[string][]domain.RuleSource)
+	}
+	sources[name][member] = append(sources[name][member], source)
 }
@@ -53,7 +53,7 @@ func TestMergeGroups_Union(t *testing.T) {
 	_ = store.CreateGroup(ctx, group3)
 
 	// Merge
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -86,6 +86,56 @@ func TestMergeGroups_Union(t *testing.T) {
 	}
 }
 
+func TestMergeGroups_Nested(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+	now := time.Now()
+
+	_ = store.CreateStack(ctx, &domain.Stack{ID: "stack1", Name: "Stack 1", Priority: 10, CreatedAt: now, UpdatedAt: now})
+	_ = store.CreateStack(ctx, &domain.Stack{ID: "stack2", Name: "Stack 2", Priority: 20, CreatedAt: now, UpdatedAt: now})
+
+	// group:eng nests group:sre from another stack, which nests group:oncall
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g1", StackID: "stack1", Name: "group:eng", Members: []string{"alice@example.com", "group:sre"}, CreatedAt: now, UpdatedAt: now})
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g2", StackID: "stack2", Name: "group:sre", Members: []string{"bob@example.com", "group:oncall"}, CreatedAt: now, UpdatedAt: now})
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g3", StackID: "stack2", Name: "group:oncall", Members: []string{"carol@example.com", "group:sre"}, CreatedAt: now, UpdatedAt: now})
+
+	policy, prov, err := merger.New(store, nil).MergeWithProvenance(ctx)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	expected := map[string][]string{
+		"group:eng":    {"alice@example.com", "bob@example.com", "carol@example.com"},
+		"group:sre":    {"bob@example.com", "carol@example.com"},
+		"group:oncall": {"bob@example.com", "carol@example.com"},
+	}
+	for name, want := range expected {
+		got := policy.Groups[name]
+		sort.Strings(got)
+		if len(got) != len(want) {
+			t.Errorf("Expected %s to have members %v, got %v", name, want, got)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected %s to have members %v, got %v", name, want, got)
+				break
+			}
+		}
+	}
+
+	// Inherited members are attributed to the group that nested them
+	if sources := prov.Groups["group:eng"]["carol@example.com"]; len(sources) != 1 || sources[0].ResourceID != "g1" {
+		t.Errorf("Expected carol to come from g1, got %+v", sources)
+	}
+	if _, ok := prov.Groups["group:eng"]["group:sre"]; ok {
+		t.Error("Expected group:sre to be flattened out of the provenance")
+	}
+	if sources := prov.NestedGroups["group:eng"]["group:sre"]; len(sources) != 1 || sources[0].ResourceID != "g1" {
+		t.Errorf("Expected group:eng to record nesting group:sre, got %+v", prov.NestedGroups)
+	}
+}
+
 func TestMergeTagOwners_Union(t *testing.T) {
 	store := memory.New()
 	ctx := context.Background()
@@ -116,7 +166,7 @@ func TestMergeTagOwners_Union(t *testing.T) {
 	_ = store.CreateTagOwner(ctx, to1)
 	_ = store.CreateTagOwner(ctx, to2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -174,7 +224,7 @@ func TestMergeHosts_FirstWriterWins(t *testing.T) {
 	_ = store.CreateHost(ctx, host2)
 	_ = store.CreateHost(ctx, host3)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -239,7 +289,7 @@ func TestMergeACLs_OrderedByPriorityThenOrder(t *testing.T) {
 	_ = store.CreateACLRule(ctx, rule2)
 	_ = store.CreateACLRule(ctx, rule3)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -299,7 +349,7 @@ func TestMergeSSH_OrderedByPriorityThenOrder(t *testing.T) {
 	_ = store.CreateSSHRule(ctx, ssh1)
 	_ = store.CreateSSHRule(ctx, ssh2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -360,7 +410,7 @@ func TestMergeAutoApprovers_Additive(t *testing.T) {
 	_ = store.CreateAutoApprover(ctx, aa2)
 	_ = store.CreateAutoApprover(ctx, aa3)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -412,7 +462,7 @@ func TestMergePostures_FirstWriterWins(t *testing.T) {
 	_ = store.CreatePosture(ctx, p1)
 	_ = store.CreatePosture(ctx, p2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -455,7 +505,7 @@ func TestMergeIPSets_FirstWriterWins(t *testing.T) {
 	_ = store.CreateIPSet(ctx, is1)
 	_ = store.CreateIPSet(ctx, is2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -499,7 +549,7 @@ func TestMergeTests_Concatenated(t *testing.T) {
 	_ = store.CreateACLTest(ctx, test1)
 	_ = store.CreateACLTest(ctx, test2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -546,7 +596,7 @@ func TestMergeNodeAttrs_Concatenated(t *testing.T) {
 	_ = store.CreateNodeAttr(ctx, na1)
 	_ = store.CreateNodeAttr(ctx, na2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -595,7 +645,7 @@ func TestMergeGrants_OrderedByPriorityThenOrder(t *testing.T) {
 	_ = store.CreateGrant(ctx, grant1)
 	_ = store.CreateGrant(ctx, grant2)
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -615,7 +665,7 @@ func TestMergeEmpty(t *testing.T) {
 	store := memory.New()
 	ctx := context.Background()
 
-	m := merger.New(store)
+	m := merger.New(store, nil)
 	policy, err := m.Merge(ctx)
 	if err != nil {
 		t.Fatalf("Merge failed: %v", err)
@@ -629,3 +679,200 @@ func TestMergeEmpty(t *testing.T) {
 		t.Errorf("Expected ACLs to be nil, got %v", policy.ACLs)
 	}
 }
+
+func TestMergeWithProvenance(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+
+	stack1 := &domain.Stack{ID: "stack1", Name: "Stack 1", Priority: 10, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	stack2 := &domain.Stack{ID: "stack2", Name: "Stack 2", Priority: 20, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	_ = store.CreateStack(ctx, stack1)
+	_ = store.CreateStack(ctx, stack2)
+
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g1", StackID: "stack1", Name: "group:dev", Members: []string{"user1@example.com", "user2@example.com"}})
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g2", StackID: "stack2", Name: "group:dev", Members: []string{"user2@example.com"}})
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h1", StackID: "stack1", Name: "db", Address: "10.0.0.1"})
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h2", StackID: "stack2", Name: "db", Address: "10.0.0.2"})
+	_ = store.CreateACLRule(ctx, &domain.ACLRule{ID: "r1", StackID: "stack2", Order: 0, Action: "accept", Sources: []string{"*"}, Destinations: []string{"*:80"}})
+	_ = store.CreateACLRule(ctx, &domain.ACLRule{ID: "r2", StackID: "stack1", Order: 5, Action: "accept", Sources: []string{"*"}, Destinations: []string{"*:22"}})
+
+	m := merger.New(store, nil)
+	policy, prov, err := m.MergeWithProvenance(ctx)
+	if err != nil {
+		t.Fatalf("MergeWithProvenance failed: %v", err)
+	}
+
+	if len(prov.ACLs) != len(policy.ACLs) {
+		t.Fatalf("Expected %d ACL sources, got %d", len(policy.ACLs), len(prov.ACLs))
+	}
+	if prov.ACLs[0] != (domain.RuleSource{StackID: "stack1", ResourceID: "r2", Order: 5}) {
+		t.Errorf("Expected ACL 0 to come from r2, got %+v", prov.ACLs[0])
+	}
+	if prov.ACLs[1].ResourceID != "r1" {
+		t.Errorf("Expected ACL 1 to come from r1, got %+v", prov.ACLs[1])
+	}
+
+	if got := prov.Groups["group:dev"]["user1@example.com"]; len(got) != 1 || got[0].ResourceID != "g1" {
+		t.Errorf("Expected user1 to come from g1, got %+v", got)
+	}
+	if got := prov.Groups["group:dev"]["user2@example.com"]; len(got) != 2 {
+		t.Errorf("Expected user2 to come from both groups, got %+v", got)
+	}
+
+	if prov.Hosts["db"].ResourceID != "h1" {
+		t.Errorf("Expected host db to come from the winning stack, got %+v", prov.Hosts["db"])
+	}
+	if prov.Stacks["stack2"] != "Stack 2" {
+		t.Errorf("Expected stack names to be resolved, got %v", prov.Stacks)
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+
+	stack1 := &domain.Stack{ID: "stack1", Name: "Stack 1", Priority: 10, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	stack2 := &domain.Stack{ID: "stack2", Name: "Stack 2", Priority: 20, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	_ = store.CreateStack(ctx, stack1)
+	_ = store.CreateStack(ctx, stack2)
+
+	// Same host name, different addresses
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h1", StackID: "stack1", Name: "db", Address: "10.0.0.1"})
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h2", StackID: "stack2", Name: "db", Address: "10.0.0.2"})
+	// Same host name, same address: not a conflict
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h3", StackID: "stack1", Name: "web", Address: "10.0.0.3"})
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h4", StackID: "stack2", Name: "web", Address: "10.0.0.3"})
+	// Same IP set members in a different order: not a conflict
+	_ = store.CreateIPSet(ctx, &domain.IPSet{ID: "i1", StackID: "stack1", Name: "ipset:prod", Addresses: []string{"10.1.0.0/16", "10.2.0.0/16"}})
+	_ = store.CreateIPSet(ctx, &domain.IPSet{ID: "i2", StackID: "stack2", Name: "ipset:prod", Addresses: []string{"10.2.0.0/16", "10.1.0.0/16"}})
+	// Same posture name, different rules
+	_ = store.CreatePosture(ctx, &domain.Posture{ID: "p1", StackID: "stack1", Name: "posture:latest", Rules: []string{"node:tsVersion >= '1.60'"}})
+	_ = store.CreatePosture(ctx, &domain.Posture{ID: "p2", StackID: "stack2", Name: "posture:latest", Rules: []string{"node:os == 'linux'"}})
+
+	m := merger.New(store, nil)
+	_, prov, err := m.MergeWithProvenance(ctx)
+	if err != nil {
+		t.Fatalf("MergeWithProvenance failed: %v", err)
+	}
+
+	if len(prov.Conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %+v", prov.Conflicts)
+	}
+
+	host := prov.Conflicts[0]
+	if host.Type != domain.ConflictTypeHost || host.Name != "db" {
+		t.Fatalf("Expected host conflict for db first, got %+v", host)
+	}
+	if host.Winner.ResourceID != "h1" || host.Winner.StackName != "Stack 1" || host.Winner.Value != "10.0.0.1" {
+		t.Errorf("Expected h1 to win, got %+v", host.Winner)
+	}
+	if len(host.Shadowed) != 1 || host.Shadowed[0].ResourceID != "h2" || host.Shadowed[0].StackName != "Stack 2" {
+		t.Errorf("Expected h2 to be shadowed, got %+v", host.Shadowed)
+	}
+
+	if prov.Conflicts[1].Type != domain.ConflictTypePosture || prov.Conflicts[1].Name != "posture:latest" {
+		t.Errorf("Expected posture conflict, got %+v", prov.Conflicts[1])
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+
+	stack1 := &domain.Stack{ID: "stack1", Name: "Stack 1", Priority: 10, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	stack2 := &domain.Stack{ID: "stack2", Name: "Stack 2", Priority: 20, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	_ = store.CreateStack(ctx, stack1)
+	_ = store.CreateStack(ctx, stack2)
+
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g1", StackID: "stack1", Name: "group:admins", Members: []string{"alice@example.com", "bob@example.com"}})
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g2", StackID: "stack2", Name: "group:admins", Members: []string{"bob@example.com", "carol@example.com"}})
+	_ = store.CreateTagOwner(ctx, &domain.TagOwner{ID: "t1", StackID: "stack1", Tag: "tag:web", Owners: []string{"group:admins"}})
+	_ = store.CreateTagOwner(ctx, &domain.TagOwner{ID: "t2", StackID: "stack2", Tag: "tag:web", Owners: []string{"carol@example.com"}})
+	_ = store.CreateIPSet(ctx, &domain.IPSet{ID: "i1", StackID: "stack1", Name: "ipset:prod", Addresses: []string{"10.1.0.0/16"}})
+	_ = store.CreateIPSet(ctx, &domain.IPSet{ID: "i2", StackID: "stack2", Name: "ipset:prod", Addresses: []string{"10.2.0.0/16"}})
+
+	strategies := domain.MergeStrategies{
+		"groups":    domain.MergeStrategyIntersect,
+		"tagOwners": domain.MergeStrategyErrorOnConflict,
+		"ipsets":    domain.MergeStrategyUnion,
+	}
+	policy, prov, err := merger.New(store, strategies).MergeWithProvenance(ctx)
+	if err != nil {
+		t.Fatalf("MergeWithProvenance failed: %v", err)
+	}
+
+	if got := policy.Groups["group:admins"]; len(got) != 1 || got[0] != "bob@example.com" {
+		t.Errorf("Expected only bob in the intersected group, got %v", got)
+	}
+	if sources := prov.Groups["group:admins"]["bob@example.com"]; len(sources) != 2 {
+		t.Errorf("Expected bob to be attributed to both groups, got %+v", sources)
+	}
+	if _, ok := prov.Groups["group:admins"]["alice@example.com"]; ok {
+		t.Errorf("Expected no provenance for alice, got %+v", prov.Groups["group:admins"])
+	}
+
+	if got := policy.TagOwners["tag:web"]; len(got) != 1 || got[0] != "group:admins" {
+		t.Errorf("Expected stack1 to define tag:web, got %v", got)
+	}
+	if len(prov.Conflicts) != 1 || prov.Conflicts[0].Type != domain.ConflictTypeTagOwner || !prov.Conflicts[0].Blocking() {
+		t.Fatalf("Expected a blocking tag owner conflict, got %+v", prov.Conflicts)
+	}
+	if prov.Conflicts[0].Winner.ResourceID != "t1" || prov.Conflicts[0].Shadowed[0].ResourceID != "t2" {
+		t.Errorf("Expected t1 to shadow t2, got %+v", prov.Conflicts[0])
+	}
+
+	got := policy.IPSets["ipset:prod"]
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "10.1.0.0/16" || got[1] != "10.2.0.0/16" {
+		t.Errorf("Expected the union of both IP sets, got %v", got)
+	}
+	if prov.IPSets["ipset:prod"].ResourceID != "i1" {
+		t.Errorf("Expected the IP set to be attributed to the highest priority stack, got %+v", prov.IPSets["ipset:prod"])
+	}
+}
+
+func TestParseStrategies(t *testing.T) {
+	strategies, err := merger.ParseStrategies(" groups=priority-override , hosts=error-on-conflict,")
+	if err != nil {
+		t.Fatalf("ParseStrategies failed: %v", err)
+	}
+	if len(strategies) != 2 || strategies["groups"] != domain.MergeStrategyPriorityOverride || strategies["hosts"] != domain.MergeStrategyErrorOnConflict {
+		t.Errorf("Unexpected strategies: %v", strategies)
+	}
+	if strategies.For("tagOwners") != domain.MergeStrategyUnion {
+		t.Errorf("Expected tagOwners to default to union, got %q", strategies.For("tagOwners"))
+	}
+
+	for _, spec := range []string{"groups", "acls=union", "groups=replace", "hosts=union", "hosts=intersect"} {
+		if _, err := merger.ParseStrategies(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestMergeSkipsDisabledStacks(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+
+	stack1 := &domain.Stack{ID: "stack1", Name: "Stack 1", Priority: 10, Disabled: true, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	stack2 := &domain.Stack{ID: "stack2", Name: "Stack 2", Priority: 20, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	_ = store.CreateStack(ctx, stack1)
+	_ = store.CreateStack(ctx, stack2)
+
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h1", StackID: "stack1", Name: "db", Address: "10.0.0.1"})
+	_ = store.CreateHost(ctx, &domain.Host{ID: "h2", StackID: "stack2", Name: "db", Address: "10.0.0.2"})
+	_ = store.CreateACLRule(ctx, &domain.ACLRule{ID: "a1", StackID: "stack1", Action: "accept", Sources: []string{"*"}, Destinations: []string{"db:*"}})
+
+	policy, prov, err := merger.New(store, nil).MergeWithProvenance(ctx)
+	if err != nil {
+		t.Fatalf("MergeWithProvenance failed: %v", err)
+	}
+
+	// The disabled stack neither wins nor conflicts
+	if policy.Hosts["db"] != "10.0.0.2" || len(prov.Conflicts) != 0 {
+		t.Errorf("Expected stack2's db without conflicts, got %v %+v", policy.Hosts, prov.Conflicts)
+	}
+	if len(policy.ACLs) != 0 {
+		t.Errorf("Expected no ACLs from the disabled stack, got %+v", policy.ACLs)
+	}
+}
@@ -8,18 +8,20 @@ import (
 
 // mergeNodeAttrs merges node attributes from all stacks.
 // Node attributes are concatenated from all stacks, ordered by stack priority then rule order.
-func (m *Merger) mergeNodeAttrs(ctx context.Context) ([]domain.TailscaleNodeAttr, error) {
+// The returned sources are parallel to the merged node attributes.
+func (m *Merger) mergeNodeAttrs(ctx context.Context) ([]domain.TailscaleNodeAttr, []domain.RuleSource, error) {
 	nodeAttrs, err := m.store.ListAllNodeAttrs(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(nodeAttrs) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Results are already ordered by stack priority then rule order
 	result := make([]domain.TailscaleNodeAttr, 0, len(nodeAttrs))
+	sources := make([]domain.RuleSource, 0, len(nodeAttrs))
 	for _, na := range nodeAttrs {
 		attr := domain.TailscaleNodeAttr{
 			Target: na.Target,
@@ -31,7 +33,8 @@ func (m *Merger) mergeNodeAttrs(ctx context.Context) ([]domain.TailscaleNodeAttr
 			attr.App = na.App
 		}
 		result = append(result, attr)
+		sources = append(sources, domain.RuleSource{StackID: na.StackID, ResourceID: na.ID, Order: na.Order})
 	}
 
-	return result, nil
+	return result, sources, nil
 }
@@ -2,28 +2,28 @@ package merger
 
 import (
 	"context"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
-// mergePostures merges postures from all stacks.
-// First-writer wins (by stack priority) - if multiple stacks define the same posture name,
-// the one from the highest priority stack is used.
-func (m *Merger) mergePostures(ctx context.Context) (map[string][]string, error) {
+// mergePostures merges postures from all stacks with the postures strategy.
+// By default the definition from the highest priority stack is used, and
+// definitions that differ from it are reported as conflicts.
+func (m *Merger) mergePostures(ctx context.Context, strategy string) (map[string][]string, map[string]domain.RuleSource, []domain.MergeConflict, error) {
 	postures, err := m.store.ListAllPostures(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if len(postures) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 
-	// Results are already ordered by stack priority, so first occurrence wins
-	result := make(map[string][]string)
+	defs := make([]definition, 0, len(postures))
 	for _, p := range postures {
-		if _, exists := result[p.Name]; !exists {
-			result[p.Name] = p.Rules
-		}
+		defs = append(defs, definition{name: p.Name, values: p.Rules, source: domain.RuleSource{StackID: p.StackID, ResourceID: p.ID}})
 	}
+	result, _, conflicts := mergeLists(domain.ConflictTypePosture, strategy, defs)
 
-	return result, nil
+	return result, firstSources(defs), conflicts, nil
 }
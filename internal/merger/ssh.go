@@ -2,25 +2,32 @@ package merger
 
 import (
 	"context"
+	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
 // mergeSSH merges SSH rules from all stacks.
 // SSH rules are ordered by stack priority, then by rule order within each stack.
-func (m *Merger) mergeSSH(ctx context.Context) ([]domain.TailscaleSSH, error) {
+// Expired rules are left out.
+// The returned sources are parallel to the merged rules.
+func (m *Merger) mergeSSH(ctx context.Context, now time.Time) ([]domain.TailscaleSSH, []domain.RuleSource, error) {
 	rules, err := m.store.ListAllSSHRules(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(rules) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Results are already ordered by stack priority then rule order
 	result := make([]domain.TailscaleSSH, 0, len(rules))
+	sources := make([]domain.RuleSource, 0, len(rules))
 	for _, r := range rules {
+		if domain.Expired(r.ExpiresAt, now) {
+			continue
+		}
 		ssh := domain.TailscaleSSH{
 			Action: r.Action,
 			Src:    r.Sources,
@@ -31,7 +38,8 @@ func (m *Merger) mergeSSH(ctx context.Context) ([]domain.TailscaleSSH, error) {
 			ssh.CheckPeriod = r.CheckPeriod
 		}
 		result = append(result, ssh)
+		sources = append(sources, domain.RuleSource{StackID: r.StackID, ResourceID: r.ID, Order: r.Order, Description: r.Description})
 	}
 
-	return result, nil
+	return result, sources, nil
 }
@@ -0,0 +1,151 @@
+package merger
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// ParseStrategies parses a comma-separated list of section=strategy pairs,
+// such as "groups=priority-override,hosts=error-on-conflict".
+func ParseStrategies(spec string) (domain.MergeStrategies, error) {
+	result := make(domain.MergeStrategies)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		section, strategy, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("merge strategy %q must be section=strategy", pair)
+		}
+		section, strategy = strings.TrimSpace(section), strings.TrimSpace(strategy)
+		allowed, ok := sectionStrategies[section]
+		if !ok {
+			return nil, fmt.Errorf("unknown merge strategy section %q; must be one of %s", section, strings.Join(slices.Sorted(maps.Keys(sectionStrategies)), ", "))
+		}
+		if !slices.Contains(allowed, strategy) {
+			return nil, fmt.Errorf("merge strategy for %s must be one of %s", section, strings.Join(allowed, ", "))
+		}
+		result[section] = strategy
+	}
+	return result, nil
+}
+
+// sectionStrategies lists the strategies each named section supports. A host
+// has a single address, so its definitions cannot be unioned or intersected.
+var sectionStrategies = map[string][]string{
+	"groups":        listStrategies,
+	"tagOwners":     listStrategies,
+	"autoApprovers": listStrategies,
+	"hosts":         {domain.MergeStrategyPriorityOverride, domain.MergeStrategyErrorOnConflict},
+	"postures":      listStrategies,
+	"ipsets":        listStrategies,
+}
+
+var listStrategies = []string{
+	domain.MergeStrategyUnion,
+	domain.MergeStrategyPriorityOverride,
+	domain.MergeStrategyErrorOnConflict,
+	domain.MergeStrategyIntersect,
+}
+
+// definition is one resource's definition of a named list, such as the
+// members of a group.
+type definition struct {
+	name   string
+	values []string
+	source domain.RuleSource
+}
+
+// mergeLists combines definitions, ordered by stack priority, with strategy.
+// It returns the merged lists, the resources that contributed each value,
+// and, for priority-override and error-on-conflict, the definitions that
+// differ from the one used.
+func mergeLists(kind, strategy string, defs []definition) (map[string][]string, map[string]map[string][]domain.RuleSource, []domain.MergeConflict) {
+	result := make(map[string][]string)
+	sources := make(map[string]map[string][]domain.RuleSource)
+	conflicts := newConflictTracker(kind, strategy)
+
+	switch strategy {
+	case domain.MergeStrategyPriorityOverride, domain.MergeStrategyErrorOnConflict:
+		for _, d := range defs {
+			if _, exists := result[d.name]; exists {
+				conflicts.shadow(d.name, d.source, uniqueValues(d.values))
+				continue
+			}
+			result[d.name] = uniqueValues(d.values)
+			for _, v := range result[d.name] {
+				addMemberSource(sources, d.name, v, d.source)
+			}
+			conflicts.win(d.name, d.source, result[d.name])
+		}
+
+	case domain.MergeStrategyIntersect:
+		count := make(map[string]int)
+		for _, d := range defs {
+			count[d.name]++
+		}
+		seen := make(map[string]map[string]int)
+		for _, d := range defs {
+			if _, ok := seen[d.name]; !ok {
+				seen[d.name] = make(map[string]int)
+				result[d.name] = []string{}
+			}
+			for _, v := range uniqueValues(d.values) {
+				seen[d.name][v]++
+				if seen[d.name][v] == count[d.name] {
+					result[d.name] = append(result[d.name], v)
+				}
+			}
+		}
+		for _, d := range defs {
+			for _, v := range uniqueValues(d.values) {
+				if seen[d.name][v] == count[d.name] {
+					addMemberSource(sources, d.name, v, d.source)
+				}
+			}
+		}
+
+	default:
+		for _, d := range defs {
+			if _, ok := result[d.name]; !ok {
+				result[d.name] = []string{}
+			}
+			for _, v := range d.values {
+				if _, ok := sources[d.name][v]; !ok {
+					result[d.name] = append(result[d.name], v)
+				}
+				addMemberSource(sources, d.name, v, d.source)
+			}
+		}
+	}
+
+	return result, sources, conflicts.result()
+}
+
+// uniqueValues returns values without repeats, in order.
+func uniqueValues(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !slices.Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// firstSources returns the source of the first definition of each name, the
+// one from the highest priority stack.
+func firstSources(defs []definition) map[string]domain.RuleSource {
+	sources := make(map[string]domain.RuleSource)
+	for _, d := range defs {
+		if _, ok := sources[d.name]; !ok {
+			sources[d.name] = d.source
+		}
+	}
+	return sources
+}
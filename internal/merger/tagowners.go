@@ -2,41 +2,28 @@ package merger
 
 import (
 	"context"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
-// mergeTagOwners merges tag owners from all stacks.
-// Tag owners with the same tag have their owners merged (union).
-func (m *Merger) mergeTagOwners(ctx context.Context) (map[string][]string, error) {
+// mergeTagOwners merges tag owners from all stacks with the tagOwners
+// strategy. The returned sources record every tag owner resource that
+// contributed each owner.
+func (m *Merger) mergeTagOwners(ctx context.Context, strategy string) (map[string][]string, map[string]map[string][]domain.RuleSource, []domain.MergeConflict, error) {
 	tagOwners, err := m.store.ListAllTagOwners(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if len(tagOwners) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 
-	// Group by tag, union owners
-	result := make(map[string][]string)
-	ownerSet := make(map[string]map[string]bool)
-
+	defs := make([]definition, 0, len(tagOwners))
 	for _, to := range tagOwners {
-		if _, ok := ownerSet[to.Tag]; !ok {
-			ownerSet[to.Tag] = make(map[string]bool)
-		}
-		for _, owner := range to.Owners {
-			ownerSet[to.Tag][owner] = true
-		}
-	}
-
-	// Convert sets to slices
-	for tag, owners := range ownerSet {
-		slice := make([]string, 0, len(owners))
-		for owner := range owners {
-			slice = append(slice, owner)
-		}
-		result[tag] = slice
+		defs = append(defs, definition{name: to.Tag, values: to.Owners, source: domain.RuleSource{StackID: to.StackID, ResourceID: to.ID, Description: to.Description}})
 	}
+	result, sources, conflicts := mergeLists(domain.ConflictTypeTagOwner, strategy, defs)
 
-	return result, nil
+	return result, sources, conflicts, nil
 }
@@ -8,18 +8,20 @@ import (
 
 // mergeTests merges ACL tests from all stacks.
 // Tests are concatenated from all stacks, ordered by stack priority then rule order.
-func (m *Merger) mergeTests(ctx context.Context) ([]domain.TailscaleTest, error) {
+// The returned sources are parallel to the merged tests.
+func (m *Merger) mergeTests(ctx context.Context) ([]domain.TailscaleTest, []domain.RuleSource, error) {
 	tests, err := m.store.ListAllACLTests(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(tests) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Results are already ordered by stack priority then rule order
 	result := make([]domain.TailscaleTest, 0, len(tests))
+	sources := make([]domain.RuleSource, 0, len(tests))
 	for _, t := range tests {
 		test := domain.TailscaleTest{
 			Src: t.Source,
@@ -31,7 +33,8 @@ func (m *Merger) mergeTests(ctx context.Context) ([]domain.TailscaleTest, error)
 			test.Deny = t.Deny
 		}
 		result = append(result, test)
+		sources = append(sources, domain.RuleSource{StackID: t.StackID, ResourceID: t.ID, Order: t.Order})
 	}
 
-	return result, nil
+	return result, sources, nil
 }
@@ -0,0 +1,129 @@
+// Package nesting supports groups that contain other groups. Tailscale
+// does not allow nested groups, so they are flattened into their members
+// when the policy is merged, and writes that would make nested groups
+// contain themselves are rejected.
+package nesting
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+)
+
+// IsGroup reports whether a group member is a nested group.
+func IsGroup(member string) bool {
+	return strings.HasPrefix(member, "group:")
+}
+
+// Members returns the members of the group name in groups that are not
+// groups themselves, including the members of its nested groups,
+// transitively. Nested groups that are not defined add no members, and a
+// group reached twice, as in a cycle, is only expanded once.
+func Members(groups map[string][]string, name string) []string {
+	var members []string
+	seen := make(map[string]bool)
+	expanded := make(map[string]bool)
+
+	var expand func(group string)
+	expand = func(group string) {
+		if expanded[group] {
+			return
+		}
+		expanded[group] = true
+		for _, member := range groups[group] {
+			if IsGroup(member) {
+				expand(member)
+			} else if !seen[member] {
+				seen[member] = true
+				members = append(members, member)
+			}
+		}
+	}
+	expand(name)
+
+	return members
+}
+
+// Cycle returns a path of nested groups in groups that leads from the group
+// name back to itself, or nil if there is none.
+func Cycle(groups map[string][]string, name string) []string {
+	visited := make(map[string]bool)
+	var path []string
+
+	var visit func(group string) bool
+	visit = func(group string) bool {
+		path = append(path, group)
+		for _, member := range groups[group] {
+			if !IsGroup(member) {
+				continue
+			}
+			if member == name {
+				path = append(path, member)
+				return true
+			}
+			if !visited[member] {
+				visited[member] = true
+				if visit(member) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	if visit(name) {
+		return path
+	}
+	return nil
+}
+
+// Check returns a *domain.GroupCycleError if giving the group name of
+// stackID the members would make it contain itself, through the groups of
+// every stack.
+func Check(ctx context.Context, store storage.Storage, stackID, name string, members []string) error {
+	return check(ctx, store, stackID, []domain.CreateGroupRequest{{Name: name, Members: members}}, false)
+}
+
+// CheckState is Check for replacing the groups of stackID with those of
+// state.
+func CheckState(ctx context.Context, store storage.Storage, stackID string, state *domain.StackState) error {
+	return check(ctx, store, stackID, state.Groups, true)
+}
+
+// check merges the members of groups into those of the other stacks,
+// including disabled stacks so that enabling them cannot form a cycle, and
+// looks for cycles through each of them. The groups of stackID are left out
+// when replacing the whole stack, and otherwise only those being written.
+func check(ctx context.Context, store storage.Storage, stackID string, groups []domain.CreateGroupRequest, replaceStack bool) error {
+	if !slices.ContainsFunc(groups, func(g domain.CreateGroupRequest) bool { return slices.ContainsFunc(g.Members, IsGroup) }) {
+		return nil
+	}
+
+	existing, err := stackstate.ListAll(ctx, store, store.ListAllGroups, store.ListGroups)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string][]string)
+	for _, g := range existing {
+		replaced := g.StackID == stackID && (replaceStack || slices.ContainsFunc(groups, func(r domain.CreateGroupRequest) bool { return r.Name == g.Name }))
+		if !replaced {
+			merged[g.Name] = append(merged[g.Name], g.Members...)
+		}
+	}
+	for _, g := range groups {
+		merged[g.Name] = append(merged[g.Name], g.Members...)
+	}
+
+	for _, g := range groups {
+		if cycle := Cycle(merged, g.Name); cycle != nil {
+			return &domain.GroupCycleError{Cycle: cycle}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package nesting_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/nesting"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage/memory"
+)
+
+func TestCycle(t *testing.T) {
+	groups := map[string][]string{
+		"group:a": {"alice@example.com", "group:b"},
+		"group:b": {"group:c", "group:undefined"},
+		"group:c": {"group:a"},
+		"group:d": {"group:d"},
+		"group:e": {"group:a"},
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"group:a", []string{"group:a", "group:b", "group:c", "group:a"}},
+		{"group:d", []string{"group:d", "group:d"}},
+		{"group:e", nil}, // Reaches a cycle, but not through itself
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nesting.Cycle(groups, tt.name); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected cycle %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if got := nesting.Members(groups, "group:e"); !slices.Equal(got, []string{"alice@example.com"}) {
+		t.Errorf("Expected group:e to flatten to alice, got %v", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+	now := time.Now()
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g1", StackID: "stack1", Name: "group:eng", Members: []string{"group:sre"}, CreatedAt: now, UpdatedAt: now})
+	_ = store.CreateGroup(ctx, &domain.Group{ID: "g2", StackID: "stack2", Name: "group:sre", Members: []string{"bob@example.com"}, CreatedAt: now, UpdatedAt: now})
+
+	// Another stack closing the loop
+	err := nesting.Check(ctx, store, "stack2", "group:sre", []string{"group:eng"})
+	var cycleErr *domain.GroupCycleError
+	if !errors.As(err, &cycleErr) || !errors.Is(err, domain.ErrInvalidInput) {
+		t.Fatalf("Expected a group cycle error, got %v", err)
+	}
+	if want := []string{"group:sre", "group:eng", "group:sre"}; !slices.Equal(cycleErr.Cycle, want) {
+		t.Errorf("Expected cycle %v, got %v", want, cycleErr.Cycle)
+	}
+
+	// Replacing the group of stack1 removes its nesting
+	state := &domain.StackState{Groups: []domain.CreateGroupRequest{{Name: "group:eng", Members: []string{"alice@example.com"}}}}
+	if err := nesting.CheckState(ctx, store, "stack1", state); err != nil {
+		t.Errorf("Expected no cycle, got %v", err)
+	}
+	state = &domain.StackState{Groups: []domain.CreateGroupRequest{{Name: "group:ops", Members: []string{"group:eng"}}}}
+	if err := nesting.CheckState(ctx, store, "stack2", state); err != nil {
+		t.Errorf("Expected no cycle once stack2 no longer defines group:sre, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package policydiff computes structural differences between Tailscale policies.
+package policydiff
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// exitNodeKey is the key used for the exit node approvers in autoApprovers diffs.
+const exitNodeKey = "exitNode"
+
+// Diff compares two policies and returns the structural changes from prev to next.
+// A nil policy is treated as empty. The From and To labels are left for the caller.
+func Diff(prev, next *domain.TailscalePolicy) *domain.PolicyDiff {
+	if prev == nil {
+		prev = &domain.TailscalePolicy{}
+	}
+	if next == nil {
+		next = &domain.TailscalePolicy{}
+	}
+
+	d := &domain.PolicyDiff{
+		Groups:        diffNamedLists(prev.Groups, next.Groups),
+		TagOwners:     diffNamedLists(prev.TagOwners, next.TagOwners),
+		Hosts:         diffHosts(prev.Hosts, next.Hosts),
+		Postures:      diffNamedLists(prev.Postures, next.Postures),
+		IPSets:        diffNamedLists(prev.IPSets, next.IPSets),
+		AutoApprovers: diffNamedLists(autoApproverLists(prev.AutoApprovers), autoApproverLists(next.AutoApprovers)),
+		ACLs:          diffRules(prev.ACLs, next.ACLs),
+		Grants:        diffRules(prev.Grants, next.Grants),
+		SSH:           diffRules(prev.SSH, next.SSH),
+		NodeAttrs:     diffRules(prev.NodeAttrs, next.NodeAttrs),
+		Tests:         diffRules(prev.Tests, next.Tests),
+	}
+
+	d.Identical = d.ChangeCount() == 0
+
+	return d
+}
+
+// diffNamedLists compares two maps of named string lists, sorted by name.
+func diffNamedLists(prev, next map[string][]string) []domain.NamedListDiff {
+	var result []domain.NamedListDiff
+
+	for _, name := range sortedKeys(prev, next) {
+		prevValues, inPrev := prev[name]
+		nextValues, inNext := next[name]
+
+		switch {
+		case !inPrev:
+			result = append(result, domain.NamedListDiff{Name: name, Change: domain.DiffAdded, Added: nextValues})
+		case !inNext:
+			result = append(result, domain.NamedListDiff{Name: name, Change: domain.DiffRemoved, Removed: prevValues})
+		default:
+			added, removed := diffStrings(prevValues, nextValues)
+			if len(added) > 0 || len(removed) > 0 {
+				result = append(result, domain.NamedListDiff{
+					Name:    name,
+					Change:  domain.DiffChanged,
+					Added:   added,
+					Removed: removed,
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+// diffHosts compares two host maps, sorted by name.
+func diffHosts(prev, next map[string]string) []domain.HostDiff {
+	var result []domain.HostDiff
+
+	for _, name := range sortedKeys(prev, next) {
+		before, inPrev := prev[name]
+		after, inNext := next[name]
+
+		switch {
+		case !inPrev:
+			result = append(result, domain.HostDiff{Name: name, Change: domain.DiffAdded, After: after})
+		case !inNext:
+			result = append(result, domain.HostDiff{Name: name, Change: domain.DiffRemoved, Before: before})
+		case before != after:
+			result = append(result, domain.HostDiff{Name: name, Change: domain.DiffChanged, Before: before, After: after})
+		}
+	}
+
+	return result
+}
+
+// diffRules compares two rule lists as multisets.
+// Rules are matched by their JSON encoding, so reordering is not a change.
+// Earlier duplicates are matched first, so only surplus copies are reported.
+// Removals are listed first, followed by additions, each in list order.
+func diffRules[T any](prev, next []T) []domain.RuleDiff {
+	prevKeys := make([]string, len(prev))
+	unmatched := make(map[string]int, len(prev))
+	for i, rule := range prev {
+		prevKeys[i] = ruleKey(rule)
+		unmatched[prevKeys[i]]++
+	}
+
+	var added []domain.RuleDiff
+	for i, rule := range next {
+		key := ruleKey(rule)
+		if unmatched[key] > 0 {
+			unmatched[key]--
+			continue
+		}
+		added = append(added, domain.RuleDiff{Change: domain.DiffAdded, Index: i, Rule: rule})
+	}
+
+	// Whatever is still unmatched for a key are its trailing occurrences in prev
+	kept := make(map[string]int, len(prev))
+	for key, n := range unmatched {
+		kept[key] = -n
+	}
+	for _, key := range prevKeys {
+		kept[key]++
+	}
+
+	var result []domain.RuleDiff
+	for i, rule := range prev {
+		key := prevKeys[i]
+		if kept[key] > 0 {
+			kept[key]--
+			continue
+		}
+		result = append(result, domain.RuleDiff{Change: domain.DiffRemoved, Index: i, Rule: rule})
+	}
+
+	return append(result, added...)
+}
+
+// ruleKey returns a canonical key for a rule.
+// encoding/json sorts map keys, so nested maps compare stably.
+func ruleKey(rule any) string {
+	data, _ := json.Marshal(rule)
+	return string(data)
+}
+
+// diffStrings returns values present only in next (added) and only in prev (removed).
+func diffStrings(prev, next []string) (added, removed []string) {
+	prevSet := make(map[string]bool, len(prev))
+	for _, v := range prev {
+		prevSet[v] = true
+	}
+	nextSet := make(map[string]bool, len(next))
+	for _, v := range next {
+		nextSet[v] = true
+	}
+
+	for _, v := range next {
+		if !prevSet[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range prev {
+		if !nextSet[v] {
+			removed = append(removed, v)
+		}
+	}
+
+	return added, removed
+}
+
+// autoApproverLists flattens auto approvers into a map keyed by route, plus exitNode.
+func autoApproverLists(aa *domain.TailscaleAutoApprovers) map[string][]string {
+	if aa == nil {
+		return nil
+	}
+
+	result := make(map[string][]string, len(aa.Routes)+1)
+	for route, approvers := range aa.Routes {
+		result[route] = approvers
+	}
+	if len(aa.ExitNode) > 0 {
+		result[exitNodeKey] = aa.ExitNode
+	}
+
+	return result
+}
+
+// sortedKeys returns the union of keys from both maps in sorted order.
+func sortedKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
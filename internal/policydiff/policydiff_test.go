@@ -0,0 +1,136 @@
+package policydiff_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/policydiff"
+)
+
+func TestDiff_Identical(t *testing.T) {
+	policy := &domain.TailscalePolicy{
+		Groups: map[string][]string{"group:dev": {"a@example.com"}},
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"*:22"}},
+			{Action: "accept", Src: []string{"*"}, Dst: []string{"*:443"}},
+		},
+	}
+
+	// Reordering rules is not a change
+	reordered := &domain.TailscalePolicy{
+		Groups: map[string][]string{"group:dev": {"a@example.com"}},
+		ACLs:   []domain.TailscaleACL{policy.ACLs[1], policy.ACLs[0]},
+	}
+
+	diff := policydiff.Diff(policy, reordered)
+	if !diff.Identical {
+		t.Errorf("Expected identical policies, got %+v", diff)
+	}
+
+	if !policydiff.Diff(nil, &domain.TailscalePolicy{}).Identical {
+		t.Error("Expected nil and empty policies to be identical")
+	}
+}
+
+func TestDiff_Groups(t *testing.T) {
+	old := &domain.TailscalePolicy{
+		Groups: map[string][]string{
+			"group:dev":    {"a@example.com", "b@example.com"},
+			"group:ops":    {"ops@example.com"},
+			"group:stable": {"s@example.com"},
+		},
+	}
+	next := &domain.TailscalePolicy{
+		Groups: map[string][]string{
+			"group:dev":    {"b@example.com", "c@example.com"},
+			"group:new":    {"n@example.com"},
+			"group:stable": {"s@example.com"},
+		},
+	}
+
+	diff := policydiff.Diff(old, next)
+	if diff.Identical {
+		t.Fatal("Expected differences")
+	}
+
+	expected := []domain.NamedListDiff{
+		{Name: "group:dev", Change: domain.DiffChanged, Added: []string{"c@example.com"}, Removed: []string{"a@example.com"}},
+		{Name: "group:new", Change: domain.DiffAdded, Added: []string{"n@example.com"}},
+		{Name: "group:ops", Change: domain.DiffRemoved, Removed: []string{"ops@example.com"}},
+	}
+	if !reflect.DeepEqual(diff.Groups, expected) {
+		t.Errorf("Groups diff = %+v, want %+v", diff.Groups, expected)
+	}
+}
+
+func TestDiff_Hosts(t *testing.T) {
+	old := &domain.TailscalePolicy{
+		Hosts: map[string]string{"db": "10.0.0.1", "web": "10.0.0.2", "gone": "10.0.0.3"},
+	}
+	next := &domain.TailscalePolicy{
+		Hosts: map[string]string{"db": "10.0.0.9", "web": "10.0.0.2", "cache": "10.0.0.4"},
+	}
+
+	diff := policydiff.Diff(old, next)
+	expected := []domain.HostDiff{
+		{Name: "cache", Change: domain.DiffAdded, After: "10.0.0.4"},
+		{Name: "db", Change: domain.DiffChanged, Before: "10.0.0.1", After: "10.0.0.9"},
+		{Name: "gone", Change: domain.DiffRemoved, Before: "10.0.0.3"},
+	}
+	if !reflect.DeepEqual(diff.Hosts, expected) {
+		t.Errorf("Hosts diff = %+v, want %+v", diff.Hosts, expected)
+	}
+}
+
+func TestDiff_Rules(t *testing.T) {
+	ssh := domain.TailscaleACL{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"*:22"}}
+	https := domain.TailscaleACL{Action: "accept", Src: []string{"*"}, Dst: []string{"*:443"}}
+	db := domain.TailscaleACL{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"db:5432"}}
+
+	old := &domain.TailscalePolicy{ACLs: []domain.TailscaleACL{ssh, https, https}}
+	next := &domain.TailscalePolicy{ACLs: []domain.TailscaleACL{db, https, ssh}}
+
+	diff := policydiff.Diff(old, next)
+	if len(diff.ACLs) != 2 {
+		t.Fatalf("Expected 2 ACL changes, got %d: %+v", len(diff.ACLs), diff.ACLs)
+	}
+
+	// One duplicate of the https rule was removed
+	if diff.ACLs[0].Change != domain.DiffRemoved || diff.ACLs[0].Index != 2 {
+		t.Errorf("Expected removal at index 2, got %+v", diff.ACLs[0])
+	}
+	if !reflect.DeepEqual(diff.ACLs[0].Rule, https) {
+		t.Errorf("Expected removed rule %+v, got %+v", https, diff.ACLs[0].Rule)
+	}
+
+	if diff.ACLs[1].Change != domain.DiffAdded || diff.ACLs[1].Index != 0 {
+		t.Errorf("Expected addition at index 0, got %+v", diff.ACLs[1])
+	}
+	if !reflect.DeepEqual(diff.ACLs[1].Rule, db) {
+		t.Errorf("Expected added rule %+v, got %+v", db, diff.ACLs[1].Rule)
+	}
+}
+
+func TestDiff_AutoApprovers(t *testing.T) {
+	old := &domain.TailscalePolicy{
+		AutoApprovers: &domain.TailscaleAutoApprovers{
+			Routes: map[string][]string{"10.0.0.0/8": {"tag:router"}},
+		},
+	}
+	next := &domain.TailscalePolicy{
+		AutoApprovers: &domain.TailscaleAutoApprovers{
+			Routes:   map[string][]string{"10.0.0.0/8": {"tag:router", "tag:gw"}},
+			ExitNode: []string{"tag:exit"},
+		},
+	}
+
+	diff := policydiff.Diff(old, next)
+	expected := []domain.NamedListDiff{
+		{Name: "10.0.0.0/8", Change: domain.DiffChanged, Added: []string{"tag:gw"}},
+		{Name: "exitNode", Change: domain.DiffAdded, Added: []string{"tag:exit"}},
+	}
+	if !reflect.DeepEqual(diff.AutoApprovers, expected) {
+		t.Errorf("AutoApprovers diff = %+v, want %+v", diff.AutoApprovers, expected)
+	}
+}
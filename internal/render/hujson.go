@@ -0,0 +1,178 @@
+// Package render renders merged policies and stack state as HuJSON and YAML
+// documents.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/tailscale/hujson"
+)
+
+// HuJSON renders policy as a formatted HuJSON document. The document starts
+// with a header naming the manager version and any merge strategies changed
+// from their defaults. If provenance is given, each run
+// of ACLs, grants, and SSH rules from one stack is preceded by a banner naming
+// the stack, and resource descriptions are rendered as comments above the
+// entries they produced.
+func HuJSON(policy *domain.TailscalePolicy, provenance *domain.PolicyProvenance, version string) ([]byte, error) {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := hujson.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []string{
+		fmt.Sprintf("This policy file is managed by tailscale-acl-manager %s.", version),
+		"Changes made here are overwritten on the next sync.",
+	}
+	if provenance != nil {
+		header = append(header, strategyLines(provenance.Strategies)...)
+	}
+	root.BeforeExtra = comment(header...)
+
+	if obj, ok := root.Value.(*hujson.Object); ok && provenance != nil {
+		for i := range obj.Members {
+			section := obj.Members[i].Name.Value.(hujson.Literal).String()
+			value := &obj.Members[i].Value
+			switch section {
+			case "groups":
+				annotateMembers(value, func(name string) []string { return memberDescriptions(provenance.Groups[name]) })
+			case "tagOwners":
+				annotateMembers(value, func(name string) []string { return memberDescriptions(provenance.TagOwners[name]) })
+			case "hosts":
+				annotateMembers(value, func(name string) []string { return descriptions(provenance.Hosts[name]) })
+			case "acls":
+				annotateRules(value, provenance.ACLs, provenance.Stacks)
+			case "grants":
+				annotateRules(value, provenance.Grants, provenance.Stacks)
+			case "ssh":
+				annotateRules(value, provenance.SSH, provenance.Stacks)
+			}
+		}
+	}
+
+	root.Format()
+	return root.Pack(), nil
+}
+
+// annotateMembers adds description comments above the members of a named section.
+func annotateMembers(v *hujson.Value, describe func(name string) []string) {
+	obj, ok := v.Value.(*hujson.Object)
+	if !ok {
+		return
+	}
+	for i := range obj.Members {
+		name := obj.Members[i].Name.Value.(hujson.Literal).String()
+		if lines := describe(name); len(lines) > 0 {
+			obj.Members[i].Name.BeforeExtra = comment(lines...)
+		}
+	}
+}
+
+// annotateRules adds a stack banner before each run of rules from one stack,
+// followed by the description of each rule. sources is parallel to the rules.
+func annotateRules(v *hujson.Value, sources []domain.RuleSource, stacks map[string]string) {
+	arr, ok := v.Value.(*hujson.Array)
+	if !ok || len(arr.Elements) != len(sources) {
+		return
+	}
+	prevStack := ""
+	for i, source := range sources {
+		var lines []string
+		if source.StackID != prevStack {
+			name := stacks[source.StackID]
+			if name == "" {
+				name = source.StackID
+			}
+			lines = append(lines, "Stack: "+name)
+			prevStack = source.StackID
+		}
+		lines = append(lines, descriptions(source)...)
+		if len(lines) > 0 {
+			arr.Elements[i].BeforeExtra = comment(lines...)
+		}
+		if i > 0 && source.StackID != sources[i-1].StackID {
+			// Separate stacks with a blank line
+			arr.Elements[i].BeforeExtra = append(hujson.Extra("\n"), arr.Elements[i].BeforeExtra...)
+		}
+	}
+}
+
+// strategyLines names the sections of strategies merged differently than by
+// default.
+func strategyLines(strategies domain.MergeStrategies) []string {
+	defaults := domain.DefaultMergeStrategies()
+	var changed []string
+	for _, section := range slices.Sorted(maps.Keys(strategies)) {
+		if strategies[section] != defaults[section] {
+			changed = append(changed, section+"="+strategies[section])
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return []string{"Merge strategies: " + strings.Join(changed, ", ") + "."}
+}
+
+// memberDescriptions returns the distinct descriptions of the resources that
+// contributed members to a unioned entry.
+func memberDescriptions(members map[string][]domain.RuleSource) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, sources := range members {
+		for _, source := range sources {
+			if source.Description != "" && !seen[source.Description] {
+				seen[source.Description] = true
+				result = append(result, source.Description)
+			}
+		}
+	}
+	sort.Strings(result)
+
+	var lines []string
+	for _, d := range result {
+		lines = append(lines, splitLines(d)...)
+	}
+	return lines
+}
+
+// descriptions returns the comment lines for a single resource's description.
+func descriptions(source domain.RuleSource) []string {
+	if source.Description == "" {
+		return nil
+	}
+	return splitLines(source.Description)
+}
+
+// splitLines splits a description into trimmed, non-empty lines.
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// comment formats lines as line comments, each on its own line.
+func comment(lines ...string) hujson.Extra {
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, line := range lines {
+		b.WriteString("// ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return hujson.Extra(b.String())
+}
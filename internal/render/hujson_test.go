@@ -0,0 +1,81 @@
+package render_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/render"
+	"github.com/tailscale/hujson"
+)
+
+func TestHuJSON(t *testing.T) {
+	policy := &domain.TailscalePolicy{
+		Groups: map[string][]string{"group:dev": {"alice@example.com"}},
+		Hosts:  map[string]string{"db": "10.0.0.5"},
+		ACLs: []domain.TailscaleACL{
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"db:5432"}},
+			{Action: "accept", Src: []string{"group:dev"}, Dst: []string{"db:22"}},
+			{Action: "accept", Src: []string{"*"}, Dst: []string{"tag:web:443"}},
+		},
+	}
+	provenance := &domain.PolicyProvenance{
+		Stacks: map[string]string{"s1": "infra", "s2": "apps"},
+		Groups: map[string]map[string][]domain.RuleSource{
+			"group:dev": {"alice@example.com": {{StackID: "s1", ResourceID: "g1", Description: "Developers"}}},
+		},
+		Hosts: map[string]domain.RuleSource{"db": {StackID: "s1", ResourceID: "h1", Description: "Primary database\nin eu-west"}},
+		ACLs: []domain.RuleSource{
+			{StackID: "s1", ResourceID: "a1", Description: "Developers reach the database"},
+			{StackID: "s1", ResourceID: "a2"},
+			{StackID: "s2", ResourceID: "a3"},
+		},
+	}
+
+	out, err := render.HuJSON(policy, provenance, "v1.2.3")
+	if err != nil {
+		t.Fatalf("HuJSON() error: %v", err)
+	}
+	doc := string(out)
+
+	for _, want := range []string{
+		"// This policy file is managed by tailscale-acl-manager v1.2.3.",
+		"// Developers\n",
+		"// Primary database\n",
+		"// in eu-west\n",
+		"// Stack: infra\n",
+		"// Developers reach the database\n",
+		"// Stack: apps\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected output to contain %q", want)
+		}
+	}
+	if strings.Count(doc, "// Stack: infra") != 1 {
+		t.Errorf("Expected one banner for consecutive rules of a stack")
+	}
+
+	// Stripping comments gives back the policy
+	standard, err := hujson.Standardize(out)
+	if err != nil {
+		t.Fatalf("Standardize() error: %v", err)
+	}
+	var parsed domain.TailscalePolicy
+	if err := json.Unmarshal(standard, &parsed); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if len(parsed.ACLs) != 3 || parsed.Hosts["db"] != "10.0.0.5" {
+		t.Errorf("Expected rendered policy to round-trip, got %+v", parsed)
+	}
+}
+
+func TestHuJSONWithoutProvenance(t *testing.T) {
+	out, err := render.HuJSON(&domain.TailscalePolicy{}, nil, "dev")
+	if err != nil {
+		t.Fatalf("HuJSON() error: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "// This policy file is managed by tailscale-acl-manager dev.") {
+		t.Errorf("Expected header comment, got %s", out)
+	}
+}
@@ -0,0 +1,164 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// plainKey matches mapping keys that need no quoting in YAML.
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// YAML renders v as a YAML document. The document has the same structure
+// and key order as the JSON encoding of v; strings are always quoted, so
+// values like "yes" or "1.0" keep their type when read back.
+func YAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeNode(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch n := node.(type) {
+	case yamlMap:
+		if len(n) == 0 {
+			buf.WriteString("{}\n")
+		} else {
+			writeYAMLMap(&buf, n, 0)
+		}
+	case []any:
+		if len(n) == 0 {
+			buf.WriteString("[]\n")
+		} else {
+			writeYAMLList(&buf, n, 0)
+		}
+	default:
+		buf.WriteString(yamlScalar(n) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlMap is a JSON object with its key order preserved.
+type yamlMap []yamlEntry
+
+type yamlEntry struct {
+	key   string
+	value any
+}
+
+// decodeNode reads one JSON value, keeping object keys in document order.
+func decodeNode(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, yamlEntry{key: key.(string), value: value})
+		}
+		_, err := dec.Token() // Closing brace
+		return m, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token() // Closing bracket
+		return list, err
+	default:
+		return tok, nil
+	}
+}
+
+func writeYAMLMap(buf *bytes.Buffer, m yamlMap, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, e := range m {
+		key := e.key
+		if !plainKey.MatchString(key) {
+			key = yamlScalar(key)
+		}
+		switch v := e.value.(type) {
+		case yamlMap:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s%s: {}\n", pad, key)
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:\n", pad, key)
+			writeYAMLMap(buf, v, indent+2)
+		case []any:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s%s: []\n", pad, key)
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:\n", pad, key)
+			writeYAMLList(buf, v, indent+2)
+		default:
+			fmt.Fprintf(buf, "%s%s: %s\n", pad, key, yamlScalar(v))
+		}
+	}
+}
+
+func writeYAMLList(buf *bytes.Buffer, list []any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range list {
+		switch v := item.(type) {
+		case yamlMap:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s- {}\n", pad)
+				continue
+			}
+			// Render the mapping one level deeper, then put the dash on its first line
+			var nested bytes.Buffer
+			writeYAMLMap(&nested, v, indent+2)
+			buf.WriteString(pad + "- ")
+			buf.Write(nested.Bytes()[indent+2:])
+		case []any:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s- []\n", pad)
+				continue
+			}
+			fmt.Fprintf(buf, "%s-\n", pad)
+			writeYAMLList(buf, v, indent+2)
+		default:
+			fmt.Fprintf(buf, "%s- %s\n", pad, yamlScalar(v))
+		}
+	}
+}
+
+// yamlScalar renders a JSON scalar. JSON strings are valid double-quoted
+// YAML scalars.
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
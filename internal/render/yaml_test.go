@@ -0,0 +1,52 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/render"
+)
+
+func TestYAML(t *testing.T) {
+	state := &domain.StackState{
+		Groups: []domain.CreateGroupRequest{{Name: "group:dev", Members: []string{"alice@example.com"}}},
+		ACLs: []domain.CreateACLRuleRequest{
+			{Order: 1, Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"db:5432"}, Description: "yes"},
+		},
+		NodeAttrs: []domain.CreateNodeAttrRequest{
+			{Target: []string{"*"}, App: map[string]any{"tailscale.com/cap/x": []any{map[string]any{}}}},
+		},
+	}
+
+	got, err := render.YAML(state)
+	if err != nil {
+		t.Fatalf("YAML() error = %v", err)
+	}
+
+	want := `groups:
+  - name: "group:dev"
+    members:
+      - "alice@example.com"
+acls:
+  - order: 1
+    action: "accept"
+    src:
+      - "group:dev"
+    dst:
+      - "db:5432"
+    description: "yes"
+nodeAttrs:
+  - target:
+      - "*"
+    app:
+      "tailscale.com/cap/x":
+        - {}
+`
+	if string(got) != want {
+		t.Errorf("YAML() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if got, _ := render.YAML(&domain.StackState{}); string(got) != "{}\n" {
+		t.Errorf("YAML(empty) = %q, want %q", got, "{}\n")
+	}
+}
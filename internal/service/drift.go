@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/policydiff"
+	"github.com/google/uuid"
+)
+
+// SetDriftPolicy sets how syncs react to drift. Defaults to warn.
+func (s *SyncService) SetDriftPolicy(policy string) {
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+	s.driftPolicy = policy
+}
+
+// DriftPolicy returns the configured drift policy.
+func (s *SyncService) DriftPolicy() string {
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+	if s.driftPolicy == "" {
+		return domain.DriftPolicyWarn
+	}
+	return s.driftPolicy
+}
+
+// StartDriftChecker runs CheckDrift every interval until ctx is cancelled.
+// A non-positive interval disables background checks.
+func (s *SyncService) StartDriftChecker(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				status, err := s.CheckDrift(ctx)
+				if err != nil {
+					log.Printf("Drift check failed: %v", err)
+				} else if status.Drifted {
+					log.Printf("Warning: tailnet policy has drifted from version #%d", status.Event.VersionNumber)
+				}
+			}
+		}
+	}()
+}
+
+// CheckDrift compares the live tailnet policy with the last successfully
+// pushed version, recording or resolving drift events as needed.
+func (s *SyncService) CheckDrift(ctx context.Context) (*domain.DriftStatus, error) {
+	live, liveETag, err := s.client.GetPolicy(ctx)
+	if err != nil {
+		s.recordDriftCheck(err)
+		return nil, fmt.Errorf("getting live policy: %w", err)
+	}
+
+	if _, err := s.detectDrift(ctx, live, liveETag); err != nil {
+		s.recordDriftCheck(err)
+		return nil, err
+	}
+
+	return s.DriftStatus(ctx)
+}
+
+// DriftStatus returns the outcome of the most recent drift check without
+// contacting Tailscale.
+func (s *SyncService) DriftStatus(ctx context.Context) (*domain.DriftStatus, error) {
+	status := &domain.DriftStatus{Policy: s.DriftPolicy()}
+
+	s.driftMu.Lock()
+	status.CheckedAt = s.driftCheckedAt
+	status.Error = s.driftCheckError
+	s.driftMu.Unlock()
+
+	event, err := s.store.GetOpenDriftEvent(ctx)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+	if event != nil {
+		status.Drifted = true
+		status.Event = event
+	}
+
+	return status, nil
+}
+
+// ListDriftEvents lists recorded drift events, newest first.
+func (s *SyncService) ListDriftEvents(ctx context.Context, limit, offset int) ([]*domain.DriftEvent, error) {
+	return s.store.ListDriftEvents(ctx, limit, offset)
+}
+
+// detectDrift compares the live policy to the last successful version.
+// It returns the open drift event, or nil if the live policy matches.
+func (s *SyncService) detectDrift(ctx context.Context, live *domain.TailscalePolicy, liveETag string) (*domain.DriftEvent, error) {
+	version, err := s.store.GetLastSuccessfulPolicyVersion(ctx)
+	if errors.Is(err, domain.ErrNotFound) {
+		// Nothing has been pushed yet, so there is nothing to drift from
+		s.recordDriftCheck(nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var diff *domain.PolicyDiff
+	if version.TailscaleETag == "" || version.TailscaleETag != liveETag {
+		// The ETag also changes on formatting-only edits, so compare structurally
+		expected, err := parseVersionPolicy(version)
+		if err != nil {
+			return nil, err
+		}
+		diff = policydiff.Diff(expected, live)
+	}
+
+	s.recordDriftCheck(nil)
+
+	if diff == nil || diff.Identical {
+		return nil, s.resolveDrift(ctx, domain.DriftResolutionReverted)
+	}
+
+	diff.From = versionLabel(version)
+	diff.To = "live"
+
+	event, err := s.store.GetOpenDriftEvent(ctx)
+	if err == nil {
+		event.LiveETag = liveETag
+		event.Diff = diff
+		return event, s.store.UpdateDriftEvent(ctx, event)
+	}
+	if !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	event = &domain.DriftEvent{
+		ID:            uuid.New().String(),
+		VersionID:     version.ID,
+		VersionNumber: version.VersionNumber,
+		ExpectedETag:  version.TailscaleETag,
+		LiveETag:      liveETag,
+		Diff:          diff,
+		DetectedAt:    time.Now(),
+	}
+	if err := s.store.CreateDriftEvent(ctx, event); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Drift detected: tailnet policy differs from version #%d", version.VersionNumber)
+	return event, nil
+}
+
+// resolveDrift closes the open drift event, if any.
+func (s *SyncService) resolveDrift(ctx context.Context, resolution string) error {
+	event, err := s.store.GetOpenDriftEvent(ctx)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	event.ResolvedAt = &now
+	event.Resolution = resolution
+	return s.store.UpdateDriftEvent(ctx, event)
+}
+
+// recordDriftCheck remembers when drift was last checked and whether the check failed.
+func (s *SyncService) recordDriftCheck(err error) {
+	now := time.Now()
+
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+	s.driftCheckedAt = &now
+	s.driftCheckError = ""
+	if err != nil {
+		s.driftCheckError = err.Error()
+	}
+}
+
+// driftMessage describes an open drift event for sync errors and warnings.
+func driftMessage(event *domain.DriftEvent) string {
+	return fmt.Sprintf("tailnet policy was modified outside the manager since version #%d", event.VersionNumber)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+)
+
+// expiryReaperInterval bounds how long the reaper sleeps, so expiries
+// written by other instances or directly to the database are still reaped.
+const expiryReaperInterval = time.Minute
+
+// StartExpiryReaper deletes expired group members, ACLs, grants, and SSH
+// rules until ctx is cancelled. It wakes at the next expiry, or earlier when
+// TriggerSync reports a change, and triggers a sync after removing anything.
+func (s *SyncService) StartExpiryReaper(ctx context.Context) {
+	go func() {
+		for {
+			wait := expiryReaperInterval
+			next, err := s.ReapExpired(ctx, time.Now())
+			if err != nil {
+				log.Printf("Expiry reaper failed: %v", err)
+			} else if next != nil && time.Until(*next) < wait {
+				wait = time.Until(*next)
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			case <-s.expiryWake:
+				timer.Stop()
+			}
+		}
+	}()
+}
+
+// wakeExpiryReaper makes the reaper recompute the next expiry.
+func (s *SyncService) wakeExpiryReaper() {
+	select {
+	case s.expiryWake <- struct{}{}:
+	default:
+	}
+}
+
+// ReapExpired deletes everything that has expired at now, including in
+// disabled stacks, recording each removal in the audit log, and triggers a
+// sync if anything was removed. Each entry is re-read in the transaction
+// that removes it, so concurrent edits are kept, and an entry that cannot be
+// removed is logged and retried on the next pass. It returns the earliest
+// expiry still pending, or nil if there is none.
+func (s *SyncService) ReapExpired(ctx context.Context, now time.Time) (*time.Time, error) {
+	var next *time.Time
+	pending := func(t time.Time) {
+		if next == nil || t.Before(*next) {
+			next = &t
+		}
+	}
+	removed := 0
+	reaped := func(resourceType, resourceID string, ok bool, err error) {
+		if err != nil {
+			log.Printf("Expiry reaper failed to remove %s %s: %v", resourceType, resourceID, err)
+		} else if ok {
+			removed++
+		}
+	}
+
+	groups, err := stackstate.ListAll(ctx, s.store, s.store.ListAllGroups, s.store.ListGroups)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		expired := false
+		for m, t := range g.MemberExpiresAt {
+			if g.MemberExpired(m, now) {
+				expired = true
+			} else {
+				pending(t)
+			}
+		}
+		if !expired {
+			continue
+		}
+
+		ok, err := s.reap(ctx, domain.AuditResourceGroup, g.ID, g.StackID, func(tx storage.Transaction) (any, any, error) {
+			g, err := tx.GetGroupByID(ctx, g.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			before := audit.Snapshot(g)
+			if !removeExpiredMembers(g, now) {
+				return nil, nil, nil
+			}
+			return before, g, tx.UpdateGroup(ctx, g)
+		})
+		reaped(domain.AuditResourceGroup, g.ID, ok, err)
+	}
+
+	acls, err := stackstate.ListAll(ctx, s.store, s.store.ListAllACLRules, s.store.ListACLRules)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range acls {
+		if r.ExpiresAt == nil {
+			continue
+		}
+		if !domain.Expired(r.ExpiresAt, now) {
+			pending(*r.ExpiresAt)
+			continue
+		}
+		ok, err := s.reap(ctx, domain.AuditResourceACL, r.ID, r.StackID, func(tx storage.Transaction) (any, any, error) {
+			r, err := tx.GetACLRule(ctx, r.ID)
+			if err != nil || !domain.Expired(r.ExpiresAt, now) {
+				return nil, nil, err
+			}
+			return r, nil, tx.DeleteACLRule(ctx, r.ID)
+		})
+		reaped(domain.AuditResourceACL, r.ID, ok, err)
+	}
+
+	grants, err := stackstate.ListAll(ctx, s.store, s.store.ListAllGrants, s.store.ListGrants)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		if g.ExpiresAt == nil {
+			continue
+		}
+		if !domain.Expired(g.ExpiresAt, now) {
+			pending(*g.ExpiresAt)
+			continue
+		}
+		ok, err := s.reap(ctx, domain.AuditResourceGrant, g.ID, g.StackID, func(tx storage.Transaction) (any, any, error) {
+			g, err := tx.GetGrant(ctx, g.ID)
+			if err != nil || !domain.Expired(g.ExpiresAt, now) {
+				return nil, nil, err
+			}
+			return g, nil, tx.DeleteGrant(ctx, g.ID)
+		})
+		reaped(domain.AuditResourceGrant, g.ID, ok, err)
+	}
+
+	sshRules, err := stackstate.ListAll(ctx, s.store, s.store.ListAllSSHRules, s.store.ListSSHRules)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range sshRules {
+		if r.ExpiresAt == nil {
+			continue
+		}
+		if !domain.Expired(r.ExpiresAt, now) {
+			pending(*r.ExpiresAt)
+			continue
+		}
+		ok, err := s.reap(ctx, domain.AuditResourceSSH, r.ID, r.StackID, func(tx storage.Transaction) (any, any, error) {
+			r, err := tx.GetSSHRule(ctx, r.ID)
+			if err != nil || !domain.Expired(r.ExpiresAt, now) {
+				return nil, nil, err
+			}
+			return r, nil, tx.DeleteSSHRule(ctx, r.ID)
+		})
+		reaped(domain.AuditResourceSSH, r.ID, ok, err)
+	}
+
+	if removed > 0 {
+		log.Printf("Expiry reaper removed %d expired entries", removed)
+		s.TriggerSync()
+	}
+	return next, nil
+}
+
+// removeExpiredMembers drops the members of g that have expired at now,
+// along with their expiries, and reports whether any were dropped.
+func removeExpiredMembers(g *domain.Group, now time.Time) bool {
+	var members []string
+	var expiresAt map[string]time.Time
+	for _, m := range g.Members {
+		if g.MemberExpired(m, now) {
+			continue
+		}
+		members = append(members, m)
+		if t, ok := g.MemberExpiresAt[m]; ok {
+			if expiresAt == nil {
+				expiresAt = make(map[string]time.Time)
+			}
+			expiresAt[m] = t
+		}
+	}
+	if len(members) == len(g.Members) {
+		return false
+	}
+	g.Members, g.MemberExpiresAt = members, expiresAt
+	return true
+}
+
+// reap applies one removal in a new transaction, bumping the stack
+// generation and recording it in the audit log. expire re-reads the entry
+// and returns it before and after the removal, or a nil before if nothing
+// has expired any more; reap then reports false and changes nothing.
+func (s *SyncService) reap(ctx context.Context, resourceType, resourceID, stackID string, expire func(tx storage.Transaction) (before, after any, err error)) (bool, error) {
+	tx, err := s.store.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	before, after, err := expire(tx)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && before == nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.IncrementStackGeneration(ctx, stackID, nil); err != nil {
+		return false, err
+	}
+	change := audit.Change{
+		Action:       domain.AuditActionExpire,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		StackID:      stackID,
+		Before:       before,
+		After:        after,
+	}
+	if err := audit.Record(ctx, tx, change); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/evaluator"
+)
+
+// QueryAccess evaluates a connection against the current merged policy and
+// reports the matching rule along with the stack that contributed it.
+func (s *SyncService) QueryAccess(ctx context.Context, req evaluator.Request) (*domain.PolicyQueryResult, error) {
+	policy, provenance, err := s.merger().MergeWithProvenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e := evaluator.New(policy)
+	decision := e.Check(req)
+
+	result := &domain.PolicyQueryResult{
+		Src:         req.Src,
+		Dst:         req.Dst,
+		Port:        req.Port,
+		Proto:       req.Proto,
+		Allowed:     decision.Allowed,
+		Match:       decision.Match,
+		Unknown:     decision.Unknown,
+		SrcMemberOf: e.Memberships(req.Src),
+		DstMemberOf: e.Memberships(req.Dst),
+	}
+	if result.Proto == "" {
+		result.Proto = evaluator.ProtoTCP
+	}
+
+	for _, endpoint := range []string{req.Src, req.Dst} {
+		if !strings.HasPrefix(endpoint, "tag:") {
+			continue
+		}
+		if result.TagOwners == nil {
+			result.TagOwners = make(map[string][]string)
+		}
+		result.TagOwners[endpoint] = e.TagOwners(endpoint)
+	}
+
+	if decision.Match == nil {
+		return result, nil
+	}
+
+	var source domain.RuleSource
+	switch decision.Match.Type {
+	case domain.RuleTypeACL:
+		result.Rule = policy.ACLs[decision.Match.Index]
+		source = provenance.ACLs[decision.Match.Index]
+	case domain.RuleTypeGrant:
+		result.Rule = policy.Grants[decision.Match.Index]
+		source = provenance.Grants[decision.Match.Index]
+	}
+	result.Source = &source
+
+	stack, err := s.store.GetStack(ctx, source.StackID)
+	if err != nil {
+		return nil, err
+	}
+	result.StackName = stack.Name
+
+	return result, nil
+}
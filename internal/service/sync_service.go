@@ -3,12 +3,20 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/evaluator"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/lint"
 	"github.com/bcnelson/tailscale-acl-manager/internal/merger"
+	"github.com/bcnelson/tailscale-acl-manager/internal/policydiff"
+	"github.com/bcnelson/tailscale-acl-manager/internal/render"
 	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 	"github.com/bcnelson/tailscale-acl-manager/internal/tailscale"
 	"github.com/google/uuid"
@@ -17,7 +25,6 @@ import (
 // SyncService handles syncing the merged policy to Tailscale.
 type SyncService struct {
 	store    storage.Storage
-	merger   *merger.Merger
 	client   tailscale.PolicyClient
 	debounce time.Duration
 	autoSync bool
@@ -28,22 +35,35 @@ type SyncService struct {
 
 	// Channels for waiters who want to block until sync completes
 	waiters []chan *domain.SyncResponse
+
+	driftMu         sync.Mutex
+	driftPolicy     string
+	driftCheckedAt  *time.Time
+	driftCheckError string
+
+	conflictsAsErrors bool
+	strategies        domain.MergeStrategies // How named sections defined by several stacks are merged
+	version           string                 // Manager version named in the rendered policy header
+
+	expiryWake chan struct{} // Nudges the expiry reaper when resources change
 }
 
 // NewSyncService creates a new SyncService.
 func NewSyncService(store storage.Storage, client tailscale.PolicyClient, debounce time.Duration, autoSync bool) *SyncService {
 	return &SyncService{
 		store:    store,
-		merger:   merger.New(store),
 		client:   client,
 		debounce: debounce,
 		autoSync: autoSync,
+
+		expiryWake: make(chan struct{}, 1),
 	}
 }
 
 // TriggerSync triggers a debounced sync operation.
 // Multiple triggers within the debounce period will result in a single sync.
 func (s *SyncService) TriggerSync() {
+	s.wakeExpiryReaper()
 	if !s.autoSync {
 		return
 	}
@@ -59,7 +79,7 @@ func (s *SyncService) TriggerSync() {
 	s.syncPending = true
 	s.syncTimer = time.AfterFunc(s.debounce, func() {
 		ctx := context.Background()
-		resp, err := s.doSync(ctx)
+		resp, err := s.doSync(ctx, false)
 		if err != nil {
 			log.Printf("Auto-sync failed: %v", err)
 			resp = &domain.SyncResponse{
@@ -86,9 +106,10 @@ func (s *SyncService) TriggerSync() {
 // Returns the sync response once the debounced sync finishes.
 // If autoSync is disabled, this performs an immediate sync.
 func (s *SyncService) TriggerSyncAndWait(ctx context.Context) (*domain.SyncResponse, error) {
+	s.wakeExpiryReaper()
 	if !s.autoSync {
 		// If autoSync is disabled, just do a direct sync
-		return s.doSync(ctx)
+		return s.doSync(ctx, false)
 	}
 
 	s.mu.Lock()
@@ -105,7 +126,7 @@ func (s *SyncService) TriggerSyncAndWait(ctx context.Context) (*domain.SyncRespo
 	s.syncPending = true
 	s.syncTimer = time.AfterFunc(s.debounce, func() {
 		syncCtx := context.Background()
-		resp, err := s.doSync(syncCtx)
+		resp, err := s.doSync(syncCtx, false)
 		if err != nil {
 			log.Printf("Auto-sync failed: %v", err)
 			resp = &domain.SyncResponse{
@@ -139,11 +160,223 @@ func (s *SyncService) TriggerSyncAndWait(ctx context.Context) (*domain.SyncRespo
 
 // GetMergedPolicy returns the current merged policy without syncing.
 func (s *SyncService) GetMergedPolicy(ctx context.Context) (*domain.TailscalePolicy, error) {
-	return s.merger.Merge(ctx)
+	return s.merger().Merge(ctx)
+}
+
+// SetConflictsAsErrors makes syncs fail when the merge reports conflicts.
+// By default conflicts are only reported as warnings.
+func (s *SyncService) SetConflictsAsErrors(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conflictsAsErrors = enabled
+}
+
+// SetMergeStrategies sets how named sections defined by several stacks are
+// merged. Sections left out keep their default strategy.
+func (s *SyncService) SetMergeStrategies(strategies domain.MergeStrategies) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strategies = strategies
+}
+
+// MergeStrategies returns the configured merge strategies, for the merges
+// made outside the service, such as guardrail checks and change set diffs.
+func (s *SyncService) MergeStrategies() domain.MergeStrategies {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.strategies
+}
+
+// merger returns a Merger of the store with the configured strategies.
+func (s *SyncService) merger() *merger.Merger {
+	return merger.New(s.store, s.MergeStrategies())
+}
+
+// SetVersion sets the manager version named in the header of pushed policy files.
+func (s *SyncService) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// RenderHuJSON renders the current merged policy as the HuJSON document a
+// sync would push, with stack banners and resource descriptions as comments.
+func (s *SyncService) RenderHuJSON(ctx context.Context) ([]byte, error) {
+	policy, provenance, err := s.merger().MergeWithProvenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return render.HuJSON(policy, provenance, s.managerVersion())
+}
+
+// managerVersion returns the configured manager version.
+func (s *SyncService) managerVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version == "" {
+		return "dev"
+	}
+	return s.version
+}
+
+// GetConflicts returns the definitions dropped by the priority-override and
+// error-on-conflict strategies in the current merge.
+func (s *SyncService) GetConflicts(ctx context.Context) ([]domain.MergeConflict, error) {
+	_, provenance, err := s.merger().MergeWithProvenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return provenance.Conflicts, nil
+}
+
+// Lint returns the issues in the current merged policy.
+func (s *SyncService) Lint(ctx context.Context) ([]domain.LintIssue, error) {
+	policy, provenance, err := s.merger().MergeWithProvenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lint.Lint(policy, provenance), nil
+}
+
+// GetExplainedPolicy returns the current merged policy together with the
+// stack resources that produced each entry.
+func (s *SyncService) GetExplainedPolicy(ctx context.Context) (*domain.ExplainedPolicy, error) {
+	policy, provenance, err := s.merger().MergeWithProvenance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.ExplainedPolicy{Policy: policy, Provenance: provenance}, nil
+}
+
+// GetLivePolicy returns the policy currently applied to the tailnet.
+func (s *SyncService) GetLivePolicy(ctx context.Context) (*domain.TailscalePolicy, error) {
+	policy, _, err := s.client.GetPolicy(ctx)
+	return policy, err
+}
+
+// RunPolicyTests evaluates the policy's ACL tests locally.
+func (s *SyncService) RunPolicyTests(policy *domain.TailscalePolicy) *domain.PolicyTestReport {
+	results := evaluator.RunTests(policy)
+	failed := evaluator.FailedTests(results)
+	skipped, unknown := evaluator.SkippedTests(results)
+	return &domain.PolicyTestReport{
+		Passed:  failed == 0,
+		Failed:  failed,
+		Skipped: skipped,
+		Unknown: unknown,
+		Results: results,
+	}
+}
+
+// DiffVersions returns the structural diff between two stored policy versions.
+// If toID is empty the current merged policy is used as the new side.
+func (s *SyncService) DiffVersions(ctx context.Context, fromID, toID string) (*domain.PolicyDiff, error) {
+	from, err := s.store.GetPolicyVersion(ctx, fromID)
+	if err != nil {
+		return nil, err
+	}
+	fromPolicy, err := parseVersionPolicy(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toLabel := "merged"
+	var toPolicy *domain.TailscalePolicy
+	if toID == "" {
+		toPolicy, err = s.merger().Merge(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		to, err := s.store.GetPolicyVersion(ctx, toID)
+		if err != nil {
+			return nil, err
+		}
+		toPolicy, err = parseVersionPolicy(to)
+		if err != nil {
+			return nil, err
+		}
+		toLabel = versionLabel(to)
+	}
+
+	diff := policydiff.Diff(fromPolicy, toPolicy)
+	diff.From = versionLabel(from)
+	diff.To = toLabel
+	return diff, nil
+}
+
+// DiffLive returns the structural diff from the live tailnet policy to the
+// current merged policy, i.e. what the next sync would change.
+func (s *SyncService) DiffLive(ctx context.Context) (*domain.PolicyDiff, error) {
+	live, err := s.GetLivePolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := s.merger().Merge(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := policydiff.Diff(live, merged)
+	diff.From = "live"
+	diff.To = "merged"
+	return diff, nil
+}
+
+// conflictMessage describes a merge conflict for sync warnings.
+func conflictMessage(c domain.MergeConflict) string {
+	shadowed := make([]string, 0, len(c.Shadowed))
+	for _, d := range c.Shadowed {
+		shadowed = append(shadowed, d.StackName)
+	}
+	return fmt.Sprintf("%s %q from stack %s shadows the definition from %s",
+		c.Type, c.Name, c.Winner.StackName, strings.Join(shadowed, ", "))
+}
+
+// tagMemberMessage lists the groups with tag members and the stacks that
+// added them.
+func tagMemberMessage(issues []domain.LintIssue) string {
+	parts := make([]string, len(issues))
+	for i, issue := range issues {
+		parts[i] = fmt.Sprintf("%s contains %s (stack %s)", issue.Key, issue.Reference, issue.StackName)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// blockingConflicts counts the conflicts that fail a sync: those of sections
+// merged with the error-on-conflict strategy, or all of them when conflicts
+// are treated as errors.
+func blockingConflicts(conflicts []domain.MergeConflict, conflictsAsErrors bool) int {
+	if conflictsAsErrors {
+		return len(conflicts)
+	}
+	blocking := 0
+	for _, c := range conflicts {
+		if c.Blocking() {
+			blocking++
+		}
+	}
+	return blocking
+}
+
+// parseVersionPolicy decodes the rendered policy stored in a version.
+func parseVersionPolicy(version *domain.PolicyVersion) (*domain.TailscalePolicy, error) {
+	var policy domain.TailscalePolicy
+	if err := json.Unmarshal([]byte(version.RenderedPolicy), &policy); err != nil {
+		return nil, fmt.Errorf("parsing policy version %d: %w", version.VersionNumber, err)
+	}
+	return &policy, nil
+}
+
+// versionLabel returns the diff label for a policy version.
+func versionLabel(version *domain.PolicyVersion) string {
+	return "version:" + strconv.Itoa(version.VersionNumber)
 }
 
 // ForceSync forces an immediate sync to Tailscale.
-func (s *SyncService) ForceSync(ctx context.Context) (*domain.SyncResponse, error) {
+// If overwriteDrift is set, the sync proceeds even when the drift policy is refuse.
+func (s *SyncService) ForceSync(ctx context.Context, overwriteDrift bool) (*domain.SyncResponse, error) {
 	s.mu.Lock()
 	// Cancel any pending debounced sync
 	if s.syncTimer != nil {
@@ -152,22 +385,31 @@ func (s *SyncService) ForceSync(ctx context.Context) (*domain.SyncResponse, erro
 	s.syncPending = false
 	s.mu.Unlock()
 
-	return s.doSync(ctx)
+	return s.doSync(ctx, overwriteDrift)
 }
 
 // doSync performs the actual sync operation.
-func (s *SyncService) doSync(ctx context.Context) (*domain.SyncResponse, error) {
+func (s *SyncService) doSync(ctx context.Context, overwriteDrift bool) (*domain.SyncResponse, error) {
 	// Merge the policy
-	policy, err := s.merger.Merge(ctx)
+	policy, provenance, err := s.merger().MergeWithProvenance(ctx)
 	if err != nil {
 		return nil, err
 	}
+	conflicts := provenance.Conflicts
 
-	// Render to JSON
+	s.mu.Lock()
+	conflictsAsErrors := s.conflictsAsErrors
+	s.mu.Unlock()
+
+	// Render to JSON for the version history, and to HuJSON for Tailscale
 	policyJSON, err := json.Marshal(policy)
 	if err != nil {
 		return nil, err
 	}
+	document, err := render.HuJSON(policy, provenance, s.managerVersion())
+	if err != nil {
+		return nil, err
+	}
 
 	// Get next version number
 	nextVersion := 1
@@ -191,17 +433,123 @@ func (s *SyncService) doSync(ctx context.Context) (*domain.SyncResponse, error)
 		return nil, err
 	}
 
-	// Get current ETag for optimistic locking
-	_, currentETag, err := s.client.GetPolicy(ctx)
+	if blocking := blockingConflicts(conflicts, conflictsAsErrors); blocking > 0 {
+		now := time.Now()
+		version.PushStatus = "failed"
+		version.PushError = fmt.Sprintf("refusing to sync: %d merge conflicts", blocking)
+		version.PushedAt = &now
+		_ = s.store.UpdatePolicyVersion(ctx, version)
+
+		return &domain.SyncResponse{
+			VersionID:     version.ID,
+			VersionNumber: version.VersionNumber,
+			Status:        "failed",
+			Error:         version.PushError,
+			Conflicts:     conflicts,
+		}, nil
+	}
+
+	// Refuse to push groups with tag members, which Tailscale rejects
+	if issues := lint.TagGroupMembers(policy, provenance); len(issues) > 0 {
+		now := time.Now()
+		version.PushStatus = "failed"
+		version.PushError = fmt.Sprintf("refusing to sync: %d group members are tags, which groups cannot contain: %s", len(issues), tagMemberMessage(issues))
+		version.PushedAt = &now
+		_ = s.store.UpdatePolicyVersion(ctx, version)
+
+		return &domain.SyncResponse{
+			VersionID:     version.ID,
+			VersionNumber: version.VersionNumber,
+			Status:        "failed",
+			Error:         version.PushError,
+			LintIssues:    issues,
+		}, nil
+	}
+
+	// Refuse to push policies that violate guardrails
+	rules, err := s.store.ListGuardrails(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if violations := guardrails.Evaluate(rules, policy, provenance); len(violations) > 0 {
+		now := time.Now()
+		version.PushStatus = "failed"
+		version.PushError = (&domain.GuardrailViolationError{Violations: violations}).Error()
+		version.PushedAt = &now
+		_ = s.store.UpdatePolicyVersion(ctx, version)
+
+		return &domain.SyncResponse{
+			VersionID:           version.ID,
+			VersionNumber:       version.VersionNumber,
+			Status:              "failed",
+			Error:               version.PushError,
+			GuardrailViolations: violations,
+		}, nil
+	}
+
+	// Run the embedded ACL tests locally before pushing
+	report := s.RunPolicyTests(policy)
+	if !report.Passed {
+		now := time.Now()
+		version.PushStatus = "failed"
+		version.PushError = fmt.Sprintf("%d of %d ACL tests failed", report.Failed, len(report.Results))
+		version.PushedAt = &now
+		_ = s.store.UpdatePolicyVersion(ctx, version)
+
+		return &domain.SyncResponse{
+			VersionID:     version.ID,
+			VersionNumber: version.VersionNumber,
+			Status:        "failed",
+			Error:         version.PushError,
+			TestResults:   report.Results,
+		}, nil
+	}
+
+	// Get current policy and ETag for drift detection and optimistic locking
+	var warnings []string
+	for _, c := range conflicts {
+		warnings = append(warnings, conflictMessage(c))
+	}
+	if report.Skipped > 0 {
+		warnings = append(warnings, fmt.Sprintf("skipped %d of %d ACL tests: %s cannot be evaluated locally",
+			report.Skipped, len(report.Results), strings.Join(report.Unknown, ", ")))
+	}
+	livePolicy, currentETag, err := s.client.GetPolicy(ctx)
 	if err != nil {
 		// If we can't get the current policy, proceed without ETag
 		log.Printf("Warning: Could not get current policy ETag: %v", err)
 		currentETag = ""
+	} else {
+		drift, err := s.detectDrift(ctx, livePolicy, currentETag)
+		if err != nil {
+			log.Printf("Warning: Drift check failed: %v", err)
+		} else if drift != nil {
+			switch s.DriftPolicy() {
+			case domain.DriftPolicyRefuse:
+				if !overwriteDrift {
+					now := time.Now()
+					version.PushStatus = "failed"
+					version.PushError = "refusing to sync: " + driftMessage(drift)
+					version.PushedAt = &now
+					_ = s.store.UpdatePolicyVersion(ctx, version)
+
+					return &domain.SyncResponse{
+						VersionID:     version.ID,
+						VersionNumber: version.VersionNumber,
+						Status:        "failed",
+						Error:         version.PushError,
+					}, nil
+				}
+			case domain.DriftPolicyWarn:
+				log.Printf("Warning: Overwriting drift: %s", driftMessage(drift))
+				warnings = append(warnings, "overwrote drift: "+driftMessage(drift))
+			}
+		}
 	}
 
 	// Push to Tailscale
 	now := time.Now()
-	newETag, err := s.client.SetPolicy(ctx, policy, currentETag)
+	newETag, err := s.client.SetPolicyHuJSON(ctx, document, currentETag)
 	if err != nil {
 		// Record failure
 		version.PushStatus = "failed"
@@ -224,11 +572,16 @@ func (s *SyncService) doSync(ctx context.Context) (*domain.SyncResponse, error)
 	if err := s.store.UpdatePolicyVersion(ctx, version); err != nil {
 		log.Printf("Warning: Failed to update version record: %v", err)
 	}
+	if err := s.resolveDrift(ctx, domain.DriftResolutionOverwritten); err != nil {
+		log.Printf("Warning: Failed to resolve drift event: %v", err)
+	}
 
 	return &domain.SyncResponse{
 		VersionID:     version.ID,
 		VersionNumber: version.VersionNumber,
 		Status:        "success",
+		Warnings:      warnings,
+		Conflicts:     conflicts,
 	}, nil
 }
 
@@ -240,11 +593,16 @@ func (s *SyncService) Rollback(ctx context.Context, versionID string) (*domain.S
 		return nil, err
 	}
 
-	// Parse the rendered policy
+	// Parse the rendered policy. Provenance is not kept with versions, so
+	// the rolled back file only carries the header comment.
 	var policy domain.TailscalePolicy
 	if err := json.Unmarshal([]byte(version.RenderedPolicy), &policy); err != nil {
 		return nil, err
 	}
+	document, err := render.HuJSON(&policy, nil, s.managerVersion())
+	if err != nil {
+		return nil, err
+	}
 
 	// Get next version number
 	nextVersion := 1
@@ -276,7 +634,7 @@ func (s *SyncService) Rollback(ctx context.Context, versionID string) (*domain.S
 
 	// Push to Tailscale
 	now := time.Now()
-	newETag, err := s.client.SetPolicy(ctx, &policy, currentETag)
+	newETag, err := s.client.SetPolicyHuJSON(ctx, document, currentETag)
 	if err != nil {
 		newVersion.PushStatus = "failed"
 		newVersion.PushError = err.Error()
@@ -295,6 +653,7 @@ func (s *SyncService) Rollback(ctx context.Context, versionID string) (*domain.S
 	newVersion.TailscaleETag = newETag
 	newVersion.PushedAt = &now
 	_ = s.store.UpdatePolicyVersion(ctx, newVersion)
+	_ = s.resolveDrift(ctx, domain.DriftResolutionOverwritten)
 
 	return &domain.SyncResponse{
 		VersionID:     newVersion.ID,
@@ -0,0 +1,144 @@
+package stackstate
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage/memory"
+)
+
+// Copy copies every stack, including disabled stacks, and the resources of
+// all stacks other than stackIDs into a new in-memory store. Everything is
+// copied by value, so writes to the copy never reach store.
+func Copy(ctx context.Context, store storage.Storage, stackIDs ...string) (*memory.Store, error) {
+	scratch := memory.New()
+	skip := make(map[string]bool, len(stackIDs))
+	for _, id := range stackIDs {
+		skip[id] = true
+	}
+
+	stacks, err := store.ListStacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range stacks {
+		stack := *stack
+		if err := scratch.CreateStack(ctx, &stack); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := ListAll(ctx, store, store.ListAllGroups, store.ListGroups)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, groups, skip, func(g *domain.Group) string { return g.StackID }, scratch.CreateGroup); err != nil {
+		return nil, err
+	}
+
+	tagOwners, err := ListAll(ctx, store, store.ListAllTagOwners, store.ListTagOwners)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, tagOwners, skip, func(t *domain.TagOwner) string { return t.StackID }, scratch.CreateTagOwner); err != nil {
+		return nil, err
+	}
+
+	hosts, err := ListAll(ctx, store, store.ListAllHosts, store.ListHosts)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, hosts, skip, func(h *domain.Host) string { return h.StackID }, scratch.CreateHost); err != nil {
+		return nil, err
+	}
+
+	acls, err := ListAll(ctx, store, store.ListAllACLRules, store.ListACLRules)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, acls, skip, func(a *domain.ACLRule) string { return a.StackID }, scratch.CreateACLRule); err != nil {
+		return nil, err
+	}
+
+	sshRules, err := ListAll(ctx, store, store.ListAllSSHRules, store.ListSSHRules)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, sshRules, skip, func(r *domain.SSHRule) string { return r.StackID }, scratch.CreateSSHRule); err != nil {
+		return nil, err
+	}
+
+	grants, err := ListAll(ctx, store, store.ListAllGrants, store.ListGrants)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, grants, skip, func(g *domain.Grant) string { return g.StackID }, scratch.CreateGrant); err != nil {
+		return nil, err
+	}
+
+	autoApprovers, err := ListAll(ctx, store, store.ListAllAutoApprovers, store.ListAutoApprovers)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, autoApprovers, skip, func(aa *domain.AutoApprover) string { return aa.StackID }, scratch.CreateAutoApprover); err != nil {
+		return nil, err
+	}
+
+	nodeAttrs, err := ListAll(ctx, store, store.ListAllNodeAttrs, store.ListNodeAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, nodeAttrs, skip, func(na *domain.NodeAttr) string { return na.StackID }, scratch.CreateNodeAttr); err != nil {
+		return nil, err
+	}
+
+	postures, err := ListAll(ctx, store, store.ListAllPostures, store.ListPostures)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, postures, skip, func(p *domain.Posture) string { return p.StackID }, scratch.CreatePosture); err != nil {
+		return nil, err
+	}
+
+	ipsets, err := ListAll(ctx, store, store.ListAllIPSets, store.ListIPSets)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, ipsets, skip, func(is *domain.IPSet) string { return is.StackID }, scratch.CreateIPSet); err != nil {
+		return nil, err
+	}
+
+	tests, err := ListAll(ctx, store, store.ListAllACLTests, store.ListACLTests)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyResources(ctx, tests, skip, func(t *domain.ACLTest) string { return t.StackID }, scratch.CreateACLTest); err != nil {
+		return nil, err
+	}
+
+	return scratch, nil
+}
+
+// copyResources creates a deep copy of every resource that does not belong
+// to a skipped stack.
+func copyResources[T any](ctx context.Context, resources []*T, skip map[string]bool, stackOf func(*T) string, create func(context.Context, *T) error) error {
+	for _, r := range resources {
+		if skip[stackOf(r)] {
+			continue
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		var clone T
+		if err := json.Unmarshal(data, &clone); err != nil {
+			return err
+		}
+		if err := create(ctx, &clone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
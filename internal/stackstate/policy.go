@@ -0,0 +1,152 @@
+package stackstate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// FromPolicy converts a policy in Tailscale format into a StackState.
+// Named sections are sorted by name; rules keep their order and get no
+// explicit order, so Apply orders them by position.
+func FromPolicy(policy *domain.TailscalePolicy) *domain.StackState {
+	state := &domain.StackState{}
+
+	for _, name := range sortedKeys(policy.Groups) {
+		state.Groups = append(state.Groups, domain.CreateGroupRequest{Name: name, Members: policy.Groups[name]})
+	}
+	for _, tag := range sortedKeys(policy.TagOwners) {
+		state.TagOwners = append(state.TagOwners, domain.CreateTagOwnerRequest{Tag: tag, Owners: policy.TagOwners[tag]})
+	}
+	for _, name := range sortedKeys(policy.Hosts) {
+		state.Hosts = append(state.Hosts, domain.CreateHostRequest{Name: name, Address: policy.Hosts[name]})
+	}
+
+	for _, acl := range policy.ACLs {
+		state.ACLs = append(state.ACLs, aclRequest(acl))
+	}
+	for _, grant := range policy.Grants {
+		state.Grants = append(state.Grants, grantRequest(grant))
+	}
+	for _, ssh := range policy.SSH {
+		state.SSHRules = append(state.SSHRules, sshRequest(ssh))
+	}
+
+	if aa := policy.AutoApprovers; aa != nil {
+		for _, route := range sortedKeys(aa.Routes) {
+			state.AutoApprovers = append(state.AutoApprovers, domain.CreateAutoApproverRequest{
+				Type:      "routes",
+				Match:     route,
+				Approvers: aa.Routes[route],
+			})
+		}
+		if len(aa.ExitNode) > 0 {
+			state.AutoApprovers = append(state.AutoApprovers, domain.CreateAutoApproverRequest{
+				Type:      "exitNode",
+				Match:     "*",
+				Approvers: aa.ExitNode,
+			})
+		}
+	}
+
+	for _, na := range policy.NodeAttrs {
+		state.NodeAttrs = append(state.NodeAttrs, domain.CreateNodeAttrRequest{Target: na.Target, Attr: na.Attr, App: na.App})
+	}
+	for _, name := range sortedKeys(policy.Postures) {
+		state.Postures = append(state.Postures, domain.CreatePostureRequest{Name: name, Rules: policy.Postures[name]})
+	}
+	for _, name := range sortedKeys(policy.IPSets) {
+		state.IPSets = append(state.IPSets, domain.CreateIPSetRequest{Name: name, Addresses: policy.IPSets[name]})
+	}
+	for _, test := range policy.Tests {
+		state.Tests = append(state.Tests, domain.CreateACLTestRequest{Source: test.Src, Accept: test.Accept, Deny: test.Deny})
+	}
+
+	return state
+}
+
+// Split converts policy like FromPolicy, but moves ACLs, grants, and SSH
+// rules matched by a split rule to the rule's stack. Everything else goes to
+// defaultStackID. The result is keyed by stack ID.
+func Split(policy *domain.TailscalePolicy, defaultStackID string, rules []domain.AdoptSplitRule) map[string]*domain.StackState {
+	rest := *policy
+	rest.ACLs, rest.Grants, rest.SSH = nil, nil, nil
+
+	states := map[string]*domain.StackState{defaultStackID: FromPolicy(&rest)}
+	stateFor := func(src, dst []string) *domain.StackState {
+		stackID := defaultStackID
+		for _, rule := range rules {
+			if splitRuleMatches(rule, src, dst) {
+				stackID = rule.StackID
+				break
+			}
+		}
+		if states[stackID] == nil {
+			states[stackID] = &domain.StackState{}
+		}
+		return states[stackID]
+	}
+
+	for _, acl := range policy.ACLs {
+		state := stateFor(acl.Src, acl.Dst)
+		state.ACLs = append(state.ACLs, aclRequest(acl))
+	}
+	for _, grant := range policy.Grants {
+		state := stateFor(grant.Src, grant.Dst)
+		state.Grants = append(state.Grants, grantRequest(grant))
+	}
+	for _, ssh := range policy.SSH {
+		state := stateFor(ssh.Src, ssh.Dst)
+		state.SSHRules = append(state.SSHRules, sshRequest(ssh))
+	}
+
+	return states
+}
+
+// splitRuleMatches reports whether a rule with the given sources and
+// destinations is moved by rule.
+func splitRuleMatches(rule domain.AdoptSplitRule, src, dst []string) bool {
+	if rule.Destination != "" {
+		for _, d := range dst {
+			if d == rule.Destination || strings.HasPrefix(d, rule.Destination+":") {
+				return true
+			}
+		}
+	}
+	if rule.Source != "" {
+		for _, s := range src {
+			if s == rule.Source {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func aclRequest(acl domain.TailscaleACL) domain.CreateACLRuleRequest {
+	return domain.CreateACLRuleRequest{Action: acl.Action, Protocol: acl.Protocol, Sources: acl.Src, Destinations: acl.Dst}
+}
+
+func grantRequest(grant domain.TailscaleGrant) domain.CreateGrantRequest {
+	return domain.CreateGrantRequest{Sources: grant.Src, Destinations: grant.Dst, IP: grant.IP, SrcPosture: grant.SrcPosture, App: grant.App}
+}
+
+func sshRequest(ssh domain.TailscaleSSH) domain.CreateSSHRuleRequest {
+	return domain.CreateSSHRuleRequest{
+		Action:       ssh.Action,
+		Sources:      ssh.Src,
+		Destinations: ssh.Dst,
+		Users:        ssh.Users,
+		CheckPeriod:  ssh.CheckPeriod,
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,419 @@
+// Package stackstate converts between the resources of a stack and the
+// StackState form used for bulk reads and replacements.
+package stackstate
+
+import (
+	"context"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Load collects all resources of a stack into a StackState.
+func Load(ctx context.Context, s storage.Storage, stackID string) (*domain.StackState, error) {
+	state := &domain.StackState{}
+
+	groups, err := s.ListGroups(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		state.Groups = append(state.Groups, domain.CreateGroupRequest{
+			Name:            g.Name,
+			Members:         g.Members,
+			MemberExpiresAt: g.MemberExpiresAt,
+			Description:     g.Description,
+		})
+	}
+
+	tagOwners, err := s.ListTagOwners(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tagOwners {
+		state.TagOwners = append(state.TagOwners, domain.CreateTagOwnerRequest{Tag: t.Tag, Owners: t.Owners, Description: t.Description})
+	}
+
+	hosts, err := s.ListHosts(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hosts {
+		state.Hosts = append(state.Hosts, domain.CreateHostRequest{Name: h.Name, Address: h.Address, Description: h.Description})
+	}
+
+	acls, err := s.ListACLRules(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range acls {
+		state.ACLs = append(state.ACLs, domain.CreateACLRuleRequest{
+			Order:        a.Order,
+			Action:       a.Action,
+			Protocol:     a.Protocol,
+			Sources:      a.Sources,
+			Destinations: a.Destinations,
+			Description:  a.Description,
+			ExpiresAt:    a.ExpiresAt,
+		})
+	}
+
+	sshRules, err := s.ListSSHRules(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range sshRules {
+		state.SSHRules = append(state.SSHRules, domain.CreateSSHRuleRequest{
+			Order:        r.Order,
+			Action:       r.Action,
+			Sources:      r.Sources,
+			Destinations: r.Destinations,
+			Users:        r.Users,
+			CheckPeriod:  r.CheckPeriod,
+			Description:  r.Description,
+			ExpiresAt:    r.ExpiresAt,
+		})
+	}
+
+	grants, err := s.ListGrants(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		state.Grants = append(state.Grants, domain.CreateGrantRequest{
+			Order:        g.Order,
+			Sources:      g.Sources,
+			Destinations: g.Destinations,
+			IP:           g.IP,
+			SrcPosture:   g.SrcPosture,
+			App:          g.App,
+			Description:  g.Description,
+			ExpiresAt:    g.ExpiresAt,
+		})
+	}
+
+	autoApprovers, err := s.ListAutoApprovers(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, aa := range autoApprovers {
+		state.AutoApprovers = append(state.AutoApprovers, domain.CreateAutoApproverRequest{
+			Type:      aa.Type,
+			Match:     aa.Match,
+			Approvers: aa.Approvers,
+		})
+	}
+
+	nodeAttrs, err := s.ListNodeAttrs(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, na := range nodeAttrs {
+		state.NodeAttrs = append(state.NodeAttrs, domain.CreateNodeAttrRequest{
+			Order:  na.Order,
+			Target: na.Target,
+			Attr:   na.Attr,
+			App:    na.App,
+		})
+	}
+
+	postures, err := s.ListPostures(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range postures {
+		state.Postures = append(state.Postures, domain.CreatePostureRequest{Name: p.Name, Rules: p.Rules})
+	}
+
+	ipsets, err := s.ListIPSets(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, is := range ipsets {
+		state.IPSets = append(state.IPSets, domain.CreateIPSetRequest{Name: is.Name, Addresses: is.Addresses})
+	}
+
+	tests, err := s.ListACLTests(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tests {
+		state.Tests = append(state.Tests, domain.CreateACLTestRequest{
+			Order:  t.Order,
+			Source: t.Source,
+			Accept: t.Accept,
+			Deny:   t.Deny,
+		})
+	}
+
+	return state, nil
+}
+
+// Apply creates every resource of state in stackID, which must be empty.
+// Rules without an explicit order are ordered by their position in the state.
+func Apply(ctx context.Context, store storage.Storage, stackID string, state *domain.StackState) error {
+	now := time.Now()
+
+	for _, g := range state.Groups {
+		group := &domain.Group{
+			ID:              uuid.New().String(),
+			StackID:         stackID,
+			Name:            g.Name,
+			Members:         g.Members,
+			MemberExpiresAt: g.MemberExpiresAt,
+			Description:     g.Description,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		if err := store.CreateGroup(ctx, group); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range state.TagOwners {
+		tagOwner := &domain.TagOwner{
+			ID:          uuid.New().String(),
+			StackID:     stackID,
+			Tag:         t.Tag,
+			Owners:      t.Owners,
+			Description: t.Description,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := store.CreateTagOwner(ctx, tagOwner); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range state.Hosts {
+		host := &domain.Host{
+			ID:          uuid.New().String(),
+			StackID:     stackID,
+			Name:        h.Name,
+			Address:     h.Address,
+			Description: h.Description,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := store.CreateHost(ctx, host); err != nil {
+			return err
+		}
+	}
+
+	for i, a := range state.ACLs {
+		rule := &domain.ACLRule{
+			ID:           uuid.New().String(),
+			StackID:      stackID,
+			Order:        i,
+			Action:       a.Action,
+			Protocol:     a.Protocol,
+			Sources:      a.Sources,
+			Destinations: a.Destinations,
+			Description:  a.Description,
+			ExpiresAt:    a.ExpiresAt,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if a.Order != 0 {
+			rule.Order = a.Order
+		}
+		if err := store.CreateACLRule(ctx, rule); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range state.SSHRules {
+		rule := &domain.SSHRule{
+			ID:           uuid.New().String(),
+			StackID:      stackID,
+			Order:        i,
+			Action:       s.Action,
+			Sources:      s.Sources,
+			Destinations: s.Destinations,
+			Users:        s.Users,
+			CheckPeriod:  s.CheckPeriod,
+			Description:  s.Description,
+			ExpiresAt:    s.ExpiresAt,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if s.Order != 0 {
+			rule.Order = s.Order
+		}
+		if err := store.CreateSSHRule(ctx, rule); err != nil {
+			return err
+		}
+	}
+
+	for i, g := range state.Grants {
+		grant := &domain.Grant{
+			ID:           uuid.New().String(),
+			StackID:      stackID,
+			Order:        i,
+			Sources:      g.Sources,
+			Destinations: g.Destinations,
+			IP:           g.IP,
+			SrcPosture:   g.SrcPosture,
+			App:          g.App,
+			Description:  g.Description,
+			ExpiresAt:    g.ExpiresAt,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if g.Order != 0 {
+			grant.Order = g.Order
+		}
+		if err := store.CreateGrant(ctx, grant); err != nil {
+			return err
+		}
+	}
+
+	for _, aa := range state.AutoApprovers {
+		autoApprover := &domain.AutoApprover{
+			ID:        uuid.New().String(),
+			StackID:   stackID,
+			Type:      aa.Type,
+			Match:     aa.Match,
+			Approvers: aa.Approvers,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := store.CreateAutoApprover(ctx, autoApprover); err != nil {
+			return err
+		}
+	}
+
+	for i, na := range state.NodeAttrs {
+		nodeAttr := &domain.NodeAttr{
+			ID:        uuid.New().String(),
+			StackID:   stackID,
+			Order:     i,
+			Target:    na.Target,
+			Attr:      na.Attr,
+			App:       na.App,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if na.Order != 0 {
+			nodeAttr.Order = na.Order
+		}
+		if err := store.CreateNodeAttr(ctx, nodeAttr); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range state.Postures {
+		posture := &domain.Posture{
+			ID:        uuid.New().String(),
+			StackID:   stackID,
+			Name:      p.Name,
+			Rules:     p.Rules,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := store.CreatePosture(ctx, posture); err != nil {
+			return err
+		}
+	}
+
+	for _, is := range state.IPSets {
+		ipset := &domain.IPSet{
+			ID:        uuid.New().String(),
+			StackID:   stackID,
+			Name:      is.Name,
+			Addresses: is.Addresses,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := store.CreateIPSet(ctx, ipset); err != nil {
+			return err
+		}
+	}
+
+	for i, t := range state.Tests {
+		test := &domain.ACLTest{
+			ID:        uuid.New().String(),
+			StackID:   stackID,
+			Order:     i,
+			Source:    t.Source,
+			Accept:    t.Accept,
+			Deny:      t.Deny,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if t.Order != 0 {
+			test.Order = t.Order
+		}
+		if err := store.CreateACLTest(ctx, test); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clear deletes every resource of a stack, leaving the stack itself.
+func Clear(ctx context.Context, store storage.Storage, stackID string) error {
+	if err := store.DeleteAllGroupsForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllTagOwnersForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllHostsForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllACLRulesForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllSSHRulesForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllGrantsForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllAutoApproversForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllNodeAttrsForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllPosturesForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllIPSetsForStack(ctx, stackID); err != nil {
+		return err
+	}
+	if err := store.DeleteAllACLTestsForStack(ctx, stackID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListAll returns the resources of every stack, including the disabled
+// stacks that ListAll* queries leave out: listAll is a ListAll* query and
+// list lists the resources of one stack of the same type.
+func ListAll[T any](ctx context.Context, s storage.Storage, listAll func(context.Context) ([]T, error), list func(context.Context, string) ([]T, error)) ([]T, error) {
+	resources, err := listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stacks, err := s.ListStacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range stacks {
+		if !stack.Disabled {
+			continue
+		}
+		disabled, err := list(ctx, stack.ID)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, disabled...)
+	}
+	return resources, nil
+}
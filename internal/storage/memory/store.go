@@ -1,7 +1,11 @@
 package memory
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -16,18 +20,27 @@ type Store struct {
 
 	apiKeys        map[string]*domain.APIKey
 	stacks         map[string]*domain.Stack
-	groups         map[string]*domain.Group         // key: stackID:name
-	tagOwners      map[string]*domain.TagOwner      // key: stackID:tag
-	hosts          map[string]*domain.Host          // key: stackID:name
-	aclRules       map[string]*domain.ACLRule       // key: id
-	sshRules       map[string]*domain.SSHRule       // key: id
-	grants         map[string]*domain.Grant         // key: id
-	autoApprovers  map[string]*domain.AutoApprover  // key: id
-	nodeAttrs      map[string]*domain.NodeAttr      // key: id
-	postures       map[string]*domain.Posture       // key: stackID:name
-	ipsets         map[string]*domain.IPSet         // key: stackID:name
-	aclTests       map[string]*domain.ACLTest       // key: id
-	policyVersions map[string]*domain.PolicyVersion // key: id
+	groups         map[string]*domain.Group          // key: stackID:name
+	tagOwners      map[string]*domain.TagOwner       // key: stackID:tag
+	hosts          map[string]*domain.Host           // key: stackID:name
+	aclRules       map[string]*domain.ACLRule        // key: id
+	sshRules       map[string]*domain.SSHRule        // key: id
+	grants         map[string]*domain.Grant          // key: id
+	autoApprovers  map[string]*domain.AutoApprover   // key: id
+	nodeAttrs      map[string]*domain.NodeAttr       // key: id
+	postures       map[string]*domain.Posture        // key: stackID:name
+	ipsets         map[string]*domain.IPSet          // key: stackID:name
+	aclTests       map[string]*domain.ACLTest        // key: id
+	claims         map[string]*domain.Claim          // key: type:name
+	approvers      map[string]*domain.AccessApprover // key: id
+	accessRequests map[string]*domain.AccessRequest  // key: id
+	accessEvents   []*domain.AccessRequestEvent      // oldest first
+	changeSets     map[string]*domain.ChangeSet      // key: id
+	changeReviews  []*domain.ChangeReview            // oldest first
+	guardrails     map[string]*domain.Guardrail      // key: id
+	policyVersions map[string]*domain.PolicyVersion  // key: id
+	driftEvents    []*domain.DriftEvent              // oldest first
+	auditEntries   []*domain.AuditEntry              // append-only, oldest first
 }
 
 // New creates a new in-memory store.
@@ -46,24 +59,186 @@ func New() *Store {
 		postures:       make(map[string]*domain.Posture),
 		ipsets:         make(map[string]*domain.IPSet),
 		aclTests:       make(map[string]*domain.ACLTest),
+		claims:         make(map[string]*domain.Claim),
+		approvers:      make(map[string]*domain.AccessApprover),
+		accessRequests: make(map[string]*domain.AccessRequest),
+		changeSets:     make(map[string]*domain.ChangeSet),
+		guardrails:     make(map[string]*domain.Guardrail),
 		policyVersions: make(map[string]*domain.PolicyVersion),
 	}
 }
 
 func (s *Store) Close() error { return nil }
 
+// BeginTx starts a transaction on a copy of the store. Commit writes the
+// entries the transaction changed back to the store, unless another
+// transaction changed any of them first; Rollback drops them.
 func (s *Store) BeginTx(ctx context.Context) (storage.Transaction, error) {
-	return &Tx{store: s}, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &Tx{store: s.clone(), base: s.clone(), parent: s}, nil
 }
 
-// Tx is a no-op transaction for in-memory store.
+// clone returns a copy of the store sharing its stored values. Callers must
+// hold s.mu.
+func (s *Store) clone() *Store {
+	return &Store{
+		apiKeys:        maps.Clone(s.apiKeys),
+		stacks:         maps.Clone(s.stacks),
+		groups:         maps.Clone(s.groups),
+		tagOwners:      maps.Clone(s.tagOwners),
+		hosts:          maps.Clone(s.hosts),
+		aclRules:       maps.Clone(s.aclRules),
+		sshRules:       maps.Clone(s.sshRules),
+		grants:         maps.Clone(s.grants),
+		autoApprovers:  maps.Clone(s.autoApprovers),
+		nodeAttrs:      maps.Clone(s.nodeAttrs),
+		postures:       maps.Clone(s.postures),
+		ipsets:         maps.Clone(s.ipsets),
+		aclTests:       maps.Clone(s.aclTests),
+		claims:         maps.Clone(s.claims),
+		approvers:      maps.Clone(s.approvers),
+		accessRequests: maps.Clone(s.accessRequests),
+		accessEvents:   slices.Clone(s.accessEvents),
+		changeSets:     maps.Clone(s.changeSets),
+		changeReviews:  slices.Clone(s.changeReviews),
+		guardrails:     maps.Clone(s.guardrails),
+		policyVersions: maps.Clone(s.policyVersions),
+		driftEvents:    slices.Clone(s.driftEvents),
+		auditEntries:   slices.Clone(s.auditEntries),
+	}
+}
+
+// Tx is a transaction of the in-memory store. It works on a copy of the
+// store, so its writes are only seen by the rest of the store once it is
+// committed.
 type Tx struct {
-	store *Store
+	store  *Store // The transaction's copy
+	base   *Store // The store as it was when the transaction began
+	parent *Store
+	done   bool
+}
+
+func (t *Tx) Commit() error {
+	if t.done {
+		return domain.ErrInvalidInput
+	}
+	t.done = true
+
+	p, c, b := t.parent, t.store, t.base
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Transactions are serializable: one that changes an entry another
+	// transaction has committed since it began fails as a whole.
+	if id := changedSince(p.stacks, b.stacks, c.stacks); id != "" {
+		if stack, exists := p.stacks[id]; exists {
+			return &domain.StackGenerationError{StackID: id, Generation: stack.Generation}
+		}
+		return fmt.Errorf("%w: stack %s was deleted by another transaction", domain.ErrConflict, id)
+	}
+	if key := cmp.Or(
+		changedSince(p.apiKeys, b.apiKeys, c.apiKeys),
+		changedSince(p.groups, b.groups, c.groups),
+		changedSince(p.tagOwners, b.tagOwners, c.tagOwners),
+		changedSince(p.hosts, b.hosts, c.hosts),
+		changedSince(p.aclRules, b.aclRules, c.aclRules),
+		changedSince(p.sshRules, b.sshRules, c.sshRules),
+		changedSince(p.grants, b.grants, c.grants),
+		changedSince(p.autoApprovers, b.autoApprovers, c.autoApprovers),
+		changedSince(p.nodeAttrs, b.nodeAttrs, c.nodeAttrs),
+		changedSince(p.postures, b.postures, c.postures),
+		changedSince(p.ipsets, b.ipsets, c.ipsets),
+		changedSince(p.aclTests, b.aclTests, c.aclTests),
+		changedSince(p.claims, b.claims, c.claims),
+		changedSince(p.approvers, b.approvers, c.approvers),
+		changedSince(p.accessRequests, b.accessRequests, c.accessRequests),
+		changedSince(p.changeSets, b.changeSets, c.changeSets),
+		changedSince(p.guardrails, b.guardrails, c.guardrails),
+		changedSince(p.policyVersions, b.policyVersions, c.policyVersions),
+	); key != "" {
+		return fmt.Errorf("%w: %s was changed by another transaction", domain.ErrConflict, key)
+	}
+	for i, e := range b.driftEvents {
+		if c.driftEvents[i] != e && p.driftEvents[i] != e {
+			return fmt.Errorf("%w: drift event %s was changed by another transaction", domain.ErrConflict, e.ID)
+		}
+	}
+	applyChanges(p.apiKeys, b.apiKeys, c.apiKeys)
+	applyChanges(p.stacks, b.stacks, c.stacks)
+	applyChanges(p.groups, b.groups, c.groups)
+	applyChanges(p.tagOwners, b.tagOwners, c.tagOwners)
+	applyChanges(p.hosts, b.hosts, c.hosts)
+	applyChanges(p.aclRules, b.aclRules, c.aclRules)
+	applyChanges(p.sshRules, b.sshRules, c.sshRules)
+	applyChanges(p.grants, b.grants, c.grants)
+	applyChanges(p.autoApprovers, b.autoApprovers, c.autoApprovers)
+	applyChanges(p.nodeAttrs, b.nodeAttrs, c.nodeAttrs)
+	applyChanges(p.postures, b.postures, c.postures)
+	applyChanges(p.ipsets, b.ipsets, c.ipsets)
+	applyChanges(p.aclTests, b.aclTests, c.aclTests)
+	applyChanges(p.claims, b.claims, c.claims)
+	applyChanges(p.approvers, b.approvers, c.approvers)
+	applyChanges(p.accessRequests, b.accessRequests, c.accessRequests)
+	applyChanges(p.changeSets, b.changeSets, c.changeSets)
+	applyChanges(p.guardrails, b.guardrails, c.guardrails)
+	applyChanges(p.policyVersions, b.policyVersions, c.policyVersions)
+	p.accessEvents = append(p.accessEvents, c.accessEvents[len(b.accessEvents):]...)
+	p.changeReviews = append(p.changeReviews, c.changeReviews[len(b.changeReviews):]...)
+	p.auditEntries = append(p.auditEntries, c.auditEntries[len(b.auditEntries):]...)
+	// Drift events are only appended or resolved in place
+	for i, e := range b.driftEvents {
+		if c.driftEvents[i] != e {
+			p.driftEvents[i] = c.driftEvents[i]
+		}
+	}
+	p.driftEvents = append(p.driftEvents, c.driftEvents[len(b.driftEvents):]...)
+	return nil
+}
+
+func (t *Tx) Rollback() error {
+	t.done = true
+	return nil
 }
 
-func (t *Tx) Commit() error   { return nil }
-func (t *Tx) Rollback() error { return nil }
-func (t *Tx) Close() error    { return nil }
+func (t *Tx) Close() error { return nil }
+
+// changedSince returns a key the transaction changed between base and
+// changed whose entry in dst no longer matches base, or "" if there is none.
+func changedSince[V comparable](dst, base, changed map[string]V) string {
+	for k, v := range changed {
+		old, inBase := base[k]
+		if inBase && old == v {
+			continue
+		}
+		if cur, ok := dst[k]; ok != inBase || cur != old {
+			return k
+		}
+	}
+	for k, old := range base {
+		if _, ok := changed[k]; ok {
+			continue
+		}
+		if cur, ok := dst[k]; !ok || cur != old {
+			return k
+		}
+	}
+	return ""
+}
+
+// applyChanges makes the entries of dst that differ between base and changed
+// match changed, leaving other entries of dst as they are.
+func applyChanges[K comparable, V comparable](dst, base, changed map[K]V) {
+	for k, v := range changed {
+		if old, ok := base[k]; !ok || old != v {
+			dst[k] = v
+		}
+	}
+	for k := range base {
+		if _, ok := changed[k]; !ok {
+			delete(dst, k)
+		}
+	}
+}
 func (t *Tx) BeginTx(ctx context.Context) (storage.Transaction, error) {
 	return nil, domain.ErrInvalidInput
 }
@@ -105,6 +280,9 @@ func (t *Tx) UpdateStack(ctx context.Context, stack *domain.Stack) error {
 func (t *Tx) DeleteStack(ctx context.Context, id string) error {
 	return t.store.DeleteStack(ctx, id)
 }
+func (t *Tx) IncrementStackGeneration(ctx context.Context, id string, ifGeneration *int64) (int64, error) {
+	return t.store.IncrementStackGeneration(ctx, id, ifGeneration)
+}
 func (t *Tx) CreateGroup(ctx context.Context, group *domain.Group) error {
 	return t.store.CreateGroup(ctx, group)
 }
@@ -381,6 +559,112 @@ func (t *Tx) ListPolicyVersions(ctx context.Context, limit, offset int) ([]*doma
 func (t *Tx) UpdatePolicyVersion(ctx context.Context, version *domain.PolicyVersion) error {
 	return t.store.UpdatePolicyVersion(ctx, version)
 }
+func (t *Tx) GetLastSuccessfulPolicyVersion(ctx context.Context) (*domain.PolicyVersion, error) {
+	return t.store.GetLastSuccessfulPolicyVersion(ctx)
+}
+func (t *Tx) CreateClaim(ctx context.Context, claim *domain.Claim) error {
+	return t.store.CreateClaim(ctx, claim)
+}
+func (t *Tx) GetClaim(ctx context.Context, claimType, name string) (*domain.Claim, error) {
+	return t.store.GetClaim(ctx, claimType, name)
+}
+func (t *Tx) GetClaimByID(ctx context.Context, id string) (*domain.Claim, error) {
+	return t.store.GetClaimByID(ctx, id)
+}
+func (t *Tx) ListClaims(ctx context.Context, stackID string) ([]*domain.Claim, error) {
+	return t.store.ListClaims(ctx, stackID)
+}
+func (t *Tx) DeleteClaim(ctx context.Context, id string) error {
+	return t.store.DeleteClaim(ctx, id)
+}
+func (t *Tx) CreateAccessApprover(ctx context.Context, approver *domain.AccessApprover) error {
+	return t.store.CreateAccessApprover(ctx, approver)
+}
+func (t *Tx) GetAccessApprover(ctx context.Context, id string) (*domain.AccessApprover, error) {
+	return t.store.GetAccessApprover(ctx, id)
+}
+func (t *Tx) ListAccessApprovers(ctx context.Context, stackID string) ([]*domain.AccessApprover, error) {
+	return t.store.ListAccessApprovers(ctx, stackID)
+}
+func (t *Tx) DeleteAccessApprover(ctx context.Context, id string) error {
+	return t.store.DeleteAccessApprover(ctx, id)
+}
+func (t *Tx) CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	return t.store.CreateAccessRequest(ctx, req)
+}
+func (t *Tx) GetAccessRequest(ctx context.Context, id string) (*domain.AccessRequest, error) {
+	return t.store.GetAccessRequest(ctx, id)
+}
+func (t *Tx) ListAccessRequests(ctx context.Context, filter domain.AccessRequestFilter) ([]*domain.AccessRequest, error) {
+	return t.store.ListAccessRequests(ctx, filter)
+}
+func (t *Tx) UpdateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	return t.store.UpdateAccessRequest(ctx, req)
+}
+func (t *Tx) CreateAccessRequestEvent(ctx context.Context, event *domain.AccessRequestEvent) error {
+	return t.store.CreateAccessRequestEvent(ctx, event)
+}
+func (t *Tx) ListAccessRequestEvents(ctx context.Context, requestID string) ([]*domain.AccessRequestEvent, error) {
+	return t.store.ListAccessRequestEvents(ctx, requestID)
+}
+func (t *Tx) CreateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	return t.store.CreateChangeSet(ctx, change)
+}
+func (t *Tx) GetChangeSet(ctx context.Context, id string) (*domain.ChangeSet, error) {
+	return t.store.GetChangeSet(ctx, id)
+}
+func (t *Tx) ListChangeSets(ctx context.Context, filter domain.ChangeSetFilter) ([]*domain.ChangeSet, error) {
+	return t.store.ListChangeSets(ctx, filter)
+}
+func (t *Tx) UpdateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	return t.store.UpdateChangeSet(ctx, change)
+}
+func (t *Tx) CreateChangeReview(ctx context.Context, review *domain.ChangeReview) error {
+	return t.store.CreateChangeReview(ctx, review)
+}
+func (t *Tx) ListChangeReviews(ctx context.Context, changeID string) ([]*domain.ChangeReview, error) {
+	return t.store.ListChangeReviews(ctx, changeID)
+}
+func (t *Tx) CreateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	return t.store.CreateGuardrail(ctx, guardrail)
+}
+func (t *Tx) GetGuardrail(ctx context.Context, id string) (*domain.Guardrail, error) {
+	return t.store.GetGuardrail(ctx, id)
+}
+func (t *Tx) ListGuardrails(ctx context.Context) ([]*domain.Guardrail, error) {
+	return t.store.ListGuardrails(ctx)
+}
+func (t *Tx) UpdateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	return t.store.UpdateGuardrail(ctx, guardrail)
+}
+func (t *Tx) DeleteGuardrail(ctx context.Context, id string) error {
+	return t.store.DeleteGuardrail(ctx, id)
+}
+func (t *Tx) CreateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	return t.store.CreateDriftEvent(ctx, event)
+}
+func (t *Tx) GetOpenDriftEvent(ctx context.Context) (*domain.DriftEvent, error) {
+	return t.store.GetOpenDriftEvent(ctx)
+}
+func (t *Tx) ListDriftEvents(ctx context.Context, limit, offset int) ([]*domain.DriftEvent, error) {
+	return t.store.ListDriftEvents(ctx, limit, offset)
+}
+func (t *Tx) UpdateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	return t.store.UpdateDriftEvent(ctx, event)
+}
+func (t *Tx) CreateAuditEntry(ctx context.Context, entry *domain.AuditEntry) error {
+	return t.store.CreateAuditEntry(ctx, entry)
+}
+func (t *Tx) ListAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	return t.store.ListAuditEntries(ctx, filter)
+}
+
+// clone returns a copy of a stored resource, so that callers modifying it
+// before writing it back do not change the store, as with SQL storage.
+func clone[T any](v *T) *T {
+	cp := *v
+	return &cp
+}
 
 // ============================================
 // API Keys
@@ -389,6 +673,8 @@ func (t *Tx) UpdatePolicyVersion(ctx context.Context, version *domain.PolicyVers
 // copyAPIKey returns a deep copy of an API key to prevent race conditions.
 func copyAPIKey(key *domain.APIKey) *domain.APIKey {
 	cp := *key
+	cp.Roles = append([]string(nil), key.Roles...)
+	cp.StackIDs = append([]string(nil), key.StackIDs...)
 	if key.LastUsedAt != nil {
 		t := *key.LastUsedAt
 		cp.LastUsedAt = &t
@@ -445,7 +731,9 @@ func (s *Store) UpdateAPIKeyLastUsed(ctx context.Context, id string) error {
 		return domain.ErrNotFound
 	}
 	now := time.Now()
-	key.LastUsedAt = &now
+	updated := *key
+	updated.LastUsedAt = &now
+	s.apiKeys[id] = &updated
 	return nil
 }
 
@@ -514,13 +802,39 @@ func (s *Store) ListStacks(ctx context.Context) ([]*domain.Stack, error) {
 func (s *Store) UpdateStack(ctx context.Context, stack *domain.Stack) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, exists := s.stacks[stack.ID]; !exists {
+	existing, exists := s.stacks[stack.ID]
+	if !exists {
 		return domain.ErrNotFound
 	}
+	stack.Generation = existing.Generation
 	s.stacks[stack.ID] = stack
 	return nil
 }
 
+// stackDisabled reports whether the stack stackID exists and is disabled.
+// ListAll* queries leave out the resources of disabled stacks. Callers must
+// hold s.mu.
+func (s *Store) stackDisabled(stackID string) bool {
+	stack, exists := s.stacks[stackID]
+	return exists && stack.Disabled
+}
+
+func (s *Store) IncrementStackGeneration(ctx context.Context, id string, ifGeneration *int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stack, exists := s.stacks[id]
+	if !exists {
+		return 0, domain.ErrNotFound
+	}
+	if ifGeneration != nil && *ifGeneration != stack.Generation {
+		return 0, &domain.StackGenerationError{StackID: id, Generation: stack.Generation}
+	}
+	updated := *stack
+	updated.Generation++
+	s.stacks[id] = &updated
+	return updated.Generation, nil
+}
+
 func (s *Store) DeleteStack(ctx context.Context, id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -528,6 +842,27 @@ func (s *Store) DeleteStack(ctx context.Context, id string) error {
 		return domain.ErrNotFound
 	}
 	delete(s.stacks, id)
+	// Claims are released with their stack
+	for key, claim := range s.claims {
+		if claim.StackID == id {
+			delete(s.claims, key)
+		}
+	}
+	for key, approver := range s.approvers {
+		if approver.StackID == id {
+			delete(s.approvers, key)
+		}
+	}
+	for key, req := range s.accessRequests {
+		if req.StackID == id {
+			delete(s.accessRequests, key)
+		}
+	}
+	for key, change := range s.changeSets {
+		if change.StackID == id {
+			delete(s.changeSets, key)
+		}
+	}
 	return nil
 }
 
@@ -555,7 +890,7 @@ func (s *Store) GetGroup(ctx context.Context, stackID, name string) (*domain.Gro
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return group, nil
+	return clone(group), nil
 }
 
 func (s *Store) ListGroups(ctx context.Context, stackID string) ([]*domain.Group, error) {
@@ -576,6 +911,9 @@ func (s *Store) ListAllGroups(ctx context.Context) ([]*domain.Group, error) {
 	defer s.mu.RUnlock()
 	groups := make([]*domain.Group, 0, len(s.groups))
 	for _, group := range s.groups {
+		if s.stackDisabled(group.StackID) {
+			continue
+		}
 		groups = append(groups, group)
 	}
 	// Sort by stack priority then name
@@ -616,7 +954,7 @@ func (s *Store) GetGroupByID(ctx context.Context, id string) (*domain.Group, err
 	defer s.mu.RUnlock()
 	for _, group := range s.groups {
 		if group.ID == id {
-			return group, nil
+			return clone(group), nil
 		}
 	}
 	return nil, domain.ErrNotFound
@@ -669,7 +1007,7 @@ func (s *Store) GetTagOwner(ctx context.Context, stackID, tag string) (*domain.T
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return to, nil
+	return clone(to), nil
 }
 
 func (s *Store) ListTagOwners(ctx context.Context, stackID string) ([]*domain.TagOwner, error) {
@@ -690,6 +1028,9 @@ func (s *Store) ListAllTagOwners(ctx context.Context) ([]*domain.TagOwner, error
 	defer s.mu.RUnlock()
 	tagOwners := make([]*domain.TagOwner, 0, len(s.tagOwners))
 	for _, to := range s.tagOwners {
+		if s.stackDisabled(to.StackID) {
+			continue
+		}
 		tagOwners = append(tagOwners, to)
 	}
 	sort.Slice(tagOwners, func(i, j int) bool {
@@ -729,7 +1070,7 @@ func (s *Store) GetTagOwnerByID(ctx context.Context, id string) (*domain.TagOwne
 	defer s.mu.RUnlock()
 	for _, to := range s.tagOwners {
 		if to.ID == id {
-			return to, nil
+			return clone(to), nil
 		}
 	}
 	return nil, domain.ErrNotFound
@@ -782,7 +1123,7 @@ func (s *Store) GetHost(ctx context.Context, stackID, name string) (*domain.Host
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return host, nil
+	return clone(host), nil
 }
 
 func (s *Store) ListHosts(ctx context.Context, stackID string) ([]*domain.Host, error) {
@@ -803,6 +1144,9 @@ func (s *Store) ListAllHosts(ctx context.Context) ([]*domain.Host, error) {
 	defer s.mu.RUnlock()
 	hosts := make([]*domain.Host, 0, len(s.hosts))
 	for _, host := range s.hosts {
+		if s.stackDisabled(host.StackID) {
+			continue
+		}
 		hosts = append(hosts, host)
 	}
 	sort.Slice(hosts, func(i, j int) bool {
@@ -842,7 +1186,7 @@ func (s *Store) GetHostByID(ctx context.Context, id string) (*domain.Host, error
 	defer s.mu.RUnlock()
 	for _, host := range s.hosts {
 		if host.ID == id {
-			return host, nil
+			return clone(host), nil
 		}
 	}
 	return nil, domain.ErrNotFound
@@ -892,7 +1236,7 @@ func (s *Store) GetACLRule(ctx context.Context, id string) (*domain.ACLRule, err
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return rule, nil
+	return clone(rule), nil
 }
 
 func (s *Store) ListACLRules(ctx context.Context, stackID string) ([]*domain.ACLRule, error) {
@@ -913,6 +1257,9 @@ func (s *Store) ListAllACLRules(ctx context.Context) ([]*domain.ACLRule, error)
 	defer s.mu.RUnlock()
 	rules := make([]*domain.ACLRule, 0, len(s.aclRules))
 	for _, rule := range s.aclRules {
+		if s.stackDisabled(rule.StackID) {
+			continue
+		}
 		rules = append(rules, rule)
 	}
 	sort.Slice(rules, func(i, j int) bool {
@@ -977,7 +1324,7 @@ func (s *Store) GetSSHRule(ctx context.Context, id string) (*domain.SSHRule, err
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return rule, nil
+	return clone(rule), nil
 }
 
 func (s *Store) ListSSHRules(ctx context.Context, stackID string) ([]*domain.SSHRule, error) {
@@ -998,6 +1345,9 @@ func (s *Store) ListAllSSHRules(ctx context.Context) ([]*domain.SSHRule, error)
 	defer s.mu.RUnlock()
 	rules := make([]*domain.SSHRule, 0, len(s.sshRules))
 	for _, rule := range s.sshRules {
+		if s.stackDisabled(rule.StackID) {
+			continue
+		}
 		rules = append(rules, rule)
 	}
 	sort.Slice(rules, func(i, j int) bool {
@@ -1062,7 +1412,7 @@ func (s *Store) GetGrant(ctx context.Context, id string) (*domain.Grant, error)
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return grant, nil
+	return clone(grant), nil
 }
 
 func (s *Store) ListGrants(ctx context.Context, stackID string) ([]*domain.Grant, error) {
@@ -1083,6 +1433,9 @@ func (s *Store) ListAllGrants(ctx context.Context) ([]*domain.Grant, error) {
 	defer s.mu.RUnlock()
 	grants := make([]*domain.Grant, 0, len(s.grants))
 	for _, grant := range s.grants {
+		if s.stackDisabled(grant.StackID) {
+			continue
+		}
 		grants = append(grants, grant)
 	}
 	sort.Slice(grants, func(i, j int) bool {
@@ -1147,7 +1500,7 @@ func (s *Store) GetAutoApprover(ctx context.Context, id string) (*domain.AutoApp
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return aa, nil
+	return clone(aa), nil
 }
 
 func (s *Store) ListAutoApprovers(ctx context.Context, stackID string) ([]*domain.AutoApprover, error) {
@@ -1167,6 +1520,9 @@ func (s *Store) ListAllAutoApprovers(ctx context.Context) ([]*domain.AutoApprove
 	defer s.mu.RUnlock()
 	aas := make([]*domain.AutoApprover, 0, len(s.autoApprovers))
 	for _, aa := range s.autoApprovers {
+		if s.stackDisabled(aa.StackID) {
+			continue
+		}
 		aas = append(aas, aa)
 	}
 	sort.Slice(aas, func(i, j int) bool {
@@ -1231,7 +1587,7 @@ func (s *Store) GetNodeAttr(ctx context.Context, id string) (*domain.NodeAttr, e
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return attr, nil
+	return clone(attr), nil
 }
 
 func (s *Store) ListNodeAttrs(ctx context.Context, stackID string) ([]*domain.NodeAttr, error) {
@@ -1252,6 +1608,9 @@ func (s *Store) ListAllNodeAttrs(ctx context.Context) ([]*domain.NodeAttr, error
 	defer s.mu.RUnlock()
 	attrs := make([]*domain.NodeAttr, 0, len(s.nodeAttrs))
 	for _, attr := range s.nodeAttrs {
+		if s.stackDisabled(attr.StackID) {
+			continue
+		}
 		attrs = append(attrs, attr)
 	}
 	sort.Slice(attrs, func(i, j int) bool {
@@ -1319,7 +1678,7 @@ func (s *Store) GetPosture(ctx context.Context, stackID, name string) (*domain.P
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return posture, nil
+	return clone(posture), nil
 }
 
 func (s *Store) ListPostures(ctx context.Context, stackID string) ([]*domain.Posture, error) {
@@ -1340,6 +1699,9 @@ func (s *Store) ListAllPostures(ctx context.Context) ([]*domain.Posture, error)
 	defer s.mu.RUnlock()
 	postures := make([]*domain.Posture, 0, len(s.postures))
 	for _, posture := range s.postures {
+		if s.stackDisabled(posture.StackID) {
+			continue
+		}
 		postures = append(postures, posture)
 	}
 	sort.Slice(postures, func(i, j int) bool {
@@ -1379,7 +1741,7 @@ func (s *Store) GetPostureByID(ctx context.Context, id string) (*domain.Posture,
 	defer s.mu.RUnlock()
 	for _, posture := range s.postures {
 		if posture.ID == id {
-			return posture, nil
+			return clone(posture), nil
 		}
 	}
 	return nil, domain.ErrNotFound
@@ -1432,7 +1794,7 @@ func (s *Store) GetIPSet(ctx context.Context, stackID, name string) (*domain.IPS
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return ipset, nil
+	return clone(ipset), nil
 }
 
 func (s *Store) ListIPSets(ctx context.Context, stackID string) ([]*domain.IPSet, error) {
@@ -1453,6 +1815,9 @@ func (s *Store) ListAllIPSets(ctx context.Context) ([]*domain.IPSet, error) {
 	defer s.mu.RUnlock()
 	ipsets := make([]*domain.IPSet, 0, len(s.ipsets))
 	for _, ipset := range s.ipsets {
+		if s.stackDisabled(ipset.StackID) {
+			continue
+		}
 		ipsets = append(ipsets, ipset)
 	}
 	sort.Slice(ipsets, func(i, j int) bool {
@@ -1492,7 +1857,7 @@ func (s *Store) GetIPSetByID(ctx context.Context, id string) (*domain.IPSet, err
 	defer s.mu.RUnlock()
 	for _, ipset := range s.ipsets {
 		if ipset.ID == id {
-			return ipset, nil
+			return clone(ipset), nil
 		}
 	}
 	return nil, domain.ErrNotFound
@@ -1542,7 +1907,7 @@ func (s *Store) GetACLTest(ctx context.Context, id string) (*domain.ACLTest, err
 	if !exists {
 		return nil, domain.ErrNotFound
 	}
-	return test, nil
+	return clone(test), nil
 }
 
 func (s *Store) ListACLTests(ctx context.Context, stackID string) ([]*domain.ACLTest, error) {
@@ -1563,6 +1928,9 @@ func (s *Store) ListAllACLTests(ctx context.Context) ([]*domain.ACLTest, error)
 	defer s.mu.RUnlock()
 	tests := make([]*domain.ACLTest, 0, len(s.aclTests))
 	for _, test := range s.aclTests {
+		if s.stackDisabled(test.StackID) {
+			continue
+		}
 		tests = append(tests, test)
 	}
 	sort.Slice(tests, func(i, j int) bool {
@@ -1645,6 +2013,21 @@ func (s *Store) GetLatestPolicyVersion(ctx context.Context) (*domain.PolicyVersi
 	return latest, nil
 }
 
+func (s *Store) GetLastSuccessfulPolicyVersion(ctx context.Context) (*domain.PolicyVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var latest *domain.PolicyVersion
+	for _, v := range s.policyVersions {
+		if v.PushStatus == "success" && (latest == nil || v.VersionNumber > latest.VersionNumber) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return nil, domain.ErrNotFound
+	}
+	return latest, nil
+}
+
 func (s *Store) ListPolicyVersions(ctx context.Context, limit, offset int) ([]*domain.PolicyVersion, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -1674,3 +2057,450 @@ func (s *Store) UpdatePolicyVersion(ctx context.Context, version *domain.PolicyV
 	s.policyVersions[version.ID] = version
 	return nil
 }
+
+// ============================================
+// Claims
+// ============================================
+
+func claimKey(claimType, name string) string { return claimType + ":" + name }
+
+func (s *Store) CreateClaim(ctx context.Context, claim *domain.Claim) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := claimKey(claim.Type, claim.Name)
+	if _, exists := s.claims[key]; exists {
+		return domain.ErrAlreadyExists
+	}
+	s.claims[key] = claim
+	return nil
+}
+
+func (s *Store) GetClaim(ctx context.Context, claimType, name string) (*domain.Claim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	claim, exists := s.claims[claimKey(claimType, name)]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	return claim, nil
+}
+
+func (s *Store) GetClaimByID(ctx context.Context, id string) (*domain.Claim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, claim := range s.claims {
+		if claim.ID == id {
+			return claim, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (s *Store) ListClaims(ctx context.Context, stackID string) ([]*domain.Claim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	claims := make([]*domain.Claim, 0)
+	for _, claim := range s.claims {
+		if claim.StackID == stackID {
+			claims = append(claims, claim)
+		}
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		if claims[i].Type != claims[j].Type {
+			return claims[i].Type < claims[j].Type
+		}
+		return claims[i].Name < claims[j].Name
+	})
+	return claims, nil
+}
+
+func (s *Store) DeleteClaim(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, claim := range s.claims {
+		if claim.ID == id {
+			delete(s.claims, key)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+// ============================================
+// Access Approvers
+// ============================================
+
+func (s *Store) CreateAccessApprover(ctx context.Context, approver *domain.AccessApprover) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.approvers {
+		if existing.StackID == approver.StackID && existing.Group == approver.Group && existing.Approver == approver.Approver {
+			return domain.ErrAlreadyExists
+		}
+	}
+	s.approvers[approver.ID] = approver
+	return nil
+}
+
+func (s *Store) GetAccessApprover(ctx context.Context, id string) (*domain.AccessApprover, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	approver, exists := s.approvers[id]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	return approver, nil
+}
+
+func (s *Store) ListAccessApprovers(ctx context.Context, stackID string) ([]*domain.AccessApprover, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	approvers := make([]*domain.AccessApprover, 0)
+	for _, approver := range s.approvers {
+		if approver.StackID == stackID {
+			approvers = append(approvers, approver)
+		}
+	}
+	sort.Slice(approvers, func(i, j int) bool {
+		if approvers[i].Group != approvers[j].Group {
+			return approvers[i].Group < approvers[j].Group
+		}
+		return approvers[i].Approver < approvers[j].Approver
+	})
+	return approvers, nil
+}
+
+func (s *Store) DeleteAccessApprover(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.approvers[id]; !exists {
+		return domain.ErrNotFound
+	}
+	delete(s.approvers, id)
+	return nil
+}
+
+// ============================================
+// Access Requests
+// ============================================
+
+func (s *Store) CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.accessRequests[req.ID]; exists {
+		return domain.ErrAlreadyExists
+	}
+	s.accessRequests[req.ID] = req
+	return nil
+}
+
+func (s *Store) GetAccessRequest(ctx context.Context, id string) (*domain.AccessRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	req, exists := s.accessRequests[id]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	return req, nil
+}
+
+func (s *Store) ListAccessRequests(ctx context.Context, filter domain.AccessRequestFilter) ([]*domain.AccessRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	requests := make([]*domain.AccessRequest, 0)
+	for _, req := range s.accessRequests {
+		if len(filter.StackIDs) > 0 && !slices.Contains(filter.StackIDs, req.StackID) {
+			continue
+		}
+		if filter.Status != "" && req.Status != filter.Status {
+			continue
+		}
+		requests = append(requests, req)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.After(requests[j].CreatedAt)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests, nil
+}
+
+func (s *Store) UpdateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.accessRequests[req.ID]; !exists {
+		return domain.ErrNotFound
+	}
+	s.accessRequests[req.ID] = req
+	return nil
+}
+
+func (s *Store) CreateAccessRequestEvent(ctx context.Context, event *domain.AccessRequestEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessEvents = append(s.accessEvents, event)
+	return nil
+}
+
+func (s *Store) ListAccessRequestEvents(ctx context.Context, requestID string) ([]*domain.AccessRequestEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := make([]*domain.AccessRequestEvent, 0)
+	for _, event := range s.accessEvents {
+		if event.RequestID == requestID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// ============================================
+// Change Sets
+// ============================================
+
+func (s *Store) CreateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.changeSets[change.ID]; exists {
+		return domain.ErrAlreadyExists
+	}
+	s.changeSets[change.ID] = change
+	return nil
+}
+
+func (s *Store) GetChangeSet(ctx context.Context, id string) (*domain.ChangeSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	change, exists := s.changeSets[id]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	return change, nil
+}
+
+func (s *Store) ListChangeSets(ctx context.Context, filter domain.ChangeSetFilter) ([]*domain.ChangeSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	changes := make([]*domain.ChangeSet, 0)
+	for _, change := range s.changeSets {
+		if len(filter.StackIDs) > 0 && !slices.Contains(filter.StackIDs, change.StackID) {
+			continue
+		}
+		if filter.Status != "" && change.Status != filter.Status {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].CreatedAt.Equal(changes[j].CreatedAt) {
+			return changes[i].CreatedAt.After(changes[j].CreatedAt)
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, nil
+}
+
+func (s *Store) UpdateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.changeSets[change.ID]; !exists {
+		return domain.ErrNotFound
+	}
+	s.changeSets[change.ID] = change
+	return nil
+}
+
+func (s *Store) CreateChangeReview(ctx context.Context, review *domain.ChangeReview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changeReviews = append(s.changeReviews, review)
+	return nil
+}
+
+func (s *Store) ListChangeReviews(ctx context.Context, changeID string) ([]*domain.ChangeReview, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reviews := make([]*domain.ChangeReview, 0)
+	for _, review := range s.changeReviews {
+		if review.ChangeID == changeID {
+			reviews = append(reviews, review)
+		}
+	}
+	return reviews, nil
+}
+
+// ============================================
+// Guardrails
+// ============================================
+
+func (s *Store) CreateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.guardrails[guardrail.ID]; exists {
+		return domain.ErrAlreadyExists
+	}
+	for _, g := range s.guardrails {
+		if g.Name == guardrail.Name {
+			return domain.ErrAlreadyExists
+		}
+	}
+	s.guardrails[guardrail.ID] = guardrail
+	return nil
+}
+
+func (s *Store) GetGuardrail(ctx context.Context, id string) (*domain.Guardrail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	guardrail, exists := s.guardrails[id]
+	if !exists {
+		return nil, domain.ErrNotFound
+	}
+	return guardrail, nil
+}
+
+func (s *Store) ListGuardrails(ctx context.Context) ([]*domain.Guardrail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	guardrails := make([]*domain.Guardrail, 0, len(s.guardrails))
+	for _, guardrail := range s.guardrails {
+		guardrails = append(guardrails, guardrail)
+	}
+	sort.Slice(guardrails, func(i, j int) bool {
+		return guardrails[i].Name < guardrails[j].Name
+	})
+	return guardrails, nil
+}
+
+func (s *Store) UpdateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.guardrails[guardrail.ID]; !exists {
+		return domain.ErrNotFound
+	}
+	for _, g := range s.guardrails {
+		if g.ID != guardrail.ID && g.Name == guardrail.Name {
+			return domain.ErrAlreadyExists
+		}
+	}
+	s.guardrails[guardrail.ID] = guardrail
+	return nil
+}
+
+func (s *Store) DeleteGuardrail(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.guardrails[id]; !exists {
+		return domain.ErrNotFound
+	}
+	delete(s.guardrails, id)
+	return nil
+}
+
+// ============================================
+// Drift Events
+// ============================================
+
+func (s *Store) CreateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.driftEvents {
+		if e.ID == event.ID {
+			return domain.ErrAlreadyExists
+		}
+	}
+	s.driftEvents = append(s.driftEvents, event)
+	return nil
+}
+
+func (s *Store) GetOpenDriftEvent(ctx context.Context) (*domain.DriftEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.driftEvents) - 1; i >= 0; i-- {
+		if s.driftEvents[i].ResolvedAt == nil {
+			return s.driftEvents[i], nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (s *Store) ListDriftEvents(ctx context.Context, limit, offset int) ([]*domain.DriftEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	events := make([]*domain.DriftEvent, 0, len(s.driftEvents))
+	// Newest first
+	for i := len(s.driftEvents) - 1; i >= 0; i-- {
+		events = append(events, s.driftEvents[i])
+	}
+	if offset >= len(events) {
+		return []*domain.DriftEvent{}, nil
+	}
+	end := offset + limit
+	if end > len(events) {
+		end = len(events)
+	}
+	return events[offset:end], nil
+}
+
+func (s *Store) UpdateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range s.driftEvents {
+		if e.ID == event.ID {
+			s.driftEvents[i] = event
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+// ============================================
+// Audit Log
+// ============================================
+
+func (s *Store) CreateAuditEntry(ctx context.Context, entry *domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditEntries = append(s.auditEntries, entry)
+	return nil
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]*domain.AuditEntry, 0)
+	// Newest first
+	for i := len(s.auditEntries) - 1; i >= 0; i-- {
+		e := s.auditEntries[i]
+		if len(filter.StackIDs) > 0 && !slices.Contains(filter.StackIDs, e.StackID) {
+			continue
+		}
+		if filter.ResourceType != "" && e.ResourceType != filter.ResourceType {
+			continue
+		}
+		if filter.ResourceID != "" && e.ResourceID != filter.ResourceID {
+			continue
+		}
+		if filter.ActorID != "" && e.ActorID != filter.ActorID {
+			continue
+		}
+		if filter.Action != "" && e.Action != filter.Action {
+			continue
+		}
+		if filter.Since != nil && e.CreatedAt.Before(*filter.Since) {
+			continue
+		}
+		if filter.Until != nil && !e.CreatedAt.Before(*filter.Until) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if filter.Offset >= len(entries) {
+		return []*domain.AuditEntry{}, nil
+	}
+	entries = entries[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(entries) {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- API key roles (array stored as separate table)
+CREATE TABLE api_key_roles (
+    api_key_id TEXT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    PRIMARY KEY (api_key_id, role)
+);
+
+-- API key stack scope (no rows = all stacks).
+-- stack_id deliberately has no foreign key: deleting a stack must not widen
+-- a key's scope to every stack.
+CREATE TABLE api_key_stacks (
+    api_key_id TEXT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    stack_id TEXT NOT NULL,
+    PRIMARY KEY (api_key_id, stack_id)
+);
+
+-- Existing keys keep full access
+INSERT INTO api_key_roles (api_key_id, role) SELECT id, 'read-only' FROM api_keys;
+INSERT INTO api_key_roles (api_key_id, role) SELECT id, 'stack-writer' FROM api_keys;
+INSERT INTO api_key_roles (api_key_id, role) SELECT id, 'policy-admin' FROM api_keys;
+INSERT INTO api_key_roles (api_key_id, role) SELECT id, 'key-admin' FROM api_keys;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS api_key_stacks;
+DROP TABLE IF EXISTS api_key_roles;
+
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Audit log of every mutation. Rows are never updated or deleted by the application.
+-- stack_id has no foreign key so entries outlive the stacks they describe.
+CREATE TABLE audit_entries (
+    id TEXT PRIMARY KEY,
+    actor_type TEXT NOT NULL,
+    actor_id TEXT NOT NULL DEFAULT '',
+    actor_name TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL DEFAULT '',
+    stack_id TEXT NOT NULL DEFAULT '',
+    before_json TEXT,
+    after_json TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_entries_created ON audit_entries(created_at DESC);
+CREATE INDEX idx_audit_entries_stack ON audit_entries(stack_id);
+CREATE INDEX idx_audit_entries_resource ON audit_entries(resource_type, resource_id);
+CREATE INDEX idx_audit_entries_actor ON audit_entries(actor_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS audit_entries;
+
+-- +goose StatementEnd
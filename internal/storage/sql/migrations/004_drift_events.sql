@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Differences between the last pushed policy version and the live tailnet policy.
+-- At most one event is open (resolved_at IS NULL) at a time.
+CREATE TABLE drift_events (
+    id TEXT PRIMARY KEY,
+    version_id TEXT NOT NULL,
+    version_number INTEGER NOT NULL,
+    expected_etag TEXT NOT NULL DEFAULT '',
+    live_etag TEXT NOT NULL DEFAULT '',
+    diff_json TEXT,
+    detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    resolution TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_drift_events_detected ON drift_events(detected_at DESC);
+CREATE INDEX idx_drift_events_resolved ON drift_events(resolved_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS drift_events;
+
+-- +goose StatementEnd
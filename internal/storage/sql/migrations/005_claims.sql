@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Exclusive ownership of group names, tags, and host names by a stack.
+-- Other stacks cannot define resources with a claimed name.
+CREATE TABLE claims (
+    id TEXT PRIMARY KEY,
+    stack_id TEXT NOT NULL REFERENCES stacks(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(type, name)
+);
+
+CREATE INDEX idx_claims_stack_id ON claims(stack_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS claims;
+
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Optional descriptions, rendered as comments in the HuJSON policy
+ALTER TABLE groups ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE tag_owners ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE hosts ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE acl_rules ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE ssh_rules ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE grants ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE grants DROP COLUMN description;
+ALTER TABLE ssh_rules DROP COLUMN description;
+ALTER TABLE acl_rules DROP COLUMN description;
+ALTER TABLE hosts DROP COLUMN description;
+ALTER TABLE tag_owners DROP COLUMN description;
+ALTER TABLE groups DROP COLUMN description;
+
+-- +goose StatementEnd
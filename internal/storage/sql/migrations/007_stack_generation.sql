@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Incremented on every change to a stack's resources, for optimistic
+-- concurrency on whole-stack writes.
+ALTER TABLE stacks ADD COLUMN generation INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE stacks DROP COLUMN generation;
+
+-- +goose StatementEnd
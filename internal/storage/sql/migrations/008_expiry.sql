@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Optional expiry for temporary access; expired entries are left out of the
+-- merged policy and deleted by the expiry reaper
+ALTER TABLE group_members ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE acl_rules ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE ssh_rules ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE grants ADD COLUMN expires_at TIMESTAMP;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE grants DROP COLUMN expires_at;
+ALTER TABLE ssh_rules DROP COLUMN expires_at;
+ALTER TABLE acl_rules DROP COLUMN expires_at;
+ALTER TABLE group_members DROP COLUMN expires_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Identities allowed to decide access requests for a stack, optionally
+-- limited to requests for one group (group_name is empty otherwise).
+CREATE TABLE access_approvers (
+    id TEXT PRIMARY KEY,
+    stack_id TEXT NOT NULL REFERENCES stacks(id) ON DELETE CASCADE,
+    group_name TEXT NOT NULL DEFAULT '',
+    approver TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(stack_id, group_name, approver)
+);
+
+CREATE INDEX idx_access_approvers_stack_id ON access_approvers(stack_id);
+
+-- Requests for time-boxed group membership or grants.
+CREATE TABLE access_requests (
+    id TEXT PRIMARY KEY,
+    stack_id TEXT NOT NULL REFERENCES stacks(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    target TEXT NOT NULL,
+    member TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    duration TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_by TEXT NOT NULL,
+    requester_id TEXT NOT NULL,
+    decided_by TEXT NOT NULL DEFAULT '',
+    decided_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    resource_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_access_requests_stack_id ON access_requests(stack_id);
+CREATE INDEX idx_access_requests_status ON access_requests(status);
+
+-- History of each access request: submission and decisions.
+CREATE TABLE access_request_events (
+    id TEXT PRIMARY KEY,
+    request_id TEXT NOT NULL REFERENCES access_requests(id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    actor_type TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    actor_name TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_access_request_events_request_id ON access_request_events(request_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS access_request_events;
+DROP TABLE IF EXISTS access_requests;
+DROP TABLE IF EXISTS access_approvers;
+
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Writes to stacks that require approvals are staged as change sets
+ALTER TABLE stacks ADD COLUMN required_approvals INTEGER NOT NULL DEFAULT 0;
+
+-- Proposed states of a stack awaiting approval. state_json holds the
+-- complete stack state that replaces the stack's resources when applied.
+CREATE TABLE change_sets (
+    id TEXT PRIMARY KEY,
+    stack_id TEXT NOT NULL REFERENCES stacks(id) ON DELETE CASCADE,
+    description TEXT NOT NULL DEFAULT '',
+    state_json TEXT NOT NULL,
+    base_generation INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    author_type TEXT NOT NULL,
+    author_id TEXT NOT NULL,
+    author_name TEXT NOT NULL,
+    closed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_change_sets_stack_id ON change_sets(stack_id);
+CREATE INDEX idx_change_sets_status ON change_sets(status);
+
+-- Approvals and rejections of change sets.
+CREATE TABLE change_reviews (
+    id TEXT PRIMARY KEY,
+    change_id TEXT NOT NULL REFERENCES change_sets(id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    actor_type TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    actor_name TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_change_reviews_change_id ON change_reviews(change_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS change_reviews;
+DROP TABLE IF EXISTS change_sets;
+ALTER TABLE stacks DROP COLUMN required_approvals;
+
+-- +goose StatementEnd
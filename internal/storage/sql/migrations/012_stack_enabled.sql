@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Disabled stacks keep their resources but are left out of the merged policy.
+ALTER TABLE stacks ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE stacks DROP COLUMN enabled;
+
+-- +goose StatementEnd
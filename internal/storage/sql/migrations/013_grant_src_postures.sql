@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Postures the source devices of a grant must satisfy.
+CREATE TABLE grant_src_postures (
+    grant_id TEXT NOT NULL REFERENCES grants(id) ON DELETE CASCADE,
+    posture TEXT NOT NULL,
+    seq INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (grant_id, seq)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS grant_src_postures;
+
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The actor that created each key. Keys created before this are unattributed.
+ALTER TABLE api_keys ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE api_keys DROP COLUMN created_by;
+
+-- +goose StatementEnd
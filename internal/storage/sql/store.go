@@ -125,10 +125,48 @@ type dbInterface interface {
 
 func createAPIKey(ctx context.Context, db dbInterface, key *domain.APIKey) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO api_keys (id, name, key_hash, key_prefix, created_at, last_used_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		key.ID, key.Name, key.KeyHash, key.KeyPrefix, key.CreatedAt, key.LastUsedAt)
-	return err
+		`INSERT INTO api_keys (id, name, key_hash, key_prefix, created_by, created_at, last_used_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.ID, key.Name, key.KeyHash, key.KeyPrefix, key.CreatedBy, key.CreatedAt, key.LastUsedAt)
+	if err != nil {
+		return err
+	}
+	if err := insertAPIKeyRoles(ctx, db, key.ID, key.Roles); err != nil {
+		return err
+	}
+	return insertAPIKeyStacks(ctx, db, key.ID, key.StackIDs)
+}
+
+func insertAPIKeyRoles(ctx context.Context, db dbInterface, keyID string, roles []string) error {
+	for _, role := range roles {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO api_key_roles (api_key_id, role) VALUES ($1, $2)`, keyID, role)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertAPIKeyStacks(ctx context.Context, db dbInterface, keyID string, stackIDs []string) error {
+	for _, stackID := range stackIDs {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO api_key_stacks (api_key_id, stack_id) VALUES ($1, $2)`, keyID, stackID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAPIKeyScopes populates the roles and stack scope of an API key.
+func loadAPIKeyScopes(ctx context.Context, db dbInterface, key *domain.APIKey) error {
+	if err := db.SelectContext(ctx, &key.Roles,
+		`SELECT role FROM api_key_roles WHERE api_key_id = $1 ORDER BY role`, key.ID); err != nil {
+		return err
+	}
+	return db.SelectContext(ctx, &key.StackIDs,
+		`SELECT stack_id FROM api_key_stacks WHERE api_key_id = $1 ORDER BY stack_id`, key.ID)
 }
 
 func (s *Store) CreateAPIKey(ctx context.Context, key *domain.APIKey) error {
@@ -142,11 +180,14 @@ func (t *Tx) CreateAPIKey(ctx context.Context, key *domain.APIKey) error {
 func getAPIKeyByHash(ctx context.Context, db dbInterface, keyHash string) (*domain.APIKey, error) {
 	var key domain.APIKey
 	err := db.GetContext(ctx, &key,
-		`SELECT id, name, key_hash, key_prefix, created_at, last_used_at FROM api_keys WHERE key_hash = $1`, keyHash)
+		`SELECT id, name, key_hash, key_prefix, created_by, created_at, last_used_at FROM api_keys WHERE key_hash = $1`, keyHash)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
-	return &key, err
+	if err != nil {
+		return nil, err
+	}
+	return &key, loadAPIKeyScopes(ctx, db, &key)
 }
 
 func (s *Store) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
@@ -160,10 +201,15 @@ func (t *Tx) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKe
 func listAPIKeys(ctx context.Context, db dbInterface) ([]*domain.APIKey, error) {
 	var keys []*domain.APIKey
 	err := db.SelectContext(ctx, &keys,
-		`SELECT id, name, key_hash, key_prefix, created_at, last_used_at FROM api_keys ORDER BY created_at DESC`)
+		`SELECT id, name, key_hash, key_prefix, created_by, created_at, last_used_at FROM api_keys ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
+	for _, k := range keys {
+		if err := loadAPIKeyScopes(ctx, db, k); err != nil {
+			return nil, err
+		}
+	}
 	return keys, nil
 }
 
@@ -229,9 +275,9 @@ func (t *Tx) CountAPIKeys(ctx context.Context) (int, error) {
 
 func createStack(ctx context.Context, db dbInterface, stack *domain.Stack) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO stacks (id, name, description, priority, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		stack.ID, stack.Name, stack.Description, stack.Priority, stack.CreatedAt, stack.UpdatedAt)
+		`INSERT INTO stacks (id, name, description, priority, required_approvals, enabled, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		stack.ID, stack.Name, stack.Description, stack.Priority, stack.RequiredApprovals, !stack.Disabled, stack.CreatedAt, stack.UpdatedAt)
 	return wrapUniqueError(err)
 }
 
@@ -246,7 +292,7 @@ func (t *Tx) CreateStack(ctx context.Context, stack *domain.Stack) error {
 func getStack(ctx context.Context, db dbInterface, id string) (*domain.Stack, error) {
 	var stack domain.Stack
 	err := db.GetContext(ctx, &stack,
-		`SELECT id, name, description, priority, created_at, updated_at FROM stacks WHERE id = $1`, id)
+		`SELECT id, name, description, priority, generation, required_approvals, NOT enabled AS disabled, created_at, updated_at FROM stacks WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -264,7 +310,7 @@ func (t *Tx) GetStack(ctx context.Context, id string) (*domain.Stack, error) {
 func getStackByName(ctx context.Context, db dbInterface, name string) (*domain.Stack, error) {
 	var stack domain.Stack
 	err := db.GetContext(ctx, &stack,
-		`SELECT id, name, description, priority, created_at, updated_at FROM stacks WHERE name = $1`, name)
+		`SELECT id, name, description, priority, generation, required_approvals, NOT enabled AS disabled, created_at, updated_at FROM stacks WHERE name = $1`, name)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -282,7 +328,7 @@ func (t *Tx) GetStackByName(ctx context.Context, name string) (*domain.Stack, er
 func listStacks(ctx context.Context, db dbInterface) ([]*domain.Stack, error) {
 	var stacks []*domain.Stack
 	err := db.SelectContext(ctx, &stacks,
-		`SELECT id, name, description, priority, created_at, updated_at FROM stacks ORDER BY priority, name`)
+		`SELECT id, name, description, priority, generation, required_approvals, NOT enabled AS disabled, created_at, updated_at FROM stacks ORDER BY priority, name`)
 	if err != nil {
 		return nil, err
 	}
@@ -300,8 +346,8 @@ func (t *Tx) ListStacks(ctx context.Context) ([]*domain.Stack, error) {
 func updateStack(ctx context.Context, db dbInterface, stack *domain.Stack) error {
 	stack.UpdatedAt = time.Now()
 	result, err := db.ExecContext(ctx,
-		`UPDATE stacks SET name = $1, description = $2, priority = $3, updated_at = $4 WHERE id = $5`,
-		stack.Name, stack.Description, stack.Priority, stack.UpdatedAt, stack.ID)
+		`UPDATE stacks SET name = $1, description = $2, priority = $3, required_approvals = $4, enabled = $5, updated_at = $6 WHERE id = $7`,
+		stack.Name, stack.Description, stack.Priority, stack.RequiredApprovals, !stack.Disabled, stack.UpdatedAt, stack.ID)
 	if err != nil {
 		return err
 	}
@@ -320,6 +366,39 @@ func (t *Tx) UpdateStack(ctx context.Context, stack *domain.Stack) error {
 	return updateStack(ctx, t.tx, stack)
 }
 
+func incrementStackGeneration(ctx context.Context, db dbInterface, id string, ifGeneration *int64) (int64, error) {
+	var result sql.Result
+	var err error
+	if ifGeneration == nil {
+		result, err = db.ExecContext(ctx,
+			`UPDATE stacks SET generation = generation + 1 WHERE id = $1`, id)
+	} else {
+		result, err = db.ExecContext(ctx,
+			`UPDATE stacks SET generation = generation + 1 WHERE id = $1 AND generation = $2`, id, *ifGeneration)
+	}
+	if err != nil {
+		return 0, err
+	}
+	rows, _ := result.RowsAffected()
+
+	stack, err := getStack(ctx, db, id)
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, &domain.StackGenerationError{StackID: id, Generation: stack.Generation}
+	}
+	return stack.Generation, nil
+}
+
+func (s *Store) IncrementStackGeneration(ctx context.Context, id string, ifGeneration *int64) (int64, error) {
+	return incrementStackGeneration(ctx, s.db, id, ifGeneration)
+}
+
+func (t *Tx) IncrementStackGeneration(ctx context.Context, id string, ifGeneration *int64) (int64, error) {
+	return incrementStackGeneration(ctx, t.tx, id, ifGeneration)
+}
+
 func deleteStack(ctx context.Context, db dbInterface, id string) error {
 	result, err := db.ExecContext(ctx, `DELETE FROM stacks WHERE id = $1`, id)
 	if err != nil {
@@ -346,13 +425,13 @@ func (t *Tx) DeleteStack(ctx context.Context, id string) error {
 
 func createGroup(ctx context.Context, db dbInterface, group *domain.Group) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO groups (id, stack_id, name, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		group.ID, group.StackID, group.Name, group.CreatedAt, group.UpdatedAt)
+		`INSERT INTO groups (id, stack_id, name, description, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		group.ID, group.StackID, group.Name, group.Description, group.CreatedAt, group.UpdatedAt)
 	if err != nil {
 		return wrapUniqueError(err)
 	}
-	return insertGroupMembers(ctx, db, group.ID, group.Members)
+	return insertGroupMembers(ctx, db, group.ID, group.Members, group.MemberExpiresAt)
 }
 
 func (s *Store) CreateGroup(ctx context.Context, group *domain.Group) error {
@@ -363,10 +442,14 @@ func (t *Tx) CreateGroup(ctx context.Context, group *domain.Group) error {
 	return createGroup(ctx, t.tx, group)
 }
 
-func insertGroupMembers(ctx context.Context, db dbInterface, groupID string, members []string) error {
+func insertGroupMembers(ctx context.Context, db dbInterface, groupID string, members []string, expiresAt map[string]time.Time) error {
 	for _, member := range members {
+		var expiry *time.Time
+		if t, ok := expiresAt[member]; ok {
+			expiry = &t
+		}
 		_, err := db.ExecContext(ctx,
-			`INSERT INTO group_members (group_id, member) VALUES ($1, $2)`, groupID, member)
+			`INSERT INTO group_members (group_id, member, expires_at) VALUES ($1, $2, $3)`, groupID, member, expiry)
 		if err != nil {
 			return err
 		}
@@ -374,25 +457,41 @@ func insertGroupMembers(ctx context.Context, db dbInterface, groupID string, mem
 	return nil
 }
 
-func getGroupMembers(ctx context.Context, db dbInterface, groupID string) ([]string, error) {
-	var members []string
-	err := db.SelectContext(ctx, &members,
-		`SELECT member FROM group_members WHERE group_id = $1`, groupID)
-	return members, err
+// loadGroupMembers fills in the members of group and their expiry.
+func loadGroupMembers(ctx context.Context, db dbInterface, group *domain.Group) error {
+	var rows []struct {
+		Member    string     `db:"member"`
+		ExpiresAt *time.Time `db:"expires_at"`
+	}
+	err := db.SelectContext(ctx, &rows,
+		`SELECT member, expires_at FROM group_members WHERE group_id = $1`, group.ID)
+	if err != nil {
+		return err
+	}
+	group.Members, group.MemberExpiresAt = nil, nil
+	for _, row := range rows {
+		group.Members = append(group.Members, row.Member)
+		if row.ExpiresAt != nil {
+			if group.MemberExpiresAt == nil {
+				group.MemberExpiresAt = make(map[string]time.Time)
+			}
+			group.MemberExpiresAt[row.Member] = *row.ExpiresAt
+		}
+	}
+	return nil
 }
 
 func getGroup(ctx context.Context, db dbInterface, stackID, name string) (*domain.Group, error) {
 	var group domain.Group
 	err := db.GetContext(ctx, &group,
-		`SELECT id, stack_id, name, created_at, updated_at FROM groups WHERE stack_id = $1 AND name = $2`, stackID, name)
+		`SELECT id, stack_id, name, description, created_at, updated_at FROM groups WHERE stack_id = $1 AND name = $2`, stackID, name)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
-	group.Members, err = getGroupMembers(ctx, db, group.ID)
-	return &group, err
+	return &group, loadGroupMembers(ctx, db, &group)
 }
 
 func (s *Store) GetGroup(ctx context.Context, stackID, name string) (*domain.Group, error) {
@@ -406,12 +505,12 @@ func (t *Tx) GetGroup(ctx context.Context, stackID, name string) (*domain.Group,
 func listGroups(ctx context.Context, db dbInterface, stackID string) ([]*domain.Group, error) {
 	var groups []*domain.Group
 	err := db.SelectContext(ctx, &groups,
-		`SELECT id, stack_id, name, created_at, updated_at FROM groups WHERE stack_id = $1 ORDER BY name`, stackID)
+		`SELECT id, stack_id, name, description, created_at, updated_at FROM groups WHERE stack_id = $1 ORDER BY name`, stackID)
 	if err != nil {
 		return nil, err
 	}
 	for _, g := range groups {
-		g.Members, _ = getGroupMembers(ctx, db, g.ID)
+		_ = loadGroupMembers(ctx, db, g)
 	}
 	return groups, nil
 }
@@ -427,14 +526,15 @@ func (t *Tx) ListGroups(ctx context.Context, stackID string) ([]*domain.Group, e
 func listAllGroups(ctx context.Context, db dbInterface) ([]*domain.Group, error) {
 	var groups []*domain.Group
 	err := db.SelectContext(ctx, &groups,
-		`SELECT g.id, g.stack_id, g.name, g.created_at, g.updated_at
+		`SELECT g.id, g.stack_id, g.name, g.description, g.created_at, g.updated_at
 		 FROM groups g JOIN stacks s ON g.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, g.name`)
 	if err != nil {
 		return nil, err
 	}
 	for _, g := range groups {
-		g.Members, _ = getGroupMembers(ctx, db, g.ID)
+		_ = loadGroupMembers(ctx, db, g)
 	}
 	return groups, nil
 }
@@ -450,7 +550,7 @@ func (t *Tx) ListAllGroups(ctx context.Context) ([]*domain.Group, error) {
 func updateGroup(ctx context.Context, db dbInterface, group *domain.Group) error {
 	group.UpdatedAt = time.Now()
 	result, err := db.ExecContext(ctx,
-		`UPDATE groups SET updated_at = $1 WHERE id = $2`, group.UpdatedAt, group.ID)
+		`UPDATE groups SET description = $1, updated_at = $2 WHERE id = $3`, group.Description, group.UpdatedAt, group.ID)
 	if err != nil {
 		return err
 	}
@@ -460,7 +560,7 @@ func updateGroup(ctx context.Context, db dbInterface, group *domain.Group) error
 	}
 	// Delete and re-insert members
 	_, _ = db.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = $1`, group.ID)
-	return insertGroupMembers(ctx, db, group.ID, group.Members)
+	return insertGroupMembers(ctx, db, group.ID, group.Members, group.MemberExpiresAt)
 }
 
 func (s *Store) UpdateGroup(ctx context.Context, group *domain.Group) error {
@@ -494,15 +594,14 @@ func (t *Tx) DeleteGroup(ctx context.Context, stackID, name string) error {
 func getGroupByID(ctx context.Context, db dbInterface, id string) (*domain.Group, error) {
 	var group domain.Group
 	err := db.GetContext(ctx, &group,
-		`SELECT id, stack_id, name, created_at, updated_at FROM groups WHERE id = $1`, id)
+		`SELECT id, stack_id, name, description, created_at, updated_at FROM groups WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
-	group.Members, err = getGroupMembers(ctx, db, group.ID)
-	return &group, err
+	return &group, loadGroupMembers(ctx, db, &group)
 }
 
 func (s *Store) GetGroupByID(ctx context.Context, id string) (*domain.Group, error) {
@@ -552,9 +651,9 @@ func (t *Tx) DeleteAllGroupsForStack(ctx context.Context, stackID string) error
 
 func createTagOwner(ctx context.Context, db dbInterface, tagOwner *domain.TagOwner) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO tag_owners (id, stack_id, tag, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		tagOwner.ID, tagOwner.StackID, tagOwner.Tag, tagOwner.CreatedAt, tagOwner.UpdatedAt)
+		`INSERT INTO tag_owners (id, stack_id, tag, description, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		tagOwner.ID, tagOwner.StackID, tagOwner.Tag, tagOwner.Description, tagOwner.CreatedAt, tagOwner.UpdatedAt)
 	if err != nil {
 		return wrapUniqueError(err)
 	}
@@ -590,7 +689,7 @@ func getTagOwnerEntries(ctx context.Context, db dbInterface, tagOwnerID string)
 func getTagOwner(ctx context.Context, db dbInterface, stackID, tag string) (*domain.TagOwner, error) {
 	var tagOwner domain.TagOwner
 	err := db.GetContext(ctx, &tagOwner,
-		`SELECT id, stack_id, tag, created_at, updated_at FROM tag_owners WHERE stack_id = $1 AND tag = $2`, stackID, tag)
+		`SELECT id, stack_id, tag, description, created_at, updated_at FROM tag_owners WHERE stack_id = $1 AND tag = $2`, stackID, tag)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -612,7 +711,7 @@ func (t *Tx) GetTagOwner(ctx context.Context, stackID, tag string) (*domain.TagO
 func listTagOwners(ctx context.Context, db dbInterface, stackID string) ([]*domain.TagOwner, error) {
 	var tagOwners []*domain.TagOwner
 	err := db.SelectContext(ctx, &tagOwners,
-		`SELECT id, stack_id, tag, created_at, updated_at FROM tag_owners WHERE stack_id = $1 ORDER BY tag`, stackID)
+		`SELECT id, stack_id, tag, description, created_at, updated_at FROM tag_owners WHERE stack_id = $1 ORDER BY tag`, stackID)
 	if err != nil {
 		return nil, err
 	}
@@ -633,8 +732,9 @@ func (t *Tx) ListTagOwners(ctx context.Context, stackID string) ([]*domain.TagOw
 func listAllTagOwners(ctx context.Context, db dbInterface) ([]*domain.TagOwner, error) {
 	var tagOwners []*domain.TagOwner
 	err := db.SelectContext(ctx, &tagOwners,
-		`SELECT t.id, t.stack_id, t.tag, t.created_at, t.updated_at
+		`SELECT t.id, t.stack_id, t.tag, t.description, t.created_at, t.updated_at
 		 FROM tag_owners t JOIN stacks s ON t.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, t.tag`)
 	if err != nil {
 		return nil, err
@@ -656,7 +756,7 @@ func (t *Tx) ListAllTagOwners(ctx context.Context) ([]*domain.TagOwner, error) {
 func updateTagOwner(ctx context.Context, db dbInterface, tagOwner *domain.TagOwner) error {
 	tagOwner.UpdatedAt = time.Now()
 	result, err := db.ExecContext(ctx,
-		`UPDATE tag_owners SET updated_at = $1 WHERE id = $2`, tagOwner.UpdatedAt, tagOwner.ID)
+		`UPDATE tag_owners SET description = $1, updated_at = $2 WHERE id = $3`, tagOwner.Description, tagOwner.UpdatedAt, tagOwner.ID)
 	if err != nil {
 		return err
 	}
@@ -699,7 +799,7 @@ func (t *Tx) DeleteTagOwner(ctx context.Context, stackID, tag string) error {
 func getTagOwnerByID(ctx context.Context, db dbInterface, id string) (*domain.TagOwner, error) {
 	var tagOwner domain.TagOwner
 	err := db.GetContext(ctx, &tagOwner,
-		`SELECT id, stack_id, tag, created_at, updated_at FROM tag_owners WHERE id = $1`, id)
+		`SELECT id, stack_id, tag, description, created_at, updated_at FROM tag_owners WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -757,9 +857,9 @@ func (t *Tx) DeleteAllTagOwnersForStack(ctx context.Context, stackID string) err
 
 func createHost(ctx context.Context, db dbInterface, host *domain.Host) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO hosts (id, stack_id, name, address, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		host.ID, host.StackID, host.Name, host.Address, host.CreatedAt, host.UpdatedAt)
+		`INSERT INTO hosts (id, stack_id, name, address, description, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		host.ID, host.StackID, host.Name, host.Address, host.Description, host.CreatedAt, host.UpdatedAt)
 	return wrapUniqueError(err)
 }
 
@@ -774,7 +874,7 @@ func (t *Tx) CreateHost(ctx context.Context, host *domain.Host) error {
 func getHost(ctx context.Context, db dbInterface, stackID, name string) (*domain.Host, error) {
 	var host domain.Host
 	err := db.GetContext(ctx, &host,
-		`SELECT id, stack_id, name, address, created_at, updated_at FROM hosts WHERE stack_id = $1 AND name = $2`, stackID, name)
+		`SELECT id, stack_id, name, address, description, created_at, updated_at FROM hosts WHERE stack_id = $1 AND name = $2`, stackID, name)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -792,7 +892,7 @@ func (t *Tx) GetHost(ctx context.Context, stackID, name string) (*domain.Host, e
 func listHosts(ctx context.Context, db dbInterface, stackID string) ([]*domain.Host, error) {
 	var hosts []*domain.Host
 	err := db.SelectContext(ctx, &hosts,
-		`SELECT id, stack_id, name, address, created_at, updated_at FROM hosts WHERE stack_id = $1 ORDER BY name`, stackID)
+		`SELECT id, stack_id, name, address, description, created_at, updated_at FROM hosts WHERE stack_id = $1 ORDER BY name`, stackID)
 	return hosts, err
 }
 
@@ -807,8 +907,9 @@ func (t *Tx) ListHosts(ctx context.Context, stackID string) ([]*domain.Host, err
 func listAllHosts(ctx context.Context, db dbInterface) ([]*domain.Host, error) {
 	var hosts []*domain.Host
 	err := db.SelectContext(ctx, &hosts,
-		`SELECT h.id, h.stack_id, h.name, h.address, h.created_at, h.updated_at
+		`SELECT h.id, h.stack_id, h.name, h.address, h.description, h.created_at, h.updated_at
 		 FROM hosts h JOIN stacks s ON h.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, h.name`)
 	return hosts, err
 }
@@ -824,8 +925,8 @@ func (t *Tx) ListAllHosts(ctx context.Context) ([]*domain.Host, error) {
 func updateHost(ctx context.Context, db dbInterface, host *domain.Host) error {
 	host.UpdatedAt = time.Now()
 	result, err := db.ExecContext(ctx,
-		`UPDATE hosts SET address = $1, updated_at = $2 WHERE id = $3`,
-		host.Address, host.UpdatedAt, host.ID)
+		`UPDATE hosts SET address = $1, description = $2, updated_at = $3 WHERE id = $4`,
+		host.Address, host.Description, host.UpdatedAt, host.ID)
 	if err != nil {
 		return err
 	}
@@ -867,7 +968,7 @@ func (t *Tx) DeleteHost(ctx context.Context, stackID, name string) error {
 func getHostByID(ctx context.Context, db dbInterface, id string) (*domain.Host, error) {
 	var host domain.Host
 	err := db.GetContext(ctx, &host,
-		`SELECT id, stack_id, name, address, created_at, updated_at FROM hosts WHERE id = $1`, id)
+		`SELECT id, stack_id, name, address, description, created_at, updated_at FROM hosts WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -921,9 +1022,9 @@ func (t *Tx) DeleteAllHostsForStack(ctx context.Context, stackID string) error {
 
 func createACLRule(ctx context.Context, db dbInterface, rule *domain.ACLRule) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO acl_rules (id, stack_id, rule_order, action, protocol, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		rule.ID, rule.StackID, rule.Order, rule.Action, rule.Protocol, rule.CreatedAt, rule.UpdatedAt)
+		`INSERT INTO acl_rules (id, stack_id, rule_order, action, protocol, description, expires_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		rule.ID, rule.StackID, rule.Order, rule.Action, rule.Protocol, rule.Description, rule.ExpiresAt, rule.CreatedAt, rule.UpdatedAt)
 	if err != nil {
 		return wrapUniqueError(err)
 	}
@@ -980,7 +1081,7 @@ func getACLRuleDestinations(ctx context.Context, db dbInterface, ruleID string)
 func getACLRule(ctx context.Context, db dbInterface, id string) (*domain.ACLRule, error) {
 	var rule domain.ACLRule
 	err := db.GetContext(ctx, &rule,
-		`SELECT id, stack_id, rule_order, action, protocol, created_at, updated_at FROM acl_rules WHERE id = $1`, id)
+		`SELECT id, stack_id, rule_order, action, protocol, description, expires_at, created_at, updated_at FROM acl_rules WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -1003,7 +1104,7 @@ func (t *Tx) GetACLRule(ctx context.Context, id string) (*domain.ACLRule, error)
 func listACLRules(ctx context.Context, db dbInterface, stackID string) ([]*domain.ACLRule, error) {
 	var rules []*domain.ACLRule
 	err := db.SelectContext(ctx, &rules,
-		`SELECT id, stack_id, rule_order, action, protocol, created_at, updated_at
+		`SELECT id, stack_id, rule_order, action, protocol, description, expires_at, created_at, updated_at
 		 FROM acl_rules WHERE stack_id = $1 ORDER BY rule_order`, stackID)
 	if err != nil {
 		return nil, err
@@ -1026,8 +1127,9 @@ func (t *Tx) ListACLRules(ctx context.Context, stackID string) ([]*domain.ACLRul
 func listAllACLRules(ctx context.Context, db dbInterface) ([]*domain.ACLRule, error) {
 	var rules []*domain.ACLRule
 	err := db.SelectContext(ctx, &rules,
-		`SELECT a.id, a.stack_id, a.rule_order, a.action, a.protocol, a.created_at, a.updated_at
+		`SELECT a.id, a.stack_id, a.rule_order, a.action, a.protocol, a.description, a.expires_at, a.created_at, a.updated_at
 		 FROM acl_rules a JOIN stacks s ON a.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, a.rule_order`)
 	if err != nil {
 		return nil, err
@@ -1050,8 +1152,8 @@ func (t *Tx) ListAllACLRules(ctx context.Context) ([]*domain.ACLRule, error) {
 func updateACLRule(ctx context.Context, db dbInterface, rule *domain.ACLRule) error {
 	rule.UpdatedAt = time.Now()
 	result, err := db.ExecContext(ctx,
-		`UPDATE acl_rules SET rule_order = $1, action = $2, protocol = $3, updated_at = $4 WHERE id = $5`,
-		rule.Order, rule.Action, rule.Protocol, rule.UpdatedAt, rule.ID)
+		`UPDATE acl_rules SET rule_order = $1, action = $2, protocol = $3, description = $4, expires_at = $5, updated_at = $6 WHERE id = $7`,
+		rule.Order, rule.Action, rule.Protocol, rule.Description, rule.ExpiresAt, rule.UpdatedAt, rule.ID)
 	if err != nil {
 		return err
 	}
@@ -1114,9 +1216,9 @@ func (t *Tx) DeleteAllACLRulesForStack(ctx context.Context, stackID string) erro
 
 func createSSHRule(ctx context.Context, db dbInterface, rule *domain.SSHRule) error {
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO ssh_rules (id, stack_id, rule_order, action, check_period, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		rule.ID, rule.StackID, rule.Order, rule.Action, rule.CheckPeriod, rule.CreatedAt, rule.UpdatedAt)
+		`INSERT INTO ssh_rules (id, stack_id, rule_order, action, check_period, description, expires_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		rule.ID, rule.StackID, rule.Order, rule.Action, rule.CheckPeriod, rule.Description, rule.ExpiresAt, rule.CreatedAt, rule.UpdatedAt)
 	if err != nil {
 		return wrapUniqueError(err)
 	}
@@ -1194,7 +1296,7 @@ func getSSHRuleUsers(ctx context.Context, db dbInterface, ruleID string) ([]stri
 func getSSHRule(ctx context.Context, db dbInterface, id string) (*domain.SSHRule, error) {
 	var rule domain.SSHRule
 	err := db.GetContext(ctx, &rule,
-		`SELECT id, stack_id, rule_order, action, check_period, created_at, updated_at FROM ssh_rules WHERE id = $1`, id)
+		`SELECT id, stack_id, rule_order, action, check_period, description, expires_at, created_at, updated_at FROM ssh_rules WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -1218,7 +1320,7 @@ func (t *Tx) GetSSHRule(ctx context.Context, id string) (*domain.SSHRule, error)
 func listSSHRules(ctx context.Context, db dbInterface, stackID string) ([]*domain.SSHRule, error) {
 	var rules []*domain.SSHRule
 	err := db.SelectContext(ctx, &rules,
-		`SELECT id, stack_id, rule_order, action, check_period, created_at, updated_at
+		`SELECT id, stack_id, rule_order, action, check_period, description, expires_at, created_at, updated_at
 		 FROM ssh_rules WHERE stack_id = $1 ORDER BY rule_order`, stackID)
 	if err != nil {
 		return nil, err
@@ -1242,8 +1344,9 @@ func (t *Tx) ListSSHRules(ctx context.Context, stackID string) ([]*domain.SSHRul
 func listAllSSHRules(ctx context.Context, db dbInterface) ([]*domain.SSHRule, error) {
 	var rules []*domain.SSHRule
 	err := db.SelectContext(ctx, &rules,
-		`SELECT r.id, r.stack_id, r.rule_order, r.action, r.check_period, r.created_at, r.updated_at
+		`SELECT r.id, r.stack_id, r.rule_order, r.action, r.check_period, r.description, r.expires_at, r.created_at, r.updated_at
 		 FROM ssh_rules r JOIN stacks s ON r.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, r.rule_order`)
 	if err != nil {
 		return nil, err
@@ -1267,8 +1370,8 @@ func (t *Tx) ListAllSSHRules(ctx context.Context) ([]*domain.SSHRule, error) {
 func updateSSHRule(ctx context.Context, db dbInterface, rule *domain.SSHRule) error {
 	rule.UpdatedAt = time.Now()
 	result, err := db.ExecContext(ctx,
-		`UPDATE ssh_rules SET rule_order = $1, action = $2, check_period = $3, updated_at = $4 WHERE id = $5`,
-		rule.Order, rule.Action, rule.CheckPeriod, rule.UpdatedAt, rule.ID)
+		`UPDATE ssh_rules SET rule_order = $1, action = $2, check_period = $3, description = $4, expires_at = $5, updated_at = $6 WHERE id = $7`,
+		rule.Order, rule.Action, rule.CheckPeriod, rule.Description, rule.ExpiresAt, rule.UpdatedAt, rule.ID)
 	if err != nil {
 		return err
 	}
@@ -1336,9 +1439,9 @@ func (t *Tx) DeleteAllSSHRulesForStack(ctx context.Context, stackID string) erro
 func createGrant(ctx context.Context, db dbInterface, grant *domain.Grant) error {
 	appJSON, _ := json.Marshal(grant.App)
 	_, err := db.ExecContext(ctx,
-		`INSERT INTO grants (id, stack_id, rule_order, app_json, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		grant.ID, grant.StackID, grant.Order, string(appJSON), grant.CreatedAt, grant.UpdatedAt)
+		`INSERT INTO grants (id, stack_id, rule_order, app_json, description, expires_at, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		grant.ID, grant.StackID, grant.Order, string(appJSON), grant.Description, grant.ExpiresAt, grant.CreatedAt, grant.UpdatedAt)
 	if err != nil {
 		return wrapUniqueError(err)
 	}
@@ -1348,7 +1451,10 @@ func createGrant(ctx context.Context, db dbInterface, grant *domain.Grant) error
 	if err := insertGrantDestinations(ctx, db, grant.ID, grant.Destinations); err != nil {
 		return err
 	}
-	return insertGrantIPs(ctx, db, grant.ID, grant.IP)
+	if err := insertGrantIPs(ctx, db, grant.ID, grant.IP); err != nil {
+		return err
+	}
+	return insertGrantSrcPostures(ctx, db, grant.ID, grant.SrcPosture)
 }
 
 func (s *Store) CreateGrant(ctx context.Context, grant *domain.Grant) error {
@@ -1392,6 +1498,17 @@ func insertGrantIPs(ctx context.Context, db dbInterface, grantID string, ips []s
 	return nil
 }
 
+func insertGrantSrcPostures(ctx context.Context, db dbInterface, grantID string, postures []string) error {
+	for i, posture := range postures {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO grant_src_postures (grant_id, posture, seq) VALUES ($1, $2, $3)`, grantID, posture, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getGrantSources(ctx context.Context, db dbInterface, grantID string) ([]string, error) {
 	var sources []string
 	err := db.SelectContext(ctx, &sources,
@@ -1413,22 +1530,33 @@ func getGrantIPs(ctx context.Context, db dbInterface, grantID string) ([]string,
 	return ips, err
 }
 
+func getGrantSrcPostures(ctx context.Context, db dbInterface, grantID string) ([]string, error) {
+	var postures []string
+	err := db.SelectContext(ctx, &postures,
+		`SELECT posture FROM grant_src_postures WHERE grant_id = $1 ORDER BY seq`, grantID)
+	return postures, err
+}
+
 type grantRow struct {
-	ID        string    `db:"id"`
-	StackID   string    `db:"stack_id"`
-	Order     int       `db:"rule_order"`
-	AppJSON   *string   `db:"app_json"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	ID          string     `db:"id"`
+	StackID     string     `db:"stack_id"`
+	Order       int        `db:"rule_order"`
+	AppJSON     *string    `db:"app_json"`
+	Description string     `db:"description"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
 }
 
 func rowToGrant(ctx context.Context, db dbInterface, row *grantRow) (*domain.Grant, error) {
 	grant := &domain.Grant{
-		ID:        row.ID,
-		StackID:   row.StackID,
-		Order:     row.Order,
-		CreatedAt: row.CreatedAt,
-		UpdatedAt: row.UpdatedAt,
+		ID:          row.ID,
+		StackID:     row.StackID,
+		Order:       row.Order,
+		Description: row.Description,
+		ExpiresAt:   row.ExpiresAt,
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
 	}
 	if row.AppJSON != nil && *row.AppJSON != "" {
 		_ = json.Unmarshal([]byte(*row.AppJSON), &grant.App)
@@ -1436,13 +1564,14 @@ func rowToGrant(ctx context.Context, db dbInterface, row *grantRow) (*domain.Gra
 	grant.Sources, _ = getGrantSources(ctx, db, grant.ID)
 	grant.Destinations, _ = getGrantDestinations(ctx, db, grant.ID)
 	grant.IP, _ = getGrantIPs(ctx, db, grant.ID)
+	grant.SrcPosture, _ = getGrantSrcPostures(ctx, db, grant.ID)
 	return grant, nil
 }
 
 func getGrant(ctx context.Context, db dbInterface, id string) (*domain.Grant, error) {
 	var row grantRow
 	err := db.GetContext(ctx, &row,
-		`SELECT id, stack_id, rule_order, app_json, created_at, updated_at FROM grants WHERE id = $1`, id)
+		`SELECT id, stack_id, rule_order, app_json, description, expires_at, created_at, updated_at FROM grants WHERE id = $1`, id)
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
@@ -1463,7 +1592,7 @@ func (t *Tx) GetGrant(ctx context.Context, id string) (*domain.Grant, error) {
 func listGrants(ctx context.Context, db dbInterface, stackID string) ([]*domain.Grant, error) {
 	var rows []grantRow
 	err := db.SelectContext(ctx, &rows,
-		`SELECT id, stack_id, rule_order, app_json, created_at, updated_at
+		`SELECT id, stack_id, rule_order, app_json, description, expires_at, created_at, updated_at
 		 FROM grants WHERE stack_id = $1 ORDER BY rule_order`, stackID)
 	if err != nil {
 		return nil, err
@@ -1487,8 +1616,9 @@ func (t *Tx) ListGrants(ctx context.Context, stackID string) ([]*domain.Grant, e
 func listAllGrants(ctx context.Context, db dbInterface) ([]*domain.Grant, error) {
 	var rows []grantRow
 	err := db.SelectContext(ctx, &rows,
-		`SELECT g.id, g.stack_id, g.rule_order, g.app_json, g.created_at, g.updated_at
+		`SELECT g.id, g.stack_id, g.rule_order, g.app_json, g.description, g.expires_at, g.created_at, g.updated_at
 		 FROM grants g JOIN stacks s ON g.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, g.rule_order`)
 	if err != nil {
 		return nil, err
@@ -1513,8 +1643,8 @@ func updateGrant(ctx context.Context, db dbInterface, grant *domain.Grant) error
 	grant.UpdatedAt = time.Now()
 	appJSON, _ := json.Marshal(grant.App)
 	result, err := db.ExecContext(ctx,
-		`UPDATE grants SET rule_order = $1, app_json = $2, updated_at = $3 WHERE id = $4`,
-		grant.Order, string(appJSON), grant.UpdatedAt, grant.ID)
+		`UPDATE grants SET rule_order = $1, app_json = $2, description = $3, expires_at = $4, updated_at = $5 WHERE id = $6`,
+		grant.Order, string(appJSON), grant.Description, grant.ExpiresAt, grant.UpdatedAt, grant.ID)
 	if err != nil {
 		return err
 	}
@@ -1525,13 +1655,17 @@ func updateGrant(ctx context.Context, db dbInterface, grant *domain.Grant) error
 	_, _ = db.ExecContext(ctx, `DELETE FROM grant_sources WHERE grant_id = $1`, grant.ID)
 	_, _ = db.ExecContext(ctx, `DELETE FROM grant_destinations WHERE grant_id = $1`, grant.ID)
 	_, _ = db.ExecContext(ctx, `DELETE FROM grant_ips WHERE grant_id = $1`, grant.ID)
+	_, _ = db.ExecContext(ctx, `DELETE FROM grant_src_postures WHERE grant_id = $1`, grant.ID)
 	if err := insertGrantSources(ctx, db, grant.ID, grant.Sources); err != nil {
 		return err
 	}
 	if err := insertGrantDestinations(ctx, db, grant.ID, grant.Destinations); err != nil {
 		return err
 	}
-	return insertGrantIPs(ctx, db, grant.ID, grant.IP)
+	if err := insertGrantIPs(ctx, db, grant.ID, grant.IP); err != nil {
+		return err
+	}
+	return insertGrantSrcPostures(ctx, db, grant.ID, grant.SrcPosture)
 }
 
 func (s *Store) UpdateGrant(ctx context.Context, grant *domain.Grant) error {
@@ -1665,6 +1799,7 @@ func listAllAutoApprovers(ctx context.Context, db dbInterface) ([]*domain.AutoAp
 	err := db.SelectContext(ctx, &aas,
 		`SELECT a.id, a.stack_id, a.type, a.match, a.created_at, a.updated_at
 		 FROM auto_approvers a JOIN stacks s ON a.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, a.type, a.match`)
 	if err != nil {
 		return nil, err
@@ -1877,6 +2012,7 @@ func listAllNodeAttrs(ctx context.Context, db dbInterface) ([]*domain.NodeAttr,
 	err := db.SelectContext(ctx, &rows,
 		`SELECT n.id, n.stack_id, n.rule_order, n.app_json, n.created_at, n.updated_at
 		 FROM node_attrs n JOIN stacks s ON n.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, n.rule_order`)
 	if err != nil {
 		return nil, err
@@ -2048,6 +2184,7 @@ func listAllPostures(ctx context.Context, db dbInterface) ([]*domain.Posture, er
 	err := db.SelectContext(ctx, &postures,
 		`SELECT p.id, p.stack_id, p.name, p.created_at, p.updated_at
 		 FROM postures p JOIN stacks s ON p.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, p.name`)
 	if err != nil {
 		return nil, err
@@ -2253,6 +2390,7 @@ func listAllIPSets(ctx context.Context, db dbInterface) ([]*domain.IPSet, error)
 	err := db.SelectContext(ctx, &ipsets,
 		`SELECT i.id, i.stack_id, i.name, i.created_at, i.updated_at
 		 FROM ip_sets i JOIN stacks s ON i.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, i.name`)
 	if err != nil {
 		return nil, err
@@ -2482,6 +2620,7 @@ func listAllACLTests(ctx context.Context, db dbInterface) ([]*domain.ACLTest, er
 	err := db.SelectContext(ctx, &tests,
 		`SELECT t.id, t.stack_id, t.rule_order, t.src, t.created_at, t.updated_at
 		 FROM acl_tests t JOIN stacks s ON t.stack_id = s.id
+		 WHERE s.enabled
 		 ORDER BY s.priority, t.rule_order`)
 	if err != nil {
 		return nil, err
@@ -2621,6 +2760,25 @@ func (t *Tx) GetLatestPolicyVersion(ctx context.Context) (*domain.PolicyVersion,
 	return getLatestPolicyVersion(ctx, t.tx)
 }
 
+func getLastSuccessfulPolicyVersion(ctx context.Context, db dbInterface) (*domain.PolicyVersion, error) {
+	var version domain.PolicyVersion
+	err := db.GetContext(ctx, &version,
+		`SELECT id, version_number, rendered_policy, tailscale_etag, push_status, push_error, created_at, pushed_at
+		 FROM policy_versions WHERE push_status = 'success' ORDER BY version_number DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return &version, err
+}
+
+func (s *Store) GetLastSuccessfulPolicyVersion(ctx context.Context) (*domain.PolicyVersion, error) {
+	return getLastSuccessfulPolicyVersion(ctx, s.db)
+}
+
+func (t *Tx) GetLastSuccessfulPolicyVersion(ctx context.Context) (*domain.PolicyVersion, error) {
+	return getLastSuccessfulPolicyVersion(ctx, t.tx)
+}
+
 func listPolicyVersions(ctx context.Context, db dbInterface, limit, offset int) ([]*domain.PolicyVersion, error) {
 	var versions []*domain.PolicyVersion
 	err := db.SelectContext(ctx, &versions,
@@ -2658,3 +2816,899 @@ func (s *Store) UpdatePolicyVersion(ctx context.Context, version *domain.PolicyV
 func (t *Tx) UpdatePolicyVersion(ctx context.Context, version *domain.PolicyVersion) error {
 	return updatePolicyVersion(ctx, t.tx, version)
 }
+
+// ============================================
+// Claims
+// ============================================
+
+func createClaim(ctx context.Context, db dbInterface, claim *domain.Claim) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO claims (id, stack_id, type, name, created_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		claim.ID, claim.StackID, claim.Type, claim.Name, claim.CreatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateClaim(ctx context.Context, claim *domain.Claim) error {
+	return createClaim(ctx, s.db, claim)
+}
+
+func (t *Tx) CreateClaim(ctx context.Context, claim *domain.Claim) error {
+	return createClaim(ctx, t.tx, claim)
+}
+
+func getClaim(ctx context.Context, db dbInterface, claimType, name string) (*domain.Claim, error) {
+	var claim domain.Claim
+	err := db.GetContext(ctx, &claim,
+		`SELECT id, stack_id, type, name, created_at FROM claims WHERE type = $1 AND name = $2`, claimType, name)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return &claim, err
+}
+
+func (s *Store) GetClaim(ctx context.Context, claimType, name string) (*domain.Claim, error) {
+	return getClaim(ctx, s.db, claimType, name)
+}
+
+func (t *Tx) GetClaim(ctx context.Context, claimType, name string) (*domain.Claim, error) {
+	return getClaim(ctx, t.tx, claimType, name)
+}
+
+func getClaimByID(ctx context.Context, db dbInterface, id string) (*domain.Claim, error) {
+	var claim domain.Claim
+	err := db.GetContext(ctx, &claim,
+		`SELECT id, stack_id, type, name, created_at FROM claims WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return &claim, err
+}
+
+func (s *Store) GetClaimByID(ctx context.Context, id string) (*domain.Claim, error) {
+	return getClaimByID(ctx, s.db, id)
+}
+
+func (t *Tx) GetClaimByID(ctx context.Context, id string) (*domain.Claim, error) {
+	return getClaimByID(ctx, t.tx, id)
+}
+
+func listClaims(ctx context.Context, db dbInterface, stackID string) ([]*domain.Claim, error) {
+	var claims []*domain.Claim
+	err := db.SelectContext(ctx, &claims,
+		`SELECT id, stack_id, type, name, created_at FROM claims WHERE stack_id = $1 ORDER BY type, name`, stackID)
+	return claims, err
+}
+
+func (s *Store) ListClaims(ctx context.Context, stackID string) ([]*domain.Claim, error) {
+	return listClaims(ctx, s.db, stackID)
+}
+
+func (t *Tx) ListClaims(ctx context.Context, stackID string) ([]*domain.Claim, error) {
+	return listClaims(ctx, t.tx, stackID)
+}
+
+func deleteClaim(ctx context.Context, db dbInterface, id string) error {
+	result, err := db.ExecContext(ctx, `DELETE FROM claims WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeleteClaim(ctx context.Context, id string) error {
+	return deleteClaim(ctx, s.db, id)
+}
+
+func (t *Tx) DeleteClaim(ctx context.Context, id string) error {
+	return deleteClaim(ctx, t.tx, id)
+}
+
+// ============================================
+// Access Approvers
+// ============================================
+
+func createAccessApprover(ctx context.Context, db dbInterface, approver *domain.AccessApprover) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO access_approvers (id, stack_id, group_name, approver, created_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		approver.ID, approver.StackID, approver.Group, approver.Approver, approver.CreatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateAccessApprover(ctx context.Context, approver *domain.AccessApprover) error {
+	return createAccessApprover(ctx, s.db, approver)
+}
+
+func (t *Tx) CreateAccessApprover(ctx context.Context, approver *domain.AccessApprover) error {
+	return createAccessApprover(ctx, t.tx, approver)
+}
+
+func getAccessApprover(ctx context.Context, db dbInterface, id string) (*domain.AccessApprover, error) {
+	var approver domain.AccessApprover
+	err := db.GetContext(ctx, &approver,
+		`SELECT id, stack_id, group_name, approver, created_at FROM access_approvers WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	return &approver, err
+}
+
+func (s *Store) GetAccessApprover(ctx context.Context, id string) (*domain.AccessApprover, error) {
+	return getAccessApprover(ctx, s.db, id)
+}
+
+func (t *Tx) GetAccessApprover(ctx context.Context, id string) (*domain.AccessApprover, error) {
+	return getAccessApprover(ctx, t.tx, id)
+}
+
+func listAccessApprovers(ctx context.Context, db dbInterface, stackID string) ([]*domain.AccessApprover, error) {
+	var approvers []*domain.AccessApprover
+	err := db.SelectContext(ctx, &approvers,
+		`SELECT id, stack_id, group_name, approver, created_at FROM access_approvers
+		 WHERE stack_id = $1 ORDER BY group_name, approver`, stackID)
+	return approvers, err
+}
+
+func (s *Store) ListAccessApprovers(ctx context.Context, stackID string) ([]*domain.AccessApprover, error) {
+	return listAccessApprovers(ctx, s.db, stackID)
+}
+
+func (t *Tx) ListAccessApprovers(ctx context.Context, stackID string) ([]*domain.AccessApprover, error) {
+	return listAccessApprovers(ctx, t.tx, stackID)
+}
+
+func deleteAccessApprover(ctx context.Context, db dbInterface, id string) error {
+	result, err := db.ExecContext(ctx, `DELETE FROM access_approvers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeleteAccessApprover(ctx context.Context, id string) error {
+	return deleteAccessApprover(ctx, s.db, id)
+}
+
+func (t *Tx) DeleteAccessApprover(ctx context.Context, id string) error {
+	return deleteAccessApprover(ctx, t.tx, id)
+}
+
+// ============================================
+// Access Requests
+// ============================================
+
+const accessRequestColumns = `id, stack_id, type, target, member, reason, duration, status, requested_by, requester_id,
+		 decided_by, decided_at, expires_at, resource_id, created_at, updated_at`
+
+func createAccessRequest(ctx context.Context, db dbInterface, req *domain.AccessRequest) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO access_requests (`+accessRequestColumns+`)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		req.ID, req.StackID, req.Type, req.Target, req.Member, req.Reason, req.Duration, req.Status,
+		req.RequestedBy, req.RequesterID, req.DecidedBy, req.DecidedAt, req.ExpiresAt, req.ResourceID,
+		req.CreatedAt, req.UpdatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	return createAccessRequest(ctx, s.db, req)
+}
+
+func (t *Tx) CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	return createAccessRequest(ctx, t.tx, req)
+}
+
+func getAccessRequest(ctx context.Context, db dbInterface, id string) (*domain.AccessRequest, error) {
+	var req domain.AccessRequest
+	err := db.GetContext(ctx, &req,
+		`SELECT `+accessRequestColumns+` FROM access_requests WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *Store) GetAccessRequest(ctx context.Context, id string) (*domain.AccessRequest, error) {
+	return getAccessRequest(ctx, s.db, id)
+}
+
+func (t *Tx) GetAccessRequest(ctx context.Context, id string) (*domain.AccessRequest, error) {
+	return getAccessRequest(ctx, t.tx, id)
+}
+
+func listAccessRequests(ctx context.Context, db dbInterface, filter domain.AccessRequestFilter) ([]*domain.AccessRequest, error) {
+	var conds []string
+	var args []any
+
+	if len(filter.StackIDs) > 0 {
+		placeholders := make([]string, len(filter.StackIDs))
+		for i, id := range filter.StackIDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conds = append(conds, "stack_id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	query := `SELECT ` + accessRequestColumns + ` FROM access_requests`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id"
+
+	requests := make([]*domain.AccessRequest, 0)
+	err := db.SelectContext(ctx, &requests, query, args...)
+	return requests, err
+}
+
+func (s *Store) ListAccessRequests(ctx context.Context, filter domain.AccessRequestFilter) ([]*domain.AccessRequest, error) {
+	return listAccessRequests(ctx, s.db, filter)
+}
+
+func (t *Tx) ListAccessRequests(ctx context.Context, filter domain.AccessRequestFilter) ([]*domain.AccessRequest, error) {
+	return listAccessRequests(ctx, t.tx, filter)
+}
+
+func updateAccessRequest(ctx context.Context, db dbInterface, req *domain.AccessRequest) error {
+	result, err := db.ExecContext(ctx,
+		`UPDATE access_requests SET status = $1, decided_by = $2, decided_at = $3, expires_at = $4, resource_id = $5, updated_at = $6
+		 WHERE id = $7`,
+		req.Status, req.DecidedBy, req.DecidedAt, req.ExpiresAt, req.ResourceID, req.UpdatedAt, req.ID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UpdateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	return updateAccessRequest(ctx, s.db, req)
+}
+
+func (t *Tx) UpdateAccessRequest(ctx context.Context, req *domain.AccessRequest) error {
+	return updateAccessRequest(ctx, t.tx, req)
+}
+
+func createAccessRequestEvent(ctx context.Context, db dbInterface, event *domain.AccessRequestEvent) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO access_request_events (id, request_id, action, actor_type, actor_id, actor_name, comment, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		event.ID, event.RequestID, event.Action, event.ActorType, event.ActorID, event.ActorName,
+		event.Comment, event.CreatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateAccessRequestEvent(ctx context.Context, event *domain.AccessRequestEvent) error {
+	return createAccessRequestEvent(ctx, s.db, event)
+}
+
+func (t *Tx) CreateAccessRequestEvent(ctx context.Context, event *domain.AccessRequestEvent) error {
+	return createAccessRequestEvent(ctx, t.tx, event)
+}
+
+func listAccessRequestEvents(ctx context.Context, db dbInterface, requestID string) ([]*domain.AccessRequestEvent, error) {
+	events := make([]*domain.AccessRequestEvent, 0)
+	err := db.SelectContext(ctx, &events,
+		`SELECT id, request_id, action, actor_type, actor_id, actor_name, comment, created_at
+		 FROM access_request_events WHERE request_id = $1 ORDER BY created_at, id`, requestID)
+	return events, err
+}
+
+func (s *Store) ListAccessRequestEvents(ctx context.Context, requestID string) ([]*domain.AccessRequestEvent, error) {
+	return listAccessRequestEvents(ctx, s.db, requestID)
+}
+
+func (t *Tx) ListAccessRequestEvents(ctx context.Context, requestID string) ([]*domain.AccessRequestEvent, error) {
+	return listAccessRequestEvents(ctx, t.tx, requestID)
+}
+
+// ============================================
+// Change Sets
+// ============================================
+
+type changeSetRow struct {
+	domain.ChangeSet
+	StateJSON string `db:"state_json"`
+}
+
+func (row changeSetRow) toDomain() (*domain.ChangeSet, error) {
+	change := row.ChangeSet
+	if err := json.Unmarshal([]byte(row.StateJSON), &change.State); err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+const changeSetColumns = `id, stack_id, description, state_json, base_generation, status,
+		 author_type, author_id, author_name, closed_at, created_at, updated_at`
+
+func createChangeSet(ctx context.Context, db dbInterface, change *domain.ChangeSet) error {
+	stateJSON, err := json.Marshal(change.State)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO change_sets (`+changeSetColumns+`)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		change.ID, change.StackID, change.Description, string(stateJSON), change.BaseGeneration, change.Status,
+		change.AuthorType, change.AuthorID, change.AuthorName, change.ClosedAt, change.CreatedAt, change.UpdatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	return createChangeSet(ctx, s.db, change)
+}
+
+func (t *Tx) CreateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	return createChangeSet(ctx, t.tx, change)
+}
+
+func getChangeSet(ctx context.Context, db dbInterface, id string) (*domain.ChangeSet, error) {
+	var row changeSetRow
+	err := db.GetContext(ctx, &row,
+		`SELECT `+changeSetColumns+` FROM change_sets WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toDomain()
+}
+
+func (s *Store) GetChangeSet(ctx context.Context, id string) (*domain.ChangeSet, error) {
+	return getChangeSet(ctx, s.db, id)
+}
+
+func (t *Tx) GetChangeSet(ctx context.Context, id string) (*domain.ChangeSet, error) {
+	return getChangeSet(ctx, t.tx, id)
+}
+
+func listChangeSets(ctx context.Context, db dbInterface, filter domain.ChangeSetFilter) ([]*domain.ChangeSet, error) {
+	var conds []string
+	var args []any
+
+	if len(filter.StackIDs) > 0 {
+		placeholders := make([]string, len(filter.StackIDs))
+		for i, id := range filter.StackIDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conds = append(conds, "stack_id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	query := `SELECT ` + changeSetColumns + ` FROM change_sets`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id"
+
+	var rows []changeSetRow
+	if err := db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	changes := make([]*domain.ChangeSet, 0, len(rows))
+	for _, row := range rows {
+		change, err := row.toDomain()
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func (s *Store) ListChangeSets(ctx context.Context, filter domain.ChangeSetFilter) ([]*domain.ChangeSet, error) {
+	return listChangeSets(ctx, s.db, filter)
+}
+
+func (t *Tx) ListChangeSets(ctx context.Context, filter domain.ChangeSetFilter) ([]*domain.ChangeSet, error) {
+	return listChangeSets(ctx, t.tx, filter)
+}
+
+func updateChangeSet(ctx context.Context, db dbInterface, change *domain.ChangeSet) error {
+	stateJSON, err := json.Marshal(change.State)
+	if err != nil {
+		return err
+	}
+	result, err := db.ExecContext(ctx,
+		`UPDATE change_sets SET description = $1, state_json = $2, status = $3, closed_at = $4, updated_at = $5
+		 WHERE id = $6`,
+		change.Description, string(stateJSON), change.Status, change.ClosedAt, change.UpdatedAt, change.ID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UpdateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	return updateChangeSet(ctx, s.db, change)
+}
+
+func (t *Tx) UpdateChangeSet(ctx context.Context, change *domain.ChangeSet) error {
+	return updateChangeSet(ctx, t.tx, change)
+}
+
+func createChangeReview(ctx context.Context, db dbInterface, review *domain.ChangeReview) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO change_reviews (id, change_id, action, actor_type, actor_id, actor_name, comment, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		review.ID, review.ChangeID, review.Action, review.ActorType, review.ActorID, review.ActorName,
+		review.Comment, review.CreatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateChangeReview(ctx context.Context, review *domain.ChangeReview) error {
+	return createChangeReview(ctx, s.db, review)
+}
+
+func (t *Tx) CreateChangeReview(ctx context.Context, review *domain.ChangeReview) error {
+	return createChangeReview(ctx, t.tx, review)
+}
+
+func listChangeReviews(ctx context.Context, db dbInterface, changeID string) ([]*domain.ChangeReview, error) {
+	reviews := make([]*domain.ChangeReview, 0)
+	err := db.SelectContext(ctx, &reviews,
+		`SELECT id, change_id, action, actor_type, actor_id, actor_name, comment, created_at
+		 FROM change_reviews WHERE change_id = $1 ORDER BY created_at, id`, changeID)
+	return reviews, err
+}
+
+func (s *Store) ListChangeReviews(ctx context.Context, changeID string) ([]*domain.ChangeReview, error) {
+	return listChangeReviews(ctx, s.db, changeID)
+}
+
+func (t *Tx) ListChangeReviews(ctx context.Context, changeID string) ([]*domain.ChangeReview, error) {
+	return listChangeReviews(ctx, t.tx, changeID)
+}
+
+// ============================================
+// Guardrails
+// ============================================
+
+type guardrailRow struct {
+	domain.Guardrail
+	TargetsJSON string `db:"targets_json"`
+	MatchJSON   string `db:"match_json"`
+}
+
+func (row guardrailRow) toDomain() (*domain.Guardrail, error) {
+	guardrail := row.Guardrail
+	if err := json.Unmarshal([]byte(row.TargetsJSON), &guardrail.Targets); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(row.MatchJSON), &guardrail.Match); err != nil {
+		return nil, err
+	}
+	return &guardrail, nil
+}
+
+// marshalGuardrail returns the JSON forms of the guardrail's targets and match.
+func marshalGuardrail(guardrail *domain.Guardrail) (string, string, error) {
+	targets := guardrail.Targets
+	if targets == nil {
+		targets = []string{}
+	}
+	targetsJSON, err := json.Marshal(targets)
+	if err != nil {
+		return "", "", err
+	}
+	matchJSON, err := json.Marshal(guardrail.Match)
+	if err != nil {
+		return "", "", err
+	}
+	return string(targetsJSON), string(matchJSON), nil
+}
+
+const guardrailColumns = `id, name, description, targets_json, match_json, source, created_at, updated_at`
+
+func createGuardrail(ctx context.Context, db dbInterface, guardrail *domain.Guardrail) error {
+	targetsJSON, matchJSON, err := marshalGuardrail(guardrail)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO guardrails (`+guardrailColumns+`)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		guardrail.ID, guardrail.Name, guardrail.Description, targetsJSON, matchJSON,
+		guardrail.Source, guardrail.CreatedAt, guardrail.UpdatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	return createGuardrail(ctx, s.db, guardrail)
+}
+
+func (t *Tx) CreateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	return createGuardrail(ctx, t.tx, guardrail)
+}
+
+func getGuardrail(ctx context.Context, db dbInterface, id string) (*domain.Guardrail, error) {
+	var row guardrailRow
+	err := db.GetContext(ctx, &row,
+		`SELECT `+guardrailColumns+` FROM guardrails WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toDomain()
+}
+
+func (s *Store) GetGuardrail(ctx context.Context, id string) (*domain.Guardrail, error) {
+	return getGuardrail(ctx, s.db, id)
+}
+
+func (t *Tx) GetGuardrail(ctx context.Context, id string) (*domain.Guardrail, error) {
+	return getGuardrail(ctx, t.tx, id)
+}
+
+func listGuardrails(ctx context.Context, db dbInterface) ([]*domain.Guardrail, error) {
+	var rows []guardrailRow
+	if err := db.SelectContext(ctx, &rows,
+		`SELECT `+guardrailColumns+` FROM guardrails ORDER BY name`); err != nil {
+		return nil, err
+	}
+	guardrails := make([]*domain.Guardrail, 0, len(rows))
+	for _, row := range rows {
+		guardrail, err := row.toDomain()
+		if err != nil {
+			return nil, err
+		}
+		guardrails = append(guardrails, guardrail)
+	}
+	return guardrails, nil
+}
+
+func (s *Store) ListGuardrails(ctx context.Context) ([]*domain.Guardrail, error) {
+	return listGuardrails(ctx, s.db)
+}
+
+func (t *Tx) ListGuardrails(ctx context.Context) ([]*domain.Guardrail, error) {
+	return listGuardrails(ctx, t.tx)
+}
+
+func updateGuardrail(ctx context.Context, db dbInterface, guardrail *domain.Guardrail) error {
+	targetsJSON, matchJSON, err := marshalGuardrail(guardrail)
+	if err != nil {
+		return err
+	}
+	result, err := db.ExecContext(ctx,
+		`UPDATE guardrails SET name = $1, description = $2, targets_json = $3, match_json = $4, updated_at = $5
+		 WHERE id = $6`,
+		guardrail.Name, guardrail.Description, targetsJSON, matchJSON, guardrail.UpdatedAt, guardrail.ID)
+	if err != nil {
+		return wrapUniqueError(err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UpdateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	return updateGuardrail(ctx, s.db, guardrail)
+}
+
+func (t *Tx) UpdateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error {
+	return updateGuardrail(ctx, t.tx, guardrail)
+}
+
+func deleteGuardrail(ctx context.Context, db dbInterface, id string) error {
+	result, err := db.ExecContext(ctx, `DELETE FROM guardrails WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeleteGuardrail(ctx context.Context, id string) error {
+	return deleteGuardrail(ctx, s.db, id)
+}
+
+func (t *Tx) DeleteGuardrail(ctx context.Context, id string) error {
+	return deleteGuardrail(ctx, t.tx, id)
+}
+
+// ============================================
+// Drift Events
+// ============================================
+
+type driftEventRow struct {
+	ID            string     `db:"id"`
+	VersionID     string     `db:"version_id"`
+	VersionNumber int        `db:"version_number"`
+	ExpectedETag  string     `db:"expected_etag"`
+	LiveETag      string     `db:"live_etag"`
+	DiffJSON      *string    `db:"diff_json"`
+	DetectedAt    time.Time  `db:"detected_at"`
+	ResolvedAt    *time.Time `db:"resolved_at"`
+	Resolution    string     `db:"resolution"`
+}
+
+func (row driftEventRow) toDomain() (*domain.DriftEvent, error) {
+	event := &domain.DriftEvent{
+		ID:            row.ID,
+		VersionID:     row.VersionID,
+		VersionNumber: row.VersionNumber,
+		ExpectedETag:  row.ExpectedETag,
+		LiveETag:      row.LiveETag,
+		DetectedAt:    row.DetectedAt,
+		ResolvedAt:    row.ResolvedAt,
+		Resolution:    row.Resolution,
+	}
+	if row.DiffJSON != nil {
+		if err := json.Unmarshal([]byte(*row.DiffJSON), &event.Diff); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+func marshalDriftDiff(event *domain.DriftEvent) (*string, error) {
+	if event.Diff == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(event.Diff)
+	if err != nil {
+		return nil, err
+	}
+	return nullableJSON(data), nil
+}
+
+func createDriftEvent(ctx context.Context, db dbInterface, event *domain.DriftEvent) error {
+	diffJSON, err := marshalDriftDiff(event)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO drift_events (id, version_id, version_number, expected_etag, live_etag, diff_json, detected_at, resolved_at, resolution)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		event.ID, event.VersionID, event.VersionNumber, event.ExpectedETag, event.LiveETag,
+		diffJSON, event.DetectedAt, event.ResolvedAt, event.Resolution)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	return createDriftEvent(ctx, s.db, event)
+}
+
+func (t *Tx) CreateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	return createDriftEvent(ctx, t.tx, event)
+}
+
+func getOpenDriftEvent(ctx context.Context, db dbInterface) (*domain.DriftEvent, error) {
+	var row driftEventRow
+	err := db.GetContext(ctx, &row,
+		`SELECT id, version_id, version_number, expected_etag, live_etag, diff_json, detected_at, resolved_at, resolution
+		 FROM drift_events WHERE resolved_at IS NULL ORDER BY detected_at DESC LIMIT 1`)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toDomain()
+}
+
+func (s *Store) GetOpenDriftEvent(ctx context.Context) (*domain.DriftEvent, error) {
+	return getOpenDriftEvent(ctx, s.db)
+}
+
+func (t *Tx) GetOpenDriftEvent(ctx context.Context) (*domain.DriftEvent, error) {
+	return getOpenDriftEvent(ctx, t.tx)
+}
+
+func listDriftEvents(ctx context.Context, db dbInterface, limit, offset int) ([]*domain.DriftEvent, error) {
+	var rows []driftEventRow
+	err := db.SelectContext(ctx, &rows,
+		`SELECT id, version_id, version_number, expected_etag, live_etag, diff_json, detected_at, resolved_at, resolution
+		 FROM drift_events ORDER BY detected_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*domain.DriftEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := row.toDomain()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *Store) ListDriftEvents(ctx context.Context, limit, offset int) ([]*domain.DriftEvent, error) {
+	return listDriftEvents(ctx, s.db, limit, offset)
+}
+
+func (t *Tx) ListDriftEvents(ctx context.Context, limit, offset int) ([]*domain.DriftEvent, error) {
+	return listDriftEvents(ctx, t.tx, limit, offset)
+}
+
+func updateDriftEvent(ctx context.Context, db dbInterface, event *domain.DriftEvent) error {
+	diffJSON, err := marshalDriftDiff(event)
+	if err != nil {
+		return err
+	}
+	result, err := db.ExecContext(ctx,
+		`UPDATE drift_events SET live_etag = $1, diff_json = $2, resolved_at = $3, resolution = $4 WHERE id = $5`,
+		event.LiveETag, diffJSON, event.ResolvedAt, event.Resolution, event.ID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UpdateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	return updateDriftEvent(ctx, s.db, event)
+}
+
+func (t *Tx) UpdateDriftEvent(ctx context.Context, event *domain.DriftEvent) error {
+	return updateDriftEvent(ctx, t.tx, event)
+}
+
+// ============================================
+// Audit Log
+// ============================================
+
+// nullableJSON converts raw JSON to a string parameter, or NULL when empty.
+// Passing []byte directly would be stored as bytea by lib/pq.
+func nullableJSON(raw json.RawMessage) *string {
+	if len(raw) == 0 {
+		return nil
+	}
+	s := string(raw)
+	return &s
+}
+
+func createAuditEntry(ctx context.Context, db dbInterface, entry *domain.AuditEntry) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO audit_entries (id, actor_type, actor_id, actor_name, action, resource_type, resource_id, stack_id, before_json, after_json, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		entry.ID, entry.ActorType, entry.ActorID, entry.ActorName, entry.Action, entry.ResourceType,
+		entry.ResourceID, entry.StackID, nullableJSON(entry.Before), nullableJSON(entry.After), entry.CreatedAt)
+	return wrapUniqueError(err)
+}
+
+func (s *Store) CreateAuditEntry(ctx context.Context, entry *domain.AuditEntry) error {
+	return createAuditEntry(ctx, s.db, entry)
+}
+
+func (t *Tx) CreateAuditEntry(ctx context.Context, entry *domain.AuditEntry) error {
+	return createAuditEntry(ctx, t.tx, entry)
+}
+
+type auditEntryRow struct {
+	ID           string    `db:"id"`
+	ActorType    string    `db:"actor_type"`
+	ActorID      string    `db:"actor_id"`
+	ActorName    string    `db:"actor_name"`
+	Action       string    `db:"action"`
+	ResourceType string    `db:"resource_type"`
+	ResourceID   string    `db:"resource_id"`
+	StackID      string    `db:"stack_id"`
+	BeforeJSON   *string   `db:"before_json"`
+	AfterJSON    *string   `db:"after_json"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+func listAuditEntries(ctx context.Context, db dbInterface, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	var conds []string
+	var args []any
+	addCond := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if len(filter.StackIDs) > 0 {
+		placeholders := make([]string, len(filter.StackIDs))
+		for i, id := range filter.StackIDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conds = append(conds, "stack_id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.ResourceType != "" {
+		addCond("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		addCond("resource_id = $%d", filter.ResourceID)
+	}
+	if filter.ActorID != "" {
+		addCond("actor_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		addCond("action = $%d", filter.Action)
+	}
+	if filter.Since != nil {
+		addCond("created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		addCond("created_at < $%d", *filter.Until)
+	}
+
+	query := `SELECT id, actor_type, actor_id, actor_name, action, resource_type, resource_id, stack_id, before_json, after_json, created_at
+		 FROM audit_entries`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	var rows []auditEntryRow
+	if err := db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*domain.AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := &domain.AuditEntry{
+			ID:           row.ID,
+			ActorType:    row.ActorType,
+			ActorID:      row.ActorID,
+			ActorName:    row.ActorName,
+			Action:       row.Action,
+			ResourceType: row.ResourceType,
+			ResourceID:   row.ResourceID,
+			StackID:      row.StackID,
+			CreatedAt:    row.CreatedAt,
+		}
+		if row.BeforeJSON != nil {
+			entry.Before = json.RawMessage(*row.BeforeJSON)
+		}
+		if row.AfterJSON != nil {
+			entry.After = json.RawMessage(*row.AfterJSON)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	return listAuditEntries(ctx, s.db, filter)
+}
+
+func (t *Tx) ListAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	return listAuditEntries(ctx, t.tx, filter)
+}
@@ -27,6 +27,13 @@ type Storage interface {
 	ListStacks(ctx context.Context) ([]*domain.Stack, error)
 	UpdateStack(ctx context.Context, stack *domain.Stack) error
 	DeleteStack(ctx context.Context, id string) error
+	// IncrementStackGeneration bumps the generation of a stack and returns
+	// the new value. If ifGeneration is non-nil and differs from the current
+	// generation, it returns a *domain.StackGenerationError and changes nothing.
+	IncrementStackGeneration(ctx context.Context, id string, ifGeneration *int64) (int64, error)
+
+	// The ListAll* queries below return the resources of enabled stacks,
+	// ordered by stack priority. stackstate.ListAll includes disabled stacks.
 
 	// Groups
 	CreateGroup(ctx context.Context, group *domain.Group) error
@@ -137,13 +144,60 @@ type Storage interface {
 	DeleteACLTest(ctx context.Context, id string) error
 	DeleteAllACLTestsForStack(ctx context.Context, stackID string) error
 
+	// Claims
+	CreateClaim(ctx context.Context, claim *domain.Claim) error
+	GetClaim(ctx context.Context, claimType, name string) (*domain.Claim, error)
+	GetClaimByID(ctx context.Context, id string) (*domain.Claim, error)
+	ListClaims(ctx context.Context, stackID string) ([]*domain.Claim, error)
+	DeleteClaim(ctx context.Context, id string) error
+
+	// Access Approvers
+	CreateAccessApprover(ctx context.Context, approver *domain.AccessApprover) error
+	GetAccessApprover(ctx context.Context, id string) (*domain.AccessApprover, error)
+	ListAccessApprovers(ctx context.Context, stackID string) ([]*domain.AccessApprover, error)
+	DeleteAccessApprover(ctx context.Context, id string) error
+
+	// Access Requests
+	CreateAccessRequest(ctx context.Context, req *domain.AccessRequest) error
+	GetAccessRequest(ctx context.Context, id string) (*domain.AccessRequest, error)
+	ListAccessRequests(ctx context.Context, filter domain.AccessRequestFilter) ([]*domain.AccessRequest, error)
+	UpdateAccessRequest(ctx context.Context, req *domain.AccessRequest) error
+	CreateAccessRequestEvent(ctx context.Context, event *domain.AccessRequestEvent) error
+	ListAccessRequestEvents(ctx context.Context, requestID string) ([]*domain.AccessRequestEvent, error)
+
+	// Change Sets
+	CreateChangeSet(ctx context.Context, change *domain.ChangeSet) error
+	GetChangeSet(ctx context.Context, id string) (*domain.ChangeSet, error)
+	ListChangeSets(ctx context.Context, filter domain.ChangeSetFilter) ([]*domain.ChangeSet, error)
+	UpdateChangeSet(ctx context.Context, change *domain.ChangeSet) error
+	CreateChangeReview(ctx context.Context, review *domain.ChangeReview) error
+	ListChangeReviews(ctx context.Context, changeID string) ([]*domain.ChangeReview, error)
+
+	// Guardrails
+	CreateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error
+	GetGuardrail(ctx context.Context, id string) (*domain.Guardrail, error)
+	ListGuardrails(ctx context.Context) ([]*domain.Guardrail, error)
+	UpdateGuardrail(ctx context.Context, guardrail *domain.Guardrail) error
+	DeleteGuardrail(ctx context.Context, id string) error
+
 	// Policy Versions
 	CreatePolicyVersion(ctx context.Context, version *domain.PolicyVersion) error
 	GetPolicyVersion(ctx context.Context, id string) (*domain.PolicyVersion, error)
 	GetLatestPolicyVersion(ctx context.Context) (*domain.PolicyVersion, error)
+	GetLastSuccessfulPolicyVersion(ctx context.Context) (*domain.PolicyVersion, error)
 	ListPolicyVersions(ctx context.Context, limit, offset int) ([]*domain.PolicyVersion, error)
 	UpdatePolicyVersion(ctx context.Context, version *domain.PolicyVersion) error
 
+	// Drift Events
+	CreateDriftEvent(ctx context.Context, event *domain.DriftEvent) error
+	GetOpenDriftEvent(ctx context.Context) (*domain.DriftEvent, error)
+	ListDriftEvents(ctx context.Context, limit, offset int) ([]*domain.DriftEvent, error)
+	UpdateDriftEvent(ctx context.Context, event *domain.DriftEvent) error
+
+	// Audit Log
+	CreateAuditEntry(ctx context.Context, entry *domain.AuditEntry) error
+	ListAuditEntries(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, error)
+
 	// Transaction support
 	BeginTx(ctx context.Context) (Transaction, error)
 }
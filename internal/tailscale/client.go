@@ -12,6 +12,7 @@ import (
 type PolicyClient interface {
 	GetPolicy(ctx context.Context) (*domain.TailscalePolicy, string, error)
 	SetPolicy(ctx context.Context, policy *domain.TailscalePolicy, etag string) (string, error)
+	SetPolicyHuJSON(ctx context.Context, document []byte, etag string) (string, error)
 	ValidatePolicy(ctx context.Context, policy *domain.TailscalePolicy) error
 }
 
@@ -71,14 +72,29 @@ func (c *Client) SetPolicy(ctx context.Context, policy *domain.TailscalePolicy,
 		return "", err
 	}
 
+	return c.currentETag(ctx), nil
+}
+
+// SetPolicyHuJSON sets the ACL policy on Tailscale from a HuJSON document,
+// keeping its comments. The etag is used as in SetPolicy.
+func (c *Client) SetPolicyHuJSON(ctx context.Context, document []byte, etag string) (string, error) {
+	if err := c.client.PolicyFile().Set(ctx, string(document), etag); err != nil {
+		return "", err
+	}
+
+	return c.currentETag(ctx), nil
+}
+
+// currentETag returns the ETag of the policy just set.
+func (c *Client) currentETag(ctx context.Context) string {
 	// After successful set, get the new ETag
 	newACL, err := c.client.PolicyFile().Get(ctx)
 	if err != nil {
 		// Set succeeded but couldn't get new ETag
-		return "", nil
+		return ""
 	}
 
-	return newACL.ETag, nil
+	return newACL.ETag
 }
 
 // ValidatePolicy validates a policy without setting it.
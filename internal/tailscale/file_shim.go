@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/evaluator"
+	"github.com/tailscale/hujson"
 )
 
 // FileShim is a testing implementation that writes policies to a file.
@@ -46,6 +48,11 @@ func (f *FileShim) GetPolicy(ctx context.Context) (*domain.TailscalePolicy, stri
 		return nil, "", fmt.Errorf("reading policy file: %w", err)
 	}
 
+	data, err = hujson.Standardize(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing policy file: %w", err)
+	}
+
 	var policy domain.TailscalePolicy
 	if err := json.Unmarshal(data, &policy); err != nil {
 		return nil, "", fmt.Errorf("parsing policy file: %w", err)
@@ -56,6 +63,17 @@ func (f *FileShim) GetPolicy(ctx context.Context) (*domain.TailscalePolicy, stri
 
 // SetPolicy writes the policy to the file.
 func (f *FileShim) SetPolicy(ctx context.Context, policy *domain.TailscalePolicy, etag string) (string, error) {
+	// Marshal with indentation for readability
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshaling policy: %w", err)
+	}
+
+	return f.SetPolicyHuJSON(ctx, data, etag)
+}
+
+// SetPolicyHuJSON writes a HuJSON policy document to the file as is.
+func (f *FileShim) SetPolicyHuJSON(ctx context.Context, data []byte, etag string) (string, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -64,10 +82,8 @@ func (f *FileShim) SetPolicy(ctx context.Context, policy *domain.TailscalePolicy
 		return "", fmt.Errorf("etag mismatch: expected %s, got %s", f.etag, etag)
 	}
 
-	// Marshal with indentation for readability
-	data, err := json.MarshalIndent(policy, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("marshaling policy: %w", err)
+	if _, err := hujson.Parse(data); err != nil {
+		return "", fmt.Errorf("parsing policy: %w", err)
 	}
 
 	// Write to file
@@ -83,7 +99,7 @@ func (f *FileShim) SetPolicy(ctx context.Context, policy *domain.TailscalePolicy
 	return f.etag, nil
 }
 
-// ValidatePolicy validates the policy (always succeeds for the shim).
+// ValidatePolicy validates the policy and runs its ACL tests locally.
 func (f *FileShim) ValidatePolicy(ctx context.Context, policy *domain.TailscalePolicy) error {
 	// Basic validation - just ensure it can be marshaled
 	_, err := json.Marshal(policy)
@@ -91,6 +107,11 @@ func (f *FileShim) ValidatePolicy(ctx context.Context, policy *domain.TailscaleP
 		return fmt.Errorf("policy validation failed: %w", err)
 	}
 
+	results := evaluator.RunTests(policy)
+	if failed := evaluator.FailedTests(results); failed > 0 {
+		return fmt.Errorf("policy validation failed: %d of %d ACL tests failed", failed, len(results))
+	}
+
 	log.Printf("[FileShim] Policy validated successfully")
 	return nil
 }
@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// ValidateAccessRequest checks the fields of a request for time-boxed access.
+// Whether the target exists is checked when the request is submitted.
+func ValidateAccessRequest(req *domain.CreateAccessRequestRequest) ValidationErrors {
+	var errs ValidationErrors
+
+	if req.StackID == "" {
+		errs.Add("stackId", "", "stackId is required")
+	}
+
+	switch req.Type {
+	case domain.AccessRequestTypeGroup:
+		if err := ValidateGroupName(req.Target); err != nil {
+			errs.Add("target", req.Target, err.Error())
+		}
+	case domain.AccessRequestTypeGrant:
+		if req.Target == "" {
+			errs.Add("target", "", "target grant ID is required")
+		}
+	default:
+		errs.Add("type", req.Type, "type must be one of group, grant")
+	}
+
+	// The member becomes a group member or the source of a grant
+	if err := ValidateGroupMember(req.Member); err != nil {
+		errs.Add("member", req.Member, err.Error())
+	}
+
+	if req.Reason == "" {
+		errs.Add("reason", "", "reason is required")
+	}
+	if d, err := time.ParseDuration(req.Duration); err != nil || d <= 0 {
+		errs.Add("duration", req.Duration, "duration must be a positive duration, e.g. 4h")
+	}
+
+	return errs
+}
@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ValidateExpiresAt checks that an expiry, if set, lies after now.
+func ValidateExpiresAt(expiresAt *time.Time, now time.Time) error {
+	if expiresAt != nil && !expiresAt.After(now) {
+		return errors.New("expiresAt must be in the future")
+	}
+	return nil
+}
+
+// ParseExpiresAt parses the RFC 3339 expiresAt of an update request.
+// An empty string removes the expiry and returns nil.
+func ParseExpiresAt(value string, now time.Time) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("expiresAt must be an RFC 3339 timestamp")
+	}
+	if err := ValidateExpiresAt(&expiresAt, now); err != nil {
+		return nil, err
+	}
+	return &expiresAt, nil
+}
+
+// ValidateMemberExpiresAt checks that every member expiry names a member of
+// the group and lies after now. Errors are reported under field, indexed by
+// member.
+func ValidateMemberExpiresAt(errs *ValidationErrors, field string, members []string, expiresAt map[string]time.Time, now time.Time) {
+	isMember := make(map[string]bool, len(members))
+	for _, m := range members {
+		isMember[m] = true
+	}
+
+	names := make([]string, 0, len(expiresAt))
+	for m := range expiresAt {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+
+	for _, m := range names {
+		path := fmt.Sprintf("%s[%s]", field, m)
+		if !isMember[m] {
+			errs.Add(path, m, "expiry given for a non-member")
+			continue
+		}
+		t := expiresAt[m]
+		if err := ValidateExpiresAt(&t, now); err != nil {
+			errs.Add(path, t.Format(time.RFC3339), err.Error())
+		}
+	}
+}
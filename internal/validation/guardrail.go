@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// ValidateGuardrail checks the fields of a guardrail.
+func ValidateGuardrail(req *domain.CreateGuardrailRequest) ValidationErrors {
+	var errs ValidationErrors
+
+	if req.Name == "" {
+		errs.Add("name", "", "name is required")
+	}
+
+	for _, target := range req.Targets {
+		if !slices.Contains(domain.GuardrailTargets, target) {
+			errs.Add("targets", target, "targets must be among "+strings.Join(domain.GuardrailTargets, ", "))
+		}
+	}
+
+	errs = append(errs, ValidateGuardrailMatch(req.Targets, req.Match)...)
+	return errs
+}
+
+// ValidateGuardrailMatch checks the conditions of a guardrail. SSH
+// conditions need a guardrail that only targets SSH rules.
+func ValidateGuardrailMatch(targets []string, m domain.GuardrailMatch) ValidationErrors {
+	var errs ValidationErrors
+
+	if m.IsEmpty() {
+		errs.Add("match", "", "match needs at least one of src, dst, users, action, requirePosture, undefinedReferences")
+	}
+	if m.UndefinedReferences && (len(m.Src) > 0 || len(m.Dst) > 0 || len(m.Users) > 0 || m.Action != "" || m.RequirePosture) {
+		errs.Add("match.undefinedReferences", "", "undefinedReferences cannot be combined with other conditions")
+	}
+
+	sshOnly := len(targets) > 0 && !slices.ContainsFunc(targets, func(t string) bool {
+		return t != domain.GuardrailTargetSSH
+	})
+	if (len(m.Users) > 0 || m.Action != "") && !sshOnly {
+		errs.Add("match", "", "users and action only apply to guardrails targeting ssh alone")
+	}
+	if m.Action != "" && m.Action != "accept" && m.Action != "check" {
+		errs.Add("match.action", m.Action, "action must be one of accept, check")
+	}
+
+	for _, patterns := range [][]string{m.Src, m.Dst, m.Users} {
+		for _, p := range patterns {
+			if p == "" {
+				errs.Add("match", "", "patterns cannot be empty")
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,184 @@
+package validation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+// ValidateStackState validates every entry of a bulk stack state with the
+// same rules as the single-resource endpoints, and rejects names that appear
+// more than once. Fields are reported as JSON paths, e.g. "acls[3].dst[1]".
+func ValidateStackState(state *domain.StackState) ValidationErrors {
+	var errs ValidationErrors
+	now := time.Now()
+
+	names := make(map[string]bool)
+	for i, g := range state.Groups {
+		path := fmt.Sprintf("groups[%d]", i)
+		if g.Name == "" {
+			errs.Add(path+".name", g.Name, "name is required")
+		} else if err := ValidateGroupName(g.Name); err != nil {
+			errs.Add(path+".name", g.Name, err.Error())
+		} else if names[g.Name] {
+			errs.Add(path+".name", g.Name, "duplicate group name")
+		}
+		names[g.Name] = true
+		for j, member := range g.Members {
+			if err := ValidateGroupMember(member); err != nil {
+				errs.Add(fmt.Sprintf("%s.members[%d]", path, j), member, err.Error())
+			}
+		}
+		ValidateMemberExpiresAt(&errs, path+".memberExpiresAt", g.Members, g.MemberExpiresAt, now)
+	}
+
+	names = make(map[string]bool)
+	for i, t := range state.TagOwners {
+		path := fmt.Sprintf("tagOwners[%d]", i)
+		if t.Tag == "" {
+			errs.Add(path+".tag", t.Tag, "tag is required")
+		} else if err := ValidateTagName(t.Tag); err != nil {
+			errs.Add(path+".tag", t.Tag, err.Error())
+		} else if names[t.Tag] {
+			errs.Add(path+".tag", t.Tag, "duplicate tag")
+		}
+		names[t.Tag] = true
+		for j, owner := range t.Owners {
+			if err := ValidateTagOwner(owner); err != nil {
+				errs.Add(fmt.Sprintf("%s.owners[%d]", path, j), owner, err.Error())
+			}
+		}
+	}
+
+	names = make(map[string]bool)
+	for i, h := range state.Hosts {
+		path := fmt.Sprintf("hosts[%d]", i)
+		if h.Name == "" {
+			errs.Add(path+".name", h.Name, "name is required")
+		} else if err := ValidateHostName(h.Name); err != nil {
+			errs.Add(path+".name", h.Name, err.Error())
+		} else if names[h.Name] {
+			errs.Add(path+".name", h.Name, "duplicate host name")
+		}
+		names[h.Name] = true
+		if h.Address == "" {
+			errs.Add(path+".address", h.Address, "address is required")
+		} else if err := ValidateHostAddress(h.Address); err != nil {
+			errs.Add(path+".address", h.Address, err.Error())
+		}
+	}
+
+	for i, a := range state.ACLs {
+		path := fmt.Sprintf("acls[%d]", i)
+		if a.Action != "" { // an empty action defaults to accept
+			if err := ValidateACLAction(a.Action); err != nil {
+				errs.Add(path+".action", a.Action, err.Error())
+			}
+		}
+		if len(a.Sources) == 0 {
+			errs.Add(path+".src", "", "src is required")
+		}
+		if len(a.Destinations) == 0 {
+			errs.Add(path+".dst", "", "dst is required")
+		}
+		validateEach(&errs, path+".src", a.Sources, ValidateACLSource)
+		validateEach(&errs, path+".dst", a.Destinations, ValidateACLDestination)
+		validateExpiresAt(&errs, path, a.ExpiresAt, now)
+	}
+
+	for i, s := range state.SSHRules {
+		path := fmt.Sprintf("ssh[%d]", i)
+		if s.Action == "" {
+			errs.Add(path+".action", s.Action, "action is required")
+		} else if err := ValidateSSHAction(s.Action); err != nil {
+			errs.Add(path+".action", s.Action, err.Error())
+		}
+		validateEach(&errs, path+".src", s.Sources, ValidateACLSource)
+		validateEach(&errs, path+".dst", s.Destinations, ValidateACLSource) // SSH destinations use same format as sources
+		validateEach(&errs, path+".users", s.Users, ValidateSSHUser)
+		validateExpiresAt(&errs, path, s.ExpiresAt, now)
+	}
+
+	for i, g := range state.Grants {
+		path := fmt.Sprintf("grants[%d]", i)
+		validateEach(&errs, path+".src", g.Sources, ValidateACLSource)
+		validateEach(&errs, path+".dst", g.Destinations, ValidateACLSource) // Grant destinations use same format as sources
+		validateEach(&errs, path+".srcPosture", g.SrcPosture, ValidatePostureName)
+		validateExpiresAt(&errs, path, g.ExpiresAt, now)
+	}
+
+	names = make(map[string]bool)
+	for i, aa := range state.AutoApprovers {
+		path := fmt.Sprintf("autoApprovers[%d]", i)
+		if aa.Type != "routes" && aa.Type != "exitNode" {
+			errs.Add(path+".type", aa.Type, "type must be 'routes' or 'exitNode'")
+		} else if err := ValidateAutoApproverMatch(aa.Type, aa.Match); err != nil {
+			errs.Add(path+".match", aa.Match, err.Error())
+		} else if key := aa.Type + ":" + aa.Match; names[key] {
+			errs.Add(path+".match", aa.Match, "duplicate auto approver")
+		} else {
+			names[key] = true
+		}
+		validateEach(&errs, path+".approvers", aa.Approvers, ValidateAutoApprover)
+	}
+
+	for i, n := range state.NodeAttrs {
+		path := fmt.Sprintf("nodeAttrs[%d]", i)
+		if len(n.Target) == 0 {
+			errs.Add(path+".target", "", "target is required")
+		}
+		validateEach(&errs, path+".target", n.Target, ValidateNodeAttrTarget)
+	}
+
+	names = make(map[string]bool)
+	for i, p := range state.Postures {
+		path := fmt.Sprintf("postures[%d]", i)
+		if p.Name == "" {
+			errs.Add(path+".name", p.Name, "name is required")
+		} else if err := ValidatePostureName(p.Name); err != nil {
+			errs.Add(path+".name", p.Name, err.Error())
+		} else if names[p.Name] {
+			errs.Add(path+".name", p.Name, "duplicate posture name")
+		}
+		names[p.Name] = true
+	}
+
+	names = make(map[string]bool)
+	for i, s := range state.IPSets {
+		path := fmt.Sprintf("ipsets[%d]", i)
+		if s.Name == "" {
+			errs.Add(path+".name", s.Name, "name is required")
+		} else if err := ValidateIPSetName(s.Name); err != nil {
+			errs.Add(path+".name", s.Name, err.Error())
+		} else if names[s.Name] {
+			errs.Add(path+".name", s.Name, "duplicate IP set name")
+		}
+		names[s.Name] = true
+		validateEach(&errs, path+".addresses", s.Addresses, ValidateHostAddress)
+	}
+
+	for i, t := range state.Tests {
+		if t.Source == "" {
+			errs.Add(fmt.Sprintf("tests[%d].src", i), t.Source, "src is required")
+		}
+	}
+
+	return errs
+}
+
+// validateEach validates every value of a list, reporting errors as path[j].
+func validateEach(errs *ValidationErrors, path string, values []string, validate func(string) error) {
+	for j, v := range values {
+		if err := validate(v); err != nil {
+			errs.Add(fmt.Sprintf("%s[%d]", path, j), v, err.Error())
+		}
+	}
+}
+
+// validateExpiresAt reports an expiry that has already passed as path.expiresAt.
+func validateExpiresAt(errs *ValidationErrors, path string, expiresAt *time.Time, now time.Time) {
+	if err := ValidateExpiresAt(expiresAt, now); err != nil {
+		errs.Add(path+".expiresAt", expiresAt.Format(time.RFC3339), err.Error())
+	}
+}
@@ -2,6 +2,8 @@ package validation
 
 import (
 	"testing"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
 func TestValidateTagName(t *testing.T) {
@@ -108,6 +110,29 @@ func TestValidateIPSetName(t *testing.T) {
 	}
 }
 
+func TestValidatePostureName(t *testing.T) {
+	tests := []struct {
+		name    string
+		posture string
+		wantErr bool
+	}{
+		{"valid posture", "posture:latestMac", false},
+		{"valid posture with hyphens", "posture:prod-devices", false},
+		{"missing prefix", "latestMac", true},
+		{"wrong prefix", "tag:latestMac", true},
+		{"empty after prefix", "posture:", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePostureName(tt.posture)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePostureName(%q) error = %v, wantErr %v", tt.posture, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateAutogroup(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -228,10 +253,9 @@ func TestValidateGroupMember(t *testing.T) {
 	}{
 		{"valid email", "user@example.com", false},
 		{"valid group ref", "group:developers", false},
-		{"valid tag ref", "tag:server", false},
+		{"tag ref", "tag:server", true},
 		{"empty", "", true},
 		{"invalid group", "group:1invalid", true},
-		{"invalid tag", "tag:_invalid", true},
 		{"plain text", "notanemail", true},
 	}
 
@@ -334,6 +358,56 @@ func TestValidateACLDestination(t *testing.T) {
 	}
 }
 
+// Tailscale accepts the wildcard with specific ports, and stack state
+// replacements, which validate every destination, must accept it too.
+func TestValidateACLDestination_WildcardPorts(t *testing.T) {
+	tests := []struct {
+		dst     string
+		wantErr bool
+	}{
+		{"*:443", false},
+		{"*:80,443", false},
+		{"*:8000-9000", false},
+		{"*:99999", true},
+		{"*:", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dst, func(t *testing.T) {
+			err := ValidateACLDestination(tt.dst)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateACLDestination(%q) error = %v, wantErr %v", tt.dst, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRuleActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func(string) error
+		action   string
+		wantErr  bool
+	}{
+		{"acl accept", ValidateACLAction, "accept", false},
+		{"acl check", ValidateACLAction, "check", true},
+		{"acl deny", ValidateACLAction, "deny", true},
+		{"acl empty", ValidateACLAction, "", true},
+		{"ssh accept", ValidateSSHAction, "accept", false},
+		{"ssh check", ValidateSSHAction, "check", false},
+		{"ssh deny", ValidateSSHAction, "deny", true},
+		{"ssh empty", ValidateSSHAction, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validate(tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate(%q) error = %v, wantErr %v", tt.action, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateSSHUser(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -459,3 +533,70 @@ func TestValidAutogroups(t *testing.T) {
 		t.Errorf("Expected 13 autogroups, got %d", len(groups))
 	}
 }
+
+func TestValidateAPIKeyRole(t *testing.T) {
+	tests := []struct {
+		role    string
+		wantErr bool
+	}{
+		{"read-only", false},
+		{"stack-writer", false},
+		{"policy-admin", false},
+		{"key-admin", false},
+		{"", true},
+		{"admin", true},
+		{"Read-Only", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			err := ValidateAPIKeyRole(tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAPIKeyRole(%q) error = %v, wantErr %v", tt.role, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStackState(t *testing.T) {
+	state := &domain.StackState{
+		Groups: []domain.CreateGroupRequest{
+			{Name: "group:dev", Members: []string{"alice@example.com"}},
+			{Name: "group:dev", Members: []string{"bob@example.com", "notanemail"}},
+		},
+		Hosts: []domain.CreateHostRequest{
+			{Name: "db", Address: "10.0.0.5"},
+			{Name: "web"},
+		},
+		ACLs: []domain.CreateACLRuleRequest{
+			{Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"db:5432"}},
+			{Action: "accept", Sources: []string{"group:dev"}, Destinations: []string{"db:5432", "db:99999"}},
+		},
+		AutoApprovers: []domain.CreateAutoApproverRequest{
+			{Type: "routes", Match: "10.0.0.0/24", Approvers: []string{"group:dev"}},
+			{Type: "routes", Match: "10.0.0.0/24", Approvers: []string{"group:dev"}},
+		},
+	}
+
+	errs := ValidateStackState(state)
+
+	want := []string{
+		"groups[1].name",
+		"groups[1].members[1]",
+		"hosts[1].address",
+		"acls[1].dst[1]",
+		"autoApprovers[1].match",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("ValidateStackState() returned %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for i, field := range want {
+		if errs[i].Field != field {
+			t.Errorf("errors[%d].Field = %q, want %q", i, errs[i].Field, field)
+		}
+	}
+
+	if errs := ValidateStackState(&domain.StackState{}); errs.HasErrors() {
+		t.Errorf("ValidateStackState(empty) = %v, want no errors", errs)
+	}
+}
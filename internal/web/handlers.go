@@ -2,13 +2,25 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/evaluator"
+	"github.com/bcnelson/tailscale-acl-manager/internal/render"
+	"github.com/bcnelson/tailscale-acl-manager/internal/stackstate"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -69,8 +81,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	// If not bootstrap, validate against stored keys
 	if !isValid {
 		keyHash := hashAPIKey(apiKey)
-		_, err := s.store.GetAPIKeyByHash(ctx, keyHash)
+		storedKey, err := s.store.GetAPIKeyByHash(ctx, keyHash)
 		if err == nil {
+			if !storedKey.IsAdmin() {
+				http.Redirect(w, r, "/login?error=API+key+must+hold+every+role+on+every+stack", http.StatusSeeOther)
+				return
+			}
 			isValid = true
 		}
 	}
@@ -110,6 +126,9 @@ type DashboardData struct {
 	StackCount    int
 	LatestVersion *domain.PolicyVersion
 	SyncStatus    string
+	Drift         *domain.DriftStatus
+	Lint          []domain.LintIssue // Lint issues in the merged policy, most severe first
+	LintError     string
 }
 
 // handleDashboard renders the dashboard page.
@@ -136,15 +155,23 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	drift, _ := s.syncService.DriftStatus(ctx)
+
+	dashboard := DashboardData{
+		Stacks:        stacks,
+		StackCount:    len(stacks),
+		LatestVersion: latestVersion,
+		SyncStatus:    syncStatus,
+		Drift:         drift,
+	}
+	if dashboard.Lint, err = s.syncService.Lint(ctx); err != nil {
+		dashboard.LintError = err.Error()
+	}
+
 	data := PageData{
-		Title:  "Dashboard",
-		Active: "dashboard",
-		Content: DashboardData{
-			Stacks:        stacks,
-			StackCount:    len(stacks),
-			LatestVersion: latestVersion,
-			SyncStatus:    syncStatus,
-		},
+		Title:   "Dashboard",
+		Active:  "dashboard",
+		Content: dashboard,
 	}
 
 	s.render(w, "base", "dashboard", data)
@@ -204,20 +231,34 @@ func (s *Server) handleStackCreate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	stack := &domain.Stack{
-		ID:          generateID(),
-		Name:        r.FormValue("name"),
-		Description: r.FormValue("description"),
-		Priority:    parseInt(r.FormValue("priority"), 100),
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:                generateID(),
+		Name:              r.FormValue("name"),
+		Description:       r.FormValue("description"),
+		Priority:          parseInt(r.FormValue("priority"), 100),
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+		RequiredApprovals: parseInt(r.FormValue("requiredApprovals"), 0),
 	}
 
 	if stack.Name == "" {
 		s.renderError(w, "Name is required", http.StatusBadRequest)
 		return
 	}
+	if stack.RequiredApprovals < 0 {
+		s.renderError(w, "Required approvals cannot be negative", http.StatusBadRequest)
+		return
+	}
 
-	if err := s.store.CreateStack(ctx, stack); err != nil {
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		After:        stack,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		return tx.CreateStack(ctx, stack)
+	}); err != nil {
 		if err == domain.ErrAlreadyExists {
 			s.renderError(w, "Stack with this name already exists", http.StatusConflict)
 			return
@@ -307,6 +348,49 @@ func (s *Server) handleStackDetail(w http.ResponseWriter, r *http.Request) {
 	s.render(w, "base", "stack_detail", data)
 }
 
+// handleStackStateDownload serves the stack's state as a JSON or YAML file
+// that can be applied with PUT /api/v1/stacks/{id}/state.
+func (s *Server) handleStackStateDownload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stackID := chi.URLParam(r, "id")
+
+	stack, err := s.store.GetStack(ctx, stackID)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			s.renderError(w, "Stack not found", http.StatusNotFound)
+			return
+		}
+		s.renderError(w, "Failed to load stack", http.StatusInternalServerError)
+		return
+	}
+
+	state, err := stackstate.Load(ctx, s.store, stackID)
+	if err != nil {
+		s.renderError(w, "Failed to load stack state", http.StatusInternalServerError)
+		return
+	}
+
+	var body []byte
+	var contentType, ext string
+	switch r.URL.Query().Get("format") {
+	case "yaml":
+		body, err = render.YAML(state)
+		contentType, ext = "application/yaml", "yaml"
+	default:
+		body, err = json.MarshalIndent(state, "", "  ")
+		contentType, ext = "application/json", "json"
+	}
+	if err != nil {
+		s.renderError(w, "Failed to render stack state", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-state.%s", stack.Name, ext)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	_, _ = w.Write(body)
+}
+
 // handleStackEditForm renders the stack edit form.
 func (s *Server) handleStackEditForm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -352,17 +436,85 @@ func (s *Server) handleStackUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := audit.Snapshot(stack)
+
 	stack.Name = r.FormValue("name")
 	stack.Description = r.FormValue("description")
 	stack.Priority = parseInt(r.FormValue("priority"), stack.Priority)
+	stack.RequiredApprovals = parseInt(r.FormValue("requiredApprovals"), stack.RequiredApprovals)
 	stack.UpdatedAt = time.Now()
 
 	if stack.Name == "" {
 		s.renderError(w, "Name is required", http.StatusBadRequest)
 		return
 	}
+	if stack.RequiredApprovals < 0 {
+		s.renderError(w, "Required approvals cannot be negative", http.StatusBadRequest)
+		return
+	}
 
-	if err := s.store.UpdateStack(ctx, stack); err != nil {
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		Before:       before,
+		After:        stack,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		return tx.UpdateStack(ctx, stack)
+	}); err != nil {
+		s.renderError(w, "Failed to update stack", http.StatusInternalServerError)
+		return
+	}
+
+	// Trigger sync
+	s.syncService.TriggerSync()
+
+	w.Header().Set("HX-Redirect", "/stacks/"+stack.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleStackEnable puts a disabled stack's resources back into the policy.
+func (s *Server) handleStackEnable(w http.ResponseWriter, r *http.Request) {
+	s.setStackDisabled(w, r, false)
+}
+
+// handleStackDisable leaves a stack's resources out of the policy without
+// deleting them.
+func (s *Server) handleStackDisable(w http.ResponseWriter, r *http.Request) {
+	s.setStackDisabled(w, r, true)
+}
+
+func (s *Server) setStackDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	ctx := r.Context()
+	stackID := chi.URLParam(r, "id")
+
+	stack, err := s.store.GetStack(ctx, stackID)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			s.renderError(w, "Stack not found", http.StatusNotFound)
+			return
+		}
+		s.renderError(w, "Failed to load stack", http.StatusInternalServerError)
+		return
+	}
+
+	before := audit.Snapshot(stack)
+	stack.Disabled = disabled
+	stack.UpdatedAt = time.Now()
+
+	change := audit.Change{
+		Action:       domain.AuditActionUpdate,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		Before:       before,
+		After:        stack,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		return tx.UpdateStack(ctx, stack)
+	}); err != nil {
 		s.renderError(w, "Failed to update stack", http.StatusInternalServerError)
 		return
 	}
@@ -379,11 +531,26 @@ func (s *Server) handleStackDelete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	stackID := chi.URLParam(r, "id")
 
-	if err := s.store.DeleteStack(ctx, stackID); err != nil {
+	stack, err := s.store.GetStack(ctx, stackID)
+	if err != nil {
 		if err == domain.ErrNotFound {
 			s.renderError(w, "Stack not found", http.StatusNotFound)
 			return
 		}
+		s.renderError(w, "Failed to load stack", http.StatusInternalServerError)
+		return
+	}
+
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceStack,
+		ResourceID:   stack.ID,
+		StackID:      stack.ID,
+		Before:       stack,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		return tx.DeleteStack(ctx, stackID)
+	}); err != nil {
 		s.renderError(w, "Failed to delete stack", http.StatusInternalServerError)
 		return
 	}
@@ -399,23 +566,123 @@ func (s *Server) handleStackDelete(w http.ResponseWriter, r *http.Request) {
 type PolicyPageData struct {
 	Policy        *domain.TailscalePolicy
 	PolicyJSON    string
-	Versions      []*domain.PolicyVersion
+	Versions      []PolicyVersionRow
 	LatestVersion *domain.PolicyVersion
+	Provenance    []ProvenanceRow
+	Conflicts     []domain.MergeConflict
+	Strategies    domain.MergeStrategies
+}
+
+// PolicyVersionRow is a version history entry with a link to its predecessor for diffing.
+type PolicyVersionRow struct {
+	*domain.PolicyVersion
+	PreviousID string // Empty for the oldest version
+}
+
+// policyVersionRows returns up to limit of the newest versions, each paired
+// with the ID of the version before it.
+func (s *Server) policyVersionRows(ctx context.Context, limit int) []PolicyVersionRow {
+	// Fetch one extra so the last row also has a predecessor
+	versions, _ := s.store.ListPolicyVersions(ctx, limit+1, 0)
+
+	rows := make([]PolicyVersionRow, 0, len(versions))
+	for i, v := range versions {
+		if i == limit {
+			break
+		}
+		row := PolicyVersionRow{PolicyVersion: v}
+		if i+1 < len(versions) {
+			row.PreviousID = versions[i+1].ID
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// ProvenanceRow traces one entry of the merged policy back to the stack
+// resources that produced it.
+type ProvenanceRow struct {
+	Section string // Policy section, e.g. "acls" or "groups"
+	Entry   string // Rule index such as "#3", or the entry name
+	Value   string // The rule as JSON, the member, or the entry's value
+	Sources []ProvenanceSource
+}
+
+// ProvenanceSource is a RuleSource with its stack name resolved.
+type ProvenanceSource struct {
+	domain.RuleSource
+	StackName string
+}
+
+// provenanceRows flattens a policy's provenance into table rows, in the
+// order sections appear in the rendered policy.
+func provenanceRows(policy *domain.TailscalePolicy, prov *domain.PolicyProvenance) []ProvenanceRow {
+	var rows []ProvenanceRow
+
+	resolve := func(sources ...domain.RuleSource) []ProvenanceSource {
+		out := make([]ProvenanceSource, 0, len(sources))
+		for _, src := range sources {
+			out = append(out, ProvenanceSource{RuleSource: src, StackName: prov.Stacks[src.StackID]})
+		}
+		return out
+	}
+	members := func(section string, sources map[string]map[string][]domain.RuleSource) {
+		for _, name := range sortedKeys(sources) {
+			for _, member := range sortedKeys(sources[name]) {
+				rows = append(rows, ProvenanceRow{Section: section, Entry: name, Value: member, Sources: resolve(sources[name][member]...)})
+			}
+		}
+	}
+	named := func(section string, sources map[string]domain.RuleSource, value func(name string) string) {
+		for _, name := range sortedKeys(sources) {
+			rows = append(rows, ProvenanceRow{Section: section, Entry: name, Value: value(name), Sources: resolve(sources[name])})
+		}
+	}
+	rules := func(section string, sources []domain.RuleSource, rule func(i int) any) {
+		for i, src := range sources {
+			rows = append(rows, ProvenanceRow{Section: section, Entry: fmt.Sprintf("#%d", i), Value: toJSON(rule(i)), Sources: resolve(src)})
+		}
+	}
+
+	members("groups", prov.Groups)
+	members("tagOwners", prov.TagOwners)
+	named("hosts", prov.Hosts, func(name string) string { return policy.Hosts[name] })
+	rules("acls", prov.ACLs, func(i int) any { return policy.ACLs[i] })
+	rules("grants", prov.Grants, func(i int) any { return policy.Grants[i] })
+	rules("ssh", prov.SSH, func(i int) any { return policy.SSH[i] })
+	members("autoApprovers", prov.AutoApprovers)
+	rules("nodeAttrs", prov.NodeAttrs, func(i int) any { return policy.NodeAttrs[i] })
+	named("postures", prov.Postures, func(name string) string { return strings.Join(policy.Postures[name], ", ") })
+	named("ipsets", prov.IPSets, func(name string) string { return strings.Join(policy.IPSets[name], ", ") })
+	rules("tests", prov.Tests, func(i int) any { return policy.Tests[i] })
+
+	return rows
+}
+
+// sortedKeys returns a map's keys in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // handlePolicyPage renders the policy page.
 func (s *Server) handlePolicyPage(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	policy, err := s.syncService.GetMergedPolicy(ctx)
+	explained, err := s.syncService.GetExplainedPolicy(ctx)
 	if err != nil {
 		s.renderError(w, "Failed to load policy", http.StatusInternalServerError)
 		return
 	}
+	policy := explained.Policy
 
 	policyJSON, _ := json.MarshalIndent(policy, "", "  ")
 
-	versions, _ := s.store.ListPolicyVersions(ctx, 10, 0)
+	versions := s.policyVersionRows(ctx, 10)
 	latestVersion, _ := s.store.GetLatestPolicyVersion(ctx)
 
 	data := PageData{
@@ -426,6 +693,9 @@ func (s *Server) handlePolicyPage(w http.ResponseWriter, r *http.Request) {
 			PolicyJSON:    string(policyJSON),
 			Versions:      versions,
 			LatestVersion: latestVersion,
+			Provenance:    provenanceRows(policy, explained.Provenance),
+			Conflicts:     explained.Provenance.Conflicts,
+			Strategies:    explained.Provenance.Strategies,
 		},
 	}
 
@@ -454,7 +724,7 @@ func (s *Server) handlePolicyPreview(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handlePolicyVersions(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	versions, _ := s.store.ListPolicyVersions(ctx, 20, 0)
+	versions := s.policyVersionRows(ctx, 20)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -480,6 +750,13 @@ func (s *Server) handlePolicyVersions(w http.ResponseWriter, r *http.Request) {
 		buf.WriteString(`</td><td class="text-muted">`)
 		buf.WriteString(v.CreatedAt.Format("Jan 2, 15:04"))
 		buf.WriteString(`</td><td class="table-actions">`)
+		if v.PreviousID != "" {
+			buf.WriteString(`<a class="btn btn-sm btn-secondary" href="/policy/diff?from=`)
+			buf.WriteString(v.PreviousID)
+			buf.WriteString(`&to=`)
+			buf.WriteString(v.ID)
+			buf.WriteString(`">Diff</a> `)
+		}
 		if v.PushStatus == "success" {
 			buf.WriteString(`<button class="btn btn-sm btn-secondary" hx-post="/policy/rollback/`)
 			buf.WriteString(v.ID)
@@ -493,18 +770,136 @@ func (s *Server) handlePolicyVersions(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(buf.Bytes())
 }
 
+// PolicyDiffPageData holds data for the policy diff page.
+type PolicyDiffPageData struct {
+	Diff  *domain.PolicyDiff
+	Error string
+}
+
+// handlePolicyDiffPage renders a diff between two policy versions.
+// If to is omitted the current merged policy is used.
+func (s *Server) handlePolicyDiffPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		s.renderError(w, "from is required", http.StatusBadRequest)
+		return
+	}
+
+	var pageData PolicyDiffPageData
+	diff, err := s.syncService.DiffVersions(ctx, from, r.URL.Query().Get("to"))
+	if err != nil {
+		pageData.Error = err.Error()
+	}
+	pageData.Diff = diff
+
+	s.render(w, "base", "policy_diff", PageData{
+		Title:   "Policy Diff",
+		Active:  "policy",
+		Content: pageData,
+	})
+}
+
+// PolicyQueryPageData holds data for the access query page.
+type PolicyQueryPageData struct {
+	Src    string
+	Dst    string
+	Port   string
+	Proto  string
+	Result *domain.PolicyQueryResult
+	Error  string
+}
+
+// handlePolicyQueryPage renders the access query form and, once src and dst
+// are given, the result of evaluating the query against the merged policy.
+func (s *Server) handlePolicyQueryPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pageData := PolicyQueryPageData{
+		Src:   strings.TrimSpace(q.Get("src")),
+		Dst:   strings.TrimSpace(q.Get("dst")),
+		Port:  strings.TrimSpace(q.Get("port")),
+		Proto: strings.ToLower(strings.TrimSpace(q.Get("proto"))),
+	}
+
+	if pageData.Src != "" || pageData.Dst != "" {
+		req := evaluator.Request{Src: pageData.Src, Dst: pageData.Dst, Proto: pageData.Proto}
+		port, err := strconv.Atoi(pageData.Port)
+		switch {
+		case pageData.Src == "" || pageData.Dst == "":
+			pageData.Error = "Source and destination are required"
+		case pageData.Port == "" && pageData.Proto != evaluator.ProtoICMP:
+			pageData.Error = "Port is required"
+		case pageData.Port != "" && (err != nil || port < 0 || port > 65535):
+			pageData.Error = "Port must be between 0 and 65535"
+		default:
+			req.Port = port
+			result, err := s.syncService.QueryAccess(r.Context(), req)
+			if err != nil {
+				pageData.Error = "Failed to evaluate query: " + err.Error()
+			}
+			pageData.Result = result
+		}
+	}
+
+	s.render(w, "base", "policy_query", PageData{
+		Title:   "Access Query",
+		Active:  "policy",
+		Content: pageData,
+	})
+}
+
+// handlePolicyDiffLivePage renders a diff from the live tailnet policy to the merged policy.
+func (s *Server) handlePolicyDiffLivePage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var pageData PolicyDiffPageData
+	diff, err := s.syncService.DiffLive(ctx)
+	if err != nil {
+		pageData.Error = "Failed to load live policy: " + err.Error()
+	}
+	pageData.Diff = diff
+
+	s.render(w, "base", "policy_diff", PageData{
+		Title:   "Policy Diff",
+		Active:  "policy",
+		Content: pageData,
+	})
+}
+
+// handleDriftDiffPage renders the diff recorded for the open drift event.
+func (s *Server) handleDriftDiffPage(w http.ResponseWriter, r *http.Request) {
+	var pageData PolicyDiffPageData
+	status, err := s.syncService.DriftStatus(r.Context())
+	switch {
+	case err != nil:
+		pageData.Error = err.Error()
+	case status.Event == nil:
+		pageData.Error = "No drift detected."
+	default:
+		pageData.Diff = status.Event.Diff
+	}
+
+	s.render(w, "base", "policy_diff", PageData{
+		Title:   "Policy Drift",
+		Active:  "policy",
+		Content: pageData,
+	})
+}
+
 // handlePolicySync triggers a policy sync.
 func (s *Server) handlePolicySync(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	result, err := s.syncService.ForceSync(ctx)
+	overwriteDrift := r.URL.Query().Get("overwriteDrift") == "true"
+	result, err := s.syncService.ForceSync(ctx, overwriteDrift)
 	if err != nil {
 		s.renderError(w, "Sync failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	if result.Status == "failed" {
-		s.renderError(w, "Sync failed: "+result.Error, http.StatusInternalServerError)
+		s.renderError(w, "Sync failed: "+result.Error+failedTestSummary(result.TestResults)+conflictSummary(result.Conflicts), http.StatusInternalServerError)
 		return
 	}
 
@@ -512,6 +907,45 @@ func (s *Server) handlePolicySync(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// failedTestSummary lists the failed ACL test assertions for display.
+func failedTestSummary(results []domain.PolicyTestResult) string {
+	var buf strings.Builder
+	for _, r := range results {
+		for _, a := range r.Assertions {
+			if a.Passed || len(a.Unknown) > 0 {
+				continue
+			}
+			buf.WriteString("<br>")
+			buf.WriteString(template.HTMLEscapeString(fmt.Sprintf("test #%d: %s should %s %s", r.Index+1, r.Src, a.Expected, a.Dst)))
+			if a.Error != "" {
+				buf.WriteString(template.HTMLEscapeString(" (" + a.Error + ")"))
+			}
+		}
+	}
+	return buf.String()
+}
+
+// conflictSummary lists merge conflicts for display.
+func conflictSummary(conflicts []domain.MergeConflict) string {
+	var buf strings.Builder
+	for _, c := range conflicts {
+		buf.WriteString("<br>")
+		buf.WriteString(template.HTMLEscapeString(fmt.Sprintf("%s %s: %s (%v) shadows %d other definition(s)", c.Type, c.Name, c.Winner.StackName, c.Winner.Value, len(c.Shadowed))))
+	}
+	return buf.String()
+}
+
+// handleDriftCheck checks the live policy for drift and reloads the dashboard.
+func (s *Server) handleDriftCheck(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.syncService.CheckDrift(r.Context()); err != nil {
+		s.renderError(w, "Drift check failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+}
+
 // handlePolicyRollback rolls back to a previous policy version.
 func (s *Server) handlePolicyRollback(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -534,7 +968,10 @@ func (s *Server) handlePolicyRollback(w http.ResponseWriter, r *http.Request) {
 
 // SettingsPageData holds data for the settings page.
 type SettingsPageData struct {
-	APIKeys []*domain.APIKey
+	APIKeys    []*domain.APIKey
+	Stacks     []*domain.Stack
+	StackNames map[string]string // Stack ID -> name for displaying key scopes
+	Roles      []string
 }
 
 // handleSettingsPage renders the settings page.
@@ -547,11 +984,25 @@ func (s *Server) handleSettingsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	stacks, err := s.store.ListStacks(ctx)
+	if err != nil {
+		s.renderError(w, "Failed to load stacks", http.StatusInternalServerError)
+		return
+	}
+
+	stackNames := make(map[string]string, len(stacks))
+	for _, stack := range stacks {
+		stackNames[stack.ID] = stack.Name
+	}
+
 	data := PageData{
 		Title:  "Settings",
 		Active: "settings",
 		Content: SettingsPageData{
-			APIKeys: keys,
+			APIKeys:    keys,
+			Stacks:     stacks,
+			StackNames: stackNames,
+			Roles:      domain.AllRoles,
 		},
 	}
 
@@ -581,6 +1032,24 @@ func (s *Server) handleAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	roles := r.Form["roles"]
+	if len(roles) == 0 {
+		roles = domain.AllRoles
+	}
+	for _, role := range roles {
+		if err := validation.ValidateAPIKeyRole(role); err != nil {
+			s.renderError(w, "Invalid role: "+role, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A key can only hand out permissions it holds itself
+	stackIDs := r.Form["stack_ids"]
+	if session := getSession(ctx); session != nil && session.APIKey != nil && !session.APIKey.Covers(roles, stackIDs) {
+		s.renderError(w, "Cannot create a key with more access than your own", http.StatusForbidden)
+		return
+	}
+
 	key, hash, prefix, err := generateAPIKeyPair()
 	if err != nil {
 		s.renderError(w, "Failed to generate key", http.StatusInternalServerError)
@@ -592,10 +1061,21 @@ func (s *Server) handleAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
 		Name:      name,
 		KeyHash:   hash,
 		KeyPrefix: prefix,
+		Roles:     roles,
+		StackIDs:  stackIDs,
+		CreatedBy: audit.ActorFromContext(r.Context()).ID,
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.store.CreateAPIKey(ctx, apiKey); err != nil {
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceAPIKey,
+		ResourceID:   apiKey.ID,
+		After:        apiKey,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		return tx.CreateAPIKey(ctx, apiKey)
+	}); err != nil {
 		s.renderError(w, "Failed to create API key", http.StatusInternalServerError)
 		return
 	}
@@ -610,7 +1090,14 @@ func (s *Server) handleAPIKeyDelete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	keyID := chi.URLParam(r, "id")
 
-	if err := s.store.DeleteAPIKey(ctx, keyID); err != nil {
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceAPIKey,
+		ResourceID:   keyID,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		return tx.DeleteAPIKey(ctx, keyID)
+	}); err != nil {
 		if err == domain.ErrNotFound {
 			s.renderError(w, "API key not found", http.StatusNotFound)
 			return
@@ -0,0 +1,269 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/access"
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
+	"github.com/go-chi/chi/v5"
+)
+
+// AccessPageData holds data for the access requests page.
+type AccessPageData struct {
+	Requests      []AccessRequestRow
+	Approvers     []AccessApproverRow
+	Stacks        []*domain.Stack
+	Status        string // Status filter, empty for all
+	DefaultMember string // Prefilled member for new requests
+}
+
+// AccessRequestRow is an access request prepared for display.
+type AccessRequestRow struct {
+	*domain.AccessRequest
+	StackName string
+	CanDecide bool
+}
+
+// AccessApproverRow is an approver prepared for display.
+type AccessApproverRow struct {
+	*domain.AccessApprover
+	StackName string
+}
+
+// handleAccessPage renders the access requests page.
+func (s *Server) handleAccessPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status := r.URL.Query().Get("status")
+
+	stacks, err := s.store.ListStacks(ctx)
+	if err != nil {
+		s.renderError(w, "Failed to load stacks", http.StatusInternalServerError)
+		return
+	}
+	stackNames := make(map[string]string, len(stacks))
+	for _, stack := range stacks {
+		stackNames[stack.ID] = stack.Name
+	}
+
+	requests, err := s.store.ListAccessRequests(ctx, domain.AccessRequestFilter{Status: status})
+	if err != nil {
+		s.renderError(w, "Failed to load access requests", http.StatusInternalServerError)
+		return
+	}
+
+	actor := audit.ActorFromContext(ctx)
+	rows := make([]AccessRequestRow, 0, len(requests))
+	for _, req := range requests {
+		req, err := access.History(ctx, s.store, req)
+		if err != nil {
+			s.renderError(w, "Failed to load access request history", http.StatusInternalServerError)
+			return
+		}
+		row := AccessRequestRow{AccessRequest: req, StackName: stackNames[req.StackID]}
+		if req.Status == domain.AccessRequestPending {
+			if row.CanDecide, err = access.CanDecide(ctx, s.store, req, actor); err != nil {
+				s.renderError(w, "Failed to load approvers", http.StatusInternalServerError)
+				return
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	var approvers []AccessApproverRow
+	for _, stack := range stacks {
+		list, err := s.store.ListAccessApprovers(ctx, stack.ID)
+		if err != nil {
+			s.renderError(w, "Failed to load approvers", http.StatusInternalServerError)
+			return
+		}
+		for _, a := range list {
+			approvers = append(approvers, AccessApproverRow{AccessApprover: a, StackName: stack.Name})
+		}
+	}
+
+	// OIDC users usually ask for access for themselves
+	defaultMember := ""
+	if actor.Type == domain.AuditActorOIDC && strings.Contains(actor.Name, "@") {
+		defaultMember = actor.Name
+	}
+
+	data := PageData{
+		Title:  "Access Requests",
+		Active: "access",
+		Content: AccessPageData{
+			Requests:      rows,
+			Approvers:     approvers,
+			Stacks:        stacks,
+			Status:        status,
+			DefaultMember: defaultMember,
+		},
+	}
+
+	s.render(w, "base", "access", data)
+}
+
+// handleAccessRequestCreate submits a new access request.
+func (s *Server) handleAccessRequestCreate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	req := &domain.CreateAccessRequestRequest{
+		StackID:  r.FormValue("stackId"),
+		Type:     r.FormValue("type"),
+		Target:   strings.TrimSpace(r.FormValue("target")),
+		Member:   strings.TrimSpace(r.FormValue("member")),
+		Reason:   strings.TrimSpace(r.FormValue("reason")),
+		Duration: strings.TrimSpace(r.FormValue("duration")),
+	}
+	if errs := validation.ValidateAccessRequest(req); errs.HasErrors() {
+		s.renderError(w, "Invalid access request: "+errs.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := access.Submit(r.Context(), s.store, req, time.Now()); err != nil {
+		s.renderAccessError(w, "Failed to submit access request", err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/access")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleAccessRequestApprove approves an access request and triggers a sync.
+func (s *Server) handleAccessRequestApprove(w http.ResponseWriter, r *http.Request) {
+	s.decideAccessRequest(w, r, func(ctx context.Context, store storage.Storage, id, comment string, now time.Time) (*domain.AccessRequest, error) {
+		return access.Approve(ctx, store, s.syncService.MergeStrategies(), id, comment, now)
+	})
+}
+
+// handleAccessRequestDeny denies an access request.
+func (s *Server) handleAccessRequestDeny(w http.ResponseWriter, r *http.Request) {
+	s.decideAccessRequest(w, r, access.Deny)
+}
+
+// decideAccessRequest applies decide to the request in the URL. The
+// optional comment comes from the htmx prompt.
+func (s *Server) decideAccessRequest(w http.ResponseWriter, r *http.Request, decide func(context.Context, storage.Storage, string, string, time.Time) (*domain.AccessRequest, error)) {
+	req, err := decide(r.Context(), s.store, chi.URLParam(r, "id"), r.Header.Get("HX-Prompt"), time.Now())
+	if err != nil {
+		s.renderAccessError(w, "Failed to decide access request", err)
+		return
+	}
+
+	if req.Status == domain.AccessRequestApproved {
+		s.syncService.TriggerSync()
+	}
+
+	w.Header().Set("HX-Redirect", "/access")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleAccessApproverCreate designates an approver for a stack or group.
+func (s *Server) handleAccessApproverCreate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	approver := &domain.AccessApprover{
+		ID:        generateID(),
+		StackID:   r.FormValue("stackId"),
+		Group:     strings.TrimSpace(r.FormValue("group")),
+		Approver:  strings.TrimSpace(r.FormValue("approver")),
+		CreatedAt: time.Now(),
+	}
+	if approver.Approver == "" {
+		s.renderError(w, "Approver is required", http.StatusBadRequest)
+		return
+	}
+	if approver.Group != "" {
+		if err := validation.ValidateGroupName(approver.Group); err != nil {
+			s.renderError(w, "Invalid group: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	identity, err := access.ResolveApprover(ctx, s.store, approver.Approver)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			s.renderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.renderError(w, "Failed to resolve approver", http.StatusInternalServerError)
+		return
+	}
+	approver.Approver = identity
+
+	change := audit.Change{
+		Action:       domain.AuditActionCreate,
+		ResourceType: domain.AuditResourceAccessApprover,
+		ResourceID:   approver.ID,
+		StackID:      approver.StackID,
+		After:        approver,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		if _, err := tx.IncrementStackGeneration(ctx, approver.StackID, nil); err != nil {
+			return err
+		}
+		return tx.CreateAccessApprover(ctx, approver)
+	}); err != nil {
+		s.renderAccessError(w, "Failed to add approver", err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/access")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleAccessApproverDelete removes an approver.
+func (s *Server) handleAccessApproverDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	approver, err := s.store.GetAccessApprover(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderAccessError(w, "Failed to remove approver", err)
+		return
+	}
+
+	change := audit.Change{
+		Action:       domain.AuditActionDelete,
+		ResourceType: domain.AuditResourceAccessApprover,
+		ResourceID:   approver.ID,
+		StackID:      approver.StackID,
+		Before:       approver,
+	}
+	if err := audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		if _, err := tx.IncrementStackGeneration(ctx, approver.StackID, nil); err != nil {
+			return err
+		}
+		return tx.DeleteAccessApprover(ctx, approver.ID)
+	}); err != nil {
+		s.renderAccessError(w, "Failed to remove approver", err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/access")
+	w.WriteHeader(http.StatusOK)
+}
+
+// renderAccessError renders an access request error with a matching status.
+func (s *Server) renderAccessError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		s.renderError(w, message+": not found", http.StatusNotFound)
+	case errors.Is(err, domain.ErrForbidden):
+		s.renderError(w, message+": you are not an approver for this request", http.StatusForbidden)
+	case errors.Is(err, domain.ErrConflict), errors.Is(err, domain.ErrAlreadyExists):
+		s.renderError(w, message+": "+err.Error(), http.StatusConflict)
+	default:
+		s.renderError(w, message+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+)
+
+const auditPageSize = 50
+
+// AuditPageData holds data for the audit log page.
+type AuditPageData struct {
+	Entries       []AuditRow
+	Stacks        []*domain.Stack
+	ResourceTypes []string
+	Actions       []string
+	Filter        AuditPageFilter
+	NextOffset    int // 0 when there are no older entries
+	PrevOffset    int // -1 when on the first page
+}
+
+// AuditPageFilter holds the filter values selected on the audit log page.
+type AuditPageFilter struct {
+	StackID      string
+	ResourceType string
+	Action       string
+	ActorID      string
+}
+
+// AuditRow is an audit entry prepared for display.
+type AuditRow struct {
+	*domain.AuditEntry
+	StackName  string
+	BeforeJSON string
+	AfterJSON  string
+}
+
+// handleAuditPage renders the audit log page.
+func (s *Server) handleAuditPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	pageFilter := AuditPageFilter{
+		StackID:      q.Get("stackId"),
+		ResourceType: q.Get("resourceType"),
+		Action:       q.Get("action"),
+		ActorID:      q.Get("actorId"),
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	filter := domain.AuditFilter{
+		ResourceType: pageFilter.ResourceType,
+		Action:       pageFilter.Action,
+		ActorID:      pageFilter.ActorID,
+		Limit:        auditPageSize + 1, // One extra to detect another page
+		Offset:       offset,
+	}
+	if pageFilter.StackID != "" {
+		filter.StackIDs = []string{pageFilter.StackID}
+	}
+
+	entries, err := s.store.ListAuditEntries(ctx, filter)
+	if err != nil {
+		s.renderError(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	stacks, err := s.store.ListStacks(ctx)
+	if err != nil {
+		s.renderError(w, "Failed to load stacks", http.StatusInternalServerError)
+		return
+	}
+	stackNames := make(map[string]string, len(stacks))
+	for _, stack := range stacks {
+		stackNames[stack.ID] = stack.Name
+	}
+
+	nextOffset := 0
+	if len(entries) > auditPageSize {
+		entries = entries[:auditPageSize]
+		nextOffset = offset + auditPageSize
+	}
+	prevOffset := -1
+	if offset > 0 {
+		prevOffset = max(offset-auditPageSize, 0)
+	}
+
+	rows := make([]AuditRow, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, AuditRow{
+			AuditEntry: e,
+			StackName:  stackNames[e.StackID],
+			BeforeJSON: indentJSON(e.Before),
+			AfterJSON:  indentJSON(e.After),
+		})
+	}
+
+	data := PageData{
+		Title:  "Audit Log",
+		Active: "audit",
+		Content: AuditPageData{
+			Entries: rows,
+			Stacks:  stacks,
+			ResourceTypes: []string{
+				domain.AuditResourceStack, domain.AuditResourceStackState, domain.AuditResourceGroup,
+				domain.AuditResourceTagOwner, domain.AuditResourceHost, domain.AuditResourceACL,
+				domain.AuditResourceSSH, domain.AuditResourceGrant, domain.AuditResourceAutoApprover,
+				domain.AuditResourceNodeAttr, domain.AuditResourcePosture, domain.AuditResourceIPSet,
+				domain.AuditResourceACLTest, domain.AuditResourceClaim, domain.AuditResourceAPIKey,
+				domain.AuditResourceAccessApprover, domain.AuditResourceAccessRequest, domain.AuditResourceChangeSet,
+				domain.AuditResourceGuardrail,
+			},
+			Actions: []string{
+				domain.AuditActionCreate, domain.AuditActionUpdate,
+				domain.AuditActionDelete, domain.AuditActionReplace, domain.AuditActionExpire,
+				domain.AuditActionApprove, domain.AuditActionDeny, domain.AuditActionReject,
+			},
+			Filter:     pageFilter,
+			NextOffset: nextOffset,
+			PrevOffset: prevOffset,
+		},
+	}
+
+	s.render(w, "base", "audit", data)
+}
+
+// indentJSON pretty-prints raw JSON for display.
+func indentJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
@@ -0,0 +1,181 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/changes"
+	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// ChangesPageData holds data for the change sets page.
+type ChangesPageData struct {
+	Changes []ChangeSetRow
+	Stacks  []*domain.Stack
+	StackID string // Stack filter, empty for all
+	Status  string // Status filter, empty for all
+}
+
+// ChangeSetRow is a change set prepared for display.
+type ChangeSetRow struct {
+	*domain.ChangeSet
+	StackName string
+}
+
+// ChangeDetailData holds data for the change set detail page.
+type ChangeDetailData struct {
+	Change    *domain.ChangeSet
+	StackName string
+	CanReview bool // The change set is pending and the user is not its author
+	Error     string
+}
+
+// redirectStaged redirects to the change set when err reports a write that
+// was staged, and reports whether it did.
+func (s *Server) redirectStaged(w http.ResponseWriter, err error) bool {
+	var staged *domain.ChangeStagedError
+	if !errors.As(err, &staged) {
+		return false
+	}
+	w.Header().Set("HX-Redirect", "/changes/"+staged.Change.ID)
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+// handleChangesPage renders the change sets page.
+func (s *Server) handleChangesPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	filter := domain.ChangeSetFilter{Status: q.Get("status")}
+	if stackID := q.Get("stackId"); stackID != "" {
+		filter.StackIDs = []string{stackID}
+	}
+
+	stacks, err := s.store.ListStacks(ctx)
+	if err != nil {
+		s.renderError(w, "Failed to load stacks", http.StatusInternalServerError)
+		return
+	}
+	stackNames := make(map[string]string, len(stacks))
+	for _, stack := range stacks {
+		stackNames[stack.ID] = stack.Name
+	}
+
+	list, err := s.store.ListChangeSets(ctx, filter)
+	if err != nil {
+		s.renderError(w, "Failed to load change sets", http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]ChangeSetRow, 0, len(list))
+	for _, change := range list {
+		change, err := changes.Get(ctx, s.store, change.ID)
+		if err != nil {
+			s.renderError(w, "Failed to load change set reviews", http.StatusInternalServerError)
+			return
+		}
+		rows = append(rows, ChangeSetRow{ChangeSet: change, StackName: stackNames[change.StackID]})
+	}
+
+	data := PageData{
+		Title:  "Change Sets",
+		Active: "changes",
+		Content: ChangesPageData{
+			Changes: rows,
+			Stacks:  stacks,
+			StackID: q.Get("stackId"),
+			Status:  filter.Status,
+		},
+	}
+
+	s.render(w, "base", "changes", data)
+}
+
+// handleChangeDetail renders a change set with its reviews and, while it
+// is pending, the merged policy diff it would cause.
+func (s *Server) handleChangeDetail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	change, err := changes.Get(ctx, s.store, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			s.renderError(w, "Change set not found", http.StatusNotFound)
+			return
+		}
+		s.renderError(w, "Failed to load change set", http.StatusInternalServerError)
+		return
+	}
+
+	detail := ChangeDetailData{Change: change}
+	if stack, err := s.store.GetStack(ctx, change.StackID); err == nil {
+		detail.StackName = stack.Name
+	}
+	if change.Status == domain.ChangeSetPending {
+		actor := audit.ActorFromContext(ctx)
+		detail.CanReview = actor.Type != change.AuthorType || actor.ID != change.AuthorID
+		if change.Diff, err = changes.Diff(ctx, s.store, s.syncService.MergeStrategies(), change); err != nil {
+			detail.Error = "Failed to compute diff: " + err.Error()
+		}
+	}
+
+	data := PageData{
+		Title:   "Change Set",
+		Active:  "changes",
+		Content: detail,
+	}
+
+	s.render(w, "base", "change_detail", data)
+}
+
+// handleChangeApprove approves a change set. When the approval applies the
+// change set, a sync is triggered.
+func (s *Server) handleChangeApprove(w http.ResponseWriter, r *http.Request) {
+	s.reviewChange(w, r, func(ctx context.Context, store storage.Storage, id, comment string, now time.Time) (*domain.ChangeSet, error) {
+		return changes.Approve(ctx, store, s.syncService.MergeStrategies(), id, comment, now)
+	})
+}
+
+// handleChangeReject rejects a change set.
+func (s *Server) handleChangeReject(w http.ResponseWriter, r *http.Request) {
+	s.reviewChange(w, r, changes.Reject)
+}
+
+// reviewChange applies review to the change set in the URL. The optional
+// comment comes from the htmx prompt.
+func (s *Server) reviewChange(w http.ResponseWriter, r *http.Request, review func(context.Context, storage.Storage, string, string, time.Time) (*domain.ChangeSet, error)) {
+	change, err := review(r.Context(), s.store, chi.URLParam(r, "id"), r.Header.Get("HX-Prompt"), time.Now())
+	if err != nil {
+		s.renderChangeError(w, "Failed to review change set", err)
+		return
+	}
+
+	if change.Status == domain.ChangeSetApplied {
+		s.syncService.TriggerSync()
+	}
+
+	w.Header().Set("HX-Redirect", "/changes/"+change.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// renderChangeError renders a change set error with a matching status.
+func (s *Server) renderChangeError(w http.ResponseWriter, message string, err error) {
+	var claimErr *domain.ClaimConflictError
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		s.renderError(w, message+": not found", http.StatusNotFound)
+	case errors.As(err, &claimErr):
+		s.renderError(w, message+": "+claimErr.Error(), http.StatusConflict)
+	case errors.Is(err, domain.ErrForbidden):
+		s.renderError(w, message+": "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, domain.ErrConflict):
+		s.renderError(w, message+": "+err.Error(), http.StatusConflict)
+	case errors.Is(err, domain.ErrInvalidInput):
+		s.renderError(w, message+": "+err.Error(), http.StatusBadRequest)
+	default:
+		s.renderError(w, message+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -2,12 +2,20 @@ package web
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
+	"github.com/bcnelson/tailscale-acl-manager/internal/changes"
+	"github.com/bcnelson/tailscale-acl-manager/internal/claims"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
+	"github.com/bcnelson/tailscale-acl-manager/internal/guardrails"
+	"github.com/bcnelson/tailscale-acl-manager/internal/nesting"
+	"github.com/bcnelson/tailscale-acl-manager/internal/storage"
 	"github.com/bcnelson/tailscale-acl-manager/internal/validation"
 	"github.com/go-chi/chi/v5"
 )
@@ -41,6 +49,21 @@ type SelectOption struct {
 	Label string
 }
 
+// auditResourceTypes maps resource names to the resource types used in the audit log.
+var auditResourceTypes = map[string]string{
+	"groups":        domain.AuditResourceGroup,
+	"tags":          domain.AuditResourceTagOwner,
+	"hosts":         domain.AuditResourceHost,
+	"acls":          domain.AuditResourceACL,
+	"ssh":           domain.AuditResourceSSH,
+	"grants":        domain.AuditResourceGrant,
+	"autoapprovers": domain.AuditResourceAutoApprover,
+	"nodeattrs":     domain.AuditResourceNodeAttr,
+	"postures":      domain.AuditResourcePosture,
+	"ipsets":        domain.AuditResourceIPSet,
+	"tests":         domain.AuditResourceACLTest,
+}
+
 // resourceTypes maps resource names to their metadata.
 var resourceTypes = map[string]ResourceMeta{
 	"groups": {
@@ -53,6 +76,8 @@ var resourceTypes = map[string]ResourceMeta{
 				ValidationPattern: `^group:[a-zA-Z][a-zA-Z0-9\-]*$`,
 				ValidationMessage: "Must be 'group:' followed by a letter, then letters/numbers/hyphens only (no underscores)"},
 			{Name: "members", Label: "Members", Type: "textarea", Required: true, Help: "One member per line (users or groups)", Placeholder: "user@example.com\ngroup:other"},
+			{Name: "memberExpiresAt", Label: "Member Expiry", Type: "textarea", Help: "Optional: one member and RFC 3339 time per line; the member is removed at that time", Placeholder: "user@example.com 2026-01-02T15:04:05Z"},
+			{Name: "description", Label: "Description", Type: "text", Help: "Optional: rendered as a comment in the policy file"},
 		},
 	},
 	"tags": {
@@ -65,6 +90,7 @@ var resourceTypes = map[string]ResourceMeta{
 				ValidationPattern: `^tag:[a-zA-Z][a-zA-Z0-9\-]*$`,
 				ValidationMessage: "Must be 'tag:' followed by a letter, then letters/numbers/hyphens only (no underscores)"},
 			{Name: "owners", Label: "Owners", Type: "textarea", Required: true, Help: "One owner per line", Placeholder: "group:admins\nuser@example.com"},
+			{Name: "description", Label: "Description", Type: "text", Help: "Optional: rendered as a comment in the policy file"},
 		},
 	},
 	"hosts": {
@@ -77,6 +103,7 @@ var resourceTypes = map[string]ResourceMeta{
 				ValidationPattern: `^[a-zA-Z][a-zA-Z0-9\-]*$`,
 				ValidationMessage: "Must start with a letter, then letters/numbers/hyphens only"},
 			{Name: "address", Label: "Address", Type: "text", Required: true, Help: "IP address or CIDR", Placeholder: "100.64.0.1"},
+			{Name: "description", Label: "Description", Type: "text", Help: "Optional: rendered as a comment in the policy file"},
 		},
 	},
 	"acls": {
@@ -86,10 +113,12 @@ var resourceTypes = map[string]ResourceMeta{
 		IDField:  "id",
 		HasOrder: true,
 		Fields: []FieldMeta{
-			{Name: "action", Label: "Action", Type: "select", Required: true, Options: []SelectOption{{Value: "accept", Label: "Accept"}, {Value: "deny", Label: "Deny"}}},
+			{Name: "action", Label: "Action", Type: "select", Required: true, Options: []SelectOption{{Value: "accept", Label: "Accept"}}},
 			{Name: "protocol", Label: "Protocol", Type: "text", Help: "Optional: tcp, udp, icmp, or empty for all", Placeholder: "tcp"},
 			{Name: "src", Label: "Sources", Type: "textarea", Required: true, Help: "One source per line", Placeholder: "*\ngroup:developers"},
 			{Name: "dst", Label: "Destinations", Type: "textarea", Required: true, Help: "One destination per line (with optional ports)", Placeholder: "tag:server:22\n100.64.0.0/24:*"},
+			{Name: "description", Label: "Description", Type: "text", Help: "Optional: rendered as a comment in the policy file"},
+			{Name: "expiresAt", Label: "Expires At", Type: "text", Help: "Optional: RFC 3339 time at which the rule is removed", Placeholder: "2026-01-02T15:04:05Z"},
 		},
 	},
 	"ssh": {
@@ -104,6 +133,8 @@ var resourceTypes = map[string]ResourceMeta{
 			{Name: "dst", Label: "Destinations", Type: "textarea", Required: true, Help: "One destination per line", Placeholder: "tag:server"},
 			{Name: "users", Label: "Users", Type: "textarea", Required: true, Help: "SSH users allowed", Placeholder: "root\nautogroup:nonroot"},
 			{Name: "checkPeriod", Label: "Check Period", Type: "text", Help: "For action=check only", Placeholder: "12h"},
+			{Name: "description", Label: "Description", Type: "text", Help: "Optional: rendered as a comment in the policy file"},
+			{Name: "expiresAt", Label: "Expires At", Type: "text", Help: "Optional: RFC 3339 time at which the rule is removed", Placeholder: "2026-01-02T15:04:05Z"},
 		},
 	},
 	"grants": {
@@ -116,6 +147,8 @@ var resourceTypes = map[string]ResourceMeta{
 			{Name: "src", Label: "Sources", Type: "textarea", Required: true, Help: "One source per line", Placeholder: "group:developers"},
 			{Name: "dst", Label: "Destinations", Type: "textarea", Required: true, Help: "One destination per line", Placeholder: "tag:server"},
 			{Name: "ip", Label: "IP Permissions", Type: "textarea", Help: "Optional: IP addresses", Placeholder: "*"},
+			{Name: "description", Label: "Description", Type: "text", Help: "Optional: rendered as a comment in the policy file"},
+			{Name: "expiresAt", Label: "Expires At", Type: "text", Help: "Optional: RFC 3339 time at which the grant is removed", Placeholder: "2026-01-02T15:04:05Z"},
 		},
 	},
 	"autoapprovers": {
@@ -146,7 +179,7 @@ var resourceTypes = map[string]ResourceMeta{
 		Plural:   "Postures",
 		IDField:  "name",
 		Fields: []FieldMeta{
-			{Name: "name", Label: "Name", Type: "text", Required: true, Help: "Posture name", Placeholder: "latestMac"},
+			{Name: "name", Label: "Name", Type: "text", Required: true, Help: "Posture name", Placeholder: "posture:latestMac"},
 			{Name: "rules", Label: "Rules", Type: "textarea", Required: true, Help: "Posture check expressions, one per line", Placeholder: "node:os == 'macos'\nnode:osVersion >= '14'"},
 		},
 	},
@@ -269,10 +302,21 @@ func (s *Server) handleResourceCreate(w http.ResponseWriter, r *http.Request) {
 
 	err = s.createResource(ctx, stackID, resourceType, r, meta)
 	if err != nil {
+		if s.redirectStaged(w, err) {
+			return
+		}
 		if err == domain.ErrAlreadyExists {
 			s.renderError(w, "Resource already exists", http.StatusConflict)
 			return
 		}
+		if errors.Is(err, domain.ErrConflict) {
+			s.renderError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidInput) {
+			s.renderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		s.renderError(w, "Failed to create resource: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -337,10 +381,21 @@ func (s *Server) handleResourceUpdate(w http.ResponseWriter, r *http.Request) {
 
 	err := s.updateResource(ctx, stackID, resourceType, name, r, meta)
 	if err != nil {
+		if s.redirectStaged(w, err) {
+			return
+		}
 		if err == domain.ErrNotFound {
 			s.renderError(w, "Resource not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, domain.ErrConflict) {
+			s.renderError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidInput) {
+			s.renderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		s.renderError(w, "Failed to update resource: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -361,6 +416,9 @@ func (s *Server) handleResourceDelete(w http.ResponseWriter, r *http.Request) {
 
 	err := s.deleteResource(ctx, stackID, resourceType, name)
 	if err != nil {
+		if s.redirectStaged(w, err) {
+			return
+		}
 		if err == domain.ErrNotFound {
 			s.renderError(w, "Resource not found", http.StatusNotFound)
 			return
@@ -390,7 +448,7 @@ func (s *Server) listResources(ctx context.Context, stackID, resourceType string
 			items = append(items, map[string]any{
 				"id":      r.ID,
 				"name":    r.Name,
-				"members": strings.Join(r.Members, ", "),
+				"members": strings.Join(listMembers(r), ", "),
 			})
 		}
 	case "tags":
@@ -424,12 +482,13 @@ func (s *Server) listResources(ctx context.Context, stackID, resourceType string
 		}
 		for _, r := range resources {
 			items = append(items, map[string]any{
-				"id":       r.ID,
-				"order":    r.Order,
-				"action":   r.Action,
-				"protocol": r.Protocol,
-				"src":      strings.Join(r.Sources, ", "),
-				"dst":      strings.Join(r.Destinations, ", "),
+				"id":        r.ID,
+				"order":     r.Order,
+				"action":    r.Action,
+				"protocol":  r.Protocol,
+				"src":       strings.Join(r.Sources, ", "),
+				"dst":       strings.Join(r.Destinations, ", "),
+				"expiresAt": formatExpiresAt(r.ExpiresAt),
 			})
 		}
 	case "ssh":
@@ -446,6 +505,7 @@ func (s *Server) listResources(ctx context.Context, stackID, resourceType string
 				"dst":         strings.Join(r.Destinations, ", "),
 				"users":       strings.Join(r.Users, ", "),
 				"checkPeriod": r.CheckPeriod,
+				"expiresAt":   formatExpiresAt(r.ExpiresAt),
 			})
 		}
 	case "grants":
@@ -455,11 +515,12 @@ func (s *Server) listResources(ctx context.Context, stackID, resourceType string
 		}
 		for _, r := range resources {
 			items = append(items, map[string]any{
-				"id":    r.ID,
-				"order": r.Order,
-				"src":   strings.Join(r.Sources, ", "),
-				"dst":   strings.Join(r.Destinations, ", "),
-				"ip":    strings.Join(r.IP, ", "),
+				"id":        r.ID,
+				"order":     r.Order,
+				"src":       strings.Join(r.Sources, ", "),
+				"dst":       strings.Join(r.Destinations, ", "),
+				"ip":        strings.Join(r.IP, ", "),
+				"expiresAt": formatExpiresAt(r.ExpiresAt),
 			})
 		}
 	case "autoapprovers":
@@ -540,9 +601,11 @@ func (s *Server) getResource(ctx context.Context, stackID, resourceType, name st
 			return nil, err
 		}
 		return map[string]any{
-			"id":      r.ID,
-			"name":    r.Name,
-			"members": r.Members,
+			"id":              r.ID,
+			"name":            r.Name,
+			"members":         r.Members,
+			"memberExpiresAt": formatMemberExpiresAt(r.MemberExpiresAt),
+			"description":     r.Description,
 		}, nil
 	case "tags":
 		r, err := s.store.GetTagOwner(ctx, stackID, name)
@@ -550,9 +613,10 @@ func (s *Server) getResource(ctx context.Context, stackID, resourceType, name st
 			return nil, err
 		}
 		return map[string]any{
-			"id":     r.ID,
-			"tag":    r.Tag,
-			"owners": r.Owners,
+			"id":          r.ID,
+			"tag":         r.Tag,
+			"owners":      r.Owners,
+			"description": r.Description,
 		}, nil
 	case "hosts":
 		r, err := s.store.GetHost(ctx, stackID, name)
@@ -560,9 +624,10 @@ func (s *Server) getResource(ctx context.Context, stackID, resourceType, name st
 			return nil, err
 		}
 		return map[string]any{
-			"id":      r.ID,
-			"name":    r.Name,
-			"address": r.Address,
+			"id":          r.ID,
+			"name":        r.Name,
+			"address":     r.Address,
+			"description": r.Description,
 		}, nil
 	case "acls":
 		r, err := s.store.GetACLRule(ctx, name)
@@ -570,12 +635,14 @@ func (s *Server) getResource(ctx context.Context, stackID, resourceType, name st
 			return nil, err
 		}
 		return map[string]any{
-			"id":       r.ID,
-			"order":    r.Order,
-			"action":   r.Action,
-			"protocol": r.Protocol,
-			"src":      r.Sources,
-			"dst":      r.Destinations,
+			"id":          r.ID,
+			"order":       r.Order,
+			"action":      r.Action,
+			"protocol":    r.Protocol,
+			"src":         r.Sources,
+			"dst":         r.Destinations,
+			"description": r.Description,
+			"expiresAt":   formatExpiresAt(r.ExpiresAt),
 		}, nil
 	case "ssh":
 		r, err := s.store.GetSSHRule(ctx, name)
@@ -590,6 +657,8 @@ func (s *Server) getResource(ctx context.Context, stackID, resourceType, name st
 			"dst":         r.Destinations,
 			"users":       r.Users,
 			"checkPeriod": r.CheckPeriod,
+			"description": r.Description,
+			"expiresAt":   formatExpiresAt(r.ExpiresAt),
 		}, nil
 	case "grants":
 		r, err := s.store.GetGrant(ctx, name)
@@ -597,11 +666,13 @@ func (s *Server) getResource(ctx context.Context, stackID, resourceType, name st
 			return nil, err
 		}
 		return map[string]any{
-			"id":    r.ID,
-			"order": r.Order,
-			"src":   r.Sources,
-			"dst":   r.Destinations,
-			"ip":    r.IP,
+			"id":          r.ID,
+			"order":       r.Order,
+			"src":         r.Sources,
+			"dst":         r.Destinations,
+			"ip":          r.IP,
+			"description": r.Description,
+			"expiresAt":   formatExpiresAt(r.ExpiresAt),
 		}, nil
 	case "autoapprovers":
 		r, err := s.store.GetAutoApprover(ctx, name)
@@ -675,6 +746,15 @@ func validateResource(resourceType string, r *http.Request) error {
 				return fmt.Errorf("invalid member[%d] '%s': %w", i, member, err)
 			}
 		}
+		expiresAt, err := parseMemberExpiresAt(r.FormValue("memberExpiresAt"))
+		if err != nil {
+			return err
+		}
+		var errs validation.ValidationErrors
+		validation.ValidateMemberExpiresAt(&errs, "member expiry", members, expiresAt, time.Now())
+		if errs.HasErrors() {
+			return errs
+		}
 	case "tags":
 		tag := r.FormValue("tag")
 		if err := validation.ValidateTagName(tag); err != nil {
@@ -696,6 +776,9 @@ func validateResource(resourceType string, r *http.Request) error {
 			return fmt.Errorf("invalid address: %w", err)
 		}
 	case "acls":
+		if err := validation.ValidateACLAction(r.FormValue("action")); err != nil {
+			return err
+		}
 		sources := parseLines(r.FormValue("src"))
 		for i, src := range sources {
 			if err := validation.ValidateACLSource(src); err != nil {
@@ -708,7 +791,13 @@ func validateResource(resourceType string, r *http.Request) error {
 				return fmt.Errorf("invalid destination[%d] '%s': %w", i, dst, err)
 			}
 		}
+		if _, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), time.Now()); err != nil {
+			return err
+		}
 	case "ssh":
+		if err := validation.ValidateSSHAction(r.FormValue("action")); err != nil {
+			return err
+		}
 		sources := parseLines(r.FormValue("src"))
 		for i, src := range sources {
 			if err := validation.ValidateACLSource(src); err != nil {
@@ -727,6 +816,9 @@ func validateResource(resourceType string, r *http.Request) error {
 				return fmt.Errorf("invalid user[%d] '%s': %w", i, user, err)
 			}
 		}
+		if _, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), time.Now()); err != nil {
+			return err
+		}
 	case "grants":
 		sources := parseLines(r.FormValue("src"))
 		for i, src := range sources {
@@ -740,6 +832,9 @@ func validateResource(resourceType string, r *http.Request) error {
 				return fmt.Errorf("invalid destination[%d] '%s': %w", i, dst, err)
 			}
 		}
+		if _, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), time.Now()); err != nil {
+			return err
+		}
 	case "autoapprovers":
 		approverType := r.FormValue("type")
 		match := r.FormValue("match")
@@ -759,6 +854,10 @@ func validateResource(resourceType string, r *http.Request) error {
 				return fmt.Errorf("invalid target[%d] '%s': %w", i, target, err)
 			}
 		}
+	case "postures":
+		if err := validation.ValidatePostureName(r.FormValue("name")); err != nil {
+			return fmt.Errorf("invalid posture name: %w", err)
+		}
 	case "ipsets":
 		name := r.FormValue("name")
 		if err := validation.ValidateIPSetName(name); err != nil {
@@ -805,36 +904,66 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 
 	switch resourceType {
 	case "groups":
-		group := &domain.Group{
-			ID:        generateID(),
-			StackID:   stackID,
-			Name:      r.FormValue("name"),
-			Members:   parseLines(r.FormValue("members")),
-			CreatedAt: now,
-			UpdatedAt: now,
+		expiresAt, err := parseMemberExpiresAt(r.FormValue("memberExpiresAt"))
+		if err != nil {
+			return err
 		}
-		return s.store.CreateGroup(ctx, group)
+		group := &domain.Group{
+			ID:              generateID(),
+			StackID:         stackID,
+			Name:            r.FormValue("name"),
+			Members:         parseLines(r.FormValue("members")),
+			MemberExpiresAt: expiresAt,
+			Description:     r.FormValue("description"),
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, group.ID, nil, group, func(tx storage.Transaction) error {
+			if err := claims.Check(ctx, tx, stackID, domain.ClaimTypeGroup, group.Name); err != nil {
+				return err
+			}
+			if err := nesting.Check(ctx, tx, stackID, group.Name, group.Members); err != nil {
+				return err
+			}
+			return tx.CreateGroup(ctx, group)
+		})
 	case "tags":
 		tagOwner := &domain.TagOwner{
-			ID:        generateID(),
-			StackID:   stackID,
-			Tag:       r.FormValue("tag"),
-			Owners:    parseLines(r.FormValue("owners")),
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		return s.store.CreateTagOwner(ctx, tagOwner)
+			ID:          generateID(),
+			StackID:     stackID,
+			Tag:         r.FormValue("tag"),
+			Owners:      parseLines(r.FormValue("owners")),
+			Description: r.FormValue("description"),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, tagOwner.ID, nil, tagOwner, func(tx storage.Transaction) error {
+			if err := claims.Check(ctx, tx, stackID, domain.ClaimTypeTag, tagOwner.Tag); err != nil {
+				return err
+			}
+			return tx.CreateTagOwner(ctx, tagOwner)
+		})
 	case "hosts":
 		host := &domain.Host{
-			ID:        generateID(),
-			StackID:   stackID,
-			Name:      r.FormValue("name"),
-			Address:   r.FormValue("address"),
-			CreatedAt: now,
-			UpdatedAt: now,
-		}
-		return s.store.CreateHost(ctx, host)
+			ID:          generateID(),
+			StackID:     stackID,
+			Name:        r.FormValue("name"),
+			Address:     r.FormValue("address"),
+			Description: r.FormValue("description"),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, host.ID, nil, host, func(tx storage.Transaction) error {
+			if err := claims.Check(ctx, tx, stackID, domain.ClaimTypeHost, host.Name); err != nil {
+				return err
+			}
+			return tx.CreateHost(ctx, host)
+		})
 	case "acls":
+		expiresAt, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), now)
+		if err != nil {
+			return err
+		}
 		rule := &domain.ACLRule{
 			ID:           generateID(),
 			StackID:      stackID,
@@ -843,11 +972,19 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			Protocol:     r.FormValue("protocol"),
 			Sources:      parseLines(r.FormValue("src")),
 			Destinations: parseLines(r.FormValue("dst")),
+			Description:  r.FormValue("description"),
+			ExpiresAt:    expiresAt,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		}
-		return s.store.CreateACLRule(ctx, rule)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, rule.ID, nil, rule, func(tx storage.Transaction) error {
+			return tx.CreateACLRule(ctx, rule)
+		})
 	case "ssh":
+		expiresAt, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), now)
+		if err != nil {
+			return err
+		}
 		rule := &domain.SSHRule{
 			ID:           generateID(),
 			StackID:      stackID,
@@ -857,11 +994,19 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			Destinations: parseLines(r.FormValue("dst")),
 			Users:        parseLines(r.FormValue("users")),
 			CheckPeriod:  r.FormValue("checkPeriod"),
+			Description:  r.FormValue("description"),
+			ExpiresAt:    expiresAt,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		}
-		return s.store.CreateSSHRule(ctx, rule)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, rule.ID, nil, rule, func(tx storage.Transaction) error {
+			return tx.CreateSSHRule(ctx, rule)
+		})
 	case "grants":
+		expiresAt, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), now)
+		if err != nil {
+			return err
+		}
 		grant := &domain.Grant{
 			ID:           generateID(),
 			StackID:      stackID,
@@ -869,10 +1014,14 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			Sources:      parseLines(r.FormValue("src")),
 			Destinations: parseLines(r.FormValue("dst")),
 			IP:           parseLines(r.FormValue("ip")),
+			Description:  r.FormValue("description"),
+			ExpiresAt:    expiresAt,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		}
-		return s.store.CreateGrant(ctx, grant)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, grant.ID, nil, grant, func(tx storage.Transaction) error {
+			return tx.CreateGrant(ctx, grant)
+		})
 	case "autoapprovers":
 		aa := &domain.AutoApprover{
 			ID:        generateID(),
@@ -883,7 +1032,9 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
-		return s.store.CreateAutoApprover(ctx, aa)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, aa.ID, nil, aa, func(tx storage.Transaction) error {
+			return tx.CreateAutoApprover(ctx, aa)
+		})
 	case "nodeattrs":
 		attr := &domain.NodeAttr{
 			ID:        generateID(),
@@ -894,7 +1045,9 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
-		return s.store.CreateNodeAttr(ctx, attr)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, attr.ID, nil, attr, func(tx storage.Transaction) error {
+			return tx.CreateNodeAttr(ctx, attr)
+		})
 	case "postures":
 		posture := &domain.Posture{
 			ID:        generateID(),
@@ -904,7 +1057,9 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
-		return s.store.CreatePosture(ctx, posture)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, posture.ID, nil, posture, func(tx storage.Transaction) error {
+			return tx.CreatePosture(ctx, posture)
+		})
 	case "ipsets":
 		ipset := &domain.IPSet{
 			ID:        generateID(),
@@ -914,7 +1069,9 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
-		return s.store.CreateIPSet(ctx, ipset)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, ipset.ID, nil, ipset, func(tx storage.Transaction) error {
+			return tx.CreateIPSet(ctx, ipset)
+		})
 	case "tests":
 		test := &domain.ACLTest{
 			ID:        generateID(),
@@ -926,7 +1083,9 @@ func (s *Server) createResource(ctx context.Context, stackID, resourceType strin
 			CreatedAt: now,
 			UpdatedAt: now,
 		}
-		return s.store.CreateACLTest(ctx, test)
+		return s.applyChange(ctx, domain.AuditActionCreate, resourceType, stackID, test.ID, nil, test, func(tx storage.Transaction) error {
+			return tx.CreateACLTest(ctx, test)
+		})
 	}
 	return domain.ErrInvalidInput
 }
@@ -946,108 +1105,170 @@ func (s *Server) updateResource(ctx context.Context, stackID, resourceType, name
 		if err != nil {
 			return err
 		}
+		expiresAt, err := parseMemberExpiresAt(r.FormValue("memberExpiresAt"))
+		if err != nil {
+			return err
+		}
+		before := audit.Snapshot(group)
 		group.Members = parseLines(r.FormValue("members"))
+		group.MemberExpiresAt = expiresAt
+		group.Description = r.FormValue("description")
 		group.UpdatedAt = now
-		return s.store.UpdateGroup(ctx, group)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, group.ID, before, group, func(tx storage.Transaction) error {
+			if err := nesting.Check(ctx, tx, stackID, group.Name, group.Members); err != nil {
+				return err
+			}
+			return tx.UpdateGroup(ctx, group)
+		})
 	case "tags":
 		tagOwner, err := s.store.GetTagOwner(ctx, stackID, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(tagOwner)
 		tagOwner.Owners = parseLines(r.FormValue("owners"))
+		tagOwner.Description = r.FormValue("description")
 		tagOwner.UpdatedAt = now
-		return s.store.UpdateTagOwner(ctx, tagOwner)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, tagOwner.ID, before, tagOwner, func(tx storage.Transaction) error {
+			return tx.UpdateTagOwner(ctx, tagOwner)
+		})
 	case "hosts":
 		host, err := s.store.GetHost(ctx, stackID, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(host)
 		host.Address = r.FormValue("address")
+		host.Description = r.FormValue("description")
 		host.UpdatedAt = now
-		return s.store.UpdateHost(ctx, host)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, host.ID, before, host, func(tx storage.Transaction) error {
+			return tx.UpdateHost(ctx, host)
+		})
 	case "acls":
 		rule, err := s.store.GetACLRule(ctx, name)
 		if err != nil {
 			return err
 		}
+		expiresAt, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), now)
+		if err != nil {
+			return err
+		}
+		before := audit.Snapshot(rule)
 		rule.Order = parseInt(r.FormValue("order"), rule.Order)
 		rule.Action = r.FormValue("action")
 		rule.Protocol = r.FormValue("protocol")
 		rule.Sources = parseLines(r.FormValue("src"))
 		rule.Destinations = parseLines(r.FormValue("dst"))
+		rule.Description = r.FormValue("description")
+		rule.ExpiresAt = expiresAt
 		rule.UpdatedAt = now
-		return s.store.UpdateACLRule(ctx, rule)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, rule.ID, before, rule, func(tx storage.Transaction) error {
+			return tx.UpdateACLRule(ctx, rule)
+		})
 	case "ssh":
 		rule, err := s.store.GetSSHRule(ctx, name)
 		if err != nil {
 			return err
 		}
+		expiresAt, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), now)
+		if err != nil {
+			return err
+		}
+		before := audit.Snapshot(rule)
 		rule.Order = parseInt(r.FormValue("order"), rule.Order)
 		rule.Action = r.FormValue("action")
 		rule.Sources = parseLines(r.FormValue("src"))
 		rule.Destinations = parseLines(r.FormValue("dst"))
 		rule.Users = parseLines(r.FormValue("users"))
 		rule.CheckPeriod = r.FormValue("checkPeriod")
+		rule.Description = r.FormValue("description")
+		rule.ExpiresAt = expiresAt
 		rule.UpdatedAt = now
-		return s.store.UpdateSSHRule(ctx, rule)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, rule.ID, before, rule, func(tx storage.Transaction) error {
+			return tx.UpdateSSHRule(ctx, rule)
+		})
 	case "grants":
 		grant, err := s.store.GetGrant(ctx, name)
 		if err != nil {
 			return err
 		}
+		expiresAt, err := validation.ParseExpiresAt(r.FormValue("expiresAt"), now)
+		if err != nil {
+			return err
+		}
+		before := audit.Snapshot(grant)
 		grant.Order = parseInt(r.FormValue("order"), grant.Order)
 		grant.Sources = parseLines(r.FormValue("src"))
 		grant.Destinations = parseLines(r.FormValue("dst"))
 		grant.IP = parseLines(r.FormValue("ip"))
+		grant.Description = r.FormValue("description")
+		grant.ExpiresAt = expiresAt
 		grant.UpdatedAt = now
-		return s.store.UpdateGrant(ctx, grant)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, grant.ID, before, grant, func(tx storage.Transaction) error {
+			return tx.UpdateGrant(ctx, grant)
+		})
 	case "autoapprovers":
 		aa, err := s.store.GetAutoApprover(ctx, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(aa)
 		aa.Type = r.FormValue("type")
 		aa.Match = r.FormValue("match")
 		aa.Approvers = parseLines(r.FormValue("approvers"))
 		aa.UpdatedAt = now
-		return s.store.UpdateAutoApprover(ctx, aa)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, aa.ID, before, aa, func(tx storage.Transaction) error {
+			return tx.UpdateAutoApprover(ctx, aa)
+		})
 	case "nodeattrs":
 		attr, err := s.store.GetNodeAttr(ctx, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(attr)
 		attr.Order = parseInt(r.FormValue("order"), attr.Order)
 		attr.Target = parseLines(r.FormValue("target"))
 		attr.Attr = parseLines(r.FormValue("attr"))
 		attr.UpdatedAt = now
-		return s.store.UpdateNodeAttr(ctx, attr)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, attr.ID, before, attr, func(tx storage.Transaction) error {
+			return tx.UpdateNodeAttr(ctx, attr)
+		})
 	case "postures":
 		posture, err := s.store.GetPosture(ctx, stackID, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(posture)
 		posture.Rules = parseLines(r.FormValue("rules"))
 		posture.UpdatedAt = now
-		return s.store.UpdatePosture(ctx, posture)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, posture.ID, before, posture, func(tx storage.Transaction) error {
+			return tx.UpdatePosture(ctx, posture)
+		})
 	case "ipsets":
 		ipset, err := s.store.GetIPSet(ctx, stackID, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(ipset)
 		ipset.Addresses = parseLines(r.FormValue("addresses"))
 		ipset.UpdatedAt = now
-		return s.store.UpdateIPSet(ctx, ipset)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, ipset.ID, before, ipset, func(tx storage.Transaction) error {
+			return tx.UpdateIPSet(ctx, ipset)
+		})
 	case "tests":
 		test, err := s.store.GetACLTest(ctx, name)
 		if err != nil {
 			return err
 		}
+		before := audit.Snapshot(test)
 		test.Order = parseInt(r.FormValue("order"), test.Order)
 		test.Source = r.FormValue("src")
 		test.Accept = parseLines(r.FormValue("accept"))
 		test.Deny = parseLines(r.FormValue("deny"))
 		test.UpdatedAt = now
-		return s.store.UpdateACLTest(ctx, test)
+		return s.applyChange(ctx, domain.AuditActionUpdate, resourceType, stackID, test.ID, before, test, func(tx storage.Transaction) error {
+			return tx.UpdateACLTest(ctx, test)
+		})
 	}
 	return domain.ErrInvalidInput
 }
@@ -1056,31 +1277,130 @@ func (s *Server) updateResource(ctx context.Context, stackID, resourceType, name
 func (s *Server) deleteResource(ctx context.Context, stackID, resourceType, name string) error {
 	switch resourceType {
 	case "groups":
-		return s.store.DeleteGroup(ctx, stackID, name)
+		r, err := s.store.GetGroup(ctx, stackID, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteGroupByID(ctx, r.ID)
+		})
 	case "tags":
-		return s.store.DeleteTagOwner(ctx, stackID, name)
+		r, err := s.store.GetTagOwner(ctx, stackID, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteTagOwnerByID(ctx, r.ID)
+		})
 	case "hosts":
-		return s.store.DeleteHost(ctx, stackID, name)
+		r, err := s.store.GetHost(ctx, stackID, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteHostByID(ctx, r.ID)
+		})
 	case "acls":
-		return s.store.DeleteACLRule(ctx, name)
+		r, err := s.store.GetACLRule(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteACLRule(ctx, r.ID)
+		})
 	case "ssh":
-		return s.store.DeleteSSHRule(ctx, name)
+		r, err := s.store.GetSSHRule(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteSSHRule(ctx, r.ID)
+		})
 	case "grants":
-		return s.store.DeleteGrant(ctx, name)
+		r, err := s.store.GetGrant(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteGrant(ctx, r.ID)
+		})
 	case "autoapprovers":
-		return s.store.DeleteAutoApprover(ctx, name)
+		r, err := s.store.GetAutoApprover(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteAutoApprover(ctx, r.ID)
+		})
 	case "nodeattrs":
-		return s.store.DeleteNodeAttr(ctx, name)
+		r, err := s.store.GetNodeAttr(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteNodeAttr(ctx, r.ID)
+		})
 	case "postures":
-		return s.store.DeletePosture(ctx, stackID, name)
+		r, err := s.store.GetPosture(ctx, stackID, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeletePostureByID(ctx, r.ID)
+		})
 	case "ipsets":
-		return s.store.DeleteIPSet(ctx, stackID, name)
+		r, err := s.store.GetIPSet(ctx, stackID, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteIPSetByID(ctx, r.ID)
+		})
 	case "tests":
-		return s.store.DeleteACLTest(ctx, name)
+		r, err := s.store.GetACLTest(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.applyChange(ctx, domain.AuditActionDelete, resourceType, stackID, r.ID, r, nil, func(tx storage.Transaction) error {
+			return tx.DeleteACLTest(ctx, r.ID)
+		})
 	}
 	return domain.ErrInvalidInput
 }
 
+// applyChange runs fn in a transaction, bumps the stack generation, and
+// records the change in the audit log. Changes that violate guardrails are
+// refused. Changes to stacks that require approvals are staged as change
+// sets instead, and reported as a *domain.ChangeStagedError.
+func (s *Server) applyChange(ctx context.Context, action, resourceType, stackID, id string, before, after any, fn func(tx storage.Transaction) error) error {
+	stack, err := s.store.GetStack(ctx, stackID)
+	if err != nil {
+		return err
+	}
+	if stack.RequiresApproval() {
+		staged, err := changes.Stage(ctx, s.store, s.syncService.MergeStrategies(), stackID, nil, fn)
+		if err != nil {
+			return err
+		}
+		return &domain.ChangeStagedError{Change: staged}
+	}
+
+	change := audit.Change{
+		Action:       action,
+		ResourceType: auditResourceTypes[resourceType],
+		ResourceID:   id,
+		StackID:      stackID,
+		Before:       before,
+		After:        after,
+	}
+	return audit.Run(ctx, s.store, change, func(tx storage.Transaction) error {
+		if _, err := tx.IncrementStackGeneration(ctx, stackID, nil); err != nil {
+			return err
+		}
+		return guardrails.CheckWrite(ctx, tx, s.syncService.MergeStrategies(), fn)
+	})
+}
+
 // parseLines parses a multiline string into a slice.
 func parseLines(s string) []string {
 	if s == "" {
@@ -1096,3 +1416,53 @@ func parseLines(s string) []string {
 	}
 	return result
 }
+
+// parseMemberExpiresAt parses lines of a member followed by an RFC 3339 time.
+func parseMemberExpiresAt(s string) (map[string]time.Time, error) {
+	var expiresAt map[string]time.Time
+	for _, line := range parseLines(s) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid member expiry '%s': expected a member and a time", line)
+		}
+		t, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid member expiry '%s': time must be RFC 3339", line)
+		}
+		if expiresAt == nil {
+			expiresAt = make(map[string]time.Time)
+		}
+		expiresAt[fields[0]] = t
+	}
+	return expiresAt, nil
+}
+
+// formatMemberExpiresAt renders member expiry as lines for the group form.
+func formatMemberExpiresAt(expiresAt map[string]time.Time) []string {
+	lines := make([]string, 0, len(expiresAt))
+	for member, t := range expiresAt {
+		lines = append(lines, member+" "+t.UTC().Format(time.RFC3339))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// formatExpiresAt renders an optional expiry, or an empty string if unset.
+func formatExpiresAt(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+	return expiresAt.UTC().Format(time.RFC3339)
+}
+
+// listMembers returns the members of a group, annotated with their expiry.
+func listMembers(group *domain.Group) []string {
+	members := make([]string, len(group.Members))
+	for i, m := range group.Members {
+		members[i] = m
+		if t, ok := group.MemberExpiresAt[m]; ok {
+			members[i] = fmt.Sprintf("%s (until %s)", m, t.UTC().Format(time.RFC3339))
+		}
+	}
+	return members
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bcnelson/tailscale-acl-manager/internal/audit"
 	"github.com/bcnelson/tailscale-acl-manager/internal/domain"
 )
 
@@ -29,8 +30,27 @@ type Session struct {
 	IsOIDC      bool   // True if authenticated via OIDC
 }
 
+// AuditActor returns the actor recorded in the audit log for changes made in this session.
+func (s *Session) AuditActor() domain.AuditActor {
+	if s.IsOIDC {
+		name := s.OIDCEmail
+		if name == "" {
+			name = s.OIDCName
+		}
+		return domain.AuditActor{Type: domain.AuditActorOIDC, ID: s.OIDCSubject, Name: name}
+	}
+	return audit.ActorFromAPIKey(s.APIKey)
+}
+
+// getSession returns the session stored in the context by sessionAuth, or nil.
+func getSession(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey).(*Session)
+	return session
+}
+
 // sessionAuth is middleware that validates session cookies.
 // It checks OIDC session first (if enabled), then falls back to API key.
+// API key sessions require an unscoped key holding every role.
 func (s *Server) sessionAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -47,6 +67,7 @@ func (s *Server) sessionAuth(next http.Handler) http.Handler {
 					IsOIDC:      true,
 				}
 				ctx = context.WithValue(ctx, sessionContextKey, session)
+				ctx = audit.WithActor(ctx, session.AuditActor())
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
@@ -79,8 +100,9 @@ func (s *Server) sessionAuth(next http.Handler) http.Handler {
 		if keyCount == 0 && s.bootstrapKey != "" {
 			if subtle.ConstantTimeCompare([]byte(apiKey), []byte(s.bootstrapKey)) == 1 {
 				storedKey = &domain.APIKey{
-					ID:   "bootstrap",
-					Name: "Bootstrap Key",
+					ID:    "bootstrap",
+					Name:  "Bootstrap Key",
+					Roles: domain.AllRoles,
 				}
 			}
 		}
@@ -96,6 +118,14 @@ func (s *Server) sessionAuth(next http.Handler) http.Handler {
 				return
 			}
 
+			// The web UI does not check roles or stack scopes, so only
+			// admin keys may use it
+			if !storedKey.IsAdmin() {
+				clearSessionCookie(w)
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+
 			// Update last used timestamp (fire and forget)
 			go func() {
 				_ = s.store.UpdateAPIKeyLastUsed(context.Background(), storedKey.ID)
@@ -105,6 +135,7 @@ func (s *Server) sessionAuth(next http.Handler) http.Handler {
 		// Store session in context
 		session := &Session{APIKey: storedKey}
 		ctx = context.WithValue(ctx, sessionContextKey, session)
+		ctx = audit.WithActor(ctx, session.AuditActor())
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -2,6 +2,7 @@ package web
 
 import (
 	"embed"
+	"encoding/json"
 	"html/template"
 	"io/fs"
 	"net/http"
@@ -89,7 +90,10 @@ func NewRouter(store storage.Storage, syncService *service.SyncService, bootstra
 		r.Post("/stacks", s.handleStackCreate)
 		r.Get("/stacks/{id}", s.handleStackDetail)
 		r.Get("/stacks/{id}/edit", s.handleStackEditForm)
+		r.Get("/stacks/{id}/state", s.handleStackStateDownload)
 		r.Put("/stacks/{id}", s.handleStackUpdate)
+		r.Post("/stacks/{id}/enable", s.handleStackEnable)
+		r.Post("/stacks/{id}/disable", s.handleStackDisable)
 		r.Delete("/stacks/{id}", s.handleStackDelete)
 
 		// Resource routes (generic for all types)
@@ -104,9 +108,31 @@ func NewRouter(store storage.Storage, syncService *service.SyncService, bootstra
 		r.Get("/policy", s.handlePolicyPage)
 		r.Get("/policy/preview", s.handlePolicyPreview)
 		r.Get("/policy/versions", s.handlePolicyVersions)
+		r.Get("/policy/diff", s.handlePolicyDiffPage)
+		r.Get("/policy/diff/live", s.handlePolicyDiffLivePage)
+		r.Get("/policy/query", s.handlePolicyQueryPage)
+		r.Get("/policy/drift", s.handleDriftDiffPage)
+		r.Post("/policy/drift/check", s.handleDriftCheck)
 		r.Post("/policy/sync", s.handlePolicySync)
 		r.Post("/policy/rollback/{id}", s.handlePolicyRollback)
 
+		// Change sets
+		r.Get("/changes", s.handleChangesPage)
+		r.Get("/changes/{id}", s.handleChangeDetail)
+		r.Post("/changes/{id}/approve", s.handleChangeApprove)
+		r.Post("/changes/{id}/reject", s.handleChangeReject)
+
+		// Audit log
+		r.Get("/audit", s.handleAuditPage)
+
+		// Access requests
+		r.Get("/access", s.handleAccessPage)
+		r.Post("/access/requests", s.handleAccessRequestCreate)
+		r.Post("/access/requests/{id}/approve", s.handleAccessRequestApprove)
+		r.Post("/access/requests/{id}/deny", s.handleAccessRequestDeny)
+		r.Post("/access/approvers", s.handleAccessApproverCreate)
+		r.Delete("/access/approvers/{id}", s.handleAccessApproverDelete)
+
 		// Settings
 		r.Get("/settings", s.handleSettingsPage)
 		r.Post("/settings/keys", s.handleAPIKeyCreate)
@@ -128,6 +154,7 @@ func (s *Server) parseTemplates() map[string]*template.Template {
 		"safeHTML":     safeHTML,
 		"safeHTMLAttr": safeHTMLAttr,
 		"json":         jsonMarshal,
+		"toJSON":       toJSON,
 	}
 
 	templates := make(map[string]*template.Template)
@@ -137,9 +164,11 @@ func (s *Server) parseTemplates() map[string]*template.Template {
 	navContent, _ := content.ReadFile("templates/components/nav.html")
 	flashContent, _ := content.ReadFile("templates/components/flash.html")
 	modalContent, _ := content.ReadFile("templates/components/modal.html")
+	diffContent, _ := content.ReadFile("templates/components/diff.html")
+	changeContent, _ := content.ReadFile("templates/components/change.html")
 
 	// Combine base with components
-	baseWithComponents := string(baseContent) + string(navContent) + string(flashContent) + string(modalContent)
+	baseWithComponents := string(baseContent) + string(navContent) + string(flashContent) + string(modalContent) + string(diffContent) + string(changeContent)
 
 	// Parse each page template separately with the base
 	pageFiles, _ := fs.Glob(content, "templates/pages/*.html")
@@ -206,6 +235,15 @@ func jsonMarshal(v any) string {
 	}
 }
 
+// toJSON encodes a value as compact JSON for display in templates.
+func toJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
 // PageData holds common data passed to all page templates.
 type PageData struct {
 	Title   string